@@ -2,11 +2,13 @@ package main
 
 import (
 	"fmt"
+	"log"
 
 	_ "github.com/golang-migrate/migrate/v4/source/file"
 	_ "github.com/jackc/pgx/v5/stdlib"
 	"github.com/size12/url-shortener/internal/app"
 	"github.com/size12/url-shortener/internal/config"
+	"github.com/size12/url-shortener/internal/logger"
 )
 
 // Run example:  go run -ldflags "-X main.buildVersion=0.19 -X main.buildDate=12.03.23 -X main.buildCommit=iter19" cmd/shortener/main.go.
@@ -19,6 +21,11 @@ func main() {
 	printBuildInfo()
 	cfg := config.GetConfig()
 
+	if err := logger.Initialize(cfg.LogLevel); err != nil {
+		log.Fatalln("Failed initialize logger:", err)
+	}
+	defer logger.Log.Sync()
+
 	service := app.App{Cfg: cfg}
 	service.Run()
 }
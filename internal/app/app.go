@@ -3,8 +3,6 @@ package app
 
 import (
 	"context"
-	"fmt"
-	"log"
 	"net"
 	"net/http"
 	"net/url"
@@ -14,12 +12,22 @@ import (
 	"time"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/size12/url-shortener/internal/certs"
 	"github.com/size12/url-shortener/internal/config"
 	"github.com/size12/url-shortener/internal/handlers"
+	"github.com/size12/url-shortener/internal/logger"
+	"github.com/size12/url-shortener/internal/metrics"
+	"github.com/size12/url-shortener/internal/policy"
 	"github.com/size12/url-shortener/internal/storage"
+	"github.com/size12/url-shortener/internal/threat"
+	"github.com/size12/url-shortener/internal/tracing"
+	"github.com/size12/url-shortener/internal/webui"
 	pb "github.com/size12/url-shortener/pkg/grpc"
+	"go.uber.org/zap"
 	"golang.org/x/crypto/acme/autocert"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 )
 
 // App is struct of service.
@@ -29,92 +37,308 @@ type App struct {
 
 // Run starts service.
 func (app App) Run() {
+	shutdownTracing, err := tracing.Init(app.Cfg)
+	if err != nil {
+		logger.Log.Fatal("Failed init tracing", zap.Error(err))
+	}
+
 	r := chi.NewRouter()
 	s, err := storage.NewStorage(app.Cfg)
 
 	if err != nil {
-		log.Fatal(err)
+		logger.Log.Fatal("Failed create storage", zap.Error(err))
+	}
+
+	health := handlers.NewHealth()
+	health.AddCheck("storage", s.Ping)
+	if migrations, ok := s.(storage.MigrationChecker); ok {
+		health.AddCheck("migrations", migrations.CheckMigrations)
+	}
+
+	// metrics wrapper hides optional interfaces of storage.
+	utmPresets, err := storage.NewUTMPresetStorage(s)
+	if err != nil {
+		logger.Log.Fatal("Failed create UTM presets storage", zap.Error(err))
+	}
+	takedowns, err := storage.NewTakedownStorage(s)
+	if err != nil {
+		logger.Log.Fatal("Failed create takedowns storage", zap.Error(err))
+	}
+	reports, err := storage.NewReportStorage(s)
+	if err != nil {
+		logger.Log.Fatal("Failed create reports storage", zap.Error(err))
+	}
+	clicks, err := storage.NewClickStorage(s)
+	if err != nil {
+		logger.Log.Fatal("Failed create clicks storage", zap.Error(err))
+	}
+	idempotency, err := storage.NewIdempotencyStorage(s)
+	if err != nil {
+		logger.Log.Fatal("Failed create idempotency storage", zap.Error(err))
+	}
+	jobs, err := storage.NewJobStorage(s)
+	if err != nil {
+		logger.Log.Fatal("Failed create jobs storage", zap.Error(err))
+	}
+	webhooks, err := storage.NewWebhookStorage(s)
+	if err != nil {
+		logger.Log.Fatal("Failed create webhooks storage", zap.Error(err))
 	}
 
+	m := metrics.New()
+	s = m.WrapStorage(s)
+	m.RegisterStatistic(s)
+
 	baseURL, err := url.Parse(app.Cfg.BaseURL)
 	if err != nil {
-		log.Fatalln(err)
+		logger.Log.Fatal("Failed parse base URL", zap.Error(err))
 	}
 
 	manager := &autocert.Manager{
-		Cache:      autocert.DirCache("cache-dir"),
+		Cache:      autocert.DirCache(app.Cfg.ACMECacheDir),
 		Prompt:     autocert.AcceptTOS,
 		HostPolicy: autocert.HostWhitelist(baseURL.Host),
 	}
 
-	service := handlers.NewService(app.Cfg, s)
+	tlsConfig, err := certs.NewHTTPConfig(app.Cfg, manager)
+	if err != nil {
+		logger.Log.Fatal("Failed create TLS config", zap.Error(err))
+	}
+
+	grpcTLSConfig, err := certs.NewGRPCConfig(app.Cfg)
+	if err != nil {
+		logger.Log.Fatal("Failed create gRPC TLS config", zap.Error(err))
+	}
+
+	var domains *policy.DomainList
+	if app.Cfg.DomainListFile != "" {
+		domains, err = policy.NewDomainList(app.Cfg.DomainListFile)
+		if err != nil {
+			logger.Log.Fatal("Failed load domains list", zap.Error(err))
+		}
+	}
+
+	errorPages, err := handlers.NewErrorPages(app.Cfg.ErrorPagesDir)
+	if err != nil {
+		logger.Log.Fatal("Failed load error pages", zap.Error(err))
+	}
+
+	opts := []handlers.ServiceOption{
+		handlers.WithUTMPresets(utmPresets),
+		handlers.WithPolicy(policy.New(app.Cfg, domains)),
+		handlers.WithTakedowns(takedowns),
+		handlers.WithReports(reports),
+		handlers.WithClicks(clicks),
+		handlers.WithIdempotency(idempotency),
+		handlers.WithJobs(jobs),
+		handlers.WithWebhooks(webhooks),
+		handlers.WithErrorPages(errorPages),
+	}
+
+	if app.Cfg.ThreatFeedFile != "" {
+		checker, err := threat.NewFeedChecker(app.Cfg.ThreatFeedFile, app.Cfg.ThreatFeedReloadInterval.Duration)
+		if err != nil {
+			logger.Log.Fatal("Failed load threat feed", zap.Error(err))
+		}
+		opts = append(opts, handlers.WithURLChecker(checker))
+	}
+
+	service := handlers.NewService(app.Cfg, s, opts...)
+	health.AddCheck("job queue", service.CheckJobBacklog)
+	health.AddCheck("webhook queue", service.CheckWebhookBacklog)
+	limiter := handlers.NewRateLimiter(app.Cfg)
 
 	server := &http.Server{
-		Addr:      app.Cfg.ServerAddress,
-		Handler:   r,
-		TLSConfig: manager.TLSConfig(),
+		Addr:              app.Cfg.ServerAddress,
+		Handler:           r,
+		TLSConfig:         tlsConfig,
+		ReadHeaderTimeout: app.Cfg.ReadHeaderTimeout.Duration,
+		ReadTimeout:       app.Cfg.ReadTimeout.Duration,
+		WriteTimeout:      app.Cfg.WriteTimeout.Duration,
+		IdleTimeout:       app.Cfg.IdleTimeout.Duration,
 	}
 
+	// plain HTTP listener serves ACME HTTP-01 challenges and redirects everything else to HTTPS.
+	var redirectServer *http.Server
+	if app.Cfg.EnableHTTPS && app.Cfg.HTTPRedirectAddress != "" {
+		redirectServer = &http.Server{
+			Addr:              app.Cfg.HTTPRedirectAddress,
+			Handler:           manager.HTTPHandler(handlers.HTTPSRedirectHandler(app.Cfg)),
+			ReadHeaderTimeout: app.Cfg.ReadHeaderTimeout.Duration,
+			ReadTimeout:       app.Cfg.ReadTimeout.Duration,
+			WriteTimeout:      app.Cfg.WriteTimeout.Duration,
+			IdleTimeout:       app.Cfg.IdleTimeout.Duration,
+		}
+	}
+
+	r.Use(tracing.Middleware)
+	r.Use(handlers.RequestLogger)
+	r.Use(m.Middleware)
 	r.Use(handlers.CookieMiddleware)
 	r.Use(handlers.GzipHandle)
-	r.Use(handlers.GzipRequest)
+	r.Use(handlers.NewBodyLimiter(app.Cfg))
+	r.Use(handlers.NewGzipRequest(app.Cfg))
 
 	r.MethodNotAllowed(handlers.URLErrorHandler)
 	r.Get("/ping", handlers.PingHandler(service))
-	r.Get("/{id}", handlers.URLGetHandler(service))
+	r.Get("/healthz", handlers.LivenessHandler)
+	r.Get("/readyz", handlers.ReadinessHandler(health))
+	r.With(limiter.Limit(handlers.RouteRedirect)).Get("/{id}", handlers.URLGetHandler(service))
+	r.With(limiter.Limit(handlers.RouteRedirect)).Get("/{id}+", handlers.PreviewHandler(service))
+	r.With(limiter.Limit(handlers.RouteRedirect)).Head("/{id}", handlers.URLGetHandler(service))
+	r.With(limiter.Limit(handlers.RouteRedirect)).Get("/{id}/*", handlers.URLGetHandler(service))
+	r.With(limiter.Limit(handlers.RouteRedirect)).Head("/{id}/*", handlers.URLGetHandler(service))
+	// report and QR code routes take precedence over path forwarding of /{id}/*.
+	r.With(limiter.Limit(handlers.RouteRedirect)).Get("/{id}/report", handlers.ReportFormHandler)
+	r.With(limiter.Limit(handlers.RouteRedirect)).Get("/{id}/qr", handlers.QRCodeHandler(service))
+	r.With(limiter.Limit(handlers.RouteCreate)).Post("/{id}/report", handlers.ReportHandler(service))
+	// web interface takes precedence over short link with the same ID.
+	r.Method(http.MethodGet, "/ui", http.RedirectHandler("/ui/", http.StatusMovedPermanently))
+	r.Method(http.MethodGet, "/ui/*", webui.Handler("/ui"))
 	r.Get("/api/user/urls", handlers.URLHistoryHandler(service))
-	r.Delete("/api/user/urls", handlers.DeleteHandler(service))
-	r.Post("/", handlers.URLPostHandler(service))
-	r.Post("/api/shorten/batch", handlers.URLBatchHandler(service))
-	r.Post("/api/shorten", handlers.URLPostHandler(service))
+	r.Get("/api/user/urls/{id}/stats", handlers.LinkStatsHandler(service))
+	r.With(limiter.Limit(handlers.RouteDelete)).Delete("/api/user/urls", handlers.DeleteHandler(service))
+	r.Get("/api/user/utm-presets", handlers.UTMPresetsHandler(service))
+	r.Put("/api/user/utm-presets/{name}", handlers.SetUTMPresetHandler(service))
+	r.Delete("/api/user/utm-presets/{name}", handlers.DeleteUTMPresetHandler(service))
+	r.Get("/api/user/webhooks", handlers.WebhooksHandler(service))
+	r.With(limiter.Limit(handlers.RouteCreate)).Post("/api/user/webhooks", handlers.CreateWebhookHandler(service))
+	r.Delete("/api/user/webhooks/{id}", handlers.DeleteWebhookHandler(service))
+	r.Get("/api/user/webhooks/deliveries", handlers.DeliveriesHandler(service))
+	r.With(limiter.Limit(handlers.RouteCreate)).Post("/api/user/webhooks/deliveries/{id}/replay", handlers.ReplayDeliveryHandler(service))
+
+	r.Group(func(r chi.Router) {
+		// replayed responses aren't limited, because they don't create links.
+		r.Use(handlers.IdempotencyMiddleware(service))
+		r.Use(limiter.Limit(handlers.RouteCreate))
+		r.Post("/", handlers.URLPostHandler(service))
+		r.Post("/api/shorten/batch", handlers.URLBatchHandler(service))
+		r.Post("/api/shorten", handlers.URLPostHandler(service))
+		r.Post(handlers.JobsPath, handlers.CreateJobHandler(service))
+	})
+	r.Get(handlers.JobsPath+"/{id}", handlers.JobHandler(service))
+	r.Get(handlers.JobsPath+"/{id}/results", handlers.JobResultsHandler(service))
+
+	r.Route(handlers.APIv2Prefix, handlers.APIv2Routes(service, limiter))
 
 	r.Group(func(r chi.Router) {
 		r.Use(handlers.NewIPPermissionsChecker(app.Cfg))
 		r.Get("/api/internal/stats", handlers.StatisticHandler(service))
+		r.Method(http.MethodGet, "/metrics", m.Handler())
+	})
+
+	r.Group(func(r chi.Router) {
+		r.Use(handlers.NewAdminChecker(app.Cfg))
+		r.Get("/api/admin/takedowns", handlers.TakedownsHandler(service))
+		r.Post("/api/admin/takedowns", handlers.TakedownHandler(service))
+		r.Delete("/api/admin/takedowns", handlers.RestoreHandler(service))
+		r.Get("/api/admin/takedowns/audit", handlers.TakedownAuditHandler(service))
+		r.Get("/api/admin/reports", handlers.ModerationQueueHandler(service))
+		r.Post("/api/admin/reports/{id}/dismiss", handlers.DismissReportsHandler(service))
+		r.Post("/api/admin/reports/{id}/takedown", handlers.TakedownReportedHandler(service))
 	})
 
+	// jobs are stopped after servers, their unfinished chunks are continued on next start.
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	jobsStopped := make(chan struct{})
+	go func() {
+		defer close(jobsStopped)
+		if err := service.RunJobs(jobsCtx); err != nil {
+			logger.Log.Fatal("Failed run jobs", zap.Error(err))
+		}
+	}()
+
+	// webhooks are stopped after jobs, so events of their links are queued. Pending deliveries are sent on next start.
+	webhooksCtx, stopWebhooks := context.WithCancel(context.Background())
+	webhooksStopped := make(chan struct{})
+	go func() {
+		defer close(webhooksStopped)
+		service.RunWebhooks(webhooksCtx)
+	}()
+
 	idleConnsClosed := make(chan struct{})
 	sigint := make(chan os.Signal, 1)
 	signal.Notify(sigint, syscall.SIGTERM, syscall.SIGINT, syscall.SIGQUIT)
 
 	listen, err := net.Listen("tcp", app.Cfg.GrpcPort)
 	if err != nil {
-		log.Fatal(err)
+		logger.Log.Fatal("Failed listen gRPC port", zap.Error(err))
 	}
-	// создаём gRPC-сервер без зарегистрированной службы
-	sgrpc := grpc.NewServer()
-	// регистрируем сервис
+
+	grpcOptions := []grpc.ServerOption{grpc.ChainUnaryInterceptor(
+		tracing.UnaryInterceptor,
+		handlers.LoggingInterceptor,
+		m.UnaryInterceptor,
+		service.IdempotencyInterceptor,
+		limiter.UnaryInterceptor,
+	)}
+	if app.Cfg.MaxBodySize > 0 {
+		grpcOptions = append(grpcOptions, grpc.MaxRecvMsgSize(int(app.Cfg.MaxBodySize)))
+	}
+	if grpcTLSConfig != nil {
+		grpcOptions = append(grpcOptions, grpc.Creds(credentials.NewTLS(grpcTLSConfig)))
+	}
+	sgrpc := grpc.NewServer(grpcOptions...)
 	pb.RegisterShortenerServer(sgrpc, handlers.NewShortenerServer(app.Cfg, service))
+	healthpb.RegisterHealthServer(sgrpc, health)
 
 	go func() {
-		fmt.Println("Сервер gRPC начал работу")
-		// получаем запрос gRPC
+		logger.Log.Info("gRPC server started", zap.String("address", app.Cfg.GrpcPort))
 		if err := sgrpc.Serve(listen); err != nil {
-			log.Fatal(err)
+			logger.Log.Fatal("gRPC server Serve error", zap.Error(err))
 		}
 	}()
 
 	go func() {
 		<-sigint
+
+		// report "not ready", so load balancers stop sending new requests before server stops.
+		health.Shutdown()
+		logger.Log.Info("Draining traffic before shutdown", zap.Duration("delay", app.Cfg.ShutdownDrainDelay.Duration))
+		time.Sleep(app.Cfg.ShutdownDrainDelay.Duration)
+
 		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 		defer cancel()
 		if err := server.Shutdown(ctx); err != nil {
-			log.Println("Failed shutdown server:", err)
+			logger.Log.Error("Failed shutdown server", zap.Error(err))
+		}
+		if redirectServer != nil {
+			if err := redirectServer.Shutdown(ctx); err != nil {
+				logger.Log.Error("Failed shutdown redirect server", zap.Error(err))
+			}
 		}
 		sgrpc.GracefulStop()
+		stopJobs()
+		<-jobsStopped
+		stopWebhooks()
+		<-webhooksStopped
+		if err := shutdownTracing(ctx); err != nil {
+			logger.Log.Error("Failed flush spans", zap.Error(err))
+		}
 		close(idleConnsClosed)
 	}()
 
-	if app.Cfg.EnableHTTPS {
-		if err := server.ListenAndServeTLS("", ""); err != http.ErrServerClosed {
-			log.Fatalf("HTTP server ListenAndServeTLS error: %v", err)
+	if !app.Cfg.EnableHTTPS {
+		logger.Log.Info("HTTP server started", zap.String("address", app.Cfg.ServerAddress))
+		if err := server.ListenAndServe(); err != http.ErrServerClosed {
+			logger.Log.Fatal("HTTP server ListenAndServe error", zap.Error(err))
+		}
+	} else {
+		if redirectServer != nil {
+			go func() {
+				logger.Log.Info("HTTP redirect server started", zap.String("address", app.Cfg.HTTPRedirectAddress))
+				if err := redirectServer.ListenAndServe(); err != http.ErrServerClosed {
+					logger.Log.Fatal("HTTP redirect server ListenAndServe error", zap.Error(err))
+				}
+			}()
 		}
-	}
 
-	if err := server.ListenAndServe(); err != http.ErrServerClosed {
-		log.Fatalf("HTTP server ListenAndServe error: %v", err)
+		logger.Log.Info("HTTPS server started", zap.String("address", app.Cfg.ServerAddress))
+		if err := server.ListenAndServeTLS("", ""); err != http.ErrServerClosed {
+			logger.Log.Fatal("HTTP server ListenAndServeTLS error", zap.Error(err))
+		}
 	}
 
 	<-idleConnsClosed
-	log.Println("Shutdown server gracefully.")
+	logger.Log.Info("Shutdown server gracefully")
 }
@@ -0,0 +1,193 @@
+// Package certs loads TLS certificates from files and reloads them, when files change.
+package certs
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/size12/url-shortener/internal/config"
+	"github.com/size12/url-shortener/internal/logger"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// Errors of TLS config.
+var (
+	ErrNoKeyPair  = errors.New("both certificate and key files must be set")
+	ErrNoCACerts  = errors.New("no certificates in CA bundle")
+	ErrNoGRPCCert = errors.New("gRPC TLS requires certificate and key files")
+	ErrNoGRPCTLS  = errors.New("gRPC client CA requires gRPC TLS")
+)
+
+// checkInterval is how often certificate files are checked for changes.
+const checkInterval = 5 * time.Second
+
+// Reloader serves certificate from files and reloads it, when files are modified.
+type Reloader struct {
+	*sync.Mutex
+	certFile string
+	keyFile  string
+	cert     *tls.Certificate
+	modTime  time.Time
+	checked  time.Time
+	interval time.Duration
+	now      func() time.Time
+}
+
+// NewReloader loads certificate from files.
+func NewReloader(certFile, keyFile string) (*Reloader, error) {
+	r := &Reloader{
+		Mutex:    &sync.Mutex{},
+		certFile: certFile,
+		keyFile:  keyFile,
+		interval: checkInterval,
+		now:      time.Now,
+	}
+
+	modTime, err := r.lastModified()
+	if err != nil {
+		return nil, err
+	}
+
+	err = r.load(modTime)
+	if err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// lastModified returns latest modification time of certificate and key files.
+func (r *Reloader) lastModified() (time.Time, error) {
+	var modTime time.Time
+	for _, file := range []string{r.certFile, r.keyFile} {
+		info, err := os.Stat(file)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(modTime) {
+			modTime = info.ModTime()
+		}
+	}
+	return modTime, nil
+}
+
+// load loads certificate from files.
+func (r *Reloader) load(modTime time.Time) error {
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("failed load certificate: %w", err)
+	}
+
+	r.cert = &cert
+	r.modTime = modTime
+	r.checked = r.now()
+	return nil
+}
+
+// GetCertificate returns current certificate. Use it as tls.Config.GetCertificate.
+// If files were modified, certificate is reloaded. If new files are invalid, old certificate is served.
+func (r *Reloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.Lock()
+	defer r.Unlock()
+
+	if r.now().Sub(r.checked) < r.interval {
+		return r.cert, nil
+	}
+	r.checked = r.now()
+
+	modTime, err := r.lastModified()
+	if err != nil {
+		logger.Log.Error("Failed check certificate files", zap.Error(err))
+		return r.cert, nil
+	}
+
+	if modTime.Equal(r.modTime) {
+		return r.cert, nil
+	}
+
+	err = r.load(modTime)
+	if err != nil {
+		logger.Log.Error("Failed reload certificate", zap.Error(err))
+		return r.cert, nil
+	}
+
+	logger.Log.Info("Certificate reloaded", zap.String("cert_file", r.certFile))
+	return r.cert, nil
+}
+
+// LoadCertPool loads CA certificates from PEM bundle.
+func LoadCertPool(file string) (*x509.CertPool, error) {
+	bundle, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(bundle) {
+		return nil, ErrNoCACerts
+	}
+	return pool, nil
+}
+
+// newFileConfig creates TLS config with certificate from files.
+func newFileConfig(cfg config.Config) (*tls.Config, error) {
+	if cfg.TLSCertFile == "" || cfg.TLSKeyFile == "" {
+		return nil, ErrNoKeyPair
+	}
+
+	reloader, err := NewReloader(cfg.TLSCertFile, cfg.TLSKeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tls.Config{
+		GetCertificate: reloader.GetCertificate,
+		MinVersion:     tls.VersionTLS12,
+	}, nil
+}
+
+// NewHTTPConfig creates TLS config of HTTP server.
+// Certificate is loaded from files, if they are set, or else obtained from Let's Encrypt by manager.
+func NewHTTPConfig(cfg config.Config, manager *autocert.Manager) (*tls.Config, error) {
+	if cfg.TLSCertFile == "" && cfg.TLSKeyFile == "" {
+		return manager.TLSConfig(), nil
+	}
+	return newFileConfig(cfg)
+}
+
+// NewGRPCConfig creates TLS config of gRPC server with certificate from files.
+// If client CA bundle is set, clients must present certificate signed by it (mTLS).
+func NewGRPCConfig(cfg config.Config) (*tls.Config, error) {
+	if !cfg.GrpcTLS {
+		if cfg.GrpcClientCAFile != "" {
+			return nil, ErrNoGRPCTLS
+		}
+		return nil, nil
+	}
+
+	if cfg.TLSCertFile == "" && cfg.TLSKeyFile == "" {
+		return nil, ErrNoGRPCCert
+	}
+
+	tlsConfig, err := newFileConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.GrpcClientCAFile != "" {
+		pool, err := LoadCertPool(cfg.GrpcClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return tlsConfig, nil
+}
@@ -0,0 +1,139 @@
+package certs
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/size12/url-shortener/internal/config"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// writeCert writes self-signed certificate with common name and its key to dir.
+func writeCert(t *testing.T, dir, commonName string) (certFile, keyFile string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.NoError(t, err)
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	assert.NoError(t, err)
+
+	certFile = filepath.Join(dir, "cert.pem")
+	keyFile = filepath.Join(dir, "key.pem")
+	assert.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	assert.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+
+	return certFile, keyFile
+}
+
+// commonName returns common name of served certificate.
+func commonName(t *testing.T, r *Reloader) string {
+	cert, err := r.GetCertificate(nil)
+	assert.NoError(t, err)
+
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	assert.NoError(t, err)
+	return leaf.Subject.CommonName
+}
+
+func TestReloader(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeCert(t, dir, "old")
+
+	r, err := NewReloader(certFile, keyFile)
+	assert.NoError(t, err)
+	r.interval = 0
+	assert.Equal(t, "old", commonName(t, r))
+
+	// certificate is reloaded, when files are modified.
+	writeCert(t, dir, "new")
+	modTime := time.Now().Add(time.Minute)
+	assert.NoError(t, os.Chtimes(certFile, modTime, modTime))
+	assert.Equal(t, "new", commonName(t, r))
+
+	// invalid files don't replace served certificate.
+	assert.NoError(t, os.WriteFile(keyFile, []byte("broken"), 0600))
+	modTime = modTime.Add(time.Minute)
+	assert.NoError(t, os.Chtimes(keyFile, modTime, modTime))
+	assert.Equal(t, "new", commonName(t, r))
+
+	_, err = NewReloader(filepath.Join(dir, "missing.pem"), keyFile)
+	assert.Error(t, err)
+}
+
+func TestNewHTTPConfig(t *testing.T) {
+	cfg := config.GetTestConfig()
+	manager := &autocert.Manager{}
+
+	// certificate from Let's Encrypt.
+	tlsConfig, err := NewHTTPConfig(cfg, manager)
+	assert.NoError(t, err)
+	assert.Contains(t, tlsConfig.NextProtos, "acme-tls/1")
+
+	// certificate from files.
+	cfg.TLSCertFile, cfg.TLSKeyFile = writeCert(t, t.TempDir(), "shortener")
+	tlsConfig, err = NewHTTPConfig(cfg, manager)
+	assert.NoError(t, err)
+	assert.NotNil(t, tlsConfig.GetCertificate)
+
+	cfg.TLSKeyFile = ""
+	_, err = NewHTTPConfig(cfg, manager)
+	assert.ErrorIs(t, err, ErrNoKeyPair)
+}
+
+func TestNewGRPCConfig(t *testing.T) {
+	cfg := config.GetTestConfig()
+
+	// TLS is disabled.
+	tlsConfig, err := NewGRPCConfig(cfg)
+	assert.NoError(t, err)
+	assert.Nil(t, tlsConfig)
+
+	cfg.GrpcClientCAFile = "ca.pem"
+	_, err = NewGRPCConfig(cfg)
+	assert.ErrorIs(t, err, ErrNoGRPCTLS)
+
+	cfg.GrpcTLS = true
+	cfg.GrpcClientCAFile = ""
+	_, err = NewGRPCConfig(cfg)
+	assert.ErrorIs(t, err, ErrNoGRPCCert)
+
+	// TLS without client certificates.
+	cfg.TLSCertFile, cfg.TLSKeyFile = writeCert(t, t.TempDir(), "shortener")
+	tlsConfig, err = NewGRPCConfig(cfg)
+	assert.NoError(t, err)
+	assert.Equal(t, tls.NoClientCert, tlsConfig.ClientAuth)
+
+	// mTLS.
+	cfg.GrpcClientCAFile, _ = writeCert(t, t.TempDir(), "clients CA")
+	tlsConfig, err = NewGRPCConfig(cfg)
+	assert.NoError(t, err)
+	assert.Equal(t, tls.RequireAndVerifyClientCert, tlsConfig.ClientAuth)
+	assert.NotNil(t, tlsConfig.ClientCAs)
+
+	// CA bundle without certificates.
+	cfg.GrpcClientCAFile = cfg.TLSKeyFile
+	_, err = NewGRPCConfig(cfg)
+	assert.ErrorIs(t, err, ErrNoCACerts)
+}
@@ -7,7 +7,9 @@ import (
 	"log"
 	"os"
 	"reflect"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/caarlos0/env/v6"
 )
@@ -22,6 +24,108 @@ type Config struct {
 	TrustedSubnet   string `env:"TRUSTED_SUBNET" json:"trusted_subnet"`
 	GrpcPort        string `env:"GRPC_RUN_PORT" json:"grpc_port"`
 	DBMigrationPath string
+	LogLevel        string `env:"LOG_LEVEL" json:"log_level,omitempty"`
+
+	// AdminAPIKey allows admin requests from outside of trusted subnet. Empty key disables it.
+	AdminAPIKey string `env:"ADMIN_API_KEY" json:"admin_api_key,omitempty"`
+
+	// TracingExporter is where spans are sent: "otlp", "stdout" or "none".
+	TracingExporter string `env:"TRACING_EXPORTER" json:"tracing_exporter,omitempty"`
+	OTLPEndpoint    string `env:"OTLP_ENDPOINT" json:"otlp_endpoint,omitempty"`
+
+	// Rate limits in requests per second for every user and every IP. Zero disables limit.
+	RateLimitCreate   float64 `env:"RATE_LIMIT_CREATE" json:"rate_limit_create,omitempty"`
+	RateLimitRedirect float64 `env:"RATE_LIMIT_REDIRECT" json:"rate_limit_redirect,omitempty"`
+	RateLimitDelete   float64 `env:"RATE_LIMIT_DELETE" json:"rate_limit_delete,omitempty"`
+	RateLimitBurst    int     `env:"RATE_LIMIT_BURST" json:"rate_limit_burst,omitempty"`
+	// TrustedProxies is comma separated CIDRs of reverse proxies. Client IP is taken from X-Real-IP or X-Forwarded-For
+	// only on requests from these networks, other requests are limited by connection address.
+	TrustedProxies string `env:"TRUSTED_PROXIES" json:"trusted_proxies,omitempty"`
+	// DailyLinksQuota is how many links user can create per day. Zero disables quota.
+	DailyLinksQuota int `env:"DAILY_LINKS_QUOTA" json:"daily_links_quota,omitempty"`
+
+	// Request limits in bytes and items. Zero disables limit.
+	MaxBodySize         int64 `env:"MAX_BODY_SIZE" json:"max_body_size,omitempty"`
+	MaxDecompressedSize int64 `env:"MAX_DECOMPRESSED_SIZE" json:"max_decompressed_size,omitempty"`
+	MaxBatchLength      int   `env:"MAX_BATCH_LENGTH" json:"max_batch_length,omitempty"`
+	MaxURLLength        int   `env:"MAX_URL_LENGTH" json:"max_url_length,omitempty"`
+
+	// HTTP server timeouts. Zero means no timeout.
+	ReadHeaderTimeout Duration `env:"READ_HEADER_TIMEOUT" json:"read_header_timeout,omitempty"`
+	ReadTimeout       Duration `env:"READ_TIMEOUT" json:"read_timeout,omitempty"`
+	WriteTimeout      Duration `env:"WRITE_TIMEOUT" json:"write_timeout,omitempty"`
+	IdleTimeout       Duration `env:"IDLE_TIMEOUT" json:"idle_timeout,omitempty"`
+
+	// TLS certificate and key files. If they aren't set, HTTPS certificate is obtained from Let's Encrypt.
+	TLSCertFile  string `env:"TLS_CERT_FILE" json:"tls_cert_file,omitempty"`
+	TLSKeyFile   string `env:"TLS_KEY_FILE" json:"tls_key_file,omitempty"`
+	ACMECacheDir string `env:"ACME_CACHE_DIR" json:"acme_cache_dir,omitempty"`
+	// GrpcTLS enables TLS of gRPC server. If GrpcClientCAFile is set, clients must present certificate signed by it.
+	GrpcTLS          bool   `env:"GRPC_TLS" json:"grpc_tls,omitempty"`
+	GrpcClientCAFile string `env:"GRPC_CLIENT_CA_FILE" json:"grpc_client_ca_file,omitempty"`
+	// HTTPRedirectAddress is address of plain HTTP listener, which serves ACME challenges and redirects to HTTPS.
+	HTTPRedirectAddress string `env:"HTTP_REDIRECT_ADDRESS" json:"http_redirect_address,omitempty"`
+
+	// RedirectCode is default status code of short link redirect: 301, 302, 307 or 308.
+	RedirectCode int `env:"REDIRECT_CODE" json:"redirect_code,omitempty"`
+	// RedirectCacheMaxAge is how long browsers and CDNs cache permanent redirects.
+	RedirectCacheMaxAge Duration `env:"REDIRECT_CACHE_MAX_AGE" json:"redirect_cache_max_age,omitempty"`
+
+	// DisableURLNormalization stores long urls as they are sent, so different spellings of url are different links.
+	DisableURLNormalization bool `env:"DISABLE_URL_NORMALIZATION" json:"disable_url_normalization,omitempty"`
+	// NormalizeSortQuery sorts query parameters of long urls, NormalizeDropFragment removes their fragments.
+	NormalizeSortQuery    bool `env:"NORMALIZE_SORT_QUERY" json:"normalize_sort_query,omitempty"`
+	NormalizeDropFragment bool `env:"NORMALIZE_DROP_FRAGMENT" json:"normalize_drop_fragment,omitempty"`
+
+	// AllowedSchemes is comma separated list of schemes, which long urls can have.
+	AllowedSchemes string `env:"ALLOWED_SCHEMES" json:"allowed_schemes,omitempty"`
+	// DomainListFile is file with allowed and denied domains of long urls. It's reloaded, when it's modified.
+	DomainListFile string `env:"DOMAIN_LIST_FILE" json:"domain_list_file,omitempty"`
+	// AllowPrivateDestinations allows links to localhost and private IP addresses.
+	AllowPrivateDestinations bool `env:"ALLOW_PRIVATE_DESTINATIONS" json:"allow_private_destinations,omitempty"`
+
+	// ThreatFeedFile is local threat feed file, which long urls are checked against.
+	ThreatFeedFile string `env:"THREAT_FEED_FILE" json:"threat_feed_file,omitempty"`
+	// ThreatFeedReloadInterval is how often threat feed file is checked for changes.
+	ThreatFeedReloadInterval Duration `env:"THREAT_FEED_RELOAD_INTERVAL" json:"threat_feed_reload_interval,omitempty"`
+	// ThreatCheckRedirects checks long urls again on redirect and shows warning page instead of redirect to flagged url.
+	ThreatCheckRedirects bool `env:"THREAT_CHECK_REDIRECTS" json:"threat_check_redirects,omitempty"`
+
+	// PreviewMode shows preview page instead of redirect for "flagged" destinations or for all "external" ones.
+	// Empty mode shows preview only for links with always_preview option and for preview requests.
+	PreviewMode string `env:"PREVIEW_MODE" json:"preview_mode,omitempty"`
+	// PreviewTrustedDomains is comma separated list of domains, which aren't external in "external" preview mode.
+	PreviewTrustedDomains string `env:"PREVIEW_TRUSTED_DOMAINS" json:"preview_trusted_domains,omitempty"`
+	// ErrorPagesDir is directory with templates of error pages, which replace built-in ones:
+	// not_found.html, deleted.html, expired.html and blocked.html.
+	ErrorPagesDir string `env:"ERROR_PAGES_DIR" json:"error_pages_dir,omitempty"`
+
+	// ReportThreshold is how many abuse reports from different IPs disable link until moderation. Zero disables it.
+	ReportThreshold int `env:"REPORT_THRESHOLD" json:"report_threshold,omitempty"`
+
+	// IdempotencyTTL is how long responses of create requests with idempotency keys are replayed. Zero disables keys.
+	IdempotencyTTL Duration `env:"IDEMPOTENCY_TTL" json:"idempotency_ttl,omitempty"`
+
+	// Bulk shortening jobs: number of workers, urls per chunk and max urls in job. Zero MaxJobLength disables limit.
+	JobWorkers   int `env:"JOB_WORKERS" json:"job_workers,omitempty"`
+	JobChunkSize int `env:"JOB_CHUNK_SIZE" json:"job_chunk_size,omitempty"`
+	MaxJobLength int `env:"MAX_JOB_LENGTH" json:"max_job_length,omitempty"`
+	// MaxJobBodySize limits body of bulk shortening job in bytes instead of MaxBodySize and MaxDecompressedSize.
+	// Default fits MaxJobLength urls of 256 bytes. Zero disables limit.
+	MaxJobBodySize int64 `env:"MAX_JOB_BODY_SIZE" json:"max_job_body_size,omitempty"`
+
+	// WebhookTimeout is timeout of webhook request. Failed delivery is retried after WebhookRetryDelay,
+	// which doubles after every attempt, and it's dead after WebhookMaxAttempts attempts.
+	WebhookTimeout     Duration `env:"WEBHOOK_TIMEOUT" json:"webhook_timeout,omitempty"`
+	WebhookRetryDelay  Duration `env:"WEBHOOK_RETRY_DELAY" json:"webhook_retry_delay,omitempty"`
+	WebhookMaxAttempts int      `env:"WEBHOOK_MAX_ATTEMPTS" json:"webhook_max_attempts,omitempty"`
+
+	// MaxQueueBacklog is how many bulk shortening jobs or webhook events can wait in queue, before service isn't ready.
+	// Zero disables check.
+	MaxQueueBacklog int `env:"MAX_QUEUE_BACKLOG" json:"max_queue_backlog,omitempty"`
+
+	// ShutdownDrainDelay is how long service reports "not ready" before it stops accepting requests. Zero disables delay.
+	ShutdownDrainDelay Duration `env:"SHUTDOWN_DRAIN_DELAY" json:"shutdown_drain_delay,omitempty"`
 }
 
 // GetDefaultConfig gets default config.
@@ -32,6 +136,42 @@ func GetDefaultConfig() Config {
 		BaseURL:         "http://127.0.0.1:8080",
 		DBMigrationPath: "file://migrations",
 		EnableHTTPS:     false,
+		LogLevel:        "info",
+		TracingExporter: "none",
+		OTLPEndpoint:    "localhost:4317",
+		ACMECacheDir:    "cache-dir",
+
+		MaxBodySize:         1 << 20,
+		MaxDecompressedSize: 10 << 20,
+		MaxBatchLength:      1000,
+		MaxURLLength:        2048,
+
+		ReadHeaderTimeout: Duration{5 * time.Second},
+		ReadTimeout:       Duration{10 * time.Second},
+		WriteTimeout:      Duration{10 * time.Second},
+		IdleTimeout:       Duration{2 * time.Minute},
+
+		RedirectCode:        307,
+		RedirectCacheMaxAge: Duration{24 * time.Hour},
+
+		AllowedSchemes: "http,https",
+
+		ThreatFeedReloadInterval: Duration{time.Minute},
+
+		IdempotencyTTL: Duration{24 * time.Hour},
+
+		JobWorkers:     4,
+		JobChunkSize:   100,
+		MaxJobLength:   500000,
+		MaxJobBodySize: 128 << 20,
+
+		WebhookTimeout:     Duration{5 * time.Second},
+		WebhookRetryDelay:  Duration{30 * time.Second},
+		WebhookMaxAttempts: 8,
+
+		MaxQueueBacklog: 1000,
+
+		ShutdownDrainDelay: Duration{5 * time.Second},
 	}
 }
 
@@ -74,19 +214,70 @@ func GetConfig() Config {
 		flag.StringVar(&flagCfg.StoragePath, "f", "", "Storage path")
 		flag.StringVar(&flagCfg.BasePath, "d", "", "DataBase path")
 		flag.StringVar(&flagCfg.TrustedSubnet, "t", "", "Trusted subnet")
+		flag.StringVar(&flagCfg.AdminAPIKey, "admin-key", "", "Admin API key")
 		flag.StringVar(&flagCfg.GrpcPort, "gp", "", "gRPC run port")
 		flag.BoolVar(&flagCfg.EnableHTTPS, "s", false, "Enable HTTPS")
+		flag.StringVar(&flagCfg.LogLevel, "l", "", "Log level")
+		flag.StringVar(&flagCfg.TracingExporter, "tracing", "", "Tracing exporter: otlp, stdout or none")
+		flag.StringVar(&flagCfg.OTLPEndpoint, "otlp", "", "OTLP collector endpoint")
+		flag.Float64Var(&flagCfg.RateLimitCreate, "rl-create", 0, "Create requests per second limit")
+		flag.Float64Var(&flagCfg.RateLimitRedirect, "rl-redirect", 0, "Redirect requests per second limit")
+		flag.Float64Var(&flagCfg.RateLimitDelete, "rl-delete", 0, "Delete requests per second limit")
+		flag.IntVar(&flagCfg.RateLimitBurst, "rl-burst", 0, "Rate limit burst")
+		flag.StringVar(&flagCfg.TrustedProxies, "trusted-proxies", "", "Comma separated CIDRs of trusted reverse proxies")
+		flag.IntVar(&flagCfg.DailyLinksQuota, "quota", 0, "Daily links quota per user")
+		flag.Int64Var(&flagCfg.MaxBodySize, "max-body", 0, "Max request body size in bytes")
+		flag.Int64Var(&flagCfg.MaxDecompressedSize, "max-decompressed", 0, "Max decompressed request body size in bytes")
+		flag.IntVar(&flagCfg.MaxBatchLength, "max-batch", 0, "Max number of urls in batch")
+		flag.IntVar(&flagCfg.MaxURLLength, "max-url", 0, "Max url length")
+		flag.Var(&flagCfg.ReadHeaderTimeout, "read-header-timeout", "HTTP server read header timeout")
+		flag.Var(&flagCfg.ReadTimeout, "read-timeout", "HTTP server read timeout")
+		flag.Var(&flagCfg.WriteTimeout, "write-timeout", "HTTP server write timeout")
+		flag.Var(&flagCfg.IdleTimeout, "idle-timeout", "HTTP server idle timeout")
+		flag.StringVar(&flagCfg.TLSCertFile, "tls-cert", "", "TLS certificate file")
+		flag.StringVar(&flagCfg.TLSKeyFile, "tls-key", "", "TLS key file")
+		flag.StringVar(&flagCfg.ACMECacheDir, "acme-cache", "", "Let's Encrypt certificates cache dir")
+		flag.BoolVar(&flagCfg.GrpcTLS, "grpc-tls", false, "Enable gRPC TLS")
+		flag.StringVar(&flagCfg.GrpcClientCAFile, "grpc-client-ca", "", "gRPC client CA bundle file")
+		flag.StringVar(&flagCfg.HTTPRedirectAddress, "redirect-addr", "", "HTTP to HTTPS redirect listener address")
+		flag.IntVar(&flagCfg.RedirectCode, "redirect-code", 0, "Default redirect status code")
+		flag.Var(&flagCfg.RedirectCacheMaxAge, "redirect-max-age", "Cache max age of permanent redirects")
+		flag.BoolVar(&flagCfg.DisableURLNormalization, "no-normalize", false, "Disable long url normalization")
+		flag.BoolVar(&flagCfg.NormalizeSortQuery, "normalize-sort-query", false, "Sort query parameters of long urls")
+		flag.BoolVar(&flagCfg.NormalizeDropFragment, "normalize-drop-fragment", false, "Drop fragments of long urls")
+		flag.StringVar(&flagCfg.AllowedSchemes, "allowed-schemes", "", "Comma separated schemes of long urls")
+		flag.StringVar(&flagCfg.DomainListFile, "domain-list", "", "File with allowed and denied domains of long urls")
+		flag.BoolVar(&flagCfg.AllowPrivateDestinations, "allow-private", false, "Allow links to private addresses")
+		flag.StringVar(&flagCfg.ThreatFeedFile, "threat-feed", "", "Threat feed file")
+		flag.Var(&flagCfg.ThreatFeedReloadInterval, "threat-feed-interval", "How often threat feed file is checked for changes")
+		flag.BoolVar(&flagCfg.ThreatCheckRedirects, "threat-check-redirects", false, "Check long urls against threat feed on redirect")
+		flag.StringVar(&flagCfg.PreviewMode, "preview-mode", "", "Show preview page for flagged or external destinations")
+		flag.StringVar(&flagCfg.PreviewTrustedDomains, "preview-trusted", "", "Comma separated domains without preview in external mode")
+		flag.StringVar(&flagCfg.ErrorPagesDir, "error-pages", "", "Directory with templates of error pages")
+		flag.IntVar(&flagCfg.ReportThreshold, "report-threshold", 0, "Abuse reports, which disable link until moderation")
+		flag.Var(&flagCfg.IdempotencyTTL, "idempotency-ttl", "How long responses of idempotency keys are replayed")
+		flag.IntVar(&flagCfg.JobWorkers, "job-workers", 0, "Number of bulk shortening job workers")
+		flag.IntVar(&flagCfg.JobChunkSize, "job-chunk", 0, "Number of urls in chunk of bulk shortening job")
+		flag.IntVar(&flagCfg.MaxJobLength, "max-job", 0, "Max number of urls in bulk shortening job")
+		flag.Int64Var(&flagCfg.MaxJobBodySize, "max-job-body", 0, "Max bulk shortening job body size in bytes")
+		flag.Var(&flagCfg.WebhookTimeout, "webhook-timeout", "Timeout of webhook request")
+		flag.Var(&flagCfg.WebhookRetryDelay, "webhook-retry-delay", "Delay before the first retry of webhook delivery")
+		flag.IntVar(&flagCfg.WebhookMaxAttempts, "webhook-attempts", 0, "Max attempts of webhook delivery")
+		flag.IntVar(&flagCfg.MaxQueueBacklog, "max-backlog", 0, "Max number of queued jobs or webhook events of ready service")
+		flag.Var(&flagCfg.ShutdownDrainDelay, "drain-delay", "Delay before shutdown, while service is not ready")
 
 		// file config.
 		flag.StringVar(&cfgFilePath, "c", "", "Config file path")
 		flag.StringVar(&cfgFilePath, "config", "", "Config file path")
 		flag.Parse()
 
+		var fileData []byte
 		if cfgFilePath != "" {
 			file, err := os.ReadFile(cfgFilePath)
 			if err != nil {
 				log.Fatalln("Failed parse config file:", err)
 			}
+			fileData = file
 
 			err = json.Unmarshal(file, &fileCfg)
 			if err != nil {
@@ -101,23 +292,87 @@ func GetConfig() Config {
 			log.Fatalln("Failed parse config:", err)
 		}
 
-		// change config by priority.
-		cfg.ChangeByPriority(fileCfg)
-		cfg.ChangeByPriority(envCfg)
-		cfg.ChangeByPriority(flagCfg)
+		// change config by priority. Explicitly set zero values disable limits, which are enabled by default.
+		cfg.ChangeByPriority(fileCfg, fileFields(fileData)...)
+		cfg.ChangeByPriority(envCfg, envFields()...)
+		cfg.ChangeByPriority(flagCfg, flagFields(flag.CommandLine, &flagCfg)...)
+		cfg.SecureBaseURL()
 	})
 
 	return cfg
 }
 
-// ChangeByPriority changes config by priority.
-func (cfg *Config) ChangeByPriority(newCfg Config) {
+// SecureBaseURL makes short URLs use https, if HTTPS is enabled.
+func (cfg *Config) SecureBaseURL() {
+	if cfg.EnableHTTPS && strings.HasPrefix(cfg.BaseURL, "http://") {
+		cfg.BaseURL = "https://" + strings.TrimPrefix(cfg.BaseURL, "http://")
+	}
+}
+
+// ChangeByPriority changes config by priority. Zero values of new config are skipped,
+// unless names of their fields are in set, so zero, which is set explicitly, replaces default.
+func (cfg *Config) ChangeByPriority(newCfg Config, set ...string) {
 	values := reflect.ValueOf(newCfg)
 	oldValues := reflect.ValueOf(cfg).Elem()
 
+	isSet := make(map[string]bool, len(set))
+	for _, name := range set {
+		isSet[name] = true
+	}
+
 	for j := 0; j < values.NumField(); j++ {
-		if !values.Field(j).IsZero() {
+		if !values.Field(j).IsZero() || isSet[values.Type().Field(j).Name] {
 			oldValues.Field(j).Set(values.Field(j))
 		}
 	}
 }
+
+// taggedFields gets names of config fields, which tag name is set according to isSet.
+func taggedFields(tag string, isSet func(name string) bool) []string {
+	var fields []string
+	t := reflect.TypeOf(Config{})
+	for j := 0; j < t.NumField(); j++ {
+		name := strings.Split(t.Field(j).Tag.Get(tag), ",")[0]
+		if name != "" && isSet(name) {
+			fields = append(fields, t.Field(j).Name)
+		}
+	}
+	return fields
+}
+
+// fileFields gets names of config fields, which are set in JSON config file.
+func fileFields(data []byte) []string {
+	var keys map[string]json.RawMessage
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return nil
+	}
+
+	return taggedFields("json", func(name string) bool {
+		_, ok := keys[name]
+		return ok
+	})
+}
+
+// envFields gets names of config fields, which env variables aren't empty.
+func envFields() []string {
+	return taggedFields("env", func(name string) bool {
+		return os.Getenv(name) != ""
+	})
+}
+
+// flagFields gets names of fields of flag config, which flags are set.
+func flagFields(flags *flag.FlagSet, flagCfg *Config) []string {
+	addresses := make(map[uintptr]string)
+	values := reflect.ValueOf(flagCfg).Elem()
+	for j := 0; j < values.NumField(); j++ {
+		addresses[values.Field(j).Addr().Pointer()] = values.Type().Field(j).Name
+	}
+
+	var fields []string
+	flags.Visit(func(f *flag.Flag) {
+		if name, ok := addresses[reflect.ValueOf(f.Value).Pointer()]; ok {
+			fields = append(fields, name)
+		}
+	})
+	return fields
+}
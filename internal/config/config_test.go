@@ -1,9 +1,13 @@
 package config
 
 import (
+	"encoding/json"
+	"flag"
 	"os"
 	"testing"
+	"time"
 
+	"github.com/caarlos0/env/v6"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -21,11 +25,51 @@ func TestGetDefaultConfig(t *testing.T) {
 		BaseURL:         "http://127.0.0.1:8080",
 		DBMigrationPath: "file://migrations",
 		GrpcPort:        ":3200",
+		LogLevel:        "info",
+		TracingExporter: "none",
+		OTLPEndpoint:    "localhost:4317",
+		ACMECacheDir:    "cache-dir",
+
+		MaxBodySize:         1 << 20,
+		MaxDecompressedSize: 10 << 20,
+		MaxBatchLength:      1000,
+		MaxURLLength:        2048,
+
+		ReadHeaderTimeout: Duration{5 * time.Second},
+		ReadTimeout:       Duration{10 * time.Second},
+		WriteTimeout:      Duration{10 * time.Second},
+		IdleTimeout:       Duration{2 * time.Minute},
+
+		RedirectCode:        307,
+		RedirectCacheMaxAge: Duration{24 * time.Hour},
+
+		AllowedSchemes: "http,https",
+
+		ThreatFeedReloadInterval: Duration{time.Minute},
+
+		IdempotencyTTL: Duration{24 * time.Hour},
+
+		JobWorkers:     4,
+		JobChunkSize:   100,
+		MaxJobLength:   500000,
+		MaxJobBodySize: 128 << 20,
+
+		WebhookTimeout:     Duration{5 * time.Second},
+		WebhookRetryDelay:  Duration{30 * time.Second},
+		WebhookMaxAttempts: 8,
+
+		MaxQueueBacklog: 1000,
+
+		ShutdownDrainDelay: Duration{5 * time.Second},
 	}, cfg)
 }
 
 func TestGetConfig(t *testing.T) {
-	os.Args = append(os.Args, "-a", ":9090", "-b", "https://127.0.0.1:9090", "-f", "file.txt", "-d", "", "-s", "-d", "postgresql://")
+	os.Args = append(os.Args, "-a", ":9090", "-b", "https://127.0.0.1:9090", "-f", "file.txt", "-d", "", "-s", "-d", "postgresql://",
+		"-max-batch", "10", "-write-timeout", "30s", "-tls-cert", "cert.pem", "-tls-key", "key.pem")
+	t.Setenv("MAX_URL_LENGTH", "512")
+	t.Setenv("IDLE_TIMEOUT", "1m")
+	t.Setenv("GRPC_TLS", "true")
 	cfg := GetConfig()
 
 	assert.Equal(t, Config{
@@ -36,6 +80,46 @@ func TestGetConfig(t *testing.T) {
 		EnableHTTPS:     true,
 		DBMigrationPath: "file://migrations",
 		GrpcPort:        ":3200",
+		LogLevel:        "info",
+		TracingExporter: "none",
+		OTLPEndpoint:    "localhost:4317",
+		ACMECacheDir:    "cache-dir",
+
+		MaxBodySize:         1 << 20,
+		MaxDecompressedSize: 10 << 20,
+		MaxBatchLength:      10,
+		MaxURLLength:        512,
+
+		ReadHeaderTimeout: Duration{5 * time.Second},
+		ReadTimeout:       Duration{10 * time.Second},
+		WriteTimeout:      Duration{30 * time.Second},
+		IdleTimeout:       Duration{time.Minute},
+
+		TLSCertFile: "cert.pem",
+		TLSKeyFile:  "key.pem",
+		GrpcTLS:     true,
+
+		RedirectCode:        307,
+		RedirectCacheMaxAge: Duration{24 * time.Hour},
+
+		AllowedSchemes: "http,https",
+
+		ThreatFeedReloadInterval: Duration{time.Minute},
+
+		IdempotencyTTL: Duration{24 * time.Hour},
+
+		JobWorkers:     4,
+		JobChunkSize:   100,
+		MaxJobLength:   500000,
+		MaxJobBodySize: 128 << 20,
+
+		WebhookTimeout:     Duration{5 * time.Second},
+		WebhookRetryDelay:  Duration{30 * time.Second},
+		WebhookMaxAttempts: 8,
+
+		MaxQueueBacklog: 1000,
+
+		ShutdownDrainDelay: Duration{5 * time.Second},
 	}, cfg)
 }
 
@@ -52,5 +136,89 @@ func TestChangeByPriority(t *testing.T) {
 		EnableHTTPS:     cfg.EnableHTTPS,
 		DBMigrationPath: cfg.DBMigrationPath,
 		GrpcPort:        cfg.GrpcPort,
+		LogLevel:        cfg.LogLevel,
+		TracingExporter: cfg.TracingExporter,
+		OTLPEndpoint:    cfg.OTLPEndpoint,
 	}, cfg)
 }
+
+func TestChangeByPriority_DisableLimits(t *testing.T) {
+	// limits gets only fields, which can be disabled by zero.
+	limits := func(cfg Config) Config {
+		return Config{
+			MaxBodySize:         cfg.MaxBodySize,
+			MaxDecompressedSize: cfg.MaxDecompressedSize,
+			MaxBatchLength:      cfg.MaxBatchLength,
+			MaxURLLength:        cfg.MaxURLLength,
+			IdempotencyTTL:      cfg.IdempotencyTTL,
+			MaxJobBodySize:      cfg.MaxJobBodySize,
+			MaxQueueBacklog:     cfg.MaxQueueBacklog,
+			ShutdownDrainDelay:  cfg.ShutdownDrainDelay,
+		}
+	}
+
+	t.Run("file", func(t *testing.T) {
+		data := []byte(`{"max_body_size":0,"max_decompressed_size":0,"max_batch_length":0,"max_url_length":0,` +
+			`"idempotency_ttl":"0s","max_job_body_size":0,"max_queue_backlog":0,"shutdown_drain_delay":"0s"}`)
+		var fileCfg Config
+		assert.NoError(t, json.Unmarshal(data, &fileCfg))
+
+		cfg := GetDefaultConfig()
+		cfg.ChangeByPriority(fileCfg, fileFields(data)...)
+		assert.Equal(t, Config{}, limits(cfg))
+		assert.Equal(t, ":8080", cfg.ServerAddress)
+	})
+
+	t.Run("env", func(t *testing.T) {
+		for _, name := range []string{"MAX_BODY_SIZE", "MAX_DECOMPRESSED_SIZE", "MAX_BATCH_LENGTH", "MAX_URL_LENGTH",
+			"MAX_JOB_BODY_SIZE", "MAX_QUEUE_BACKLOG"} {
+			t.Setenv(name, "0")
+		}
+		t.Setenv("IDEMPOTENCY_TTL", "0s")
+		t.Setenv("SHUTDOWN_DRAIN_DELAY", "0s")
+		t.Setenv("SERVER_ADDRESS", "")
+
+		var envCfg Config
+		assert.NoError(t, env.Parse(&envCfg))
+
+		cfg := GetDefaultConfig()
+		cfg.ChangeByPriority(envCfg, envFields()...)
+		assert.Equal(t, Config{}, limits(cfg))
+		assert.Equal(t, ":8080", cfg.ServerAddress)
+	})
+
+	t.Run("flags", func(t *testing.T) {
+		var flagCfg Config
+		flags := flag.NewFlagSet("test", flag.ContinueOnError)
+		flags.StringVar(&flagCfg.ServerAddress, "a", "", "Server address")
+		flags.Int64Var(&flagCfg.MaxBodySize, "max-body", 0, "")
+		flags.Int64Var(&flagCfg.MaxDecompressedSize, "max-decompressed", 0, "")
+		flags.IntVar(&flagCfg.MaxBatchLength, "max-batch", 0, "")
+		flags.IntVar(&flagCfg.MaxURLLength, "max-url", 0, "")
+		flags.Var(&flagCfg.IdempotencyTTL, "idempotency-ttl", "")
+		flags.Int64Var(&flagCfg.MaxJobBodySize, "max-job-body", 0, "")
+		flags.IntVar(&flagCfg.MaxQueueBacklog, "max-backlog", 0, "")
+		flags.Var(&flagCfg.ShutdownDrainDelay, "drain-delay", "")
+		assert.NoError(t, flags.Parse([]string{"-max-body", "0", "-max-decompressed", "0", "-max-batch", "0", "-max-url", "0",
+			"-idempotency-ttl", "0s", "-max-job-body", "0", "-max-backlog", "0", "-drain-delay", "0s"}))
+
+		cfg := GetDefaultConfig()
+		cfg.ChangeByPriority(flagCfg, flagFields(flags, &flagCfg)...)
+		assert.Equal(t, Config{}, limits(cfg))
+		assert.Equal(t, ":8080", cfg.ServerAddress)
+	})
+}
+
+func TestSecureBaseURL(t *testing.T) {
+	cfg := GetTestConfig()
+
+	cfg.SecureBaseURL()
+	assert.Equal(t, "http://127.0.0.1:8081", cfg.BaseURL)
+
+	cfg.EnableHTTPS = true
+	cfg.SecureBaseURL()
+	assert.Equal(t, "https://127.0.0.1:8081", cfg.BaseURL)
+
+	cfg.SecureBaseURL()
+	assert.Equal(t, "https://127.0.0.1:8081", cfg.BaseURL)
+}
@@ -0,0 +1,28 @@
+package config
+
+import "time"
+
+// Duration is time.Duration, which can be parsed from strings like "10s" in env, JSON and flags.
+type Duration struct {
+	time.Duration
+}
+
+// UnmarshalText parses duration from text.
+func (d *Duration) UnmarshalText(text []byte) error {
+	return d.Set(string(text))
+}
+
+// MarshalText converts duration to text.
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+// Set parses duration from flag value.
+func (d *Duration) Set(value string) error {
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return err
+	}
+	d.Duration = duration
+	return nil
+}
@@ -0,0 +1,24 @@
+package config
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDuration(t *testing.T) {
+	cfg := Config{}
+	err := json.Unmarshal([]byte(`{"read_timeout": "15s", "idle_timeout": "2m30s"}`), &cfg)
+	assert.NoError(t, err)
+	assert.Equal(t, 15*time.Second, cfg.ReadTimeout.Duration)
+	assert.Equal(t, 150*time.Second, cfg.IdleTimeout.Duration)
+
+	err = json.Unmarshal([]byte(`{"read_timeout": "15 seconds"}`), &cfg)
+	assert.Error(t, err)
+
+	data, err := json.Marshal(Duration{time.Minute})
+	assert.NoError(t, err)
+	assert.Equal(t, `"1m0s"`, string(data))
+}
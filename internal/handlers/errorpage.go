@@ -0,0 +1,181 @@
+package handlers
+
+import (
+	"errors"
+	"html/template"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/size12/url-shortener/internal/logger"
+	"github.com/size12/url-shortener/internal/storage"
+	"go.uber.org/zap"
+)
+
+// Kinds of error pages of short links. Custom template of error page is file named by its kind with .html extension.
+const (
+	PageNotFound = "not_found"
+	PageDeleted  = "deleted"
+	PageExpired  = "expired"
+	PageBlocked  = "blocked"
+)
+
+// ErrLinkExpired is returned instead of redirect, if link is expired.
+var ErrLinkExpired = errors.New("link is expired")
+
+// errorPage is built-in template of error pages.
+var errorPage = template.Must(template.New("error").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><meta name="robots" content="noindex"><title>{{.Title}}</title></head>
+<body>
+<h1>{{.Title}}</h1>
+{{if eq .Kind "not_found"}}<p>This short link doesn't exist. Check that it's typed correctly.</p>
+{{else if eq .Kind "deleted"}}<p>This short link was deleted by its owner.</p>
+{{else if eq .Kind "expired"}}<p>This short link has expired and doesn't lead anywhere anymore.</p>
+{{else}}<p>This short link was disabled by the service administration: {{.Reason}}.</p>
+{{end}}</body>
+</html>
+`))
+
+// ErrorPage is data of error page template.
+type ErrorPage struct {
+	// Kind is one of PageNotFound, PageDeleted, PageExpired and PageBlocked.
+	Kind string
+	ID   string
+	Code int
+	// Title is status text of code.
+	Title string
+	// Message is short description of error, which is returned to API clients.
+	Message string
+	// Reason is why link is blocked.
+	Reason string
+}
+
+// ErrorPages are templates of error pages by their kind.
+type ErrorPages struct {
+	templates map[string]*template.Template
+}
+
+// NewErrorPages gets built-in error pages, which are replaced by templates from dir, if they exist there.
+// Empty dir means built-in pages only.
+func NewErrorPages(dir string) (*ErrorPages, error) {
+	pages := &ErrorPages{templates: make(map[string]*template.Template)}
+
+	for _, kind := range []string{PageNotFound, PageDeleted, PageExpired, PageBlocked} {
+		pages.templates[kind] = errorPage
+		if dir == "" {
+			continue
+		}
+
+		tmpl, err := template.ParseFiles(filepath.Join(dir, kind+".html"))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		pages.templates[kind] = tmpl
+	}
+
+	return pages, nil
+}
+
+// linkErrorPage gets error page of short link for error of redirect. It returns false, if error isn't about link.
+func linkErrorPage(id string, err error) (ErrorPage, bool) {
+	page := ErrorPage{ID: id}
+
+	var takedownErr *TakedownError
+	switch {
+	case errors.As(err, &takedownErr):
+		page.Kind, page.Code = PageBlocked, takedownErr.Takedown.Code
+		page.Message, page.Reason = takedownErr.Error(), takedownErr.Takedown.Reason
+	case errors.Is(err, ErrLinkExpired):
+		page.Kind, page.Code, page.Message = PageExpired, http.StatusGone, "link is expired"
+	case errors.Is(err, storage.Err410):
+		page.Kind, page.Code, page.Message = PageDeleted, http.StatusGone, "link is deleted"
+	case errors.Is(err, storage.Err404):
+		page.Kind, page.Code, page.Message = PageNotFound, http.StatusNotFound, "not found"
+	default:
+		return page, false
+	}
+
+	page.Title = http.StatusText(page.Code)
+	return page, true
+}
+
+// writeLinkError writes error of short link as HTML page for browsers, as plain text on request
+// or as problem JSON for API clients.
+// Error mustn't be cached, because link can be restored or created.
+func (service *Service) writeLinkError(w http.ResponseWriter, r *http.Request, page ErrorPage, err error) {
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Expires", expiredDate)
+	w.Header().Add("Vary", "Accept")
+
+	switch negotiateErrorType(r.Header.Get("Accept")) {
+	case "text/html":
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("X-Robots-Tag", "noindex")
+		w.WriteHeader(page.Code)
+
+		if err := service.errorPages.templates[page.Kind].Execute(w, page); err != nil {
+			logger.Log.Error("Failed write error page", zap.String("kind", page.Kind), zap.Error(err))
+		}
+	case "text/plain":
+		http.Error(w, page.Message, page.Code)
+	default:
+		writeError(w, r, err)
+	}
+}
+
+// negotiateErrorType gets type of error response by Accept header: text/html, text/plain or problem JSON.
+// Only explicitly accepted types are chosen, so wildcards of API clients get problem JSON as other errors.
+func negotiateErrorType(accept string) string {
+	best, bestQuality := ProblemContentType, 0.0
+
+	for _, offer := range []string{"text/html", ProblemContentType, "application/json", "text/plain"} {
+		if quality := acceptQuality(accept, offer); quality > bestQuality {
+			best, bestQuality = offer, quality
+		}
+	}
+
+	if best == "application/json" {
+		return ProblemContentType
+	}
+	return best
+}
+
+// acceptQuality gets quality of media type in Accept header. Zero means type isn't accepted explicitly.
+// XHTML is accepted as HTML.
+func acceptQuality(accept, mediaType string) float64 {
+	var quality float64
+
+	for _, part := range strings.Split(accept, ",") {
+		accepted, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+
+		if accepted == "application/xhtml+xml" {
+			accepted = "text/html"
+		}
+		if accepted != mediaType {
+			continue
+		}
+
+		q := 1.0
+		if value, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(value, 64); err != nil {
+				continue
+			}
+		}
+
+		if q > quality {
+			quality = q
+		}
+	}
+
+	return quality
+}
@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/size12/url-shortener/internal/config"
+	"github.com/size12/url-shortener/internal/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+// getErrorPage gets response to short link request with Accept header.
+func getErrorPage(r http.Handler, target, accept string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(http.MethodGet, target, nil)
+	request.Header.Set("Accept", accept)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, request)
+	return w
+}
+
+func TestNegotiateErrorType(t *testing.T) {
+	tests := []struct {
+		accept string
+		want   string
+	}{
+		{accept: "", want: ProblemContentType},
+		{accept: "*/*", want: ProblemContentType},
+		{accept: "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", want: "text/html"},
+		{accept: "application/xhtml+xml", want: "text/html"},
+		{accept: "application/json", want: ProblemContentType},
+		{accept: "application/problem+json", want: ProblemContentType},
+		{accept: "application/json, text/html;q=0.5", want: ProblemContentType},
+		{accept: "text/plain, text/html;q=0.5", want: "text/plain"},
+		{accept: "text/html;q=0", want: ProblemContentType},
+		{accept: "text/html;q=bad, application/json", want: ProblemContentType},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, negotiateErrorType(tt.accept), tt.accept)
+	}
+}
+
+func TestErrorPages(t *testing.T) {
+	cfg := config.GetTestConfig()
+	s, err := storage.NewMapStorage(cfg)
+	assert.NoError(t, err)
+	service := NewService(cfg, s)
+	r := redirectRouter(service)
+
+	browser := "text/html,application/xhtml+xml,*/*;q=0.8"
+
+	// not found.
+	w := getErrorPage(r, "/100", browser)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, "text/html; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+	assert.Equal(t, "Accept", w.Header().Get("Vary"))
+	assert.Contains(t, w.Body.String(), "This short link doesn't exist")
+
+	w = getErrorPage(r, "/100", "text/plain")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, "not found\n", w.Body.String())
+
+	w = getErrorPage(r, "/100", "*/*")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, ProblemContentType, w.Header().Get("Content-Type"))
+	assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+	assert.JSONEq(t, `{"type":"about:blank","title":"Not Found","status":404,"detail":"not found","instance":"/100","code":"not_found"}`,
+		w.Body.String())
+
+	// expired.
+	res := doRequest(r, http.MethodPost, "/api/shorten", "application/json",
+		`{"url":"https://yandex.ru/expired","expires_at":"2020-01-01T00:00:00Z"}`, nil)
+	assert.Equal(t, http.StatusCreated, res.StatusCode)
+
+	w = getErrorPage(r, "/1", browser)
+	assert.Equal(t, http.StatusGone, w.Code)
+	assert.Contains(t, w.Body.String(), "This short link has expired")
+
+	w = getErrorPage(r, "/1", "")
+	assert.Equal(t, http.StatusGone, w.Code)
+	assert.Contains(t, w.Body.String(), `"code":"link_expired"`)
+
+	_, err = service.GetLongURL(context.Background(), "1")
+	assert.ErrorIs(t, err, ErrLinkExpired)
+
+	// link, which expires later, redirects.
+	res = doRequest(r, http.MethodPost, "/?expires_at=2120-01-01T00:00:00Z", "text/plain", "https://yandex.ru/later", nil)
+	assert.Equal(t, http.StatusCreated, res.StatusCode)
+
+	res = doRequest(r, http.MethodGet, "/2", "", "", nil)
+	assert.Equal(t, http.StatusTemporaryRedirect, res.StatusCode)
+
+	res = doRequest(r, http.MethodPost, "/?expires_at=tomorrow", "text/plain", "https://yandex.ru/tomorrow", nil)
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+
+	// deleted.
+	assert.NoError(t, service.DeleteURL(context.Background(), "user12", []string{"2"}))
+
+	w = getErrorPage(r, "/2", browser)
+	assert.Equal(t, http.StatusGone, w.Code)
+	assert.Contains(t, w.Body.String(), "This short link was deleted")
+
+	w = getErrorPage(r, "/2", "application/json")
+	assert.Equal(t, http.StatusGone, w.Code)
+	assert.Contains(t, w.Body.String(), `"code":"link_deleted"`)
+	assert.Contains(t, w.Body.String(), `"detail":"link is deleted"`)
+}
+
+func TestNewErrorPages(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, PageNotFound+".html"),
+		[]byte(`<p>Custom {{.Code}}: no link {{.ID}}</p>`), 0o644))
+
+	pages, err := NewErrorPages(dir)
+	assert.NoError(t, err)
+
+	cfg := config.GetTestConfig()
+	s, err := storage.NewMapStorage(cfg)
+	assert.NoError(t, err)
+	r := redirectRouter(NewService(cfg, s, WithErrorPages(pages)))
+
+	w := getErrorPage(r, "/abc", "text/html")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, "<p>Custom 404: no link abc</p>", w.Body.String())
+
+	// pages, which aren't in directory, are built-in.
+	assert.Equal(t, errorPage, pages.templates[PageDeleted])
+
+	// invalid template.
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, PageBlocked+".html"), []byte(`{{.Reason`), 0o644))
+	_, err = NewErrorPages(dir)
+	assert.Error(t, err)
+}
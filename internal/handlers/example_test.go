@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"log"
@@ -109,13 +110,13 @@ func ExampleURLHistoryHandler() {
 	}
 
 	// creating short urls.
-	_, err = s.CreateShort(userID, "https://yandex.ru")
+	_, err = s.CreateShort(context.Background(), userID, "https://yandex.ru")
 
 	if err != nil {
 		log.Fatal("Failed shorten URL")
 	}
 
-	_, err = s.CreateShort(userID, "https://google.com")
+	_, err = s.CreateShort(context.Background(), userID, "https://google.com")
 
 	if err != nil {
 		log.Fatal("Failed shorten URL")
@@ -160,13 +161,13 @@ func ExampleDeleteHandler() {
 	}
 
 	// creating short urls.
-	_, err = s.CreateShort(userID, "https://yandex.ru")
+	_, err = s.CreateShort(context.Background(), userID, "https://yandex.ru")
 
 	if err != nil {
 		log.Fatal("Failed shorten URL")
 	}
 
-	_, err = s.CreateShort(userID, "https://google.com")
+	_, err = s.CreateShort(context.Background(), userID, "https://google.com")
 
 	if err != nil {
 		log.Fatal("Failed shorten URL")
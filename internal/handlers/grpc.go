@@ -4,11 +4,10 @@ import (
 	"context"
 
 	"github.com/size12/url-shortener/internal/config"
+	"github.com/size12/url-shortener/internal/qrcode"
 	"github.com/size12/url-shortener/internal/storage"
 	pb "github.com/size12/url-shortener/pkg/grpc"
-	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
-	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/types/known/emptypb"
 )
 
@@ -30,30 +29,70 @@ func NewShortenerServer(cfg config.Config, service *Service) *ShortenerServer {
 // Ping check connection to storage.
 func (server *ShortenerServer) Ping(ctx context.Context, in *emptypb.Empty) (*emptypb.Empty, error) {
 	empty := &emptypb.Empty{}
-	err := server.service.CheckPing()
+	err := server.service.CheckPing(ctx)
 	if err != nil {
-		return empty, status.Error(codes.Unavailable, "Storage doesn't response.")
+		return empty, grpcError(ctx, &Error{Code: CodeUnavailable, Message: "storage doesn't respond", Err: err})
 	}
 	return empty, nil
 }
 
+// metadataUser gets ID of user from metadata of request.
+func metadataUser(ctx context.Context) (string, error) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok || len(md.Get("userID")) == 0 {
+		return "", NewError(CodeUnauthenticated, "wrong metadata")
+	}
+	return md.Get("userID")[0], nil
+}
+
+// linkOptions gets options of new link from request.
+func linkOptions(in *pb.Link) storage.LinkOptions {
+	opts := storage.LinkOptions{
+		RedirectCode:  int(in.RedirectCode),
+		QueryMode:     in.QueryMode,
+		ForwardPath:   in.ForwardPath,
+		Title:         in.Title,
+		AlwaysPreview: in.AlwaysPreview,
+	}
+	if in.ExpiresAt != nil {
+		expires := in.ExpiresAt.AsTime()
+		opts.ExpiresAt = &expires
+	}
+	return opts
+}
+
+// utmRequest gets UTM parameters of new link from request.
+func utmRequest(in *pb.Link) storage.UTMRequest {
+	req := storage.UTMRequest{UTMPreset: in.UtmPreset}
+	if in.Utm != nil {
+		req.UTM = &storage.UTM{
+			Source:   in.Utm.Source,
+			Medium:   in.Utm.Medium,
+			Campaign: in.Utm.Campaign,
+			Term:     in.Utm.Term,
+			Content:  in.Utm.Content,
+		}
+	}
+	return req
+}
+
 // CreateShort creates short from long url.
 func (server *ShortenerServer) CreateShort(ctx context.Context, in *pb.Link) (*pb.Link, error) {
 	result := &pb.Link{}
 
-	md, ok := metadata.FromIncomingContext(ctx)
-	if !ok {
-		return nil, status.Error(codes.Unknown, "wrong metadata")
-	}
-
-	if len(md.Get("userID")) == 0 {
-		return nil, status.Error(codes.Unknown, "wrong metadata")
+	userID, err := metadataUser(ctx)
+	if err != nil {
+		return nil, grpcError(ctx, err)
 	}
 
-	id, err := server.service.ShortSingleURL(md.Get("userID")[0], in.LongUrl)
+	id, err := server.service.ShortSingleURL(ctx, userID, storage.RequestJSON{
+		URL:         in.LongUrl,
+		LinkOptions: linkOptions(in),
+		UTMRequest:  utmRequest(in),
+	})
 
 	if err != storage.Err409 && err != nil {
-		return result, err
+		return nil, grpcError(ctx, err)
 	}
 
 	result.ShortUrl = server.cfg.BaseURL + "/" + id
@@ -69,54 +108,50 @@ func (server *ShortenerServer) CreateShort(ctx context.Context, in *pb.Link) (*p
 // GetStatistics gets count of urls and users.
 func (server *ShortenerServer) GetStatistics(ctx context.Context, _ *emptypb.Empty) (*pb.Statistic, error) {
 	result := &pb.Statistic{}
-	stat, err := server.service.GetStatistic()
+	stat, err := server.service.GetStatistic(ctx)
+	if err != nil {
+		return nil, grpcError(ctx, err)
+	}
+
 	result.Users = uint32(stat.Users)
 	result.Urls = uint32(stat.Urls)
 
-	return result, err
+	return result, nil
 }
 
 // GetLong gets long url from short one.
 func (server *ShortenerServer) GetLong(ctx context.Context, in *pb.Link) (*pb.Link, error) {
 	result := &pb.Link{}
-	long, err := server.service.GetLongURL(in.Id)
-	if err == storage.Err404 {
-		return nil, status.Error(codes.NotFound, "Link not in storage")
+	long, err := server.service.GetLongURL(ctx, in.Id)
+	if err != nil {
+		return nil, grpcError(ctx, err)
 	}
+
 	result.LongUrl = long
-	return result, err
+	return result, nil
 }
 
 // Delete deletes url from storage.
 func (server *ShortenerServer) Delete(ctx context.Context, in *pb.Link) (*emptypb.Empty, error) {
-	md, ok := metadata.FromIncomingContext(ctx)
-	if !ok {
-		return nil, status.Error(codes.Unknown, "wrong metadata")
-	}
-
-	if len(md.Get("userID")) == 0 {
-		return nil, status.Error(codes.Unknown, "wrong metadata")
+	userID, err := metadataUser(ctx)
+	if err != nil {
+		return nil, grpcError(ctx, err)
 	}
 
-	userID := md.Get("userID")[0]
-
-	err := server.service.DeleteURL(userID, []string{in.Id})
-	return nil, err
+	err = server.service.DeleteURL(ctx, userID, []string{in.Id})
+	return nil, grpcError(ctx, err)
 }
 
 // GetHistory gets history.
 func (server *ShortenerServer) GetHistory(ctx context.Context, in *emptypb.Empty) (*pb.Batch, error) {
-	md, ok := metadata.FromIncomingContext(ctx)
-	if !ok || len(md.Get("userID")) == 0 {
-		return nil, status.Error(codes.Unknown, "wrong metadata")
+	userID, err := metadataUser(ctx)
+	if err != nil {
+		return nil, grpcError(ctx, err)
 	}
 
-	userID := md.Get("userID")[0]
-
-	history, err := server.service.GetHistory(userID)
-
+	history, err := server.service.GetHistory(ctx, userID)
 	if err != nil {
-		return nil, err
+		return nil, grpcError(ctx, err)
 	}
 
 	result := &pb.Batch{}
@@ -132,13 +167,11 @@ func (server *ShortenerServer) GetHistory(ctx context.Context, in *emptypb.Empty
 
 // BatchShort shorts many urls, not single one.
 func (server *ShortenerServer) BatchShort(ctx context.Context, in *pb.Batch) (*pb.Batch, error) {
-	md, ok := metadata.FromIncomingContext(ctx)
-	if !ok || len(md.Get("userID")) == 0 {
-		return nil, status.Error(codes.Unknown, "wrong metadata")
+	userID, err := metadataUser(ctx)
+	if err != nil {
+		return nil, grpcError(ctx, err)
 	}
 
-	userID := md.Get("userID")[0]
-
 	result := &pb.Batch{}
 	query := make([]storage.BatchJSON, 0, len(in.Result))
 
@@ -146,17 +179,19 @@ func (server *ShortenerServer) BatchShort(ctx context.Context, in *pb.Batch) (*p
 		query = append(query, storage.BatchJSON{
 			CorrelationID: url.CorrelationId,
 			URL:           url.LongUrl,
+			LinkOptions:   linkOptions(url),
+			UTMRequest:    utmRequest(url),
 		})
 	}
 
-	urls, err := server.service.ShortURLs(userID, query)
+	urls, err := server.service.ShortURLs(ctx, userID, query)
 
 	if err == storage.Err409 {
 		err = nil
 	}
 
 	if err != nil {
-		return nil, err
+		return nil, grpcError(ctx, err)
 	}
 
 	result.Result = make([]*pb.Link, 0, len(urls))
@@ -170,3 +205,31 @@ func (server *ShortenerServer) BatchShort(ctx context.Context, in *pb.Batch) (*p
 
 	return result, nil
 }
+
+// GetQRCode gets image of QR code with short url of link.
+func (server *ShortenerServer) GetQRCode(ctx context.Context, in *pb.QRRequest) (*pb.QRCode, error) {
+	opts := DefaultQROptions()
+	if in.Format != "" {
+		opts.Format = in.Format
+	}
+	if in.Size != 0 {
+		opts.Size = int(in.Size)
+	}
+	if in.Margin != nil {
+		opts.Margin = int(*in.Margin)
+	}
+	if in.Level != "" {
+		level, err := qrcode.ParseLevel(in.Level)
+		if err != nil {
+			return nil, grpcError(ctx, err)
+		}
+		opts.Level = level
+	}
+
+	image, _, err := server.service.GetQRCode(ctx, in.Id, opts)
+	if err != nil {
+		return nil, grpcError(ctx, err)
+	}
+
+	return &pb.QRCode{Image: image, ContentType: opts.ContentType()}, nil
+}
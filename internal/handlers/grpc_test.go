@@ -8,7 +8,9 @@ import (
 	"github.com/size12/url-shortener/internal/storage"
 	pb "github.com/size12/url-shortener/pkg/grpc"
 	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/types/known/emptypb"
 )
 
@@ -96,14 +98,12 @@ func TestGRPCHandlers(t *testing.T) {
 
 	// get non existed long.
 	_, err = server.GetLong(ctx, out)
-	assert.Error(t, err)
-	// get existed long.
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	// get deleted long.
 	out.Id = "1"
 	long, err := server.GetLong(ctx, out)
-	assert.Error(t, err)
-	assert.Equal(t, &pb.Link{
-		LongUrl: "https://yandex.ru",
-	}, long)
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	assert.Nil(t, long)
 
 	// batch short.
 	links := &pb.Batch{}
@@ -159,4 +159,13 @@ func TestGRPCHandlers(t *testing.T) {
 		},
 	}, history)
 
+	// create short with redirect code.
+	out, err = server.CreateShort(ctx, &pb.Link{LongUrl: "https://dzen.ru", RedirectCode: 308})
+	assert.NoError(t, err)
+	redirect, err := handlers.GetRedirect(ctx, out.Id, "", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 308, redirect.Code)
+
+	_, err = server.CreateShort(ctx, &pb.Link{LongUrl: "https://dzen.ru/news", RedirectCode: 200})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
 }
@@ -2,85 +2,430 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"net/http"
+	"net/url"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/size12/url-shortener/internal/config"
+	"github.com/size12/url-shortener/internal/policy"
+	"github.com/size12/url-shortener/internal/ratelimit"
 	"github.com/size12/url-shortener/internal/storage"
+	"github.com/size12/url-shortener/internal/threat"
+	"github.com/size12/url-shortener/internal/urlnorm"
+)
+
+// Errors of service layer.
+var (
+	ErrBatchTooLarge = errors.New("too many urls in batch")
+	ErrURLTooLong    = errors.New("url is too long")
+
+	ErrUnknownUTMPreset = errors.New("unknown UTM preset")
 )
 
 // Service struct for service layer.
 type Service struct {
-	cfg     config.Config
-	storage storage.Storage
+	cfg        config.Config
+	storage    storage.Storage
+	quota      *ratelimit.Quota
+	proxies    trustedProxies
+	utmPresets storage.UTMPresetStorage
+	policy     *policy.Policy
+	checker    threat.URLChecker
+	takedowns  storage.TakedownStorage
+	reports    storage.ReportStorage
+	errorPages *ErrorPages
+	clicks     storage.ClickStorage
+
+	idempotency      storage.IdempotencyStorage
+	idempotencyLocks *keyLocks
+
+	jobs     storage.JobStorage
+	jobQueue *jobQueue
+
+	webhooks           storage.WebhookStorage
+	webhookEvents      chan linkEvent
+	clickSubscriptions *clickSubscriptions
+	webhookWake        chan struct{}
+	webhookClient      *http.Client
+}
+
+// ServiceOption sets optional dependency of service.
+type ServiceOption func(service *Service)
+
+// WithUTMPresets sets storage of UTM presets. By default presets are stored by links storage, if it can, or in memory.
+func WithUTMPresets(presets storage.UTMPresetStorage) ServiceOption {
+	return func(service *Service) {
+		service.utmPresets = presets
+	}
+}
+
+// WithPolicy sets policy of long urls. By default policy is created from config without domains list.
+func WithPolicy(p *policy.Policy) ServiceOption {
+	return func(service *Service) {
+		service.policy = p
+	}
+}
+
+// WithURLChecker sets checker of malicious urls. By default urls aren't checked.
+func WithURLChecker(checker threat.URLChecker) ServiceOption {
+	return func(service *Service) {
+		service.checker = checker
+	}
+}
+
+// WithTakedowns sets storage of takedowns. By default takedowns are stored in memory.
+func WithTakedowns(takedowns storage.TakedownStorage) ServiceOption {
+	return func(service *Service) {
+		service.takedowns = takedowns
+	}
+}
+
+// WithReports sets storage of abuse reports. By default reports are stored in memory.
+func WithReports(reports storage.ReportStorage) ServiceOption {
+	return func(service *Service) {
+		service.reports = reports
+	}
+}
+
+// WithErrorPages sets templates of error pages of short links. By default built-in pages are used.
+func WithErrorPages(pages *ErrorPages) ServiceOption {
+	return func(service *Service) {
+		service.errorPages = pages
+	}
+}
+
+// WithClicks sets storage of link visits. By default visits are counted in memory.
+func WithClicks(clicks storage.ClickStorage) ServiceOption {
+	return func(service *Service) {
+		service.clicks = clicks
+	}
+}
+
+// WithIdempotency sets storage of responses of requests with idempotency keys. By default responses are stored in memory.
+func WithIdempotency(responses storage.IdempotencyStorage) ServiceOption {
+	return func(service *Service) {
+		service.idempotency = responses
+	}
+}
+
+// WithJobs sets storage of bulk shortening jobs. By default jobs are stored in memory.
+func WithJobs(jobs storage.JobStorage) ServiceOption {
+	return func(service *Service) {
+		service.jobs = jobs
+	}
+}
+
+// WithWebhooks sets storage of webhooks and their deliveries. By default webhooks are stored in memory.
+func WithWebhooks(webhooks storage.WebhookStorage) ServiceOption {
+	return func(service *Service) {
+		service.webhooks = webhooks
+	}
 }
 
 // NewService gets new handlers service.
-func NewService(cfg config.Config, s storage.Storage) *Service {
-	return &Service{
+func NewService(cfg config.Config, s storage.Storage, opts ...ServiceOption) *Service {
+	service := &Service{
 		cfg:     cfg,
 		storage: s,
+		quota:   ratelimit.NewQuota(cfg.DailyLinksQuota),
+		proxies: parseTrustedProxies(cfg.TrustedProxies),
+
+		idempotencyLocks: newKeyLocks(),
+		jobQueue:         newJobQueue(),
+
+		webhookEvents:      make(chan linkEvent, webhookEventsQueue),
+		clickSubscriptions: newClickSubscriptions(),
+		webhookWake:        make(chan struct{}, 1),
+		webhookClient:      newWebhookClient(cfg.WebhookTimeout.Duration, cfg.AllowPrivateDestinations),
+	}
+
+	for _, opt := range opts {
+		opt(service)
+	}
+
+	if service.utmPresets == nil {
+		service.utmPresets = storage.NewMapUTMPresets()
+		if presets, ok := s.(storage.UTMPresetStorage); ok {
+			service.utmPresets = presets
+		}
 	}
+
+	if service.policy == nil {
+		service.policy = policy.New(cfg, nil)
+	}
+
+	if service.takedowns == nil {
+		service.takedowns = storage.NewMapTakedowns()
+	}
+
+	if service.reports == nil {
+		service.reports = storage.NewMapReports()
+	}
+
+	if service.clicks == nil {
+		service.clicks = storage.NewMapClicks()
+	}
+
+	if service.idempotency == nil {
+		service.idempotency = storage.NewMapIdempotency()
+	}
+
+	if service.jobs == nil {
+		service.jobs = storage.NewMapJobs()
+	}
+
+	if service.webhooks == nil {
+		service.webhooks = storage.NewMapWebhooks()
+	}
+
+	if service.errorPages == nil {
+		// built-in pages have no errors.
+		service.errorPages, _ = NewErrorPages("")
+	}
+
+	return service
+}
+
+// checkBatch checks number of urls in batch and length of urls, which are sent by user.
+// It's checked before urls are built and normalized, so too large batch doesn't cost their checks.
+func (service *Service) checkBatch(urls ...string) error {
+	if service.cfg.MaxBatchLength > 0 && len(urls) > service.cfg.MaxBatchLength {
+		return ErrBatchTooLarge
+	}
+
+	if service.cfg.MaxURLLength <= 0 {
+		return nil
+	}
+
+	for _, url := range urls {
+		if len(url) > service.cfg.MaxURLLength {
+			return ErrURLTooLong
+		}
+	}
+
+	return nil
+}
+
+// checkOptions checks options of new links.
+func (service *Service) checkOptions(opts ...storage.LinkOptions) error {
+	for _, o := range opts {
+		if err := o.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkThreats checks new urls with url checker.
+func (service *Service) checkThreats(ctx context.Context, urls ...string) error {
+	if service.checker == nil {
+		return nil
+	}
+
+	for _, url := range urls {
+		verdict, err := service.checker.CheckURL(ctx, url)
+		if err != nil {
+			return err
+		}
+
+		if verdict.Malicious {
+			return fmt.Errorf("%w: %s", threat.ErrMaliciousURL, verdict.Reason)
+		}
+	}
+
+	return nil
+}
+
+// normalizeURL gets canonical form of long url, which is stored and used to find duplicates.
+func (service *Service) normalizeURL(long string) (string, error) {
+	if service.cfg.DisableURLNormalization {
+		return long, nil
+	}
+
+	return urlnorm.Normalize(long, urlnorm.Rules{
+		SortQuery:    service.cfg.NormalizeSortQuery,
+		DropFragment: service.cfg.NormalizeDropFragment,
+	})
+}
+
+// updateLink sets options and original url of created link.
+// Existing links, which user doesn't own, aren't changed. Original url of link is set once, so the first spelling is kept.
+func (service *Service) updateLink(ctx context.Context, userID string, want storage.Link) error {
+	setOriginal := want.OriginalURL != want.URL
+	if want.Options.IsZero() && !setOriginal {
+		return nil
+	}
+
+	link, err := service.storage.GetLink(ctx, want.ID)
+	if err != nil {
+		return err
+	}
+
+	if link.UserID != userID {
+		return nil
+	}
+
+	if !want.Options.IsZero() {
+		if err := service.storage.SetLinkOptions(ctx, want.ID, want.Options); err != nil {
+			return err
+		}
+	}
+
+	if setOriginal && link.OriginalURL == "" {
+		return service.storage.SetOriginalURL(ctx, want.ID, want.OriginalURL)
+	}
+
+	return nil
+}
+
+// takeQuota reserves n links of user's daily quota.
+// Reserved links, which aren't created, are returned by refundQuota.
+func (service *Service) takeQuota(userID string, n int) error {
+	if ok, retry := service.quota.Take(userID, n); !ok {
+		return &RateLimitError{Reason: "daily links quota exceeded", RetryAfter: retry}
+	}
+	return nil
+}
+
+// refundQuota returns n reserved links of user's daily quota, if storage hasn't created all of them.
+// Storage doesn't tell, which links of batch already existed, so links created before start are counted as existing.
+func (service *Service) refundQuota(ctx context.Context, userID string, start time.Time, n int, ids []string, err error) {
+	if err == nil {
+		return
+	}
+
+	if !errors.Is(err, storage.Err409) {
+		service.quota.Refund(userID, n)
+		return
+	}
+
+	created := make(map[string]bool)
+	for _, id := range ids {
+		if created[id] {
+			continue
+		}
+
+		link, getErr := service.storage.GetLink(ctx, id)
+		created[id] = getErr == nil && !link.CreatedAt.Before(start)
+	}
+
+	for _, ok := range created {
+		if ok {
+			n--
+		}
+	}
+	service.quota.Refund(userID, n)
 }
 
 // CheckPing checks if storage works.
-func (service *Service) CheckPing() error {
-	return service.storage.Ping()
+func (service *Service) CheckPing(ctx context.Context) error {
+	return service.storage.Ping(ctx)
 }
 
 // PingHandler checks if storage works.
 func PingHandler(service *Service) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		err := service.CheckPing()
+		err := service.CheckPing(r.Context())
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeError(w, r, &Error{Code: CodeUnavailable, Message: "storage is unavailable", Err: err})
+			return
 		}
 		w.WriteHeader(http.StatusOK)
 	}
 }
 
-// URLErrorHandler returns error, if someone gets wrong page.
+// readBody reads request body. If body is empty or too large, writes error and returns false.
+func readBody(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	resBody, err := io.ReadAll(r.Body)
+	defer r.Body.Close()
+
+	if errors.Is(err, ErrBodyTooLarge) {
+		writeError(w, r, err)
+		return nil, false
+	}
+
+	if err != nil || len(resBody) == 0 {
+		writeError(w, r, &Error{Code: CodeInvalidBody, Message: "wrong body", Err: err})
+		return nil, false
+	}
+
+	return resBody, true
+}
+
+// URLErrorHandler returns error, if someone calls page with wrong method.
 func URLErrorHandler(w http.ResponseWriter, r *http.Request) {
-	http.Error(w, "wrong method", http.StatusBadRequest)
+	writeError(w, r, NewError(CodeMethodNotAllowed, "wrong method"))
+}
+
+// HTTPSRedirectHandler redirects plain HTTP requests to the same path on HTTPS host of base URL.
+// Host is taken from config, not from request, so Host header can't redirect users to other site.
+func HTTPSRedirectHandler(cfg config.Config) http.HandlerFunc {
+	host := ""
+	if baseURL, err := url.Parse(cfg.BaseURL); err == nil {
+		host = baseURL.Host
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		target := "https://" + host + r.URL.RequestURI()
+		if host == "" {
+			target = "https://" + r.Host + r.URL.RequestURI()
+		}
+
+		code := http.StatusPermanentRedirect
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			code = http.StatusMovedPermanently
+		}
+		http.Redirect(w, r, target, code)
+	}
 }
 
 // DeleteURL deletes link from storage.
 // You can delete link, only if you've created it.
-func (service *Service) DeleteURL(userID string, urls []string) error {
-	return service.storage.Delete(userID, urls...)
+func (service *Service) DeleteURL(ctx context.Context, userID string, urls []string) error {
+	if service.cfg.MaxBatchLength > 0 && len(urls) > service.cfg.MaxBatchLength {
+		return ErrBatchTooLarge
+	}
+
+	if err := service.storage.Delete(ctx, userID, urls...); err != nil {
+		return err
+	}
+
+	for _, id := range urls {
+		service.emitLinkEvent(linkEvent{Type: storage.EventLinkDeleted, UserID: userID, LinkID: id})
+	}
+	return nil
 }
 
 // DeleteHandler deletes link from storage.
 func DeleteHandler(service *Service) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		userCookie, err := r.Cookie("userID")
+		userID, err := requestUser(r)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeError(w, r, err)
 			return
 		}
-		userID := userCookie.Value
 
-		resBody, err := io.ReadAll(r.Body)
-		defer r.Body.Close()
-		if err != nil || string(resBody) == "" {
-			http.Error(w, "wrong body", http.StatusBadRequest)
+		resBody, ok := readBody(w, r)
+		if !ok {
 			return
 		}
 
 		var toDelete []string
 		err = json.Unmarshal(resBody, &toDelete)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			writeError(w, r, invalidBody(err))
 			return
 		}
 
-		err = service.DeleteURL(userID, toDelete)
-
+		err = service.DeleteURL(r.Context(), userID, toDelete)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeError(w, r, err)
 			return
 		}
 		w.WriteHeader(http.StatusAccepted)
@@ -88,40 +433,91 @@ func DeleteHandler(service *Service) http.HandlerFunc {
 }
 
 // ShortURLs shorts many urls.
-func (service *Service) ShortURLs(userID string, urlsJSON []storage.BatchJSON) ([]storage.BatchJSON, error) {
+func (service *Service) ShortURLs(ctx context.Context, userID string, urlsJSON []storage.BatchJSON) ([]storage.BatchJSON, error) {
+	raw := make([]string, len(urlsJSON))
+	for i := range urlsJSON {
+		raw[i] = urlsJSON[i].URL
+	}
+
+	if err := service.checkBatch(raw...); err != nil {
+		return nil, err
+	}
+
 	urls := make([]string, len(urlsJSON))
+	originals := make([]string, len(urlsJSON))
+	opts := make([]storage.LinkOptions, len(urlsJSON))
 	resultJSON := make([]storage.BatchJSON, len(urlsJSON))
 
 	for i := range urlsJSON {
-		urls[i] = urlsJSON[i].URL
+		long, err := service.buildURL(ctx, userID, urlsJSON[i].URL, urlsJSON[i].UTMRequest)
+		if err != nil {
+			return nil, err
+		}
+		canonical, err := service.normalizeURL(long)
+		if err != nil {
+			return nil, err
+		}
+		if err := service.policy.Check(canonical); err != nil {
+			return nil, err
+		}
+		urls[i] = canonical
+		originals[i] = long
+		opts[i] = urlsJSON[i].LinkOptions
 	}
 
-	result, err := service.storage.CreateShort(userID, urls...)
+	if err := service.checkOptions(opts...); err != nil {
+		return nil, err
+	}
+
+	if err := service.checkThreats(ctx, urls...); err != nil {
+		return nil, err
+	}
+
+	if err := service.takeQuota(userID, len(urls)); err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	result, err := service.storage.CreateShort(ctx, userID, urls...)
+	service.refundQuota(ctx, userID, start, len(urls), result, err)
 	if err != nil && err != storage.Err409 {
 		return nil, err
 	}
 
+	for i, id := range result {
+		link := storage.Link{ID: id, URL: urls[i], OriginalURL: originals[i], Options: opts[i]}
+		if setErr := service.updateLink(ctx, userID, link); setErr != nil {
+			return nil, setErr
+		}
+	}
+
 	for i, v := range urlsJSON {
 		resultJSON[i] = storage.BatchJSON{CorrelationID: v.CorrelationID, ShortURL: service.cfg.BaseURL + "/" + result[i]}
 	}
 
+	// if some urls are already shortened, only links created by this call are new.
+	var since time.Time
+	if err != nil {
+		since = start
+	}
+	for _, id := range result {
+		service.emitLinkEvent(linkEvent{Type: storage.EventLinkCreated, UserID: userID, LinkID: id, Since: since})
+	}
+
 	return resultJSON, err
 }
 
 // URLBatchHandler shortens batch of urls in single request.
 func URLBatchHandler(service *Service) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		userCookie, err := r.Cookie("userID")
+		userID, err := requestUser(r)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeError(w, r, err)
 			return
 		}
-		userID := userCookie.Value
 
-		resBody, err := io.ReadAll(r.Body)
-		defer r.Body.Close()
-		if err != nil || string(resBody) == "" {
-			http.Error(w, "wrong body", http.StatusBadRequest)
+		resBody, ok := readBody(w, r)
+		if !ok {
 			return
 		}
 
@@ -130,20 +526,19 @@ func URLBatchHandler(service *Service) http.HandlerFunc {
 		err = json.Unmarshal(resBody, &reqURLs)
 
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			writeError(w, r, invalidBody(err))
 			return
 		}
 
-		respURLs, err := service.ShortURLs(userID, reqURLs)
-
+		respURLs, err := service.ShortURLs(r.Context(), userID, reqURLs)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeError(w, r, err)
 			return
 		}
 
 		b, err := json.Marshal(respURLs)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeError(w, r, err)
 			return
 		}
 
@@ -154,23 +549,23 @@ func URLBatchHandler(service *Service) http.HandlerFunc {
 }
 
 // GetHistory gets history of your urls.
-func (service *Service) GetHistory(userID string) ([]storage.LinkJSON, error) {
-	return service.storage.GetHistory(userID)
+func (service *Service) GetHistory(ctx context.Context, userID string) ([]storage.LinkJSON, error) {
+	return service.storage.GetHistory(ctx, userID)
 }
 
 // URLHistoryHandler gets history of your urls.
 func URLHistoryHandler(service *Service) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		userCookie, err := r.Cookie("userID")
+		userID, err := requestUser(r)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			writeError(w, r, err)
 			return
 		}
-		userID := userCookie.Value
 
-		history, err := service.GetHistory(userID)
+		history, err := service.GetHistory(r.Context(), userID)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeError(w, r, err)
+			return
 		}
 
 		if len(history) == 0 {
@@ -180,70 +575,148 @@ func URLHistoryHandler(service *Service) http.HandlerFunc {
 
 		data, err := json.Marshal(history)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeError(w, r, err)
+			return
 		}
 		w.Header().Add("Content-Type", "application/json")
 		w.Write(data)
 	}
 }
 
-// GetLongURL gets long url.
-func (service *Service) GetLongURL(id string) (string, error) {
-	return service.storage.GetLong(id)
+// GetLongURL gets long url. It returns *TakedownError, if link is taken down, and ErrLinkExpired, if link is expired.
+func (service *Service) GetLongURL(ctx context.Context, id string) (string, error) {
+	link, err := service.getActiveLink(ctx, id)
+	return link.URL, err
+}
+
+// getActiveLink gets link, which isn't expired and isn't taken down.
+func (service *Service) getActiveLink(ctx context.Context, id string) (storage.Link, error) {
+	link, err := service.storage.GetLink(ctx, id)
+	if err != nil {
+		return link, err
+	}
+
+	if link.Options.IsExpired(time.Now()) {
+		return storage.Link{}, ErrLinkExpired
+	}
+
+	if err := service.checkTakedown(ctx, id, link.URL); err != nil {
+		return storage.Link{}, err
+	}
+	return link, nil
 }
 
 // URLGetHandler sends person to page, which url was shortened.
+// It answers GET and HEAD requests with status code and cache headers of link.
+// On /{id}/* route path after ID is forwarded to long url, if link allows it.
+// With preview=1 query parameter, or if link or config requires it, preview page is shown instead of redirect.
+// GET requests, which are redirected, are counted as visits of link.
 func URLGetHandler(service *Service) http.HandlerFunc {
+	return service.redirectHandler(false)
+}
+
+// PreviewHandler shows preview page of link with its destination, title and creation date.
+func PreviewHandler(service *Service) http.HandlerFunc {
+	return service.redirectHandler(true)
+}
+
+// redirectHandler gets handler of short link, which always shows preview page, if alwaysPreview is set.
+func (service *Service) redirectHandler(alwaysPreview bool) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		id := chi.URLParam(r, "id")
 		if id == "" {
-			http.Error(w, "missing id parameter", http.StatusBadRequest)
+			writeError(w, r, NewError(CodeInvalidRequest, "missing id parameter"))
 			return
 		}
-		url, err := service.GetLongURL(id)
 
-		if errors.Is(err, storage.Err410) {
-			http.Error(w, "link is deleted", http.StatusGone)
-			return
-		}
+		query := r.URL.Query()
+		preview := isPreviewRequest(query) || alwaysPreview
 
-		if errors.Is(err, storage.Err404) {
-			http.Error(w, "not found", http.StatusNotFound)
+		redirect, err := service.GetRedirect(r.Context(), id, redirectSuffix(r), query)
+
+		if page, ok := linkErrorPage(id, err); ok {
+			service.writeLinkError(w, r, page, err)
 			return
 		}
 
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeError(w, r, err)
 			return
 		}
 
-		w.Header().Set("Location", url)
-		w.WriteHeader(http.StatusTemporaryRedirect)
+		redirect.Preview = redirect.Preview || preview
+		if r.Method == http.MethodGet && !redirect.Preview && redirect.Warning == "" {
+			service.countClick(r.Context(), id)
+			service.emitClickEvent(r.Context(), redirect.UserID, id)
+		}
+		service.writeRedirect(w, r, redirect)
 	}
 }
 
 // ShortSingleURL shorts single url.
-func (service *Service) ShortSingleURL(userID string, url string) (string, error) {
-	result, err := service.storage.CreateShort(userID, url)
+func (service *Service) ShortSingleURL(ctx context.Context, userID string, req storage.RequestJSON) (string, error) {
+	if err := service.checkBatch(req.URL); err != nil {
+		return "", err
+	}
+
+	original, err := service.buildURL(ctx, userID, req.URL, req.UTMRequest)
+	if err != nil {
+		return "", err
+	}
+
+	url, err := service.normalizeURL(original)
+	if err != nil {
+		return "", err
+	}
+
+	if err := service.policy.Check(url); err != nil {
+		return "", err
+	}
+
+	opts := req.LinkOptions
+	if err := service.checkOptions(opts); err != nil {
+		return "", err
+	}
+
+	if err := service.checkThreats(ctx, url); err != nil {
+		return "", err
+	}
+
+	if err := service.takeQuota(userID, 1); err != nil {
+		return "", err
+	}
+
+	result, err := service.storage.CreateShort(ctx, userID, url)
+	if err != nil {
+		// existing link isn't new, failed link isn't created.
+		service.quota.Refund(userID, 1)
+	}
 	if len(result) == 0 {
 		return "", err
 	}
+
+	link := storage.Link{ID: result[0], URL: url, OriginalURL: original, Options: opts}
+	if setErr := service.updateLink(ctx, userID, link); setErr != nil {
+		return "", setErr
+	}
+
+	if err == nil {
+		service.emitLinkEvent(linkEvent{Type: storage.EventLinkCreated, UserID: userID, LinkID: result[0]})
+	}
+
 	return result[0], err
 }
 
 // URLPostHandler creates new short URL.
 func URLPostHandler(service *Service) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		userCookie, err := r.Cookie("userID")
+		userID, err := requestUser(r)
 		if err != nil {
-			http.Error(w, err.Error(), 400)
+			writeError(w, r, err)
 			return
 		}
-		userID := userCookie.Value
-		resBody, err := io.ReadAll(r.Body)
-		defer r.Body.Close()
-		if err != nil || string(resBody) == "" {
-			http.Error(w, "wrong body", http.StatusBadRequest)
+		resBody, ok := readBody(w, r)
+		if !ok {
 			return
 		}
 		switch r.Header.Get("Content-Type") {
@@ -252,20 +725,19 @@ func URLPostHandler(service *Service) http.HandlerFunc {
 				var reqJSON storage.RequestJSON
 				err := json.Unmarshal(resBody, &reqJSON)
 				if err != nil {
-					http.Error(w, err.Error(), http.StatusBadRequest)
+					writeError(w, r, invalidBody(err))
 					return
 				}
-				res, err2 := service.ShortSingleURL(userID, reqJSON.URL)
-
+				res, err2 := service.ShortSingleURL(r.Context(), userID, reqJSON)
 				if err2 != nil && !errors.Is(err2, storage.Err409) {
-					http.Error(w, err2.Error(), http.StatusBadRequest)
+					writeError(w, r, err2)
 					return
 				}
 
 				respJSON, err := json.Marshal(storage.ResponseJSON{Result: service.cfg.BaseURL + "/" + res})
 
 				if err != nil {
-					http.Error(w, err.Error(), http.StatusInternalServerError)
+					writeError(w, r, err)
 					return
 				}
 
@@ -279,9 +751,20 @@ func URLPostHandler(service *Service) http.HandlerFunc {
 			}
 		default:
 			{
-				res, err2 := service.ShortSingleURL(userID, string(resBody))
+				opts, err := queryLinkOptions(r)
+				if err != nil {
+					writeError(w, r, err)
+					return
+				}
+
+				res, err2 := service.ShortSingleURL(r.Context(), userID, storage.RequestJSON{
+					URL:         string(resBody),
+					LinkOptions: opts,
+					UTMRequest:  queryUTM(r),
+				})
+
 				if err2 != nil && !errors.Is(err2, storage.Err409) {
-					http.Error(w, err2.Error(), 400)
+					writeError(w, r, err2)
 					return
 				}
 				w.Header().Set("Content-Type", "text/plain; charset=utf-8")
@@ -299,23 +782,23 @@ func URLPostHandler(service *Service) http.HandlerFunc {
 }
 
 // GetStatistic returns total urls and users.
-func (service *Service) GetStatistic() (storage.Statistic, error) {
-	return service.storage.GetStatistic()
+func (service *Service) GetStatistic(ctx context.Context) (storage.Statistic, error) {
+	return service.storage.GetStatistic(ctx)
 }
 
 // StatisticHandler returns total urls and users.
 func StatisticHandler(service *Service) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		stats, err := service.GetStatistic()
+		stats, err := service.GetStatistic(r.Context())
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeError(w, r, err)
 			return
 		}
 
 		data, err := json.Marshal(stats)
 
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeError(w, r, err)
 			return
 		}
 
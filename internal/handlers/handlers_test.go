@@ -23,11 +23,37 @@ func TestURLErrorHandler(t *testing.T) {
 	h := http.HandlerFunc(URLErrorHandler)
 	h.ServeHTTP(w, request)
 	res := w.Result()
-	assert.Equal(t, 400, res.StatusCode)
+	assert.Equal(t, http.StatusMethodNotAllowed, res.StatusCode)
+	assert.Equal(t, ProblemContentType, res.Header.Get("Content-Type"))
 	io.Copy(io.Discard, res.Body)
 	defer res.Body.Close()
 }
 
+func TestHTTPSRedirectHandler(t *testing.T) {
+	cfg := config.GetTestConfig()
+	cfg.BaseURL = "https://short.ru:8443"
+	h := HTTPSRedirectHandler(cfg)
+
+	tests := []struct {
+		method string
+		code   int
+	}{
+		{method: http.MethodGet, code: http.StatusMovedPermanently},
+		{method: http.MethodPost, code: http.StatusPermanentRedirect},
+	}
+
+	for _, tc := range tests {
+		request := httptest.NewRequest(tc.method, "http://evil.com/api/user/urls?page=1", nil)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, request)
+		res := w.Result()
+		res.Body.Close()
+
+		assert.Equal(t, tc.code, res.StatusCode)
+		assert.Equal(t, "https://short.ru:8443/api/user/urls?page=1", res.Header.Get("Location"))
+	}
+}
+
 func TestURLPostHandler(t *testing.T) {
 	type want struct {
 		code     int
@@ -57,7 +83,7 @@ func TestURLPostHandler(t *testing.T) {
 			"don't send body",
 			&storage.MapStorage{Locations: map[string]string{"1": "https://dzen.ru"}, Mutex: &sync.Mutex{}, Users: map[string][]string{"123456": {"2"}}},
 			"",
-			want{400, "wrong body\n", &storage.MapStorage{Locations: map[string]string{"1": "https://dzen.ru"}, Mutex: &sync.Mutex{}, Users: map[string][]string{"123456": {"2"}}}, true},
+			want{400, "wrong body", &storage.MapStorage{Locations: map[string]string{"1": "https://dzen.ru"}, Mutex: &sync.Mutex{}, Users: map[string][]string{"123456": {"2"}}}, true},
 		},
 	}
 
@@ -118,7 +144,7 @@ func TestURLPostJSONHandler(t *testing.T) {
 			"don't send body",
 			&storage.MapStorage{Locations: map[string]string{"1": "https://dzen.ru"}, Mutex: &sync.Mutex{}, Users: map[string][]string{"123456": {"2"}}},
 			"",
-			want{400, "wrong body\n", &storage.MapStorage{Locations: map[string]string{"1": "https://dzen.ru"}, Mutex: &sync.Mutex{}, Users: map[string][]string{"123456": {"2"}}}, true},
+			want{400, "wrong body", &storage.MapStorage{Locations: map[string]string{"1": "https://dzen.ru"}, Mutex: &sync.Mutex{}, Users: map[string][]string{"123456": {"2"}}}, true},
 		},
 	}
 
@@ -170,13 +196,13 @@ func TestURLGetHandler(t *testing.T) {
 			"get link which NOT in storage",
 			&storage.MapStorage{Locations: map[string]string{"1": "https://dzen.ru"}, Mutex: &sync.Mutex{}},
 			"2",
-			want{404, "not found\n", true},
+			want{404, `"code":"not_found"`, true},
 		},
 		{
 			"don't send ID parameter",
 			&storage.MapStorage{Locations: map[string]string{"1": "https://dzen.ru"}, Mutex: &sync.Mutex{}},
 			"",
-			want{400, "missing id parameter\n", true},
+			want{400, `"detail":"missing id parameter"`, true},
 		},
 	}
 
@@ -198,7 +224,7 @@ func TestURLGetHandler(t *testing.T) {
 			defer res.Body.Close()
 			assert.NoError(t, err)
 			if tc.want.error {
-				assert.Equal(t, tc.want.response, string(resBody))
+				assert.Contains(t, string(resBody), tc.want.response)
 			}
 
 		})
@@ -256,7 +282,7 @@ func TestService_GetStatistic(t *testing.T) {
 	}, check)
 
 	// adding url to storage.
-	_, err = s.CreateShort("user12", "https://yandex.ru")
+	_, err = s.CreateShort(context.Background(), "user12", "https://yandex.ru")
 	assert.NoError(t, err)
 
 	w = httptest.NewRecorder()
@@ -293,3 +319,76 @@ func TestGenerateRandom(t *testing.T) {
 	assert.NoError(t, err, "Generate 0 length random bytes.")
 	assert.Len(t, res, 0, "Generate 0 length random bytes.")
 }
+
+func TestURLPostHandler_LongURL(t *testing.T) {
+	cfg := config.GetTestConfig()
+	cfg.MaxURLLength = config.GetDefaultConfig().MaxURLLength
+	s, err := storage.NewMapStorage(cfg)
+	assert.NoError(t, err)
+
+	// urls up to default limit are accepted, DB stores them in text column.
+	long := "https://yandex.ru/" + strings.Repeat("a", 300-len("https://yandex.ru/"))
+	request := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(long))
+	request.AddCookie(&http.Cookie{Name: "userID", Value: "user12"})
+	w := httptest.NewRecorder()
+	URLPostHandler(NewService(cfg, s)).ServeHTTP(w, request)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, long, s.Locations["1"])
+}
+
+func TestURLBatchHandler_Limits(t *testing.T) {
+	cfg := config.GetTestConfig()
+	cfg.MaxBatchLength = 2
+	cfg.MaxURLLength = 30
+	s, err := storage.NewMapStorage(cfg)
+	assert.NoError(t, err)
+
+	h := URLBatchHandler(NewService(cfg, s))
+
+	cases := []struct {
+		name string
+		body string
+		code int
+	}{
+		{
+			"batch within limits",
+			`[{"correlation_id": "1", "original_url": "https://yandex.ru"}, {"correlation_id": "2", "original_url": "https://google.com"}]`,
+			http.StatusCreated,
+		},
+		{
+			"too many urls",
+			`[{"correlation_id": "1", "original_url": "https://yandex.ru"}, {"correlation_id": "2", "original_url": "https://google.com"}, {"correlation_id": "3", "original_url": "https://youtube.com"}]`,
+			http.StatusRequestEntityTooLarge,
+		},
+		{
+			"too long url",
+			`[{"correlation_id": "1", "original_url": "https://yandex.ru/very/long/path/to/page"}]`,
+			http.StatusBadRequest,
+		},
+		{
+			// batch size is checked before urls.
+			"too many invalid urls",
+			`[{"correlation_id": "1", "original_url": "yandex"}, {"correlation_id": "2", "original_url": "google"}, {"correlation_id": "3", "original_url": "youtube"}]`,
+			http.StatusRequestEntityTooLarge,
+		},
+		{
+			// url, which is sent, is checked, though its canonical form is shorter.
+			"too long raw url",
+			`[{"correlation_id": "1", "original_url": "HTTPS://YANDEX.RU:443/a/../b/./c"}]`,
+			http.StatusBadRequest,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodPost, "/api/shorten/batch", strings.NewReader(tc.body))
+			request.AddCookie(&http.Cookie{Name: "userID", Value: "user12"})
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, request)
+			assert.Equal(t, tc.code, w.Code)
+		})
+	}
+
+	// nothing except first batch was added.
+	assert.Len(t, s.Locations, 2)
+}
@@ -0,0 +1,188 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/size12/url-shortener/internal/logger"
+	pb "github.com/size12/url-shortener/pkg/grpc"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+// Readiness statuses.
+const (
+	StatusOK           = "ok"
+	StatusFailed       = "failed"
+	StatusNotReady     = "not ready"
+	StatusShuttingDown = "shutting down"
+)
+
+// readinessTimeout is max time of all readiness checks.
+const readinessTimeout = 2 * time.Second
+
+// watchInterval is how often readiness is checked for gRPC health watchers.
+var watchInterval = time.Second
+
+// ReadinessCheck checks if dependency of service (storage, queue and etc.) is ready to serve requests.
+type ReadinessCheck func(ctx context.Context) error
+
+// Readiness is result of readiness checks.
+type Readiness struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+// Health is liveness and readiness state of service. It's shared by HTTP probes and gRPC health service.
+type Health struct {
+	healthpb.UnimplementedHealthServer
+	*sync.RWMutex
+	checks       map[string]ReadinessCheck
+	shuttingDown bool
+}
+
+// NewHealth creates health state without readiness checks.
+func NewHealth() *Health {
+	return &Health{
+		RWMutex: &sync.RWMutex{},
+		checks:  make(map[string]ReadinessCheck),
+	}
+}
+
+// AddCheck adds named readiness check.
+func (h *Health) AddCheck(name string, check ReadinessCheck) {
+	h.Lock()
+	defer h.Unlock()
+	h.checks[name] = check
+}
+
+// Shutdown marks service as not ready, so traffic drains before graceful shutdown.
+func (h *Health) Shutdown() {
+	h.Lock()
+	defer h.Unlock()
+	h.shuttingDown = true
+}
+
+// Ready runs all readiness checks concurrently.
+func (h *Health) Ready(ctx context.Context) Readiness {
+	h.RLock()
+	shuttingDown := h.shuttingDown
+	checks := make(map[string]ReadinessCheck, len(h.checks))
+	for name, check := range h.checks {
+		checks[name] = check
+	}
+	h.RUnlock()
+
+	if shuttingDown {
+		return Readiness{Status: StatusShuttingDown}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, readinessTimeout)
+	defer cancel()
+
+	result := Readiness{Status: StatusOK, Checks: make(map[string]string, len(checks))}
+	mu := &sync.Mutex{}
+	wg := &sync.WaitGroup{}
+
+	for name, check := range checks {
+		wg.Add(1)
+		go func(name string, check ReadinessCheck) {
+			defer wg.Done()
+
+			err := check(ctx)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				logger.FromContext(ctx).Warn("Readiness check failed", zap.String("check", name), zap.Error(err))
+				result.Status = StatusNotReady
+				result.Checks[name] = StatusFailed
+				return
+			}
+			result.Checks[name] = StatusOK
+		}(name, check)
+	}
+
+	wg.Wait()
+	return result
+}
+
+// writeHealth writes health response as JSON.
+func writeHealth(w http.ResponseWriter, code int, readiness Readiness) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+
+	err := json.NewEncoder(w).Encode(readiness)
+	if err != nil {
+		logger.Log.Error("Failed write health response", zap.Error(err))
+	}
+}
+
+// LivenessHandler responds OK while process is alive. It doesn't check dependencies.
+func LivenessHandler(w http.ResponseWriter, r *http.Request) {
+	writeHealth(w, http.StatusOK, Readiness{Status: StatusOK})
+}
+
+// ReadinessHandler responds OK, if all readiness checks passed, and 503 otherwise or during shutdown.
+func ReadinessHandler(health *Health) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		readiness := health.Ready(r.Context())
+		if readiness.Status != StatusOK {
+			writeHealth(w, http.StatusServiceUnavailable, readiness)
+			return
+		}
+		writeHealth(w, http.StatusOK, readiness)
+	}
+}
+
+// servingStatus returns gRPC serving status of service. Empty service name means whole server.
+func (h *Health) servingStatus(ctx context.Context, service string) healthpb.HealthCheckResponse_ServingStatus {
+	if service != "" && service != pb.Shortener_ServiceDesc.ServiceName {
+		return healthpb.HealthCheckResponse_SERVICE_UNKNOWN
+	}
+
+	if h.Ready(ctx).Status != StatusOK {
+		return healthpb.HealthCheckResponse_NOT_SERVING
+	}
+	return healthpb.HealthCheckResponse_SERVING
+}
+
+// Check implements grpc.health.v1 Check with readiness state.
+func (h *Health) Check(ctx context.Context, in *healthpb.HealthCheckRequest) (*healthpb.HealthCheckResponse, error) {
+	servingStatus := h.servingStatus(ctx, in.GetService())
+	if servingStatus == healthpb.HealthCheckResponse_SERVICE_UNKNOWN {
+		return nil, status.Error(codes.NotFound, "Unknown service.")
+	}
+	return &healthpb.HealthCheckResponse{Status: servingStatus}, nil
+}
+
+// Watch implements grpc.health.v1 Watch. It sends current status and then every its change.
+func (h *Health) Watch(in *healthpb.HealthCheckRequest, stream healthpb.Health_WatchServer) error {
+	ctx := stream.Context()
+	ticker := time.NewTicker(watchInterval)
+	defer ticker.Stop()
+
+	last := healthpb.HealthCheckResponse_ServingStatus(-1)
+	for {
+		servingStatus := h.servingStatus(ctx, in.GetService())
+		if servingStatus != last {
+			err := stream.Send(&healthpb.HealthCheckResponse{Status: servingStatus})
+			if err != nil {
+				return err
+			}
+			last = servingStatus
+		}
+
+		select {
+		case <-ctx.Done():
+			return status.FromContextError(ctx.Err()).Err()
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/size12/url-shortener/internal/config"
+	"github.com/size12/url-shortener/internal/storage"
+	pb "github.com/size12/url-shortener/pkg/grpc"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+func TestLivenessHandler(t *testing.T) {
+	request := httptest.NewRequest(http.MethodGet, "/healthz", nil)
+	w := httptest.NewRecorder()
+	LivenessHandler(w, request)
+
+	res := w.Result()
+	defer res.Body.Close()
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, "application/json", res.Header.Get("Content-Type"))
+}
+
+func TestReadinessHandler(t *testing.T) {
+	var storageErr error
+
+	health := NewHealth()
+	health.AddCheck("storage", func(ctx context.Context) error { return storageErr })
+	health.AddCheck("queue", func(ctx context.Context) error { return nil })
+
+	tests := []struct {
+		name      string
+		prepare   func()
+		code      int
+		readiness Readiness
+	}{
+		{
+			name:      "ready",
+			prepare:   func() {},
+			code:      http.StatusOK,
+			readiness: Readiness{Status: StatusOK, Checks: map[string]string{"storage": StatusOK, "queue": StatusOK}},
+		},
+		{
+			name:      "storage failed",
+			prepare:   func() { storageErr = errors.New("failed ping DB") },
+			code:      http.StatusServiceUnavailable,
+			readiness: Readiness{Status: StatusNotReady, Checks: map[string]string{"storage": StatusFailed, "queue": StatusOK}},
+		},
+		{
+			name: "shutting down",
+			prepare: func() {
+				storageErr = nil
+				health.Shutdown()
+			},
+			code:      http.StatusServiceUnavailable,
+			readiness: Readiness{Status: StatusShuttingDown},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.prepare()
+
+			request := httptest.NewRequest(http.MethodGet, "/readyz", nil)
+			w := httptest.NewRecorder()
+			ReadinessHandler(health)(w, request)
+
+			res := w.Result()
+			defer res.Body.Close()
+			assert.Equal(t, tc.code, res.StatusCode)
+
+			var readiness Readiness
+			assert.NoError(t, json.NewDecoder(res.Body).Decode(&readiness))
+			assert.Equal(t, tc.readiness, readiness)
+		})
+	}
+}
+
+func TestService_CheckBacklog(t *testing.T) {
+	cfg := config.GetTestConfig()
+	cfg.MaxQueueBacklog = 2
+	service := NewService(cfg, nil)
+
+	health := NewHealth()
+	health.AddCheck("job queue", service.CheckJobBacklog)
+	health.AddCheck("webhook queue", service.CheckWebhookBacklog)
+	assert.Equal(t, StatusOK, health.Ready(context.Background()).Status)
+
+	for i := int64(1); i <= 3; i++ {
+		service.jobQueue.push(i)
+		service.emitLinkEvent(linkEvent{Type: storage.EventLinkCreated, UserID: "user12", LinkID: "1"})
+	}
+	assert.Equal(t, Readiness{Status: StatusNotReady, Checks: map[string]string{"job queue": StatusFailed, "webhook queue": StatusFailed}},
+		health.Ready(context.Background()))
+
+	// backlog is drained.
+	service.jobQueue.pop()
+	<-service.webhookEvents
+	assert.Equal(t, StatusOK, health.Ready(context.Background()).Status)
+
+	// zero threshold disables check.
+	service.cfg.MaxQueueBacklog = 0
+	service.jobQueue.push(4)
+	service.jobQueue.push(5)
+	assert.NoError(t, service.CheckJobBacklog(context.Background()))
+}
+
+func TestHealth_Check(t *testing.T) {
+	health := NewHealth()
+	health.AddCheck("storage", func(ctx context.Context) error { return nil })
+
+	for _, service := range []string{"", pb.Shortener_ServiceDesc.ServiceName} {
+		resp, err := health.Check(context.Background(), &healthpb.HealthCheckRequest{Service: service})
+		assert.NoError(t, err)
+		assert.Equal(t, healthpb.HealthCheckResponse_SERVING, resp.Status)
+	}
+
+	_, err := health.Check(context.Background(), &healthpb.HealthCheckRequest{Service: "unknown"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	health.Shutdown()
+	resp, err := health.Check(context.Background(), &healthpb.HealthCheckRequest{})
+	assert.NoError(t, err)
+	assert.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, resp.Status)
+}
+
+// watchStream is fake gRPC health watch stream.
+type watchStream struct {
+	grpc.ServerStream
+	ctx       context.Context
+	responses chan *healthpb.HealthCheckResponse
+}
+
+func (s *watchStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *watchStream) Send(resp *healthpb.HealthCheckResponse) error {
+	s.responses <- resp
+	return nil
+}
+
+func TestHealth_Watch(t *testing.T) {
+	watchInterval = time.Millisecond
+	defer func() { watchInterval = time.Second }()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stream := &watchStream{ctx: ctx, responses: make(chan *healthpb.HealthCheckResponse, 1)}
+
+	health := NewHealth()
+	done := make(chan error)
+	go func() {
+		done <- health.Watch(&healthpb.HealthCheckRequest{}, stream)
+	}()
+
+	// current status is sent immediately and then on change.
+	assert.Equal(t, healthpb.HealthCheckResponse_SERVING, (<-stream.responses).Status)
+	health.Shutdown()
+	assert.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, (<-stream.responses).Status)
+
+	cancel()
+	assert.Equal(t, codes.Canceled, status.Code(<-done))
+}
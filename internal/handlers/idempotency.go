@@ -0,0 +1,364 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/size12/url-shortener/internal/logger"
+	"github.com/size12/url-shortener/internal/storage"
+	pb "github.com/size12/url-shortener/pkg/grpc"
+	"go.uber.org/zap"
+	spb "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+// IdempotencyKeyHeader is header with idempotency key of create request.
+// Retry of request with the same key gets response of the first request instead of creating links again.
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// IdempotentReplayedHeader is set on responses, which are replayed.
+const IdempotentReplayedHeader = "Idempotent-Replayed"
+
+// idempotencyKeyMetadata is gRPC metadata key with idempotency key.
+const idempotencyKeyMetadata = "idempotency-key"
+
+// maxIdempotencyKeyLength is max length of idempotency key.
+const maxIdempotencyKeyLength = 255
+
+// Errors of idempotency keys.
+var (
+	ErrIdempotencyKeyTooLong = errors.New("idempotency key must be at most 255 characters")
+	ErrIdempotencyKeyInUse   = errors.New("request with the same idempotency key is in progress")
+	ErrIdempotencyKeyReused  = errors.New("idempotency key is already used for other request")
+)
+
+// grpcIdempotentMethods are gRPC methods, which accept idempotency key.
+var grpcIdempotentMethods = map[string]bool{
+	pb.Shortener_CreateShort_FullMethodName: true,
+	pb.Shortener_BatchShort_FullMethodName:  true,
+}
+
+// keyLocks are idempotency keys of requests in progress.
+type keyLocks struct {
+	keys map[string]struct{}
+	*sync.Mutex
+}
+
+// newKeyLocks creates empty key locks.
+func newKeyLocks() *keyLocks {
+	return &keyLocks{keys: make(map[string]struct{}), Mutex: &sync.Mutex{}}
+}
+
+// lock locks key. It returns false, if key is already locked.
+func (l *keyLocks) lock(key string) bool {
+	l.Lock()
+	defer l.Unlock()
+
+	if _, ok := l.keys[key]; ok {
+		return false
+	}
+	l.keys[key] = struct{}{}
+	return true
+}
+
+// unlock unlocks key.
+func (l *keyLocks) unlock(key string) {
+	l.Lock()
+	defer l.Unlock()
+
+	delete(l.keys, key)
+}
+
+// fingerprint gets hash of request parts, which identifies request of idempotency key.
+func fingerprint(parts ...[]byte) string {
+	h := sha256.New()
+	for _, part := range parts {
+		h.Write(part)
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// bodyFingerprint is fingerprint of request with body, which is the same as fingerprint of parts and body.
+// Body is hashed while it's read, so large bodies aren't kept in memory.
+type bodyFingerprint struct {
+	hash hash.Hash
+	body io.Reader
+}
+
+// newBodyFingerprint starts fingerprint of request parts and body.
+func newBodyFingerprint(body io.Reader, parts ...[]byte) *bodyFingerprint {
+	h := sha256.New()
+	for _, part := range parts {
+		h.Write(part)
+		h.Write([]byte{0})
+	}
+	return &bodyFingerprint{hash: h, body: body}
+}
+
+// Read reads body and hashes it.
+func (f *bodyFingerprint) Read(p []byte) (int, error) {
+	n, err := f.body.Read(p)
+	f.hash.Write(p[:n])
+	return n, err
+}
+
+// sum reads rest of body and gets fingerprint. It must be called once.
+func (f *bodyFingerprint) sum() (string, error) {
+	if _, err := io.Copy(f.hash, f.body); err != nil {
+		if errors.Is(err, ErrBodyTooLarge) {
+			return "", err
+		}
+		return "", invalidBody(err)
+	}
+	f.hash.Write([]byte{0})
+	return hex.EncodeToString(f.hash.Sum(nil)), nil
+}
+
+// idempotent runs request once per user and idempotency key.
+// Stored response of the same request is returned instead of running it again, and replayed is true.
+// Response of run is stored only if it's ok, so requests, which failed temporarily, are run again on retry.
+// Fingerprint of request is got after run, so body of request can be hashed while it's read by run.
+func (service *Service) idempotent(ctx context.Context, userID, key string, requestFingerprint func() (string, error),
+	run func() (resp storage.IdempotentResponse, ok bool)) (resp storage.IdempotentResponse, replayed bool, err error) {
+	if len(key) > maxIdempotencyKeyLength {
+		return storage.IdempotentResponse{}, false, ErrIdempotencyKeyTooLong
+	}
+
+	lockKey := userID + "\x00" + key
+	if !service.idempotencyLocks.lock(lockKey) {
+		return storage.IdempotentResponse{}, false, ErrIdempotencyKeyInUse
+	}
+	defer service.idempotencyLocks.unlock(lockKey)
+
+	now := time.Now().UTC()
+	stored, err := service.idempotency.GetResponse(ctx, userID, key, now)
+	if err == nil {
+		fp, err := requestFingerprint()
+		if err != nil {
+			return storage.IdempotentResponse{}, false, err
+		}
+		if stored.Fingerprint != fp {
+			return storage.IdempotentResponse{}, false, ErrIdempotencyKeyReused
+		}
+		return stored, true, nil
+	}
+
+	if !errors.Is(err, storage.Err404) {
+		return storage.IdempotentResponse{}, false, err
+	}
+
+	resp, ok := run()
+	if !ok {
+		return resp, false, nil
+	}
+
+	fp, err := requestFingerprint()
+	if err != nil {
+		// response is sent, but it isn't stored, because request can't be identified.
+		logger.FromContext(ctx).Warn("Failed get fingerprint of idempotent request", zap.Error(err))
+		return resp, false, nil
+	}
+
+	resp.UserID, resp.Key, resp.Fingerprint = userID, key, fp
+	resp.ExpiresAt = now.Add(service.cfg.IdempotencyTTL.Duration)
+	if err := service.idempotency.SaveResponse(ctx, resp, now); err != nil {
+		// request is done, so its response is sent anyway.
+		logger.FromContext(ctx).Error("Failed save idempotent response", zap.Error(err))
+	}
+
+	return resp, false, nil
+}
+
+// isIdempotentStatus checks if HTTP response can be replayed. Server errors and rate limits are temporary.
+func isIdempotentStatus(code int) bool {
+	return code < http.StatusInternalServerError && code != http.StatusTooManyRequests
+}
+
+// IdempotencyMiddleware replays response of create request, which is retried with the same Idempotency-Key header.
+// Keys are per user, key of other request is rejected. Requests without key aren't changed.
+// Must be used after CookieMiddleware, so every request has user ID.
+func IdempotencyMiddleware(service *Service) func(handler http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(IdempotencyKeyHeader)
+			if key == "" || service.cfg.IdempotencyTTL.Duration <= 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			userID, err := requestUser(r)
+			if err != nil {
+				writeError(w, r, err)
+				return
+			}
+
+			// body is hashed while handler reads it, handler mustn't close it, because rest of body is hashed after.
+			body := r.Body
+			defer body.Close()
+			requestFingerprint := newBodyFingerprint(body, []byte(r.Method), []byte(r.URL.RequestURI()),
+				[]byte(r.Header.Get("Content-Type")))
+			r.Body = io.NopCloser(requestFingerprint)
+
+			resp, replayed, err := service.idempotent(r.Context(), userID, key, requestFingerprint.sum,
+				func() (storage.IdempotentResponse, bool) {
+					var recorded bytes.Buffer
+					ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+					ww.Tee(&recorded)
+
+					next.ServeHTTP(ww, r)
+
+					code := ww.Status()
+					if code == 0 {
+						code = http.StatusOK
+					}
+
+					return storage.IdempotentResponse{
+						Status:      code,
+						ContentType: w.Header().Get("Content-Type"),
+						Location:    w.Header().Get("Location"),
+						Body:        recorded.Bytes(),
+					}, isIdempotentStatus(code)
+				})
+
+			if err != nil {
+				writeError(w, r, err)
+				return
+			}
+
+			if replayed {
+				if resp.ContentType != "" {
+					w.Header().Set("Content-Type", resp.ContentType)
+				}
+				if resp.Location != "" {
+					w.Header().Set("Location", resp.Location)
+				}
+				w.Header().Set(IdempotentReplayedHeader, "true")
+				w.WriteHeader(resp.Status)
+				w.Write(resp.Body)
+			}
+		})
+	}
+}
+
+// isIdempotentCode checks if gRPC response can be replayed. Errors of server and limits are temporary.
+func isIdempotentCode(code codes.Code) bool {
+	switch code {
+	case codes.Unknown, codes.Internal, codes.Unavailable, codes.ResourceExhausted, codes.DeadlineExceeded,
+		codes.Canceled, codes.Aborted, codes.DataLoss:
+		return false
+	default:
+		return true
+	}
+}
+
+// grpcResponse gets stored response of gRPC method: message of successful response or status of error.
+func grpcResponse(resp interface{}, err error) (storage.IdempotentResponse, bool) {
+	st := status.Convert(err)
+	if !isIdempotentCode(st.Code()) {
+		return storage.IdempotentResponse{}, false
+	}
+
+	var message proto.Message = st.Proto()
+	if err == nil {
+		msg, ok := resp.(proto.Message)
+		if !ok {
+			return storage.IdempotentResponse{}, false
+		}
+
+		packed, packErr := anypb.New(msg)
+		if packErr != nil {
+			return storage.IdempotentResponse{}, false
+		}
+		message = packed
+	}
+
+	body, marshalErr := proto.Marshal(message)
+	if marshalErr != nil {
+		return storage.IdempotentResponse{}, false
+	}
+
+	return storage.IdempotentResponse{Status: int(st.Code()), Body: body}, true
+}
+
+// replayGRPC gets response or error of gRPC method from stored response.
+func replayGRPC(resp storage.IdempotentResponse) (interface{}, error) {
+	if codes.Code(resp.Status) != codes.OK {
+		var st spb.Status
+		if err := proto.Unmarshal(resp.Body, &st); err != nil {
+			return nil, err
+		}
+		return nil, status.FromProto(&st).Err()
+	}
+
+	var packed anypb.Any
+	if err := proto.Unmarshal(resp.Body, &packed); err != nil {
+		return nil, err
+	}
+	return packed.UnmarshalNew()
+}
+
+// IdempotencyInterceptor replays response of create method, which is retried with the same idempotency-key metadata.
+func (service *Service) IdempotencyInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if !grpcIdempotentMethods[info.FullMethod] || service.cfg.IdempotencyTTL.Duration <= 0 {
+		return handler(ctx, req)
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	if len(md.Get(idempotencyKeyMetadata)) == 0 {
+		return handler(ctx, req)
+	}
+	key := md.Get(idempotencyKeyMetadata)[0]
+
+	userID, err := metadataUser(ctx)
+	if err != nil {
+		return nil, grpcError(ctx, err)
+	}
+
+	message, ok := req.(proto.Message)
+	if !ok {
+		return handler(ctx, req)
+	}
+
+	data, err := proto.MarshalOptions{Deterministic: true}.Marshal(message)
+	if err != nil {
+		return nil, grpcError(ctx, err)
+	}
+
+	var result interface{}
+	var resultErr error
+	requestFingerprint := func() (string, error) {
+		return fingerprint([]byte(info.FullMethod), data), nil
+	}
+	resp, replayed, err := service.idempotent(ctx, userID, key, requestFingerprint,
+		func() (storage.IdempotentResponse, bool) {
+			result, resultErr = handler(ctx, req)
+			return grpcResponse(result, resultErr)
+		})
+
+	if err != nil {
+		return nil, grpcError(ctx, err)
+	}
+
+	if replayed {
+		grpc.SetHeader(ctx, metadata.Pairs(strings.ToLower(IdempotentReplayedHeader), "true"))
+		return replayGRPC(resp)
+	}
+
+	return result, resultErr
+}
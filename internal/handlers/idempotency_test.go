@@ -0,0 +1,209 @@
+package handlers
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/size12/url-shortener/internal/config"
+	"github.com/size12/url-shortener/internal/storage"
+	pb "github.com/size12/url-shortener/pkg/grpc"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// idempotencyRouter gets router with create routes, which accept idempotency keys.
+func idempotencyRouter(service *Service) *chi.Mux {
+	r := chi.NewRouter()
+	r.Group(func(r chi.Router) {
+		r.Use(IdempotencyMiddleware(service))
+		r.Post("/", URLPostHandler(service))
+		r.Post("/api/shorten/batch", URLBatchHandler(service))
+	})
+	return r
+}
+
+// postWithKey sends create request of user with idempotency key.
+func postWithKey(r http.Handler, target, contentType, body, key string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(http.MethodPost, target, strings.NewReader(body))
+	request.Header.Set("Content-Type", contentType)
+	request.Header.Set(IdempotencyKeyHeader, key)
+	request.AddCookie(&http.Cookie{Name: "userID", Value: "user12"})
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, request)
+	return w
+}
+
+func TestIdempotencyMiddleware(t *testing.T) {
+	cfg := config.GetTestConfig()
+	cfg.IdempotencyTTL = config.Duration{Duration: time.Hour}
+	s, err := storage.NewMapStorage(cfg)
+	assert.NoError(t, err)
+	service := NewService(cfg, s)
+	r := idempotencyRouter(service)
+
+	batch := `[{"correlation_id":"a","original_url":"https://yandex.ru"},{"correlation_id":"b","original_url":"https://google.com"}]`
+
+	first := postWithKey(r, "/api/shorten/batch", "application/json", batch, "job-1")
+	assert.Equal(t, http.StatusCreated, first.Code)
+	assert.Empty(t, first.Header().Get(IdempotentReplayedHeader))
+
+	// retry gets the same response, links aren't created again.
+	retry := postWithKey(r, "/api/shorten/batch", "application/json", batch, "job-1")
+	assert.Equal(t, first.Code, retry.Code)
+	assert.Equal(t, first.Body.String(), retry.Body.String())
+	assert.Equal(t, first.Header().Get("Content-Type"), retry.Header().Get("Content-Type"))
+	assert.Equal(t, "true", retry.Header().Get(IdempotentReplayedHeader))
+	assert.Len(t, s.Locations, 2)
+
+	// without key request is run again, so duplicates are conflicts.
+	w := postWithKey(r, "/", "text/plain", "https://yandex.ru", "")
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Empty(t, w.Header().Get(IdempotentReplayedHeader))
+
+	// key can't be used for other request.
+	w = postWithKey(r, "/", "text/plain", "https://dzen.ru", "job-1")
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.Contains(t, w.Body.String(), `"code":"idempotency_key_reused"`)
+
+	// errors of client are replayed too.
+	w = postWithKey(r, "/", "text/plain", "not url", "job-2")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = postWithKey(r, "/", "text/plain", "not url", "job-2")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "true", w.Header().Get(IdempotentReplayedHeader))
+
+	// key of request in progress.
+	assert.True(t, service.idempotencyLocks.lock("user12\x00job-3"))
+	w = postWithKey(r, "/", "text/plain", "https://dzen.ru", "job-3")
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Contains(t, w.Body.String(), `"code":"idempotency_key_in_use"`)
+	service.idempotencyLocks.unlock("user12\x00job-3")
+
+	w = postWithKey(r, "/", "text/plain", "https://dzen.ru", strings.Repeat("k", maxIdempotencyKeyLength+1))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestIdempotencyMiddleware_Expired(t *testing.T) {
+	cfg := config.GetTestConfig()
+	cfg.IdempotencyTTL = config.Duration{Duration: time.Hour}
+	s, err := storage.NewMapStorage(cfg)
+	assert.NoError(t, err)
+	responses := storage.NewMapIdempotency()
+	r := idempotencyRouter(NewService(cfg, s, WithIdempotency(responses)))
+
+	w := postWithKey(r, "/", "text/plain", "https://dzen.ru", "job-1")
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	resp := responses.Responses["user12\x00job-1"]
+	assert.Equal(t, http.StatusCreated, resp.Status)
+	assert.Equal(t, "text/plain; charset=utf-8", resp.ContentType)
+
+	// expired response isn't replayed.
+	resp.ExpiresAt = time.Now().Add(-time.Second)
+	responses.Responses["user12\x00job-1"] = resp
+
+	w = postWithKey(r, "/", "text/plain", "https://dzen.ru", "job-1")
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Empty(t, w.Header().Get(IdempotentReplayedHeader))
+}
+
+func TestIdempotencyMiddleware_StreamedBody(t *testing.T) {
+	cfg := config.GetTestConfig()
+	cfg.IdempotencyTTL = config.Duration{Duration: time.Hour}
+	s, err := storage.NewMapStorage(cfg)
+	assert.NoError(t, err)
+	responses := storage.NewMapIdempotency()
+	service := NewService(cfg, s, WithIdempotency(responses))
+
+	// handler reads only start of body.
+	var read string
+	r := chi.NewRouter()
+	r.With(IdempotencyMiddleware(service)).Post("/upload", func(w http.ResponseWriter, r *http.Request) {
+		start := make([]byte, 5)
+		n, _ := io.ReadFull(r.Body, start)
+		r.Body.Close()
+		read = string(start[:n])
+		w.WriteHeader(http.StatusCreated)
+	})
+
+	body := "first line\nsecond line\n"
+	w := postWithKey(r, "/upload", "text/plain", body, "job-1")
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, "first", read)
+
+	// fingerprint has the whole body and is the same as fingerprint of buffered body.
+	assert.Equal(t, fingerprint([]byte(http.MethodPost), []byte("/upload"), []byte("text/plain"), []byte(body)),
+		responses.Responses["user12\x00job-1"].Fingerprint)
+
+	w = postWithKey(r, "/upload", "text/plain", body, "job-1")
+	assert.Equal(t, "true", w.Header().Get(IdempotentReplayedHeader))
+
+	w = postWithKey(r, "/upload", "text/plain", "first line\nother line\n", "job-1")
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+}
+
+func TestIdempotencyMiddleware_Disabled(t *testing.T) {
+	cfg := config.GetTestConfig()
+	s, err := storage.NewMapStorage(cfg)
+	assert.NoError(t, err)
+	r := idempotencyRouter(NewService(cfg, s))
+
+	w := postWithKey(r, "/", "text/plain", "https://dzen.ru", "job-1")
+	assert.Equal(t, http.StatusCreated, w.Code)
+	w = postWithKey(r, "/", "text/plain", "https://dzen.ru", "job-1")
+	assert.Equal(t, http.StatusConflict, w.Code)
+}
+
+func TestIdempotencyInterceptor(t *testing.T) {
+	cfg := config.GetTestConfig()
+	cfg.IdempotencyTTL = config.Duration{Duration: time.Hour}
+	s, err := storage.NewMapStorage(cfg)
+	assert.NoError(t, err)
+	service := NewService(cfg, s)
+	server := NewShortenerServer(cfg, service)
+
+	calls := 0
+	info := &grpc.UnaryServerInfo{FullMethod: pb.Shortener_CreateShort_FullMethodName}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		calls++
+		return server.CreateShort(ctx, req.(*pb.Link))
+	}
+
+	ctx := metadata.NewIncomingContext(context.Background(),
+		metadata.New(map[string]string{"userID": "user12", idempotencyKeyMetadata: "job-1"}))
+
+	first, err := service.IdempotencyInterceptor(ctx, &pb.Link{LongUrl: "https://yandex.ru"}, info, handler)
+	assert.NoError(t, err)
+
+	retry, err := service.IdempotencyInterceptor(ctx, &pb.Link{LongUrl: "https://yandex.ru"}, info, handler)
+	assert.NoError(t, err)
+	assert.Equal(t, first.(*pb.Link).ShortUrl, retry.(*pb.Link).ShortUrl)
+	assert.Equal(t, 1, calls)
+
+	_, err = service.IdempotencyInterceptor(ctx, &pb.Link{LongUrl: "https://google.com"}, info, handler)
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+
+	// errors are replayed with the same status.
+	ctx = metadata.NewIncomingContext(context.Background(),
+		metadata.New(map[string]string{"userID": "user12", idempotencyKeyMetadata: "job-2"}))
+	_, err = service.IdempotencyInterceptor(ctx, &pb.Link{LongUrl: "https://dzen.ru", RedirectCode: 200}, info, handler)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	_, replayErr := service.IdempotencyInterceptor(ctx, &pb.Link{LongUrl: "https://dzen.ru", RedirectCode: 200}, info, handler)
+	assert.Equal(t, status.Convert(err).Proto().String(), status.Convert(replayErr).Proto().String())
+	assert.Equal(t, 2, calls)
+
+	// requests without key and other methods aren't changed.
+	ctx = metadata.NewIncomingContext(context.Background(), metadata.New(map[string]string{"userID": "user12"}))
+	_, err = service.IdempotencyInterceptor(ctx, &pb.Link{LongUrl: "https://yandex.ru"}, info, handler)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, calls)
+}
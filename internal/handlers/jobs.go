@@ -0,0 +1,649 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/size12/url-shortener/internal/logger"
+	"github.com/size12/url-shortener/internal/storage"
+	"go.uber.org/zap"
+)
+
+// JobsPath is path of bulk shortening jobs.
+const JobsPath = "/api/shorten/jobs"
+
+// defaultJobChunkSize is number of urls in chunk of job, if it isn't set in config.
+const defaultJobChunkSize = 100
+
+// jobResultsPage is how many items of job are read from storage at once, when results are written.
+const jobResultsPage = 1000
+
+// jobResultsLimit is max number of results in response, so large job is downloaded in parts, which are written
+// within WriteTimeout of server.
+const jobResultsLimit = 10000
+
+// jobRetryDelay is delay before job, which failed because of storage or service, is run again.
+// It doubles after every failed run until maxJobRetryDelay.
+const (
+	jobRetryDelay    = time.Second
+	maxJobRetryDelay = 5 * time.Minute
+)
+
+// Errors of bulk shortening jobs.
+var (
+	ErrJobTooLarge      = errors.New("too many urls in job")
+	ErrEmptyJob         = errors.New("job has no urls")
+	ErrInvalidJobCSV    = errors.New("csv must have header with original_url column")
+	ErrInvalidJobFormat = errors.New("format must be json or csv")
+	ErrInvalidJobID     = errors.New("wrong job ID")
+	ErrInvalidJobOffset = errors.New("offset must be non-negative number")
+)
+
+// JobResource is bulk shortening job in responses.
+type JobResource struct {
+	ID         int64     `json:"id"`
+	Status     string    `json:"status"`
+	Total      int       `json:"total"`
+	Processed  int       `json:"processed"`
+	Failed     int       `json:"failed"`
+	Error      string    `json:"error,omitempty"`
+	ResultsURL string    `json:"results_url"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// JobResult is result of url of job. Either ShortURL or Error is set.
+type JobResult struct {
+	CorrelationID string `json:"correlation_id,omitempty"`
+	URL           string `json:"original_url"`
+	ShortURL      string `json:"short_url,omitempty"`
+	Error         string `json:"error,omitempty"`
+}
+
+// jobQueue is queue of jobs, which wait for worker. Job is queued once, until worker takes it.
+// Failures are numbers of failed runs of jobs in a row, retryDelay is delay after the first of them.
+type jobQueue struct {
+	ids        []int64
+	queued     map[int64]bool
+	failures   map[int64]int
+	retryDelay time.Duration
+	notify     chan struct{}
+	*sync.Mutex
+}
+
+// newJobQueue creates empty job queue.
+func newJobQueue() *jobQueue {
+	return &jobQueue{
+		queued:     make(map[int64]bool),
+		failures:   make(map[int64]int),
+		retryDelay: jobRetryDelay,
+		notify:     make(chan struct{}, 1),
+		Mutex:      &sync.Mutex{},
+	}
+}
+
+// wake wakes one of waiting workers.
+func (q *jobQueue) wake() {
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+}
+
+// push adds job to queue, if it isn't queued yet.
+func (q *jobQueue) push(id int64) {
+	q.Lock()
+	defer q.Unlock()
+
+	if q.queued[id] {
+		return
+	}
+	q.queued[id] = true
+	q.ids = append(q.ids, id)
+	q.wake()
+}
+
+// pop takes the oldest job from queue. It returns false, if queue is empty.
+func (q *jobQueue) pop() (int64, bool) {
+	q.Lock()
+	defer q.Unlock()
+
+	if len(q.ids) == 0 {
+		return 0, false
+	}
+
+	id := q.ids[0]
+	q.ids = q.ids[1:]
+	delete(q.queued, id)
+
+	// other workers take the rest of jobs.
+	if len(q.ids) > 0 {
+		q.wake()
+	}
+	return id, true
+}
+
+// retry queues job again after delay, which doubles after every failed run of job in a row. It returns delay.
+func (q *jobQueue) retry(id int64) time.Duration {
+	q.Lock()
+	defer q.Unlock()
+
+	q.failures[id]++
+	delay := q.retryDelay
+	for i := 1; i < q.failures[id] && delay < maxJobRetryDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxJobRetryDelay {
+		delay = maxJobRetryDelay
+	}
+
+	time.AfterFunc(delay, func() { q.push(id) })
+	return delay
+}
+
+// succeed forgets failed runs of job, when its progress is saved.
+func (q *jobQueue) succeed(id int64) {
+	q.Lock()
+	defer q.Unlock()
+	delete(q.failures, id)
+}
+
+// len gets number of queued jobs.
+func (q *jobQueue) len() int {
+	q.Lock()
+	defer q.Unlock()
+	return len(q.ids)
+}
+
+// jobResource gets job in response format.
+func (service *Service) jobResource(job storage.Job) JobResource {
+	return JobResource{
+		ID:         job.ID,
+		Status:     job.Status,
+		Total:      job.Total,
+		Processed:  job.Processed,
+		Failed:     job.Failed,
+		Error:      job.Error,
+		ResultsURL: fmt.Sprintf("%s%s/%d/results", service.cfg.BaseURL, JobsPath, job.ID),
+		CreatedAt:  job.CreatedAt,
+		UpdatedAt:  job.UpdatedAt,
+	}
+}
+
+// jobChunkSize gets number of urls, which are shortened at once. Chunk isn't larger than max batch.
+func (service *Service) jobChunkSize() int {
+	size := service.cfg.JobChunkSize
+	if size <= 0 {
+		size = defaultJobChunkSize
+	}
+	if service.cfg.MaxBatchLength > 0 && size > service.cfg.MaxBatchLength {
+		size = service.cfg.MaxBatchLength
+	}
+	return size
+}
+
+// CreateJob adds job of user and queues it. Urls are checked, when job is processed, so bad urls fail only their items.
+func (service *Service) CreateJob(ctx context.Context, userID string, urls []storage.BatchJSON) (storage.Job, error) {
+	if len(urls) == 0 {
+		return storage.Job{}, ErrEmptyJob
+	}
+
+	if service.cfg.MaxJobLength > 0 && len(urls) > service.cfg.MaxJobLength {
+		return storage.Job{}, ErrJobTooLarge
+	}
+
+	now := time.Now().UTC()
+	job, err := service.jobs.AddJob(ctx, storage.Job{UserID: userID, Status: storage.JobQueued, CreatedAt: now, UpdatedAt: now}, urls)
+	if err != nil {
+		return storage.Job{}, err
+	}
+
+	service.jobQueue.push(job.ID)
+	return job, nil
+}
+
+// GetJob gets job of user. Jobs of other users aren't found.
+func (service *Service) GetJob(ctx context.Context, userID string, id int64) (storage.Job, error) {
+	job, err := service.jobs.GetJob(ctx, id)
+	if err != nil {
+		return storage.Job{}, err
+	}
+
+	if job.UserID != userID {
+		return storage.Job{}, storage.Err404
+	}
+
+	return job, nil
+}
+
+// CheckJobBacklog checks if queue of jobs is shorter than MaxQueueBacklog. It's readiness check.
+func (service *Service) CheckJobBacklog(ctx context.Context) error {
+	if n := service.jobQueue.len(); service.cfg.MaxQueueBacklog > 0 && n > service.cfg.MaxQueueBacklog {
+		return fmt.Errorf("%d jobs are queued, max backlog is %d", n, service.cfg.MaxQueueBacklog)
+	}
+	return nil
+}
+
+// RunJobs queues unfinished jobs and processes jobs with workers until ctx is done.
+// Interrupted job isn't lost: it's continued from its first unprocessed chunk on next run.
+func (service *Service) RunJobs(ctx context.Context) error {
+	jobs, err := service.jobs.GetUnfinishedJobs(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, job := range jobs {
+		service.jobQueue.push(job.ID)
+	}
+
+	workers := service.cfg.JobWorkers
+	if workers <= 0 {
+		workers = 1
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			service.jobWorker(ctx)
+		}()
+	}
+
+	wg.Wait()
+	return nil
+}
+
+// jobWorker processes queued jobs until ctx is done.
+func (service *Service) jobWorker(ctx context.Context) {
+	for {
+		id, ok := service.jobQueue.pop()
+		if !ok {
+			select {
+			case <-ctx.Done():
+				return
+			case <-service.jobQueue.notify:
+				continue
+			}
+		}
+
+		service.runJob(ctx, id)
+		if ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+// runJob processes job chunk by chunk. Progress is saved after every chunk, so stopped job can be continued.
+// Storage requests don't use ctx, so chunk, which is in progress, is saved, when ctx is done.
+// If storage or service fails, job isn't failed, but is run again later from the same chunk.
+// Job fails only if its items are lost.
+func (service *Service) runJob(ctx context.Context, id int64) {
+	storageCtx := context.Background()
+	log := logger.Log.With(zap.Int64("job", id))
+
+	job, err := service.jobs.GetJob(storageCtx, id)
+	if errors.Is(err, storage.Err404) {
+		log.Error("Failed get job", zap.Error(err))
+		return
+	}
+	if err != nil {
+		service.retryJob(log, id, err)
+		return
+	}
+
+	chunkSize := service.jobChunkSize()
+	for !job.IsFinished() {
+		if ctx.Err() != nil {
+			return
+		}
+
+		items, err := service.jobs.GetJobItems(storageCtx, id, job.Processed, chunkSize)
+		if err == nil && len(items) == 0 && job.Processed < job.Total {
+			job.Status, job.Error = storage.JobFailed, fmt.Sprintf("job has %d items, %d expected", job.Processed, job.Total)
+			log.Error("Failed process job", zap.String("error", job.Error))
+		} else {
+			if err == nil {
+				err = service.shortJobItems(storageCtx, job.UserID, items)
+			}
+			if err != nil {
+				service.retryJob(log, id, err)
+				return
+			}
+
+			job.Status = storage.JobRunning
+			job.Processed += len(items)
+			for _, item := range items {
+				if item.Error != "" {
+					job.Failed++
+				}
+			}
+			if job.Processed >= job.Total {
+				job.Status = storage.JobDone
+			}
+		}
+
+		job.UpdatedAt = time.Now().UTC()
+		if err := service.jobs.UpdateJob(storageCtx, job, items...); err != nil {
+			// chunk isn't saved, so it's processed again.
+			service.retryJob(log, id, err)
+			return
+		}
+		service.jobQueue.succeed(id)
+	}
+}
+
+// retryJob queues job, which failed because of storage or service, again after delay.
+func (service *Service) retryJob(log *zap.Logger, id int64, err error) {
+	delay := service.jobQueue.retry(id)
+	log.Error("Failed process job, it is retried", zap.Duration("delay", delay), zap.Error(err))
+}
+
+// shortJobItems shortens urls of job items and sets their short urls or errors.
+// It returns error only if urls can't be shortened because of service, for example storage is down.
+func (service *Service) shortJobItems(ctx context.Context, userID string, items []storage.JobItem) error {
+	batch := make([]storage.BatchJSON, len(items))
+	for i := range items {
+		batch[i] = items[i].BatchJSON
+	}
+
+	result, err := service.ShortURLs(ctx, userID, batch)
+	if err == nil || errors.Is(err, storage.Err409) {
+		for i := range items {
+			items[i].ShortURL, items[i].Error = result[i].ShortURL, ""
+		}
+		return nil
+	}
+
+	if AsError(err).Code == CodeInternal {
+		return err
+	}
+
+	// one bad url fails whole batch, so urls of chunk are shortened one by one to find bad ones.
+	for i := range items {
+		result, err := service.ShortURLs(ctx, userID, batch[i:i+1])
+		switch {
+		case err == nil || errors.Is(err, storage.Err409):
+			items[i].ShortURL, items[i].Error = result[0].ShortURL, ""
+		case AsError(err).Code == CodeInternal:
+			return err
+		default:
+			items[i].ShortURL, items[i].Error = "", AsError(err).Message
+		}
+	}
+
+	return nil
+}
+
+// parseJobCSV gets urls of job from CSV with header. Column original_url is required, correlation_id is optional.
+// Other columns are ignored.
+func parseJobCSV(data []byte) ([]storage.BatchJSON, error) {
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, ErrInvalidJobCSV
+	}
+
+	urlColumn, idColumn := -1, -1
+	for i, name := range header {
+		switch strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff"))) {
+		case "original_url":
+			urlColumn = i
+		case "correlation_id":
+			idColumn = i
+		}
+	}
+
+	if urlColumn < 0 {
+		return nil, ErrInvalidJobCSV
+	}
+
+	urls := make([]storage.BatchJSON, 0)
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		var item storage.BatchJSON
+		if urlColumn < len(record) {
+			item.URL = record[urlColumn]
+		}
+		if idColumn >= 0 && idColumn < len(record) {
+			item.CorrelationID = record[idColumn]
+		}
+		urls = append(urls, item)
+	}
+
+	return urls, nil
+}
+
+// pathID gets numeric ID from URL. Wrong ID isn't found, invalid is its error.
+func pathID(r *http.Request, invalid error) (int64, error) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil || id <= 0 {
+		return 0, &Error{Code: CodeNotFound, Message: invalid.Error(), Err: invalid}
+	}
+	return id, nil
+}
+
+// CreateJobHandler submits bulk shortening job. Body is JSON array like in batch request or CSV with header.
+// Job is processed in background, response has its ID and Location of its status.
+func CreateJobHandler(service *Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := requestUser(r)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		resBody, ok := readBody(w, r)
+		if !ok {
+			return
+		}
+
+		var urls []storage.BatchJSON
+		if strings.HasPrefix(r.Header.Get("Content-Type"), "text/csv") {
+			urls, err = parseJobCSV(resBody)
+		} else {
+			err = json.Unmarshal(resBody, &urls)
+		}
+		if err != nil {
+			writeError(w, r, invalidBody(err))
+			return
+		}
+
+		job, err := service.CreateJob(r.Context(), userID, urls)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		w.Header().Set("Location", fmt.Sprintf("%s/%d", JobsPath, job.ID))
+		writeJSON(w, r, http.StatusAccepted, service.jobResource(job))
+	}
+}
+
+// JobHandler gets status and progress of user's job.
+func JobHandler(service *Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := requestUser(r)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		id, err := pathID(r, ErrInvalidJobID)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		job, err := service.GetJob(r.Context(), userID, id)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		writeJSON(w, r, http.StatusOK, service.jobResource(job))
+	}
+}
+
+// JobResultsHandler gets results of processed urls of user's job in order of request: JSON array or CSV with format=csv.
+// Response has at most jobResultsLimit results from offset query parameter. If there are more results,
+// Link header has url of the next part. Results of job, which is still running, are partial.
+func JobResultsHandler(service *Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := requestUser(r)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		format := r.URL.Query().Get("format")
+		if format != "" && format != "json" && format != "csv" {
+			writeError(w, r, ErrInvalidJobFormat)
+			return
+		}
+
+		offset := 0
+		if raw := r.URL.Query().Get("offset"); raw != "" {
+			offset, err = strconv.Atoi(raw)
+			if err != nil || offset < 0 {
+				writeError(w, r, ErrInvalidJobOffset)
+				return
+			}
+		}
+
+		id, err := pathID(r, ErrInvalidJobID)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		job, err := service.GetJob(r.Context(), userID, id)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		end := job.Processed
+		if end-offset > jobResultsLimit {
+			end = offset + jobResultsLimit
+
+			query := url.Values{"offset": {strconv.Itoa(end)}}
+			if format != "" {
+				query.Set("format", format)
+			}
+			w.Header().Set("Link", fmt.Sprintf(`<%s?%s>; rel="next"`, service.jobResource(job).ResultsURL, query.Encode()))
+		}
+
+		// limit gets size of next page of processed items.
+		limit := func(written int) int {
+			if end-written < jobResultsPage {
+				return end - written
+			}
+			return jobResultsPage
+		}
+
+		var items []storage.JobItem
+		if offset < end {
+			items, err = service.jobs.GetJobItems(r.Context(), id, offset, limit(offset))
+			if err != nil {
+				writeError(w, r, err)
+				return
+			}
+		}
+
+		writer := newJobResultsWriter(w, format == "csv")
+		for written := offset; len(items) > 0; {
+			for _, item := range items {
+				writer.write(JobResult{CorrelationID: item.CorrelationID, URL: item.URL, ShortURL: item.ShortURL, Error: item.Error})
+			}
+
+			written += len(items)
+			if written >= end {
+				break
+			}
+
+			items, err = service.jobs.GetJobItems(r.Context(), id, written, limit(written))
+			if err != nil {
+				// status is already sent, so response is cut.
+				logger.FromContext(r.Context()).Error("Failed get job results", zap.Error(err))
+				return
+			}
+		}
+
+		writer.close()
+	}
+}
+
+// jobResultsWriter streams job results as JSON array or CSV.
+type jobResultsWriter struct {
+	w     http.ResponseWriter
+	csv   *csv.Writer
+	count int
+}
+
+// newJobResultsWriter writes headers of results and starts body.
+func newJobResultsWriter(w http.ResponseWriter, isCSV bool) *jobResultsWriter {
+	writer := &jobResultsWriter{w: w}
+	if isCSV {
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		writer.csv = csv.NewWriter(w)
+		writer.csv.Write([]string{"correlation_id", "original_url", "short_url", "error"})
+		return writer
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("["))
+	return writer
+}
+
+// write writes result.
+func (writer *jobResultsWriter) write(result JobResult) {
+	defer func() { writer.count++ }()
+
+	if writer.csv != nil {
+		writer.csv.Write([]string{result.CorrelationID, result.URL, result.ShortURL, result.Error})
+		return
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		return
+	}
+	if writer.count > 0 {
+		writer.w.Write([]byte(","))
+	}
+	writer.w.Write(data)
+}
+
+// close ends body of results.
+func (writer *jobResultsWriter) close() {
+	if writer.csv != nil {
+		writer.csv.Flush()
+		return
+	}
+	writer.w.Write([]byte("]"))
+}
@@ -0,0 +1,319 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/size12/url-shortener/internal/config"
+	"github.com/size12/url-shortener/internal/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+// jobsRouter gets router with jobs routes.
+func jobsRouter(service *Service) *chi.Mux {
+	r := chi.NewRouter()
+	r.Post(JobsPath, CreateJobHandler(service))
+	r.Get(JobsPath+"/{id}", JobHandler(service))
+	r.Get(JobsPath+"/{id}/results", JobResultsHandler(service))
+	return r
+}
+
+// jobsRequest sends request of user to jobs router.
+func jobsRequest(r http.Handler, method, target, contentType, body, userID string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(method, target, strings.NewReader(body))
+	request.Header.Set("Content-Type", contentType)
+	request.AddCookie(&http.Cookie{Name: "userID", Value: userID})
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, request)
+	return w
+}
+
+// runJobs processes queued jobs, until all jobs are finished.
+func runJobs(t *testing.T, service *Service) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		assert.NoError(t, service.RunJobs(ctx))
+	}()
+
+	assert.Eventually(t, func() bool {
+		jobs, err := service.jobs.GetUnfinishedJobs(context.Background())
+		return err == nil && len(jobs) == 0
+	}, 5*time.Second, 10*time.Millisecond)
+
+	cancel()
+	<-done
+}
+
+func TestJobs(t *testing.T) {
+	cfg := config.GetTestConfig()
+	cfg.JobChunkSize = 2
+	cfg.MaxJobLength = 5
+	cfg.MaxURLLength = 30
+	s, err := storage.NewMapStorage(cfg)
+	assert.NoError(t, err)
+	service := NewService(cfg, s)
+	r := jobsRouter(service)
+
+	body := `[{"correlation_id":"a","original_url":"https://yandex.ru"},
+		{"correlation_id":"b","original_url":"https://google.com/` + strings.Repeat("a", 30) + `"},
+		{"correlation_id":"c","original_url":"https://dzen.ru"}]`
+
+	w := jobsRequest(r, http.MethodPost, JobsPath, "application/json", body, "user12")
+	assert.Equal(t, http.StatusAccepted, w.Code)
+	assert.Equal(t, JobsPath+"/1", w.Header().Get("Location"))
+
+	var job JobResource
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &job))
+	assert.Equal(t, int64(1), job.ID)
+	assert.Equal(t, storage.JobQueued, job.Status)
+	assert.Equal(t, 3, job.Total)
+	assert.Equal(t, "http://127.0.0.1:8081"+JobsPath+"/1/results", job.ResultsURL)
+
+	runJobs(t, service)
+
+	w = jobsRequest(r, http.MethodGet, JobsPath+"/1", "", "", "user12")
+	assert.Equal(t, http.StatusOK, w.Code)
+	job = JobResource{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &job))
+	assert.Equal(t, storage.JobDone, job.Status)
+	assert.Equal(t, 3, job.Processed)
+	assert.Equal(t, 1, job.Failed)
+
+	// bad url fails only its item, other urls of chunk are shortened.
+	w = jobsRequest(r, http.MethodGet, JobsPath+"/1/results", "", "", "user12")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	var results []JobResult
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &results))
+	assert.Equal(t, []JobResult{
+		{CorrelationID: "a", URL: "https://yandex.ru", ShortURL: "http://127.0.0.1:8081/1"},
+		{CorrelationID: "b", URL: "https://google.com/" + strings.Repeat("a", 30), Error: ErrURLTooLong.Error()},
+		{CorrelationID: "c", URL: "https://dzen.ru", ShortURL: "http://127.0.0.1:8081/2"},
+	}, results)
+
+	w = jobsRequest(r, http.MethodGet, JobsPath+"/1/results?format=csv", "", "", "user12")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "text/csv; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Equal(t, "correlation_id,original_url,short_url,error\n"+
+		"a,https://yandex.ru,http://127.0.0.1:8081/1,\n"+
+		"b,https://google.com/"+strings.Repeat("a", 30)+",,url is too long\n"+
+		"c,https://dzen.ru,http://127.0.0.1:8081/2,\n", w.Body.String())
+
+	w = jobsRequest(r, http.MethodGet, JobsPath+"/1/results?format=xml", "", "", "user12")
+	assertProblem(t, w, http.StatusBadRequest, CodeInvalidRequest)
+
+	// jobs of other users aren't found.
+	w = jobsRequest(r, http.MethodGet, JobsPath+"/1", "", "", "user13")
+	assertProblem(t, w, http.StatusNotFound, CodeNotFound)
+	w = jobsRequest(r, http.MethodGet, JobsPath+"/1/results", "", "", "user13")
+	assertProblem(t, w, http.StatusNotFound, CodeNotFound)
+	w = jobsRequest(r, http.MethodGet, JobsPath+"/abc", "", "", "user12")
+	assertProblem(t, w, http.StatusNotFound, CodeNotFound)
+
+	w = jobsRequest(r, http.MethodPost, JobsPath, "application/json", `[]`, "user12")
+	assertProblem(t, w, http.StatusBadRequest, CodeInvalidRequest)
+	w = jobsRequest(r, http.MethodPost, JobsPath, "application/json", `[{},{},{},{},{},{}]`, "user12")
+	assertProblem(t, w, http.StatusRequestEntityTooLarge, CodeBatchTooLarge)
+	w = jobsRequest(r, http.MethodPost, JobsPath, "application/json", `{"url":"https://yandex.ru"}`, "user12")
+	assertProblem(t, w, http.StatusBadRequest, CodeInvalidBody)
+}
+
+func TestJobs_LargeBody(t *testing.T) {
+	cfg := config.GetTestConfig()
+	cfg.MaxBodySize = 1 << 20
+	cfg.MaxJobBodySize = 4 << 20
+	s, err := storage.NewMapStorage(cfg)
+	assert.NoError(t, err)
+	service := NewService(cfg, s)
+
+	r := chi.NewRouter()
+	r.Use(NewBodyLimiter(cfg))
+	r.Post("/", URLPostHandler(service))
+	r.Post(JobsPath, CreateJobHandler(service))
+	r.Get(JobsPath+"/{id}/results", JobResultsHandler(service))
+
+	// job is larger, than limit of other requests.
+	var body strings.Builder
+	body.WriteString("original_url\n")
+	for i := 0; int64(body.Len()) <= cfg.MaxBodySize; i++ {
+		fmt.Fprintf(&body, "https://yandex.ru/search?text=%d\n", i)
+	}
+	total := strings.Count(body.String(), "\n") - 1
+	assert.Greater(t, total, jobResultsLimit)
+
+	w := jobsRequest(r, http.MethodPost, JobsPath, "text/csv", body.String(), "user12")
+	assert.Equal(t, http.StatusAccepted, w.Code)
+
+	w = jobsRequest(r, http.MethodPost, "/", "text/plain", body.String(), "user12")
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+
+	w = jobsRequest(r, http.MethodPost, JobsPath, "text/csv", body.String()+strings.Repeat(body.String()[13:], 4), "user12")
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+
+	// items aren't shortened, because only paging of results is checked.
+	job, err := service.jobs.GetJob(context.Background(), 1)
+	assert.NoError(t, err)
+	assert.Equal(t, total, job.Total)
+	job.Status, job.Processed = storage.JobDone, job.Total
+	assert.NoError(t, service.jobs.UpdateJob(context.Background(), job))
+
+	// results are downloaded in parts.
+	w = jobsRequest(r, http.MethodGet, JobsPath+"/1/results?format=csv", "", "", "user12")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, jobResultsLimit+1, strings.Count(w.Body.String(), "\n"))
+	assert.Equal(t, fmt.Sprintf(`<http://127.0.0.1:8081%s/1/results?format=csv&offset=%d>; rel="next"`, JobsPath, jobResultsLimit),
+		w.Header().Get("Link"))
+
+	var results []JobResult
+	for next := fmt.Sprintf("%s/1/results?offset=%d", JobsPath, jobResultsLimit); next != ""; {
+		w = jobsRequest(r, http.MethodGet, next, "", "", "user12")
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var part []JobResult
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &part))
+		results = append(results, part...)
+
+		next = strings.TrimPrefix(strings.TrimSuffix(w.Header().Get("Link"), `>; rel="next"`), "<http://127.0.0.1:8081")
+	}
+	assert.Len(t, results, total-jobResultsLimit)
+	assert.Equal(t, fmt.Sprintf("https://yandex.ru/search?text=%d", jobResultsLimit), results[0].URL)
+	assert.Equal(t, fmt.Sprintf("https://yandex.ru/search?text=%d", total-1), results[len(results)-1].URL)
+
+	w = jobsRequest(r, http.MethodGet, JobsPath+"/1/results?offset=-1", "", "", "user12")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestJobs_CSV(t *testing.T) {
+	cfg := config.GetTestConfig()
+	s, err := storage.NewMapStorage(cfg)
+	assert.NoError(t, err)
+	service := NewService(cfg, s)
+	r := jobsRouter(service)
+
+	body := "name,original_url,correlation_id\nYandex,https://yandex.ru,a\nGoogle,https://google.com,b\n"
+	w := jobsRequest(r, http.MethodPost, JobsPath, "text/csv", body, "user12")
+	assert.Equal(t, http.StatusAccepted, w.Code)
+
+	runJobs(t, service)
+
+	w = jobsRequest(r, http.MethodGet, JobsPath+"/1/results", "", "", "user12")
+	var results []JobResult
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &results))
+	assert.Equal(t, []JobResult{
+		{CorrelationID: "a", URL: "https://yandex.ru", ShortURL: "http://127.0.0.1:8081/1"},
+		{CorrelationID: "b", URL: "https://google.com", ShortURL: "http://127.0.0.1:8081/2"},
+	}, results)
+
+	w = jobsRequest(r, http.MethodPost, JobsPath, "text/csv", "url\nhttps://yandex.ru\n", "user12")
+	assertProblem(t, w, http.StatusBadRequest, CodeInvalidBody)
+}
+
+func TestJobs_Resume(t *testing.T) {
+	cfg := config.GetTestConfig()
+	cfg.JobChunkSize = 1
+	s, err := storage.NewMapStorage(cfg)
+	assert.NoError(t, err)
+	jobs := storage.NewMapJobs()
+	ctx := context.Background()
+
+	// job was stopped after the first chunk.
+	job, err := jobs.AddJob(ctx, storage.Job{UserID: "user12", Status: storage.JobQueued},
+		[]storage.BatchJSON{{URL: "https://yandex.ru"}, {URL: "https://google.com"}})
+	assert.NoError(t, err)
+	job.Status, job.Processed = storage.JobRunning, 1
+	assert.NoError(t, jobs.UpdateJob(ctx, job, storage.JobItem{Position: 0,
+		BatchJSON: storage.BatchJSON{URL: "https://yandex.ru", ShortURL: "http://127.0.0.1:8081/100"}}))
+
+	service := NewService(cfg, s, WithJobs(jobs))
+	runJobs(t, service)
+
+	job, err = jobs.GetJob(ctx, job.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, storage.JobDone, job.Status)
+	assert.Equal(t, 2, job.Processed)
+
+	items, err := jobs.GetJobItems(ctx, job.ID, 0, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, "http://127.0.0.1:8081/100", items[0].ShortURL)
+	assert.Equal(t, "http://127.0.0.1:8081/1", items[1].ShortURL)
+	assert.Len(t, s.Locations, 1)
+}
+
+// failingJobs is jobs storage, whose items can't be got fails times or are lost.
+type failingJobs struct {
+	storage.JobStorage
+	fails int
+	lost  bool
+}
+
+func (jobs *failingJobs) GetJobItems(ctx context.Context, id int64, offset, limit int) ([]storage.JobItem, error) {
+	if jobs.lost {
+		return nil, nil
+	}
+	if jobs.fails > 0 {
+		jobs.fails--
+		return nil, errors.New("storage is down")
+	}
+	return jobs.JobStorage.GetJobItems(ctx, id, offset, limit)
+}
+
+func TestJobs_Retry(t *testing.T) {
+	cfg := config.GetTestConfig()
+	s, err := storage.NewMapStorage(cfg)
+	assert.NoError(t, err)
+	jobs := &failingJobs{JobStorage: storage.NewMapJobs(), fails: 2}
+	service := NewService(cfg, s, WithJobs(jobs))
+	service.jobQueue.retryDelay = time.Millisecond
+	ctx := context.Background()
+
+	job, err := service.CreateJob(ctx, "user12", []storage.BatchJSON{{URL: "https://yandex.ru"}, {URL: "https://google.com"}})
+	assert.NoError(t, err)
+	service.jobQueue.pop()
+
+	// job isn't failed, when storage is down.
+	service.runJob(ctx, job.ID)
+	job, err = jobs.GetJob(ctx, job.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, storage.JobQueued, job.Status)
+	assert.Empty(t, job.Error)
+
+	// it's queued again and done, when storage is up.
+	runJobs(t, service)
+	job, err = jobs.GetJob(ctx, job.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, storage.JobDone, job.Status)
+	assert.Equal(t, 2, job.Processed)
+	assert.Empty(t, service.jobQueue.failures)
+
+	// but it's failed, when its items are lost.
+	jobs.lost = true
+	job, err = service.CreateJob(ctx, "user12", []storage.BatchJSON{{URL: "https://dzen.ru"}})
+	assert.NoError(t, err)
+	service.runJob(ctx, job.ID)
+	job, err = jobs.GetJob(ctx, job.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, storage.JobFailed, job.Status)
+	assert.Equal(t, "job has 0 items, 1 expected", job.Error)
+}
+
+func TestJobQueue_Retry(t *testing.T) {
+	q := newJobQueue()
+	q.retryDelay = time.Minute
+
+	for _, delay := range []time.Duration{time.Minute, 2 * time.Minute, 4 * time.Minute, 5 * time.Minute, 5 * time.Minute} {
+		assert.Equal(t, delay, q.retry(1))
+	}
+
+	q.succeed(1)
+	assert.Equal(t, time.Minute, q.retry(1))
+}
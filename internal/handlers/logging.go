@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"context"
+	"encoding/hex"
+	"net/http"
+	"time"
+	"unicode"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/size12/url-shortener/internal/logger"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// RequestIDHeader is header (and gRPC metadata key) with request ID.
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength is max length of request ID, which is accepted from client.
+const maxRequestIDLength = 128
+
+// requestID returns request ID sent by client, if it's valid, or generates new one.
+func requestID(id string) string {
+	if id != "" && len(id) <= maxRequestIDLength {
+		valid := true
+		for _, r := range id {
+			if r > unicode.MaxASCII || !unicode.IsPrint(r) {
+				valid = false
+				break
+			}
+		}
+
+		if valid {
+			return id
+		}
+	}
+
+	b, err := generateRandom(16)
+	if err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
+
+// requestLogger creates logger with request ID and trace ID of span in context.
+func requestLogger(ctx context.Context, id string) *zap.Logger {
+	fields := []zap.Field{zap.String("request_id", id)}
+	if spanContext := trace.SpanContextFromContext(ctx); spanContext.HasTraceID() {
+		fields = append(fields, zap.String("trace_id", spanContext.TraceID().String()))
+	}
+	return logger.Log.With(fields...)
+}
+
+// logUserID returns part of user cookie without signature, so logs can't be used to steal cookies.
+func logUserID(userID string) string {
+	if len(userID) > 64 {
+		return userID[64:]
+	}
+	return userID
+}
+
+// RequestLogger logs every request as JSON and adds request-scoped logger to request context.
+// Request ID is taken from X-Request-ID header or generated and sent back in the same header.
+func RequestLogger(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		id := requestID(r.Header.Get(RequestIDHeader))
+		w.Header().Set(RequestIDHeader, id)
+
+		log := requestLogger(r.Context(), id)
+		r = r.WithContext(logger.WithContext(r.Context(), log))
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+
+		next.ServeHTTP(ww, r)
+
+		route := ""
+		if rctx := chi.RouteContext(r.Context()); rctx != nil {
+			route = rctx.RoutePattern()
+		}
+
+		code := ww.Status()
+		if code == 0 {
+			code = http.StatusOK
+		}
+
+		userID := ""
+		if userCookie, err := r.Cookie("userID"); err == nil {
+			userID = logUserID(userCookie.Value)
+		}
+
+		log.Info("HTTP request",
+			zap.String("method", r.Method),
+			zap.String("route", route),
+			zap.String("path", r.URL.Path),
+			zap.Int("status", code),
+			zap.Duration("latency", time.Since(start)),
+			zap.Int("bytes", ww.BytesWritten()),
+			zap.String("user_id", userID),
+		)
+	})
+}
+
+// LoggingInterceptor logs every gRPC request and adds request-scoped logger to context.
+// Request ID is taken from x-request-id metadata or generated and sent back in header.
+func LoggingInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	start := time.Now()
+
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	id := ""
+	if values := md.Get(RequestIDHeader); len(values) != 0 {
+		id = values[0]
+	}
+	id = requestID(id)
+	_ = grpc.SetHeader(ctx, metadata.Pairs(RequestIDHeader, id))
+
+	log := requestLogger(ctx, id)
+	ctx = logger.WithContext(ctx, log)
+
+	resp, err := handler(ctx, req)
+
+	userID := ""
+	if values := md.Get("userID"); len(values) != 0 {
+		userID = logUserID(values[0])
+	}
+
+	log.Info("gRPC request",
+		zap.String("method", info.FullMethod),
+		zap.String("code", status.Code(err).String()),
+		zap.Duration("latency", time.Since(start)),
+		zap.String("user_id", userID),
+	)
+
+	return resp, err
+}
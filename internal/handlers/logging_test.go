@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/size12/url-shortener/internal/logger"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// observeLogs replaces base logger with observer for test.
+func observeLogs(t *testing.T) *observer.ObservedLogs {
+	core, logs := observer.New(zapcore.InfoLevel)
+	base := logger.Log
+	logger.Log = zap.New(core)
+	t.Cleanup(func() {
+		logger.Log = base
+	})
+	return logs
+}
+
+func TestRequestLogger(t *testing.T) {
+	logs := observeLogs(t)
+
+	r := chi.NewRouter()
+	r.Use(RequestLogger)
+	r.Get("/{id}", func(w http.ResponseWriter, r *http.Request) {
+		logger.FromContext(r.Context()).Error("Failed get long url")
+		w.WriteHeader(http.StatusTemporaryRedirect)
+	})
+
+	// request ID is propagated from client.
+	request := httptest.NewRequest(http.MethodGet, "/1", nil)
+	request.Header.Set(RequestIDHeader, "request-12")
+	request.AddCookie(&http.Cookie{Name: "userID", Value: strings.Repeat("a", 64) + "0123456789abcdef"})
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, request)
+
+	assert.Equal(t, "request-12", w.Header().Get(RequestIDHeader))
+	assert.Equal(t, 2, logs.Len())
+
+	entries := logs.TakeAll()
+	assert.Equal(t, "request-12", entries[0].ContextMap()["request_id"])
+
+	access := entries[1].ContextMap()
+	assert.Equal(t, "request-12", access["request_id"])
+	assert.Equal(t, "GET", access["method"])
+	assert.Equal(t, "/{id}", access["route"])
+	assert.Equal(t, int64(http.StatusTemporaryRedirect), access["status"])
+	assert.Equal(t, "0123456789abcdef", access["user_id"])
+
+	// request ID is generated, if client sent invalid one.
+	request = httptest.NewRequest(http.MethodGet, "/1", nil)
+	request.Header.Set(RequestIDHeader, "bad\nid")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, request)
+
+	id := w.Header().Get(RequestIDHeader)
+	assert.Len(t, id, 32)
+	assert.Equal(t, id, logs.TakeAll()[1].ContextMap()["request_id"])
+}
+
+func TestLoggingInterceptor(t *testing.T) {
+	logs := observeLogs(t)
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.New(map[string]string{
+		"userID":        "user12",
+		RequestIDHeader: "request-12",
+	}))
+	info := &grpc.UnaryServerInfo{FullMethod: "/url_shortener.Shortener/Ping"}
+
+	_, err := LoggingInterceptor(ctx, nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		logger.FromContext(ctx).Info("inside handler")
+		return nil, nil
+	})
+	assert.NoError(t, err)
+
+	entries := logs.TakeAll()
+	assert.Len(t, entries, 2)
+	assert.Equal(t, "request-12", entries[0].ContextMap()["request_id"])
+	assert.Equal(t, "OK", entries[1].ContextMap()["code"])
+	assert.Equal(t, "user12", entries[1].ContextMap()["user_id"])
+}
@@ -5,17 +5,18 @@ import (
 	"crypto/hmac"
 	"crypto/rand"
 	"crypto/sha256"
+	"crypto/subtle"
 	"encoding/hex"
 	"errors"
-	"fmt"
 	"io"
-	"log"
 	"net"
 	"net/http"
 	"strings"
 	"time"
 
 	"github.com/size12/url-shortener/internal/config"
+	"github.com/size12/url-shortener/internal/logger"
+	"go.uber.org/zap"
 )
 
 // compress response.
@@ -33,7 +34,7 @@ type gzipWriter struct {
 
 // Write - sends gzip packed response.
 func (w gzipWriter) Write(b []byte) (int, error) {
-	// w.Writer будет отвечать за gzip-сжатие, поэтому пишем в него
+	// w.Writer is gzip writer, so response is compressed.
 	return w.Writer.Write(b)
 }
 
@@ -54,33 +55,29 @@ func CookieMiddleware(next http.Handler) http.Handler {
 		if ok == nil { // check if cookie is valid.
 			id, err := hex.DecodeString(userID.Value)
 			if err != nil || len(id) != 40 {
-				http.Error(w, err.Error(), 400)
-				return
-			}
-			signSrc := id[:32]
-			id = id[32:]
-			h := hmac.New(sha256.New, secretKey)
-			h.Write(id)
-			sign := h.Sum(nil)
-			if !hmac.Equal(signSrc, sign) {
-				//fmt.Println("failed to verify signature")
-				ok = errors.New("failed to verify signature")
+				ok = errors.New("invalid cookie")
+			} else {
+				signSrc := id[:32]
+				id = id[32:]
+				h := hmac.New(sha256.New, secretKey)
+				h.Write(id)
+				sign := h.Sum(nil)
+				if !hmac.Equal(signSrc, sign) {
+					ok = errors.New("failed to verify signature")
+				}
 			}
 		}
 		if ok != nil {
-			//fmt.Println("Generating new cookie")
 			randomID, err := generateRandom(8)
 			h := hmac.New(sha256.New, secretKey)
 			h.Write(randomID)
 			sign := h.Sum(nil)
 			if err != nil {
-				http.Error(w, err.Error(), 400)
+				writeError(w, r, err)
+				return
 			}
 			expiration := time.Now().Add(365 * 24 * time.Hour)
-			//fmt.Println("Sign:", sign)
-			//fmt.Println("ID:", randomID)
 			cookieString := hex.EncodeToString(append(sign, randomID...))
-			//fmt.Println("New user cookie is:", cookieString)
 			cookie := http.Cookie{Name: "userID", Value: cookieString, Expires: expiration, Path: "/"}
 			http.SetCookie(w, &cookie)
 			r.AddCookie(&cookie)
@@ -89,24 +86,97 @@ func CookieMiddleware(next http.Handler) http.Handler {
 	})
 }
 
-// GzipRequest accepts gzip request.
-func GzipRequest(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if !strings.Contains(r.Header.Get("Content-Encoding"), "gzip") {
+// ErrBodyTooLarge is returned when request body is bigger than allowed.
+var ErrBodyTooLarge = errors.New("request body too large")
+
+// limitedBody is request body which returns ErrBodyTooLarge after more than n bytes were read.
+type limitedBody struct {
+	io.Reader
+	io.Closer
+	n int64
+}
+
+// Read reads body, while it's not too large.
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if int64(len(p)) > b.n+1 {
+		p = p[:b.n+1]
+	}
+
+	n, err := b.Reader.Read(p)
+	if int64(n) <= b.n {
+		b.n -= int64(n)
+		return n, err
+	}
+
+	n = int(b.n)
+	b.n = 0
+	return n, ErrBodyTooLarge
+}
+
+// isJobUpload checks if request submits bulk shortening job, which body is limited by MaxJobBodySize.
+func isJobUpload(r *http.Request) bool {
+	return r.Method == http.MethodPost && r.URL.Path == JobsPath
+}
+
+// NewBodyLimiter limits size of request body.
+func NewBodyLimiter(cfg config.Config) func(handler http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			limit := cfg.MaxBodySize
+			if isJobUpload(r) {
+				limit = cfg.MaxJobBodySize
+			}
+
+			if limit <= 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if r.ContentLength > limit {
+				writeError(w, r, ErrBodyTooLarge)
+				return
+			}
+
+			r.Body = &limitedBody{Reader: r.Body, Closer: r.Body, n: limit}
 			next.ServeHTTP(w, r)
-			return
-		}
+		})
+	}
+}
 
-		// переменная r будет читать входящие данные и распаковывать их.
-		reader, err := gzip.NewReader(r.Body)
-		if err != nil {
-			fmt.Println(err)
-			return
-		}
-		defer reader.Close()
-		r.Body = reader
-		next.ServeHTTP(w, r)
-	})
+// NewGzipRequest accepts gzip request and limits size of decompressed body.
+func NewGzipRequest(cfg config.Config) func(handler http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !strings.Contains(r.Header.Get("Content-Encoding"), "gzip") {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			// reader decompresses request body.
+			reader, err := gzip.NewReader(r.Body)
+			if errors.Is(err, ErrBodyTooLarge) {
+				writeError(w, r, err)
+				return
+			}
+
+			if err != nil {
+				writeError(w, r, &Error{Code: CodeInvalidBody, Message: "wrong gzip body", Err: err})
+				return
+			}
+			defer reader.Close()
+
+			limit := cfg.MaxDecompressedSize
+			if isJobUpload(r) {
+				limit = cfg.MaxJobBodySize
+			}
+
+			r.Body = reader
+			if limit > 0 {
+				r.Body = &limitedBody{Reader: reader, Closer: reader, n: limit}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
 }
 
 // GzipHandle sends gzip packed data.
@@ -129,19 +199,21 @@ func GzipHandle(next http.Handler) http.Handler {
 	})
 }
 
-// NewIPPermissionsChecker checks if user can get statistic.
+// NewIPPermissionsChecker checks if user can get statistic. Client IP is taken from headers only from trusted proxies.
 func NewIPPermissionsChecker(cfg config.Config) func(handler http.Handler) http.Handler {
+	proxies := parseTrustedProxies(cfg.TrustedProxies)
+
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			if cfg.TrustedSubnet == "" {
-				http.Error(w, "403 Forbidden", http.StatusForbidden)
+				writeError(w, r, NewError(CodeForbidden, "forbidden"))
 				return
 			}
 
-			rawIP := r.Header.Get("X-Real-IP")
+			rawIP := proxies.clientIP(r)
 
 			if rawIP == "" {
-				http.Error(w, "403 Forbidden", http.StatusForbidden)
+				writeError(w, r, NewError(CodeForbidden, "forbidden"))
 				return
 			}
 
@@ -149,13 +221,13 @@ func NewIPPermissionsChecker(cfg config.Config) func(handler http.Handler) http.
 			_, subnet, err := net.ParseCIDR(cfg.TrustedSubnet)
 
 			if err != nil {
-				http.Error(w, "internal server error", http.StatusInternalServerError)
-				log.Fatalln("Failed parse CIDR subnet address:", err)
+				logger.FromContext(r.Context()).Error("Failed parse CIDR subnet address", zap.Error(err))
+				writeError(w, r, err)
 				return
 			}
 
 			if !subnet.Contains(IP) {
-				http.Error(w, "403 Forbidden", http.StatusForbidden)
+				writeError(w, r, NewError(CodeForbidden, "forbidden"))
 				return
 			}
 
@@ -163,3 +235,35 @@ func NewIPPermissionsChecker(cfg config.Config) func(handler http.Handler) http.
 		})
 	}
 }
+
+// adminAPIKey gets admin API key from "Authorization: Bearer" or X-Admin-Key header.
+func adminAPIKey(r *http.Request) string {
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		return strings.TrimPrefix(auth, "Bearer ")
+	}
+	return r.Header.Get("X-Admin-Key")
+}
+
+// validAdminKey checks admin API key of request in constant time. Empty key is never valid.
+func validAdminKey(key string, r *http.Request) bool {
+	got := adminAPIKey(r)
+	return key != "" && got != "" && subtle.ConstantTimeCompare([]byte(got), []byte(key)) == 1
+}
+
+// NewAdminChecker checks if user can call admin endpoints: by admin API key, or by IP from trusted subnet.
+func NewAdminChecker(cfg config.Config) func(handler http.Handler) http.Handler {
+	checkIP := NewIPPermissionsChecker(cfg)
+
+	return func(next http.Handler) http.Handler {
+		byIP := checkIP(next)
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if validAdminKey(cfg.AdminAPIKey, r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			byIP.ServeHTTP(w, r)
+		})
+	}
+}
@@ -1,10 +1,13 @@
 package handlers
 
 import (
+	"bytes"
 	"compress/gzip"
 	"errors"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
@@ -66,6 +69,8 @@ func TestNewIPPermissionsChecker(t *testing.T) {
 	NewIPPermissionsChecker(cfg)(next).ServeHTTP(w, request)
 
 	cfg.TrustedSubnet = "127.0.0.1/24"
+	// requests of httptest come from trusted proxy 192.0.2.1.
+	cfg.TrustedProxies = "192.0.2.0/24"
 
 	request = httptest.NewRequest(http.MethodGet, "/api/internal/stats", nil)
 	request.Header.Set("X-Real-IP", "128.0.0.2")
@@ -92,6 +97,66 @@ func TestNewIPPermissionsChecker(t *testing.T) {
 	assert.Equal(t, true, nextWasCalled)
 }
 
+func TestNewAdminChecker(t *testing.T) {
+	cfg := config.GetTestConfig()
+	cfg.TrustedSubnet = "127.0.0.1/24"
+	// requests of httptest come from trusted proxy 192.0.2.1.
+	cfg.TrustedProxies = "192.0.2.0/24"
+	cfg.AdminAPIKey = "secret"
+
+	nextWasCalled := false
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		nextWasCalled = true
+	})
+
+	tt := []struct {
+		name   string
+		header http.Header
+		want   bool
+	}{
+		{name: "no key and IP", header: http.Header{}, want: false},
+		{name: "bearer key", header: http.Header{"Authorization": []string{"Bearer secret"}}, want: true},
+		{name: "header key", header: http.Header{"X-Admin-Key": []string{"secret"}}, want: true},
+		{name: "wrong key", header: http.Header{"X-Admin-Key": []string{"secret2"}}, want: false},
+		{name: "trusted IP", header: http.Header{"X-Real-Ip": []string{"127.0.0.2"}}, want: true},
+		{name: "wrong key from trusted IP", header: http.Header{"X-Admin-Key": []string{"wrong"}, "X-Real-Ip": []string{"127.0.0.2"}}, want: true},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			nextWasCalled = false
+			request := httptest.NewRequest(http.MethodGet, "/api/admin/takedowns", nil)
+			request.Header = tc.header
+			w := httptest.NewRecorder()
+
+			NewAdminChecker(cfg)(next).ServeHTTP(w, request)
+			assert.Equal(t, tc.want, nextWasCalled)
+			if !tc.want {
+				assert.Equal(t, http.StatusForbidden, w.Code)
+			}
+		})
+	}
+
+	// client, which isn't trusted proxy, can't pretend to be from trusted subnet.
+	nextWasCalled = false
+	request := httptest.NewRequest(http.MethodGet, "/api/admin/takedowns", nil)
+	request.RemoteAddr = "9.9.9.9:5000"
+	request.Header.Set("X-Real-IP", "127.0.0.2")
+	request.Header.Set("X-Forwarded-For", "127.0.0.2")
+	w := httptest.NewRecorder()
+	NewAdminChecker(cfg)(next).ServeHTTP(w, request)
+	assert.False(t, nextWasCalled)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	// empty key doesn't match empty header.
+	cfg.AdminAPIKey = ""
+	nextWasCalled = false
+	request = httptest.NewRequest(http.MethodGet, "/api/admin/takedowns", nil)
+	request.Header.Set("Authorization", "Bearer ")
+	NewAdminChecker(cfg)(next).ServeHTTP(httptest.NewRecorder(), request)
+	assert.False(t, nextWasCalled)
+}
+
 func TestGzipHandle(t *testing.T) {
 	request := httptest.NewRequest(http.MethodPost, "/", nil)
 	w := httptest.NewRecorder()
@@ -116,7 +181,8 @@ func TestGzipHandle(t *testing.T) {
 }
 
 func TestGzipRequest(t *testing.T) {
-	request := httptest.NewRequest(http.MethodPost, "/", nil)
+	cfg := config.GetTestConfig()
+	request := httptest.NewRequest(http.MethodPost, "/", gzipBody(t, "https://yandex.ru"))
 	w := httptest.NewRecorder()
 	request.Header.Set("Content-Encoding", "gzip")
 
@@ -124,6 +190,97 @@ func TestGzipRequest(t *testing.T) {
 		assert.IsType(t, &gzip.Reader{}, r.Body)
 	})
 
-	GzipRequest(next).ServeHTTP(w, request)
+	NewGzipRequest(cfg)(next).ServeHTTP(w, request)
+
+	// body which is not gzip.
+	request = httptest.NewRequest(http.MethodPost, "/", strings.NewReader("https://yandex.ru"))
+	request.Header.Set("Content-Encoding", "gzip")
+	w = httptest.NewRecorder()
+
+	NewGzipRequest(cfg)(next).ServeHTTP(w, request)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestGzipRequest_Limit(t *testing.T) {
+	cfg := config.GetTestConfig()
+	cfg.MaxDecompressedSize = 10
+
+	// gzip bomb: small compressed body which is large after decompression.
+	request := httptest.NewRequest(http.MethodPost, "/", gzipBody(t, strings.Repeat("a", 1000)))
+	request.Header.Set("Content-Encoding", "gzip")
+	w := httptest.NewRecorder()
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		readBody(w, r)
+	})
+
+	NewGzipRequest(cfg)(next).ServeHTTP(w, request)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+
+	request = httptest.NewRequest(http.MethodPost, "/", gzipBody(t, "aaaaaaaaaa"))
+	request.Header.Set("Content-Encoding", "gzip")
+	w = httptest.NewRecorder()
+
+	NewGzipRequest(cfg)(next).ServeHTTP(w, request)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestNewBodyLimiter(t *testing.T) {
+	cfg := config.GetTestConfig()
+	cfg.MaxBodySize = 5
+
+	var body []byte
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = readBody(w, r)
+	})
 
+	// body within limit.
+	request := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("12345"))
+	w := httptest.NewRecorder()
+	NewBodyLimiter(cfg)(next).ServeHTTP(w, request)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "12345", string(body))
+
+	// body with known length is rejected before reading.
+	request = httptest.NewRequest(http.MethodPost, "/", strings.NewReader("123456"))
+	w = httptest.NewRecorder()
+	NewBodyLimiter(cfg)(next).ServeHTTP(w, request)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+
+	// body with unknown length is rejected while reading.
+	request = httptest.NewRequest(http.MethodPost, "/", io.MultiReader(strings.NewReader("123"), strings.NewReader("456")))
+	request.ContentLength = -1
+	w = httptest.NewRecorder()
+	NewBodyLimiter(cfg)(next).ServeHTTP(w, request)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+}
+
+// gzipBody compresses data.
+func gzipBody(t *testing.T, data string) io.Reader {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	_, err := gz.Write([]byte(data))
+	assert.NoError(t, err)
+	assert.NoError(t, gz.Close())
+	return &buf
+}
+
+func TestCookieMiddleware_InvalidCookie(t *testing.T) {
+	for _, value := range []string{"badCookie12", "abcdef"} {
+		request := httptest.NewRequest(http.MethodGet, "/ping", nil)
+		request.AddCookie(&http.Cookie{Name: "userID", Value: value})
+		w := httptest.NewRecorder()
+
+		served := false
+		next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			served = true
+		})
+
+		CookieMiddleware(next).ServeHTTP(w, request)
+
+		// invalid cookie is replaced with new one.
+		assert.True(t, served, value)
+		assert.Equal(t, http.StatusOK, w.Code, value)
+		assert.NotEmpty(t, w.Result().Cookies(), value)
+	}
 }
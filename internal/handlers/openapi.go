@@ -0,0 +1,293 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// openAPIVersion is version of OpenAPI specification of API v2 document.
+const openAPIVersion = "3.0.3"
+
+// routeDoc describes endpoint of API v2 in OpenAPI document.
+type routeDoc struct {
+	id      string
+	summary string
+	tag     string
+	// request is value of JSON body type. Nil means request hasn't body.
+	request interface{}
+	// responses are successful responses.
+	responses []routeResponse
+	// errors are codes of errors, which are specific for endpoint.
+	// Errors of every endpoint, rate limits and trusted subnet are added to document automatically.
+	errors []ErrorCode
+}
+
+// routeResponse is successful response of endpoint.
+type routeResponse struct {
+	code        int
+	description string
+	// body is value of JSON body type. Nil means response hasn't body.
+	body interface{}
+}
+
+// openAPI is OpenAPI 3 document.
+type openAPI struct {
+	OpenAPI    string                                 `json:"openapi"`
+	Info       openAPIInfo                            `json:"info"`
+	Servers    []openAPIServer                        `json:"servers"`
+	Paths      map[string]map[string]openAPIOperation `json:"paths"`
+	Components openAPIComponents                      `json:"components"`
+}
+
+// openAPIInfo is metadata of API.
+type openAPIInfo struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+// openAPIServer is url of API.
+type openAPIServer struct {
+	URL string `json:"url"`
+}
+
+// openAPIComponents are schemas, which are referenced by operations.
+type openAPIComponents struct {
+	Schemas map[string]*openAPISchema `json:"schemas"`
+}
+
+// openAPIOperation is method of path.
+type openAPIOperation struct {
+	OperationID string                     `json:"operationId"`
+	Summary     string                     `json:"summary"`
+	Tags        []string                   `json:"tags,omitempty"`
+	Parameters  []openAPIParameter         `json:"parameters,omitempty"`
+	RequestBody *openAPIRequestBody        `json:"requestBody,omitempty"`
+	Responses   map[string]openAPIResponse `json:"responses"`
+}
+
+// openAPIParameter is parameter of operation.
+type openAPIParameter struct {
+	Name     string         `json:"name"`
+	In       string         `json:"in"`
+	Required bool           `json:"required"`
+	Schema   *openAPISchema `json:"schema"`
+}
+
+// openAPIRequestBody is body of request.
+type openAPIRequestBody struct {
+	Required bool                        `json:"required"`
+	Content  map[string]openAPIMediaType `json:"content"`
+}
+
+// openAPIResponse is response of operation.
+type openAPIResponse struct {
+	Description string                      `json:"description"`
+	Content     map[string]openAPIMediaType `json:"content,omitempty"`
+}
+
+// openAPIMediaType is schema of content type.
+type openAPIMediaType struct {
+	Schema *openAPISchema `json:"schema"`
+}
+
+// openAPISchema is JSON schema of value.
+type openAPISchema struct {
+	Ref                  string                    `json:"$ref,omitempty"`
+	Type                 string                    `json:"type,omitempty"`
+	Format               string                    `json:"format,omitempty"`
+	Nullable             bool                      `json:"nullable,omitempty"`
+	Items                *openAPISchema            `json:"items,omitempty"`
+	Properties           map[string]*openAPISchema `json:"properties,omitempty"`
+	Required             []string                  `json:"required,omitempty"`
+	AdditionalProperties *openAPISchema            `json:"additionalProperties,omitempty"`
+}
+
+// pathParam is parameter in chi route pattern, which can have regexp after colon.
+var pathParam = regexp.MustCompile(`{([^}:]+)(:[^}]*)?}`)
+
+// timeType is type of time, which is string in JSON.
+var timeType = reflect.TypeOf(time.Time{})
+
+// schemaRegistry builds schemas of Go types. Named structs are components of document.
+type schemaRegistry map[string]*openAPISchema
+
+// schema gets schema of type.
+func (schemas schemaRegistry) schema(t reflect.Type) *openAPISchema {
+	switch {
+	case t == timeType:
+		return &openAPISchema{Type: "string", Format: "date-time"}
+	case t.Kind() == reflect.Ptr:
+		s := schemas.schema(t.Elem())
+		if s.Ref != "" {
+			return s
+		}
+		nullable := *s
+		nullable.Nullable = true
+		return &nullable
+	case t.Kind() == reflect.Struct:
+		name := t.Name()
+		if _, ok := schemas[name]; !ok {
+			// reserve name, so recursive types are finished.
+			schemas[name] = nil
+			s := &openAPISchema{Type: "object", Properties: make(map[string]*openAPISchema)}
+			schemas.addFields(s, t)
+			sort.Strings(s.Required)
+			schemas[name] = s
+		}
+		return &openAPISchema{Ref: "#/components/schemas/" + name}
+	case t.Kind() == reflect.Slice:
+		return &openAPISchema{Type: "array", Items: schemas.schema(t.Elem())}
+	case t.Kind() == reflect.Map:
+		return &openAPISchema{Type: "object", AdditionalProperties: schemas.schema(t.Elem())}
+	case t.Kind() == reflect.String:
+		return &openAPISchema{Type: "string"}
+	case t.Kind() == reflect.Bool:
+		return &openAPISchema{Type: "boolean"}
+	case t.Kind() >= reflect.Int && t.Kind() <= reflect.Int32, t.Kind() >= reflect.Uint && t.Kind() <= reflect.Uint32:
+		return &openAPISchema{Type: "integer", Format: "int32"}
+	case t.Kind() == reflect.Int64 || t.Kind() == reflect.Uint64:
+		return &openAPISchema{Type: "integer", Format: "int64"}
+	case t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64:
+		return &openAPISchema{Type: "number"}
+	default:
+		return &openAPISchema{}
+	}
+}
+
+// addFields adds JSON fields of struct to schema. Fields of embedded structs are fields of struct,
+// fields without omitempty are required.
+func (schemas schemaRegistry) addFields(s *openAPISchema, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+
+		name, options, _ := strings.Cut(tag, ",")
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			schemas.addFields(s, field.Type)
+			continue
+		}
+
+		if !field.IsExported() {
+			continue
+		}
+
+		if name == "" {
+			name = field.Name
+		}
+
+		s.Properties[name] = schemas.schema(field.Type)
+		if !strings.Contains(options, "omitempty") {
+			s.Required = append(s.Required, name)
+		}
+	}
+}
+
+// jsonContent gets JSON content of value type.
+func (schemas schemaRegistry) jsonContent(contentType string, v interface{}) map[string]openAPIMediaType {
+	return map[string]openAPIMediaType{contentType: {Schema: schemas.schema(reflect.TypeOf(v))}}
+}
+
+// operation gets OpenAPI operation of route.
+func (schemas schemaRegistry) operation(route apiV2Route) openAPIOperation {
+	doc := route.doc
+	op := openAPIOperation{
+		OperationID: doc.id,
+		Summary:     doc.summary,
+		Responses:   make(map[string]openAPIResponse),
+	}
+	if doc.tag != "" {
+		op.Tags = []string{doc.tag}
+	}
+
+	for _, match := range pathParam.FindAllStringSubmatch(route.pattern, -1) {
+		op.Parameters = append(op.Parameters, openAPIParameter{
+			Name: match[1], In: "path", Required: true, Schema: &openAPISchema{Type: "string"},
+		})
+	}
+
+	errs := append([]ErrorCode{}, doc.errors...)
+	if route.idempotent {
+		op.Parameters = append(op.Parameters, openAPIParameter{
+			Name: IdempotencyKeyHeader, In: "header", Schema: &openAPISchema{Type: "string"},
+		})
+		errs = append(errs, CodeIdempotencyInUse, CodeIdempotencyReuse)
+	}
+	if doc.request != nil {
+		op.RequestBody = &openAPIRequestBody{Required: true, Content: schemas.jsonContent("application/json", doc.request)}
+		errs = append(errs, CodeInvalidBody)
+	}
+	if route.class != "" {
+		errs = append(errs, CodeRateLimited)
+	}
+	if route.trusted {
+		errs = append(errs, CodeForbidden)
+	}
+	errs = append(errs, CodeInternal)
+
+	for _, resp := range doc.responses {
+		response := openAPIResponse{Description: resp.description}
+		if resp.body != nil {
+			response.Content = schemas.jsonContent("application/json", resp.body)
+		}
+		op.Responses[strconv.Itoa(resp.code)] = response
+	}
+
+	for _, code := range errs {
+		status := strconv.Itoa(errorStatuses[code].http)
+		if _, ok := op.Responses[status]; ok {
+			continue
+		}
+		op.Responses[status] = openAPIResponse{
+			Description: http.StatusText(errorStatuses[code].http) + ".",
+			Content:     schemas.jsonContent(ProblemContentType, Problem{}),
+		}
+	}
+
+	return op
+}
+
+// openAPIDocument gets OpenAPI document of API v2, which is served at server url.
+func openAPIDocument(server string) openAPI {
+	schemas := make(schemaRegistry)
+	doc := openAPI{
+		OpenAPI: openAPIVersion,
+		Info:    openAPIInfo{Title: "URL shortener API", Version: "2.0.0"},
+		Servers: []openAPIServer{{URL: server}},
+		Paths:   make(map[string]map[string]openAPIOperation),
+	}
+
+	for _, route := range apiV2Routes {
+		path := pathParam.ReplaceAllString(route.pattern, "{$1}")
+		if doc.Paths[path] == nil {
+			doc.Paths[path] = make(map[string]openAPIOperation)
+		}
+		doc.Paths[path][strings.ToLower(route.method)] = schemas.operation(route)
+	}
+
+	doc.Components.Schemas = schemas
+	return doc
+}
+
+// OpenAPIHandler returns OpenAPI document of API v2, which is served at server url.
+func OpenAPIHandler(server string) http.HandlerFunc {
+	data, err := json.Marshal(openAPIDocument(server))
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	}
+}
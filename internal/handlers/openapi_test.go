@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/size12/url-shortener/internal/config"
+	"github.com/size12/url-shortener/internal/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOpenAPIHandler(t *testing.T) {
+	cfg := config.GetTestConfig()
+	s, err := storage.NewMapStorage(cfg)
+	assert.NoError(t, err)
+	service := NewService(cfg, s)
+	r := apiV2Router(service)
+
+	w := apiV2Request(r, http.MethodGet, "/openapi.json", "", "user12")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+
+	var doc openAPI
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &doc))
+	assert.Equal(t, openAPIVersion, doc.OpenAPI)
+	assert.Equal(t, cfg.BaseURL+APIv2Prefix, doc.Servers[0].URL)
+
+	// every served route is documented, and every documented route is served.
+	served := make(map[string]bool)
+	err = chi.Walk(r, func(method, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		path := strings.TrimPrefix(route, APIv2Prefix)
+		if path != "/openapi.json" {
+			served[strings.ToLower(method)+" "+path] = true
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+
+	documented := make(map[string]bool)
+	for path, operations := range doc.Paths {
+		for method, op := range operations {
+			documented[method+" "+path] = true
+			assert.NotEmpty(t, op.OperationID)
+			assert.NotEmpty(t, op.Responses)
+		}
+	}
+	assert.Equal(t, served, documented)
+
+	// references are resolved.
+	var refs []string
+	var collect func(s *openAPISchema)
+	collect = func(s *openAPISchema) {
+		if s == nil {
+			return
+		}
+		if s.Ref != "" {
+			refs = append(refs, strings.TrimPrefix(s.Ref, "#/components/schemas/"))
+		}
+		collect(s.Items)
+		collect(s.AdditionalProperties)
+		for _, property := range s.Properties {
+			collect(property)
+		}
+	}
+	for _, schema := range doc.Components.Schemas {
+		collect(schema)
+	}
+	for _, operations := range doc.Paths {
+		for _, op := range operations {
+			if op.RequestBody != nil {
+				for _, media := range op.RequestBody.Content {
+					collect(media.Schema)
+				}
+			}
+			for _, response := range op.Responses {
+				for _, media := range response.Content {
+					collect(media.Schema)
+				}
+			}
+		}
+	}
+	for _, ref := range refs {
+		assert.Contains(t, doc.Components.Schemas, ref)
+	}
+}
+
+func TestOpenAPIDocument(t *testing.T) {
+	doc := openAPIDocument("https://short.example/api/v2")
+
+	// schemas are built from types of responses.
+	link := doc.Components.Schemas["LinkResource"]
+	assert.Equal(t, []string{"created_at", "id", "original_url", "short_url"}, link.Required)
+	assert.Equal(t, &openAPISchema{Type: "string", Format: "date-time", Nullable: true}, link.Properties["expires_at"])
+	assert.Equal(t, &openAPISchema{Type: "integer", Format: "int32"}, link.Properties["redirect_code"])
+
+	list := doc.Components.Schemas["LinkList"]
+	assert.Equal(t, &openAPISchema{Type: "array", Items: &openAPISchema{Ref: "#/components/schemas/LinkResource"}},
+		list.Properties["links"])
+
+	create := doc.Paths["/links"]["post"]
+	assert.Equal(t, "#/components/schemas/CreateLinkRequest", create.RequestBody.Content["application/json"].Schema.Ref)
+	assert.Contains(t, create.Responses, "201")
+	assert.Contains(t, create.Responses, "429")
+	assert.Equal(t, "#/components/schemas/Problem", create.Responses["400"].Content[ProblemContentType].Schema.Ref)
+
+	get := doc.Paths["/links/{id}"]["get"]
+	assert.Equal(t, []openAPIParameter{{Name: "id", In: "path", Required: true, Schema: &openAPISchema{Type: "string"}}},
+		get.Parameters)
+	assert.Contains(t, get.Responses, "410")
+
+	assert.Contains(t, doc.Paths["/stats"]["get"].Responses, "403")
+}
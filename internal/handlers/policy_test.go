@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/size12/url-shortener/internal/config"
+	"github.com/size12/url-shortener/internal/storage"
+	pb "github.com/size12/url-shortener/pkg/grpc"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestURLPostHandler_Policy(t *testing.T) {
+	cfg := config.GetTestConfig()
+	s, err := storage.NewMapStorage(cfg)
+	assert.NoError(t, err)
+	r := redirectRouter(NewService(cfg, s))
+
+	tests := []struct {
+		name        string
+		target      string
+		contentType string
+		body        string
+		code        int
+	}{
+		{"javascript url", "/", "text/plain", "javascript:alert(1)", http.StatusUnprocessableEntity},
+		{"loop to short link", "/", "text/plain", cfg.BaseURL + "/1", http.StatusUnprocessableEntity},
+		{"private address", "/api/shorten", "application/json", `{"url":"http://192.168.0.1/admin"}`, http.StatusUnprocessableEntity},
+		{"relative url", "/api/shorten", "application/json", `{"url":"/page"}`, http.StatusBadRequest},
+		{"batch", "/api/shorten/batch", "application/json",
+			`[{"correlation_id":"1","original_url":"https://yandex.ru"},{"correlation_id":"2","original_url":"data:text/html,hi"}]`,
+			http.StatusUnprocessableEntity},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			res := doRequest(r, http.MethodPost, tc.target, tc.contentType, tc.body, nil)
+			assert.Equal(t, tc.code, res.StatusCode)
+		})
+	}
+
+	stat, err := s.GetStatistic(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 0, stat.Urls)
+}
+
+func TestShortenerServer_CreateShort_Policy(t *testing.T) {
+	cfg := config.GetTestConfig()
+	s, err := storage.NewMapStorage(cfg)
+	assert.NoError(t, err)
+	server := NewShortenerServer(cfg, NewService(cfg, s))
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.New(map[string]string{"userID": "user12"}))
+
+	_, err = server.CreateShort(ctx, &pb.Link{LongUrl: "javascript:alert(1)"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = server.CreateShort(ctx, &pb.Link{LongUrl: "http://localhost/"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/size12/url-shortener/internal/config"
+	"github.com/size12/url-shortener/internal/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+// previewRouter gets router with redirect and preview routes.
+func previewRouter(service *Service) *chi.Mux {
+	r := redirectRouter(service)
+	r.Get("/{id}+", PreviewHandler(service))
+	return r
+}
+
+// getPage gets status code and body of page.
+func getPage(r http.Handler, target string) (int, string) {
+	request := httptest.NewRequest(http.MethodGet, target, nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, request)
+	return w.Code, w.Body.String()
+}
+
+func TestPreviewHandler(t *testing.T) {
+	cfg := config.GetTestConfig()
+	s, err := storage.NewMapStorage(cfg)
+	assert.NoError(t, err)
+	r := previewRouter(NewService(cfg, s))
+
+	res := doRequest(r, http.MethodPost, "/api/shorten", "application/json",
+		`{"url":"https://yandex.ru/news","title":"<b>News</b>","query_mode":"append"}`, nil)
+	assert.Equal(t, http.StatusCreated, res.StatusCode)
+
+	code, body := getPage(r, "/1+")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Contains(t, body, "&lt;b&gt;News&lt;/b&gt;")
+	assert.Contains(t, body, `href="https://yandex.ru/news"`)
+	assert.Contains(t, body, "Created: ")
+	assert.Contains(t, body, `href="/1/report"`)
+
+	// preview parameter isn't forwarded to long url.
+	code, body = getPage(r, "/1?preview=1&a=b")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Contains(t, body, `href="https://yandex.ru/news?a=b"`)
+
+	res = doRequest(r, http.MethodGet, "/1?preview=0", "", "", nil)
+	assert.Equal(t, http.StatusTemporaryRedirect, res.StatusCode)
+
+	res = doRequest(r, http.MethodGet, "/100+", "", "", nil)
+	assert.Equal(t, http.StatusNotFound, res.StatusCode)
+
+	// link always shows preview.
+	res = doRequest(r, http.MethodPost, "/?always_preview=true&title=Maps", "text/plain", "https://yandex.ru/maps", nil)
+	assert.Equal(t, http.StatusCreated, res.StatusCode)
+
+	code, body = getPage(r, "/2")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Contains(t, body, "<h1>Maps</h1>")
+
+	res = doRequest(r, http.MethodPost, "/?always_preview=maybe", "text/plain", "https://yandex.ru/music", nil)
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+}
+
+func TestURLGetHandler_PreviewMode(t *testing.T) {
+	cfg := config.GetTestConfig()
+	s, err := storage.NewMapStorage(cfg)
+	assert.NoError(t, err)
+
+	checker := &hostChecker{hosts: []string{"phish.ru"}}
+	service := NewService(cfg, s)
+	_, err = service.storage.CreateShort(context.Background(), "user12", "https://phish.ru", "https://mail.yandex.ru", "https://google.com")
+	assert.NoError(t, err)
+
+	// flagged destinations.
+	cfg.PreviewMode = PreviewFlagged
+	r := previewRouter(NewService(cfg, s, WithURLChecker(checker)))
+
+	code, body := getPage(r, "/1")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Contains(t, body, "Warning:")
+	assert.Contains(t, body, "phishing")
+
+	res := doRequest(r, http.MethodGet, "/3", "", "", nil)
+	assert.Equal(t, http.StatusTemporaryRedirect, res.StatusCode)
+
+	// external destinations.
+	cfg.PreviewMode = PreviewExternal
+	cfg.PreviewTrustedDomains = "yandex.ru, example.com"
+	r = previewRouter(NewService(cfg, s, WithURLChecker(checker)))
+
+	res = doRequest(r, http.MethodGet, "/2", "", "", nil)
+	assert.Equal(t, http.StatusTemporaryRedirect, res.StatusCode)
+
+	code, body = getPage(r, "/3")
+	assert.Equal(t, http.StatusOK, code)
+	assert.NotContains(t, body, "Warning:")
+}
@@ -0,0 +1,296 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/size12/url-shortener/internal/logger"
+	"github.com/size12/url-shortener/internal/policy"
+	"github.com/size12/url-shortener/internal/qrcode"
+	"github.com/size12/url-shortener/internal/storage"
+	"github.com/size12/url-shortener/internal/threat"
+	"github.com/size12/url-shortener/internal/urlnorm"
+	"go.uber.org/zap"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ProblemContentType is content type of RFC 7807 error responses.
+const ProblemContentType = "application/problem+json"
+
+// errorDomain is domain of gRPC error details.
+const errorDomain = "url-shortener"
+
+// ErrorCode is stable code of error. Clients should rely on it, not on error message.
+type ErrorCode string
+
+// Codes of errors.
+const (
+	CodeInvalidBody      ErrorCode = "invalid_body"
+	CodeBodyTooLarge     ErrorCode = "body_too_large"
+	CodeInvalidURL       ErrorCode = "invalid_url"
+	CodeURLTooLong       ErrorCode = "url_too_long"
+	CodeForbiddenURL     ErrorCode = "forbidden_url"
+	CodeMaliciousURL     ErrorCode = "malicious_url"
+	CodeInvalidOptions   ErrorCode = "invalid_options"
+	CodeUnknownUTMPreset ErrorCode = "unknown_utm_preset"
+	CodeBatchTooLarge    ErrorCode = "batch_too_large"
+	CodeInvalidRequest   ErrorCode = "invalid_request"
+	CodeUnauthenticated  ErrorCode = "unauthenticated"
+	CodeForbidden        ErrorCode = "forbidden"
+	CodeNotFound         ErrorCode = "not_found"
+	CodeLinkDeleted      ErrorCode = "link_deleted"
+	CodeLinkExpired      ErrorCode = "link_expired"
+	CodeLinkBlocked      ErrorCode = "link_blocked"
+	CodeMethodNotAllowed ErrorCode = "method_not_allowed"
+	CodeRateLimited      ErrorCode = "rate_limited"
+	CodeIdempotencyInUse ErrorCode = "idempotency_key_in_use"
+	CodeIdempotencyReuse ErrorCode = "idempotency_key_reused"
+	CodeUnavailable      ErrorCode = "unavailable"
+	CodeInternal         ErrorCode = "internal"
+)
+
+// errorStatus is how errors of code are answered over HTTP and gRPC.
+type errorStatus struct {
+	http int
+	grpc codes.Code
+}
+
+// errorStatuses are statuses of error codes.
+var errorStatuses = map[ErrorCode]errorStatus{
+	CodeInvalidBody:      {http.StatusBadRequest, codes.InvalidArgument},
+	CodeBodyTooLarge:     {http.StatusRequestEntityTooLarge, codes.InvalidArgument},
+	CodeInvalidURL:       {http.StatusBadRequest, codes.InvalidArgument},
+	CodeURLTooLong:       {http.StatusBadRequest, codes.InvalidArgument},
+	CodeForbiddenURL:     {http.StatusUnprocessableEntity, codes.InvalidArgument},
+	CodeMaliciousURL:     {http.StatusUnprocessableEntity, codes.InvalidArgument},
+	CodeInvalidOptions:   {http.StatusBadRequest, codes.InvalidArgument},
+	CodeUnknownUTMPreset: {http.StatusBadRequest, codes.InvalidArgument},
+	CodeBatchTooLarge:    {http.StatusRequestEntityTooLarge, codes.InvalidArgument},
+	CodeInvalidRequest:   {http.StatusBadRequest, codes.InvalidArgument},
+	CodeUnauthenticated:  {http.StatusUnauthorized, codes.Unauthenticated},
+	CodeForbidden:        {http.StatusForbidden, codes.PermissionDenied},
+	CodeNotFound:         {http.StatusNotFound, codes.NotFound},
+	CodeLinkDeleted:      {http.StatusGone, codes.NotFound},
+	CodeLinkExpired:      {http.StatusGone, codes.NotFound},
+	CodeLinkBlocked:      {http.StatusUnavailableForLegalReasons, codes.PermissionDenied},
+	CodeMethodNotAllowed: {http.StatusMethodNotAllowed, codes.Unimplemented},
+	CodeRateLimited:      {http.StatusTooManyRequests, codes.ResourceExhausted},
+	CodeIdempotencyInUse: {http.StatusConflict, codes.Aborted},
+	CodeIdempotencyReuse: {http.StatusUnprocessableEntity, codes.FailedPrecondition},
+	CodeUnavailable:      {http.StatusServiceUnavailable, codes.Unavailable},
+	CodeInternal:         {http.StatusInternalServerError, codes.Internal},
+}
+
+// Error is error of service with stable code.
+// Message is shown to clients, wrapped error is only logged, so internals don't leak.
+type Error struct {
+	Code    ErrorCode
+	Message string
+	// Status overrides HTTP status of code, for example takedown is answered with its own code.
+	Status int
+	Err    error
+}
+
+// NewError gets error of code with message for clients.
+func NewError(code ErrorCode, message string) *Error {
+	return &Error{Code: code, Message: message}
+}
+
+// Error returns message of error.
+func (e *Error) Error() string {
+	if e.Err != nil && e.Err.Error() != e.Message {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+// Unwrap gets wrapped error.
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// HTTPStatus gets HTTP status code of error.
+func (e *Error) HTTPStatus() int {
+	if e.Status != 0 {
+		return e.Status
+	}
+	return errorStatuses[e.Code].http
+}
+
+// GRPCCode gets gRPC status code of error.
+func (e *Error) GRPCCode() codes.Code {
+	return errorStatuses[e.Code].grpc
+}
+
+// clientErrors are known errors and their codes. Messages of these errors are shown to clients.
+var clientErrors = []struct {
+	err  error
+	code ErrorCode
+}{
+	{ErrBodyTooLarge, CodeBodyTooLarge},
+	{ErrBatchTooLarge, CodeBatchTooLarge},
+	{ErrURLTooLong, CodeURLTooLong},
+	{ErrUnknownUTMPreset, CodeUnknownUTMPreset},
+	{ErrInvalidUTMPresetName, CodeInvalidRequest},
+	{policy.ErrInvalidURL, CodeInvalidURL},
+	{urlnorm.ErrInvalidHost, CodeInvalidURL},
+	{policy.ErrForbiddenURL, CodeForbiddenURL},
+	{threat.ErrMaliciousURL, CodeMaliciousURL},
+	{storage.ErrInvalidOptions, CodeInvalidOptions},
+	{ErrInvalidRedirectCodeParam, CodeInvalidOptions},
+	{ErrInvalidForwardPathParam, CodeInvalidOptions},
+	{ErrInvalidPreviewParam, CodeInvalidOptions},
+	{ErrInvalidExpiresAtParam, CodeInvalidOptions},
+	{ErrInvalidQRFormat, CodeInvalidRequest},
+	{ErrInvalidQRSize, CodeInvalidRequest},
+	{ErrInvalidQRMargin, CodeInvalidRequest},
+	{qrcode.ErrInvalidLevel, CodeInvalidRequest},
+	{ErrInvalidTakedownKind, CodeInvalidRequest},
+	{ErrInvalidTakedownTarget, CodeInvalidRequest},
+	{ErrInvalidTakedownCode, CodeInvalidRequest},
+	{ErrTakedownReason, CodeInvalidRequest},
+	{ErrReportReason, CodeInvalidRequest},
+	{ErrJobTooLarge, CodeBatchTooLarge},
+	{ErrEmptyJob, CodeInvalidRequest},
+	{ErrInvalidJobFormat, CodeInvalidRequest},
+	{ErrInvalidJobOffset, CodeInvalidRequest},
+	{ErrInvalidWebhookEvents, CodeInvalidRequest},
+	{ErrInvalidWebhookSecret, CodeInvalidRequest},
+	{ErrTooManyWebhooks, CodeInvalidRequest},
+	{ErrInvalidDeliveryStatus, CodeInvalidRequest},
+	{ErrInvalidDeliveryLimit, CodeInvalidRequest},
+	{ErrIdempotencyKeyTooLong, CodeInvalidRequest},
+	{ErrIdempotencyKeyInUse, CodeIdempotencyInUse},
+	{ErrIdempotencyKeyReused, CodeIdempotencyReuse},
+	{ErrLinkExpired, CodeLinkExpired},
+	{storage.Err410, CodeLinkDeleted},
+	{storage.Err404, CodeNotFound},
+}
+
+// linkMessages are messages of link errors, which are friendlier than messages of storage errors.
+var linkMessages = map[ErrorCode]string{
+	CodeNotFound:    "not found",
+	CodeLinkDeleted: "link is deleted",
+	CodeLinkExpired: "link is expired",
+}
+
+// AsError gets service error of err. Unknown errors are internal, their messages aren't shown to clients.
+func AsError(err error) *Error {
+	var serviceErr *Error
+	if errors.As(err, &serviceErr) {
+		return serviceErr
+	}
+
+	var takedownErr *TakedownError
+	if errors.As(err, &takedownErr) {
+		return &Error{Code: CodeLinkBlocked, Message: takedownErr.Error(), Status: takedownErr.Takedown.Code, Err: err}
+	}
+
+	var limitErr *RateLimitError
+	if errors.As(err, &limitErr) {
+		return &Error{Code: CodeRateLimited, Message: limitErr.Error(), Err: err}
+	}
+
+	for _, known := range clientErrors {
+		if errors.Is(err, known.err) {
+			message, ok := linkMessages[known.code]
+			if !ok {
+				message = err.Error()
+			}
+			return &Error{Code: known.code, Message: message, Err: err}
+		}
+	}
+
+	return &Error{Code: CodeInternal, Message: "internal server error", Err: err}
+}
+
+// invalidBody gets error of request body, which can't be decoded.
+func invalidBody(err error) *Error {
+	return &Error{Code: CodeInvalidBody, Message: err.Error(), Err: err}
+}
+
+// requestUser gets ID of user from cookie, which is set by CookieMiddleware.
+func requestUser(r *http.Request) (string, error) {
+	cookie, err := r.Cookie("userID")
+	if err != nil {
+		return "", &Error{Code: CodeUnauthenticated, Message: "missing userID cookie", Err: err}
+	}
+	return cookie.Value, nil
+}
+
+// Problem is RFC 7807 error response. Code is stable code of error.
+type Problem struct {
+	Type     string    `json:"type"`
+	Title    string    `json:"title"`
+	Status   int       `json:"status"`
+	Detail   string    `json:"detail,omitempty"`
+	Instance string    `json:"instance,omitempty"`
+	Code     ErrorCode `json:"code"`
+}
+
+// logInternal logs error, if it's internal, because its details aren't sent to clients.
+func logInternal(ctx context.Context, e *Error) {
+	if e.Code == CodeInternal || e.Code == CodeUnavailable {
+		logger.FromContext(ctx).Error("Request failed", zap.String("code", string(e.Code)), zap.Error(e.Err))
+	}
+}
+
+// writeError writes error as application/problem+json response.
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	e := AsError(err)
+	logInternal(r.Context(), e)
+
+	var limitErr *RateLimitError
+	if errors.As(err, &limitErr) {
+		w.Header().Set("Retry-After", limitErr.retryAfterSeconds())
+	}
+
+	status := e.HTTPStatus()
+	data, err := json.Marshal(Problem{
+		Type:     "about:blank",
+		Title:    http.StatusText(status),
+		Status:   status,
+		Detail:   e.Message,
+		Instance: r.URL.Path,
+		Code:     e.Code,
+	})
+	if err != nil {
+		// problem always can be marshaled.
+		http.Error(w, e.Message, status)
+		return
+	}
+
+	w.Header().Set("Content-Type", ProblemContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	w.Write(data)
+}
+
+// grpcError converts error to gRPC status with stable code of error in details.
+func grpcError(ctx context.Context, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var limitErr *RateLimitError
+	if errors.As(err, &limitErr) {
+		return rateLimitStatus(ctx, limitErr)
+	}
+
+	e := AsError(err)
+	logInternal(ctx, e)
+	return grpcStatus(e)
+}
+
+// grpcStatus gets gRPC status of error with its stable code in ErrorInfo details.
+func grpcStatus(e *Error) error {
+	st := status.New(e.GRPCCode(), e.Message)
+	if withDetails, err := st.WithDetails(&errdetails.ErrorInfo{Reason: string(e.Code), Domain: errorDomain}); err == nil {
+		st = withDetails
+	}
+	return st.Err()
+}
@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/size12/url-shortener/internal/policy"
+	"github.com/size12/url-shortener/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestAsError(t *testing.T) {
+	tests := []struct {
+		name    string
+		err     error
+		code    ErrorCode
+		status  int
+		message string
+	}{
+		{"invalid url", fmt.Errorf("check: %w", policy.ErrInvalidURL), CodeInvalidURL, http.StatusBadRequest, "check: " + policy.ErrInvalidURL.Error()},
+		{"not found", storage.Err404, CodeNotFound, http.StatusNotFound, "not found"},
+		{"deleted", storage.Err410, CodeLinkDeleted, http.StatusGone, "link is deleted"},
+		{"body too large", ErrBodyTooLarge, CodeBodyTooLarge, http.StatusRequestEntityTooLarge, ErrBodyTooLarge.Error()},
+		{"service error", NewError(CodeForbidden, "forbidden"), CodeForbidden, http.StatusForbidden, "forbidden"},
+		{"internal", errors.New("pq: connection refused"), CodeInternal, http.StatusInternalServerError, "internal server error"},
+	}
+
+	for _, tt := range tests {
+		e := AsError(tt.err)
+		assert.Equal(t, tt.code, e.Code, tt.name)
+		assert.Equal(t, tt.status, e.HTTPStatus(), tt.name)
+		assert.Equal(t, tt.message, e.Message, tt.name)
+		assert.ErrorIs(t, e, tt.err, tt.name)
+	}
+
+	// takedown is answered with its own code.
+	e := AsError(&TakedownError{Takedown: storage.Takedown{Code: http.StatusUnavailableForLegalReasons}})
+	assert.Equal(t, CodeLinkBlocked, e.Code)
+	assert.Equal(t, http.StatusUnavailableForLegalReasons, e.HTTPStatus())
+	assert.Equal(t, codes.PermissionDenied, e.GRPCCode())
+}
+
+func TestWriteError(t *testing.T) {
+	request := httptest.NewRequest(http.MethodPost, "/api/shorten", nil)
+	w := httptest.NewRecorder()
+	writeError(w, request, errors.New("pq: password authentication failed for user admin"))
+
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, ProblemContentType, w.Header().Get("Content-Type"))
+	assert.NotContains(t, w.Body.String(), "password")
+
+	var problem Problem
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &problem))
+	assert.Equal(t, Problem{
+		Type:     "about:blank",
+		Title:    "Internal Server Error",
+		Status:   http.StatusInternalServerError,
+		Detail:   "internal server error",
+		Instance: "/api/shorten",
+		Code:     CodeInternal,
+	}, problem)
+
+	w = httptest.NewRecorder()
+	writeError(w, request, policy.ErrForbiddenURL)
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &problem))
+	assert.Equal(t, CodeForbiddenURL, problem.Code)
+	assert.Equal(t, policy.ErrForbiddenURL.Error(), problem.Detail)
+}
+
+func TestRequestUser(t *testing.T) {
+	request := httptest.NewRequest(http.MethodGet, "/api/user/urls", nil)
+	_, err := requestUser(request)
+	assert.Equal(t, CodeUnauthenticated, AsError(err).Code)
+	assert.Equal(t, http.StatusUnauthorized, AsError(err).HTTPStatus())
+
+	request.AddCookie(&http.Cookie{Name: "userID", Value: "user12"})
+	userID, err := requestUser(request)
+	assert.NoError(t, err)
+	assert.Equal(t, "user12", userID)
+}
+
+func TestGRPCError(t *testing.T) {
+	ctx := context.Background()
+	assert.NoError(t, grpcError(ctx, nil))
+
+	tests := []struct {
+		err    error
+		code   codes.Code
+		reason ErrorCode
+	}{
+		{storage.Err404, codes.NotFound, CodeNotFound},
+		{ErrLinkExpired, codes.NotFound, CodeLinkExpired},
+		{policy.ErrInvalidURL, codes.InvalidArgument, CodeInvalidURL},
+		{NewError(CodeUnauthenticated, "wrong metadata"), codes.Unauthenticated, CodeUnauthenticated},
+		{errors.New("pq: connection refused"), codes.Internal, CodeInternal},
+	}
+
+	for _, tt := range tests {
+		st := status.Convert(grpcError(ctx, tt.err))
+		assert.Equal(t, tt.code, st.Code(), tt.err.Error())
+		assert.NotContains(t, st.Message(), "pq:")
+
+		details := st.Details()
+		if assert.Len(t, details, 1) {
+			info, ok := details[0].(*errdetails.ErrorInfo)
+			assert.True(t, ok)
+			assert.Equal(t, string(tt.reason), info.Reason)
+			assert.Equal(t, errorDomain, info.Domain)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/size12/url-shortener/internal/qrcode"
+)
+
+// Formats of QR code images.
+const (
+	QRFormatPNG = "png"
+	QRFormatSVG = "svg"
+)
+
+// Limits and defaults of QR code parameters.
+const (
+	minQRSize     = 64
+	maxQRSize     = 2048
+	maxQRMargin   = 16
+	defaultQRSize = 256
+	// defaultQRMargin is quiet zone, which is required by standard.
+	defaultQRMargin = 4
+)
+
+// qrCacheMaxAge is how long QR codes are cached by browser.
+// Short url of link never changes, but link can be taken down, so QR code isn't cached for long.
+const qrCacheMaxAge = 5 * time.Minute
+
+// Errors of QR code parameters.
+var (
+	ErrInvalidQRFormat = errors.New("format must be png or svg")
+	ErrInvalidQRSize   = errors.New("size must be from 64 to 2048")
+	ErrInvalidQRMargin = errors.New("margin must be from 0 to 16")
+)
+
+// QROptions are parameters of QR code image.
+type QROptions struct {
+	Format string
+	// Size is side of image in pixels. PNG side is rounded down to whole pixels per module.
+	Size   int
+	Margin int
+	Level  qrcode.Level
+}
+
+// DefaultQROptions gets parameters of QR code, which aren't set in request.
+func DefaultQROptions() QROptions {
+	return QROptions{Format: QRFormatPNG, Size: defaultQRSize, Margin: defaultQRMargin, Level: qrcode.Medium}
+}
+
+// Validate checks parameters of QR code.
+func (opts QROptions) Validate() error {
+	if opts.Format != QRFormatPNG && opts.Format != QRFormatSVG {
+		return ErrInvalidQRFormat
+	}
+
+	if opts.Size < minQRSize || opts.Size > maxQRSize {
+		return ErrInvalidQRSize
+	}
+
+	if opts.Margin < 0 || opts.Margin > maxQRMargin {
+		return ErrInvalidQRMargin
+	}
+
+	if opts.Level < qrcode.Low || opts.Level > qrcode.High {
+		return qrcode.ErrInvalidLevel
+	}
+
+	return nil
+}
+
+// ContentType gets content type of image.
+func (opts QROptions) ContentType() string {
+	if opts.Format == QRFormatSVG {
+		return "image/svg+xml"
+	}
+	return "image/png"
+}
+
+// GetQRCode gets image of QR code with short url of link and how long image can be cached,
+// which is not longer than link works.
+// Like redirect, it returns *TakedownError, if link is taken down, and ErrLinkExpired, if link is expired.
+func (service *Service) GetQRCode(ctx context.Context, id string, opts QROptions) ([]byte, time.Duration, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, 0, err
+	}
+
+	link, err := service.getActiveLink(ctx, id)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	maxAge := qrCacheMaxAge
+	if link.Options.ExpiresAt != nil {
+		if left := time.Until(*link.Options.ExpiresAt); left < maxAge {
+			maxAge = left
+		}
+	}
+
+	code, err := qrcode.Encode([]byte(service.cfg.BaseURL+"/"+id), opts.Level)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if opts.Format == QRFormatSVG {
+		return code.SVG(opts.Size, opts.Margin), maxAge, nil
+	}
+	image, err := code.PNG(opts.Size, opts.Margin)
+	return image, maxAge, err
+}
+
+// queryQROptions gets parameters of QR code from query: format, size, margin and level.
+func queryQROptions(r *http.Request) (QROptions, error) {
+	query := r.URL.Query()
+	opts := DefaultQROptions()
+
+	if format := query.Get("format"); format != "" {
+		opts.Format = format
+	}
+
+	if size := query.Get("size"); size != "" {
+		n, err := strconv.Atoi(size)
+		if err != nil {
+			return opts, ErrInvalidQRSize
+		}
+		opts.Size = n
+	}
+
+	if margin := query.Get("margin"); margin != "" {
+		n, err := strconv.Atoi(margin)
+		if err != nil {
+			return opts, ErrInvalidQRMargin
+		}
+		opts.Margin = n
+	}
+
+	if level := query.Get("level"); level != "" {
+		l, err := qrcode.ParseLevel(level)
+		if err != nil {
+			return opts, err
+		}
+		opts.Level = l
+	}
+
+	return opts, nil
+}
+
+// QRCodeHandler returns PNG or SVG image of QR code with short url of link.
+func QRCodeHandler(service *Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		opts, err := queryQROptions(r)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		image, maxAge, err := service.GetQRCode(r.Context(), chi.URLParam(r, "id"), opts)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		// QR code isn't kept in shared caches, because they would show it after link is taken down.
+		w.Header().Set("Content-Type", opts.ContentType())
+		w.Header().Set("Cache-Control", "private, max-age="+strconv.Itoa(int(maxAge/time.Second)))
+		w.Write(image)
+	}
+}
@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/size12/url-shortener/internal/config"
+	"github.com/size12/url-shortener/internal/storage"
+	pb "github.com/size12/url-shortener/pkg/grpc"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestQRCodeHandler(t *testing.T) {
+	cfg := config.GetTestConfig()
+	s, err := storage.NewMapStorage(cfg)
+	assert.NoError(t, err)
+	service := NewService(cfg, s)
+	r := redirectRouter(service)
+	r.Get("/{id}/qr", QRCodeHandler(service))
+
+	res := doRequest(r, http.MethodPost, "/", "text/plain", "https://yandex.ru", nil)
+	assert.Equal(t, http.StatusCreated, res.StatusCode)
+
+	request := httptest.NewRequest(http.MethodGet, "/1/qr", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, request)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "image/png", w.Header().Get("Content-Type"))
+	assert.Equal(t, "private, max-age=300", w.Header().Get("Cache-Control"))
+
+	img, err := png.Decode(bytes.NewReader(w.Body.Bytes()))
+	assert.NoError(t, err)
+	assert.LessOrEqual(t, img.Bounds().Dx(), 256)
+	assert.Greater(t, img.Bounds().Dx(), 200)
+
+	request = httptest.NewRequest(http.MethodGet, "/1/qr?format=svg&size=512&margin=0&level=h", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, request)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "image/svg+xml", w.Header().Get("Content-Type"))
+	assert.True(t, strings.HasPrefix(w.Body.String(), "<svg"))
+	assert.Contains(t, w.Body.String(), `width="512"`)
+	assert.Contains(t, w.Body.String(), "M0,0h1v1h-1z")
+
+	for _, query := range []string{"format=gif", "size=10", "size=big", "margin=-1", "margin=17", "level=X"} {
+		res = doRequest(r, http.MethodGet, "/1/qr?"+query, "", "", nil)
+		assert.Equal(t, http.StatusBadRequest, res.StatusCode, query)
+	}
+
+	res = doRequest(r, http.MethodGet, "/100/qr", "", "", nil)
+	assert.Equal(t, http.StatusNotFound, res.StatusCode)
+
+	// QR code isn't cached longer than link works.
+	expiresAt := time.Now().Add(time.Minute).UTC().Format(time.RFC3339)
+	res = doRequest(r, http.MethodPost, "/api/shorten", "application/json",
+		`{"url":"https://yandex.ru/soon","expires_at":"`+expiresAt+`"}`, nil)
+	assert.Equal(t, http.StatusCreated, res.StatusCode)
+
+	request = httptest.NewRequest(http.MethodGet, "/2/qr", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, request)
+	assert.Equal(t, http.StatusOK, w.Code)
+	maxAge, err := strconv.Atoi(strings.TrimPrefix(w.Header().Get("Cache-Control"), "private, max-age="))
+	assert.NoError(t, err)
+	assert.LessOrEqual(t, maxAge, 60)
+	assert.Greater(t, maxAge, 0)
+}
+
+func TestQRCodeHandler_Disabled(t *testing.T) {
+	cfg := config.GetTestConfig()
+	s, err := storage.NewMapStorage(cfg)
+	assert.NoError(t, err)
+	service := NewService(cfg, s)
+	r := redirectRouter(service)
+	r.Get("/{id}/qr", QRCodeHandler(service))
+
+	res := doRequest(r, http.MethodPost, "/api/shorten", "application/json",
+		`{"url":"https://yandex.ru/expired","expires_at":"2020-01-01T00:00:00Z"}`, nil)
+	assert.Equal(t, http.StatusCreated, res.StatusCode)
+	res = doRequest(r, http.MethodPost, "/", "text/plain", "https://yandex.ru/blocked", nil)
+	assert.Equal(t, http.StatusCreated, res.StatusCode)
+	res = doRequest(r, http.MethodPost, "/", "text/plain", "https://mail.evil.ru/login", nil)
+	assert.Equal(t, http.StatusCreated, res.StatusCode)
+
+	_, err = service.Takedown(context.Background(), "admin", TakedownRequest{Kind: storage.TakedownLink, Target: "2", Reason: "court order"})
+	assert.NoError(t, err)
+	_, err = service.Takedown(context.Background(), "admin", TakedownRequest{Kind: storage.TakedownDomain, Target: "evil.ru", Reason: "phishing",
+		Code: http.StatusGone})
+	assert.NoError(t, err)
+
+	// QR codes of links, which don't redirect, aren't shown.
+	for id, code := range map[string]int{
+		"1": http.StatusGone,
+		"2": http.StatusUnavailableForLegalReasons,
+		"3": http.StatusGone,
+	} {
+		request := httptest.NewRequest(http.MethodGet, "/"+id+"/qr", nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, request)
+		assert.Equal(t, code, w.Code, id)
+		assert.NotEqual(t, "image/png", w.Header().Get("Content-Type"), id)
+	}
+
+	_, _, err = service.GetQRCode(context.Background(), "1", DefaultQROptions())
+	assert.ErrorIs(t, err, ErrLinkExpired)
+	var takedownErr *TakedownError
+	_, _, err = service.GetQRCode(context.Background(), "2", DefaultQROptions())
+	assert.ErrorAs(t, err, &takedownErr)
+}
+
+func TestGRPCGetQRCode(t *testing.T) {
+	cfg := config.GetTestConfig()
+	s, err := storage.NewMapStorage(cfg)
+	assert.NoError(t, err)
+	server := NewShortenerServer(cfg, NewService(cfg, s))
+
+	_, err = s.CreateShort(context.Background(), "user12", "https://yandex.ru")
+	assert.NoError(t, err)
+
+	out, err := server.GetQRCode(context.Background(), &pb.QRRequest{Id: "1"})
+	assert.NoError(t, err)
+	assert.Equal(t, "image/png", out.ContentType)
+	_, err = png.Decode(bytes.NewReader(out.Image))
+	assert.NoError(t, err)
+
+	margin := uint32(0)
+	out, err = server.GetQRCode(context.Background(), &pb.QRRequest{Id: "1", Format: "svg", Margin: &margin, Level: "Q"})
+	assert.NoError(t, err)
+	assert.Equal(t, "image/svg+xml", out.ContentType)
+	assert.Contains(t, string(out.Image), "M0,0h1v1h-1z")
+
+	_, err = server.GetQRCode(context.Background(), &pb.QRRequest{Id: "1", Size: 5000})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = server.GetQRCode(context.Background(), &pb.QRRequest{Id: "1", Level: "X"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = server.GetQRCode(context.Background(), &pb.QRRequest{Id: "100"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
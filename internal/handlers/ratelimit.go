@@ -0,0 +1,210 @@
+package handlers
+
+import (
+	"context"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/size12/url-shortener/internal/config"
+	"github.com/size12/url-shortener/internal/logger"
+	"github.com/size12/url-shortener/internal/ratelimit"
+	pb "github.com/size12/url-shortener/pkg/grpc"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+// Route classes, every class has its own rate limit.
+const (
+	RouteCreate   = "create"
+	RouteRedirect = "redirect"
+	RouteDelete   = "delete"
+)
+
+// grpcRouteClasses maps gRPC methods to route classes.
+var grpcRouteClasses = map[string]string{
+	pb.Shortener_CreateShort_FullMethodName: RouteCreate,
+	pb.Shortener_BatchShort_FullMethodName:  RouteCreate,
+	pb.Shortener_GetLong_FullMethodName:     RouteRedirect,
+	pb.Shortener_Delete_FullMethodName:      RouteDelete,
+	pb.Shortener_GetQRCode_FullMethodName:   RouteRedirect,
+}
+
+// RateLimitError is returned when client exceeds rate limit or daily quota.
+type RateLimitError struct {
+	Reason     string
+	RetryAfter time.Duration
+}
+
+// Error returns reason of limit.
+func (e *RateLimitError) Error() string {
+	return e.Reason
+}
+
+// retryAfterSeconds returns Retry-After value in whole seconds.
+func (e *RateLimitError) retryAfterSeconds() string {
+	return strconv.Itoa(int(math.Ceil(e.RetryAfter.Seconds())))
+}
+
+// RateLimiter limits requests of every user and every client IP.
+type RateLimiter struct {
+	limiters map[string]*ratelimit.Limiter
+	proxies  trustedProxies
+}
+
+// NewRateLimiter creates rate limiter with limits from config.
+func NewRateLimiter(cfg config.Config) *RateLimiter {
+	return &RateLimiter{
+		limiters: map[string]*ratelimit.Limiter{
+			RouteCreate:   ratelimit.NewLimiter(cfg.RateLimitCreate, cfg.RateLimitBurst),
+			RouteRedirect: ratelimit.NewLimiter(cfg.RateLimitRedirect, cfg.RateLimitBurst),
+			RouteDelete:   ratelimit.NewLimiter(cfg.RateLimitDelete, cfg.RateLimitBurst),
+		},
+		proxies: parseTrustedProxies(cfg.TrustedProxies),
+	}
+}
+
+// check takes tokens of user and IP in route class.
+func (rl *RateLimiter) check(class, userID, ip string) error {
+	limiter := rl.limiters[class]
+
+	for _, key := range []string{"user:" + userID, "ip:" + ip} {
+		if key == "user:" || key == "ip:" {
+			continue
+		}
+
+		if ok, wait := limiter.Allow(key); !ok {
+			return &RateLimitError{Reason: "too many requests", RetryAfter: wait}
+		}
+	}
+
+	return nil
+}
+
+// Limit limits requests of route class.
+// Must be used after CookieMiddleware, so every request has user ID.
+func (rl *RateLimiter) Limit(class string) func(handler http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			userID := ""
+			if userCookie, err := r.Cookie("userID"); err == nil {
+				userID = userCookie.Value
+			}
+
+			if err := rl.check(class, userID, rl.proxies.clientIP(r)); err != nil {
+				writeError(w, r, err)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// UnaryInterceptor limits gRPC requests.
+func (rl *RateLimiter) UnaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	class, ok := grpcRouteClasses[info.FullMethod]
+	if !ok {
+		return handler(ctx, req)
+	}
+
+	userID := ""
+	if md, ok := metadata.FromIncomingContext(ctx); ok && len(md.Get("userID")) != 0 {
+		userID = md.Get("userID")[0]
+	}
+
+	ip := ""
+	if p, ok := peer.FromContext(ctx); ok {
+		ip = hostOnly(p.Addr.String())
+	}
+
+	if err := rl.check(class, userID, ip); err != nil {
+		return nil, rateLimitStatus(ctx, err.(*RateLimitError))
+	}
+
+	return handler(ctx, req)
+}
+
+// rateLimitStatus converts limit error to gRPC status, retry-after is sent in header.
+func rateLimitStatus(ctx context.Context, err *RateLimitError) error {
+	_ = grpc.SetHeader(ctx, metadata.Pairs("retry-after", err.retryAfterSeconds()))
+	return grpcStatus(AsError(err))
+}
+
+// trustedProxies are networks of reverse proxies, whose forwarding headers are trusted.
+type trustedProxies []*net.IPNet
+
+// parseTrustedProxies parses comma separated CIDRs. Invalid CIDRs are skipped.
+func parseTrustedProxies(raw string) trustedProxies {
+	var proxies trustedProxies
+	for _, cidr := range strings.Split(raw, ",") {
+		cidr = strings.TrimSpace(cidr)
+		if cidr == "" {
+			continue
+		}
+
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			logger.Log.Warn("Failed parse trusted proxy CIDR", zap.String("cidr", cidr), zap.Error(err))
+			continue
+		}
+		proxies = append(proxies, network)
+	}
+	return proxies
+}
+
+// contains checks if address is address of trusted proxy.
+func (proxies trustedProxies) contains(addr string) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+
+	for _, network := range proxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIP gets client IP from connection address.
+// Only requests from trusted proxies are taken from X-Real-IP or the last untrusted address of X-Forwarded-For,
+// otherwise any client could choose its IP.
+func (proxies trustedProxies) clientIP(r *http.Request) string {
+	ip := hostOnly(r.RemoteAddr)
+	if !proxies.contains(ip) {
+		return ip
+	}
+
+	if real := strings.TrimSpace(r.Header.Get("X-Real-IP")); net.ParseIP(real) != nil {
+		return real
+	}
+
+	forwarded := strings.Split(r.Header.Get("X-Forwarded-For"), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		addr := strings.TrimSpace(forwarded[i])
+		if net.ParseIP(addr) == nil {
+			break
+		}
+		if !proxies.contains(addr) {
+			return addr
+		}
+	}
+
+	return ip
+}
+
+// hostOnly removes port from address.
+func hostOnly(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	return host
+}
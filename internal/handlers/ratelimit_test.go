@@ -0,0 +1,222 @@
+package handlers
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/size12/url-shortener/internal/config"
+	"github.com/size12/url-shortener/internal/storage"
+	pb "github.com/size12/url-shortener/pkg/grpc"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+func TestRateLimiter_Limit(t *testing.T) {
+	cfg := config.GetTestConfig()
+	cfg.RateLimitCreate = 1
+	cfg.RateLimitBurst = 2
+	// requests of httptest come from 192.0.2.1.
+	cfg.TrustedProxies = "192.0.2.0/24"
+	limiter := NewRateLimiter(cfg)
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	})
+	h := limiter.Limit(RouteCreate)(next)
+
+	send := func(userID, ip string) *http.Response {
+		request := httptest.NewRequest(http.MethodPost, "/", nil)
+		request.Header.Set("X-Real-IP", ip)
+		request.AddCookie(&http.Cookie{Name: "userID", Value: userID})
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, request)
+		return w.Result()
+	}
+
+	for i := 0; i < 2; i++ {
+		res := send("user12", "127.0.0.1")
+		res.Body.Close()
+		assert.Equal(t, http.StatusCreated, res.StatusCode)
+	}
+
+	// user is limited.
+	res := send("user12", "127.0.0.2")
+	res.Body.Close()
+	assert.Equal(t, http.StatusTooManyRequests, res.StatusCode)
+	assert.Equal(t, "1", res.Header.Get("Retry-After"))
+
+	// IP is limited too, even with new user.
+	res = send("user13", "127.0.0.1")
+	res.Body.Close()
+	assert.Equal(t, http.StatusTooManyRequests, res.StatusCode)
+
+	// other route classes are not limited.
+	w := httptest.NewRecorder()
+	limiter.Limit(RouteRedirect)(next).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/1", nil))
+	assert.Equal(t, http.StatusCreated, w.Code)
+}
+
+func TestRateLimiter_SpoofedIP(t *testing.T) {
+	cfg := config.GetTestConfig()
+	cfg.RateLimitCreate = 1
+	cfg.RateLimitBurst = 1
+	limiter := NewRateLimiter(cfg)
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	})
+	h := limiter.Limit(RouteCreate)(next)
+
+	// client, which isn't trusted proxy, can't choose its IP, so new users and IPs don't help.
+	codes := make([]int, 0, 3)
+	for i, ip := range []string{"1.2.3.0", "1.2.3.1", "1.2.3.2"} {
+		request := httptest.NewRequest(http.MethodPost, "/", nil)
+		request.RemoteAddr = "9.9.9.9:5000"
+		request.Header.Set("X-Real-IP", ip)
+		request.Header.Set("X-Forwarded-For", ip)
+		request.AddCookie(&http.Cookie{Name: "userID", Value: "user" + strconv.Itoa(i)})
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, request)
+		codes = append(codes, w.Code)
+	}
+	assert.Equal(t, []int{http.StatusCreated, http.StatusTooManyRequests, http.StatusTooManyRequests}, codes)
+}
+
+func TestTrustedProxies_ClientIP(t *testing.T) {
+	proxies := parseTrustedProxies("10.0.0.0/8, wrong, 192.168.1.1/32")
+	assert.Len(t, proxies, 2)
+
+	tests := []struct {
+		name      string
+		remote    string
+		realIP    string
+		forwarded string
+		want      string
+	}{
+		{"direct", "9.9.9.9:5000", "1.2.3.4", "1.2.3.4", "9.9.9.9"},
+		{"real ip of proxy", "10.0.0.1:5000", "1.2.3.4", "", "1.2.3.4"},
+		{"forwarded by proxies", "10.0.0.1:5000", "", "1.2.3.4, 5.6.7.8, 192.168.1.1", "5.6.7.8"},
+		{"invalid real ip", "10.0.0.1:5000", "unknown", "", "10.0.0.1"},
+		{"invalid forwarded", "10.0.0.1:5000", "", "unknown, 10.0.0.2", "10.0.0.1"},
+		{"no headers", "10.0.0.1:5000", "", "", "10.0.0.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodGet, "/", nil)
+			request.RemoteAddr = tt.remote
+			if tt.realIP != "" {
+				request.Header.Set("X-Real-IP", tt.realIP)
+			}
+			if tt.forwarded != "" {
+				request.Header.Set("X-Forwarded-For", tt.forwarded)
+			}
+			assert.Equal(t, tt.want, proxies.clientIP(request))
+		})
+	}
+}
+
+func TestRateLimiter_UnaryInterceptor(t *testing.T) {
+	cfg := config.GetTestConfig()
+	cfg.RateLimitDelete = 1
+	limiter := NewRateLimiter(cfg)
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.New(map[string]string{"userID": "user12"}))
+	ctx = peer.NewContext(ctx, &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 5000}})
+
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return "ok", nil
+	}
+	info := &grpc.UnaryServerInfo{FullMethod: pb.Shortener_Delete_FullMethodName}
+
+	resp, err := limiter.UnaryInterceptor(ctx, nil, info, handler)
+	assert.NoError(t, err)
+	assert.Equal(t, "ok", resp)
+
+	_, err = limiter.UnaryInterceptor(ctx, nil, info, handler)
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+
+	// methods without class are not limited.
+	info = &grpc.UnaryServerInfo{FullMethod: pb.Shortener_Ping_FullMethodName}
+	_, err = limiter.UnaryInterceptor(ctx, nil, info, handler)
+	assert.NoError(t, err)
+}
+
+func TestService_DailyQuota(t *testing.T) {
+	cfg := config.GetTestConfig()
+	cfg.DailyLinksQuota = 2
+	s, err := storage.NewMapStorage(cfg)
+	assert.NoError(t, err)
+	service := NewService(cfg, s)
+
+	_, err = service.ShortSingleURL(context.Background(), "user12", storage.RequestJSON{URL: "https://yandex.ru"})
+	assert.NoError(t, err)
+
+	// batch doesn't fit into quota.
+	_, err = service.ShortURLs(context.Background(), "user12", []storage.BatchJSON{
+		{CorrelationID: "1", URL: "https://google.com"},
+		{CorrelationID: "2", URL: "https://youtube.com"},
+	})
+	var limitErr *RateLimitError
+	assert.ErrorAs(t, err, &limitErr)
+
+	h := URLPostHandler(service)
+
+	request := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("https://google.com"))
+	request.AddCookie(&http.Cookie{Name: "userID", Value: "user12"})
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, request)
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	request = httptest.NewRequest(http.MethodPost, "/", strings.NewReader("https://youtube.com"))
+	request.AddCookie(&http.Cookie{Name: "userID", Value: "user12"})
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, request)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.NotEmpty(t, w.Header().Get("Retry-After"))
+
+	// other users have own quota.
+	_, err = service.ShortSingleURL(context.Background(), "user13", storage.RequestJSON{URL: "https://youtube.com"})
+	assert.NoError(t, err)
+}
+
+func TestService_DailyQuota_Existing(t *testing.T) {
+	cfg := config.GetTestConfig()
+	cfg.DailyLinksQuota = 3
+	s, err := storage.NewMapStorage(cfg)
+	assert.NoError(t, err)
+	service := NewService(cfg, s)
+	ctx := context.Background()
+
+	_, err = service.ShortSingleURL(ctx, "user12", storage.RequestJSON{URL: "https://yandex.ru"})
+	assert.NoError(t, err)
+
+	// links, which already exist, don't spend quota.
+	for i := 0; i < 3; i++ {
+		_, err = service.ShortSingleURL(ctx, "user12", storage.RequestJSON{URL: "https://yandex.ru"})
+		assert.ErrorIs(t, err, storage.Err409)
+	}
+
+	// only new link of batch spends quota.
+	_, err = service.ShortURLs(ctx, "user12", []storage.BatchJSON{
+		{CorrelationID: "1", URL: "https://yandex.ru"},
+		{CorrelationID: "2", URL: "https://google.com"},
+	})
+	assert.ErrorIs(t, err, storage.Err409)
+
+	_, err = service.ShortSingleURL(ctx, "user12", storage.RequestJSON{URL: "https://youtube.com"})
+	assert.NoError(t, err)
+
+	_, err = service.ShortSingleURL(ctx, "user12", storage.RequestJSON{URL: "https://dzen.ru"})
+	var limitErr *RateLimitError
+	assert.ErrorAs(t, err, &limitErr)
+}
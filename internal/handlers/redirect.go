@@ -0,0 +1,356 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"html/template"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/size12/url-shortener/internal/logger"
+	"github.com/size12/url-shortener/internal/storage"
+	"go.uber.org/zap"
+)
+
+// Errors of link options in query parameters.
+var (
+	ErrInvalidRedirectCodeParam = errors.New("redirect_code must be a number")
+	ErrInvalidForwardPathParam  = errors.New("forward_path must be true or false")
+	ErrInvalidPreviewParam      = errors.New("always_preview must be true or false")
+	ErrInvalidExpiresAtParam    = errors.New("expires_at must be RFC 3339 time")
+)
+
+// expiredDate is value of Expires header for responses, which mustn't be cached.
+var expiredDate = time.Unix(0, 0).UTC().Format(http.TimeFormat)
+
+// warningPage is shown instead of redirect, if long url is flagged by url checker.
+var warningPage = template.Must(template.New("warning").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><meta name="robots" content="noindex"><title>Warning: suspicious link</title></head>
+<body>
+<h1>Warning: suspicious link</h1>
+<p>This short link leads to a site, which may steal your data or harm your device: {{.Warning}}.</p>
+<p>Destination: <code>{{.Location}}</code></p>
+<p><a href="{{.Location}}" rel="noopener noreferrer nofollow">Continue at your own risk</a></p>
+</body>
+</html>
+`))
+
+// previewPage is shown instead of redirect, if link preview is requested or required.
+var previewPage = template.Must(template.New("preview").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><meta name="robots" content="noindex"><title>{{if .Title}}{{.Title}}{{else}}Link preview{{end}}</title></head>
+<body>
+<h1>{{if .Title}}{{.Title}}{{else}}Link preview{{end}}</h1>
+{{if .Warning}}<p><strong>Warning:</strong> this site may steal your data or harm your device: {{.Warning}}.</p>
+{{end}}<p>This short link leads to: <code>{{.Location}}</code></p>
+{{if not .CreatedAt.IsZero}}<p>Created: {{.CreatedAt.UTC.Format "2006-01-02"}}</p>
+{{end}}<p><a href="{{.Location}}" rel="noopener noreferrer nofollow">Continue</a></p>
+<p><a href="/{{.ID}}/report">Report this link</a></p>
+</body>
+</html>
+`))
+
+// Preview modes of config.
+const (
+	// PreviewFlagged shows preview page for destinations flagged by url checker.
+	PreviewFlagged = "flagged"
+	// PreviewExternal shows preview page for flagged destinations and destinations outside of trusted domains.
+	PreviewExternal = "external"
+)
+
+// Redirect is answer to short link request.
+type Redirect struct {
+	ID string
+	// UserID is owner of link.
+	UserID   string
+	Location string
+	Code     int
+	ETag     string
+	// Warning is why long url is flagged by url checker. Warning page is shown instead of redirect, if it's set.
+	Warning string
+	// Title and CreatedAt of link are shown on preview page.
+	Title     string
+	CreatedAt time.Time
+	// Preview shows preview page instead of redirect.
+	Preview bool
+}
+
+// IsPermanent checks if redirect can be cached by browsers and CDNs.
+func (redirect Redirect) IsPermanent() bool {
+	return redirect.Code == http.StatusMovedPermanently || redirect.Code == http.StatusPermanentRedirect
+}
+
+// redirectCode gets redirect code of link: from link options, or from config, or 307.
+func (service *Service) redirectCode(opts storage.LinkOptions) int {
+	if opts.RedirectCode != 0 {
+		return opts.RedirectCode
+	}
+
+	if storage.IsRedirectCode(service.cfg.RedirectCode) {
+		return service.cfg.RedirectCode
+	}
+
+	return http.StatusTemporaryRedirect
+}
+
+// GetRedirect gets where and how short link redirects. It has no side effects, so it's used for HEAD requests too.
+// Path suffix after link ID and request query are forwarded to long url, if link options allow it.
+// It returns *TakedownError, if link is taken down, and ErrLinkExpired, if link is expired.
+func (service *Service) GetRedirect(ctx context.Context, id, suffix string, query url.Values) (Redirect, error) {
+	link, err := service.storage.GetLink(ctx, id)
+	if err != nil {
+		return Redirect{}, err
+	}
+
+	if link.Options.IsExpired(time.Now()) {
+		return Redirect{}, ErrLinkExpired
+	}
+
+	if err := service.checkTakedown(ctx, id, link.URL); err != nil {
+		return Redirect{}, err
+	}
+
+	if strings.Trim(suffix, "/") != "" && !link.Options.ForwardPath {
+		return Redirect{}, storage.Err404
+	}
+
+	location, err := url.Parse(link.URL)
+	if err != nil {
+		return Redirect{}, err
+	}
+
+	if link.Options.ForwardPath {
+		joinPath(location, suffix)
+	}
+	mergeQuery(location, query, link.Options.QueryMode)
+
+	redirect := Redirect{
+		ID:        id,
+		UserID:    link.UserID,
+		Location:  location.String(),
+		Code:      service.redirectCode(link.Options),
+		Title:     link.Options.Title,
+		CreatedAt: link.CreatedAt,
+	}
+
+	hash := sha256.Sum256([]byte(strconv.Itoa(redirect.Code) + " " + redirect.Location))
+	redirect.ETag = `"` + hex.EncodeToString(hash[:8]) + `"`
+
+	if service.checker != nil && (service.cfg.ThreatCheckRedirects || service.cfg.PreviewMode != "") {
+		verdict, err := service.checker.CheckURL(ctx, redirect.Location)
+		if err != nil {
+			logger.FromContext(ctx).Error("Failed check long url", zap.Error(err))
+		} else if verdict.Malicious {
+			redirect.Warning = verdict.Reason
+		}
+	}
+
+	redirect.Preview = link.Options.AlwaysPreview || service.requiresPreview(location.Hostname(), redirect.Warning)
+
+	return redirect, nil
+}
+
+// requiresPreview checks if preview mode of config requires preview page for destination.
+func (service *Service) requiresPreview(host, warning string) bool {
+	switch service.cfg.PreviewMode {
+	case PreviewFlagged:
+		return warning != ""
+	case PreviewExternal:
+		return warning != "" || !service.isTrustedDomain(host)
+	default:
+		return false
+	}
+}
+
+// isTrustedDomain checks if host is one of trusted domains of preview or their subdomain.
+func (service *Service) isTrustedDomain(host string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for _, domain := range strings.Split(service.cfg.PreviewTrustedDomains, ",") {
+		domain = strings.ToLower(strings.Trim(strings.TrimSpace(domain), "."))
+		if domain != "" && (host == domain || strings.HasSuffix(host, "."+domain)) {
+			return true
+		}
+	}
+	return false
+}
+
+// joinPath appends path suffix to path of long url.
+// Suffix is cleaned, so it can't go above path of long url with "..".
+func joinPath(location *url.URL, suffix string) {
+	suffix = strings.TrimPrefix(suffix, "/")
+	if suffix == "" {
+		return
+	}
+
+	cleaned := path.Clean("/" + suffix)
+	if strings.HasSuffix(suffix, "/") && cleaned != "/" {
+		cleaned += "/"
+	}
+
+	if location.RawPath != "" {
+		location.RawPath = strings.TrimSuffix(location.RawPath, "/") + (&url.URL{Path: cleaned}).EscapedPath()
+	}
+	location.Path = strings.TrimSuffix(location.Path, "/") + cleaned
+}
+
+// mergeQuery merges request query into query of long url by mode.
+// Parameters of long url keep their order and encoding, request parameters are added after them.
+func mergeQuery(location *url.URL, query url.Values, mode string) {
+	if len(query) == 0 || mode == "" {
+		return
+	}
+
+	var pairs []string
+	if location.RawQuery != "" {
+		pairs = strings.Split(location.RawQuery, "&")
+	}
+
+	if mode == storage.QueryModeOverride {
+		kept := pairs[:0]
+		for _, pair := range pairs {
+			key, _, _ := strings.Cut(pair, "=")
+			if name, err := url.QueryUnescape(key); err == nil && query.Has(name) {
+				continue
+			}
+			kept = append(kept, pair)
+		}
+		pairs = kept
+	}
+
+	pairs = append(pairs, query.Encode())
+	location.RawQuery = strings.Join(pairs, "&")
+}
+
+// writeRedirect writes redirect with cache headers.
+// Permanent redirects are cached for RedirectCacheMaxAge, temporary ones mustn't be cached, because link can be edited.
+func (service *Service) writeRedirect(w http.ResponseWriter, r *http.Request, redirect Redirect) {
+	if redirect.Preview {
+		writePreview(w, redirect)
+		return
+	}
+
+	if redirect.Warning != "" {
+		writeWarning(w, redirect)
+		return
+	}
+
+	w.Header().Set("ETag", redirect.ETag)
+
+	if redirect.IsPermanent() {
+		maxAge := service.cfg.RedirectCacheMaxAge.Duration
+		w.Header().Set("Cache-Control", "public, max-age="+strconv.Itoa(int(maxAge.Seconds())))
+		w.Header().Set("Expires", time.Now().Add(maxAge).UTC().Format(http.TimeFormat))
+	} else {
+		w.Header().Set("Cache-Control", "no-store")
+		w.Header().Set("Expires", expiredDate)
+	}
+
+	if r.Header.Get("If-None-Match") == redirect.ETag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("Location", redirect.Location)
+	w.WriteHeader(redirect.Code)
+}
+
+// writeWarning writes warning page instead of redirect to flagged url. Warning mustn't be cached, because threat feed changes.
+func writeWarning(w http.ResponseWriter, redirect Redirect) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Expires", expiredDate)
+	w.Header().Set("X-Robots-Tag", "noindex")
+	w.WriteHeader(http.StatusOK)
+
+	if err := warningPage.Execute(w, redirect); err != nil {
+		logger.Log.Error("Failed write warning page", zap.Error(err))
+	}
+}
+
+// writePreview writes preview page with destination of link. Preview mustn't be cached, because link can be edited.
+func writePreview(w http.ResponseWriter, redirect Redirect) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Expires", expiredDate)
+	w.Header().Set("X-Robots-Tag", "noindex")
+	w.WriteHeader(http.StatusOK)
+
+	if err := previewPage.Execute(w, redirect); err != nil {
+		logger.Log.Error("Failed write preview page", zap.Error(err))
+	}
+}
+
+// isPreviewRequest checks if request asks for preview page with preview query parameter.
+// Parameter is removed from query, so it isn't forwarded to long url.
+func isPreviewRequest(query url.Values) bool {
+	if !query.Has("preview") {
+		return false
+	}
+
+	preview, err := strconv.ParseBool(query.Get("preview"))
+	query.Del("preview")
+	return err == nil && preview
+}
+
+// queryLinkOptions gets options of new link from query parameters of plain text request.
+func queryLinkOptions(r *http.Request) (storage.LinkOptions, error) {
+	query := r.URL.Query()
+	opts := storage.LinkOptions{QueryMode: query.Get("query_mode"), Title: query.Get("title")}
+
+	if code := query.Get("redirect_code"); code != "" {
+		n, err := strconv.Atoi(code)
+		if err != nil {
+			return opts, ErrInvalidRedirectCodeParam
+		}
+		opts.RedirectCode = n
+	}
+
+	if forward := query.Get("forward_path"); forward != "" {
+		ok, err := strconv.ParseBool(forward)
+		if err != nil {
+			return opts, ErrInvalidForwardPathParam
+		}
+		opts.ForwardPath = ok
+	}
+
+	if preview := query.Get("always_preview"); preview != "" {
+		ok, err := strconv.ParseBool(preview)
+		if err != nil {
+			return opts, ErrInvalidPreviewParam
+		}
+		opts.AlwaysPreview = ok
+	}
+
+	if expires := query.Get("expires_at"); expires != "" {
+		t, err := time.Parse(time.RFC3339, expires)
+		if err != nil {
+			return opts, ErrInvalidExpiresAtParam
+		}
+		opts.ExpiresAt = &t
+	}
+
+	return opts, nil
+}
+
+// redirectSuffix gets path after short link ID from wildcard route.
+func redirectSuffix(r *http.Request) string {
+	suffix := chi.URLParam(r, "*")
+	if r.URL.RawPath == "" {
+		return suffix
+	}
+
+	// chi routes by escaped path, if it differs from decoded one.
+	decoded, err := url.PathUnescape(suffix)
+	if err != nil {
+		return suffix
+	}
+	return decoded
+}
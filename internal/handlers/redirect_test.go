@@ -0,0 +1,203 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/size12/url-shortener/internal/config"
+	"github.com/size12/url-shortener/internal/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+// redirectRouter creates router with create and redirect routes.
+func redirectRouter(service *Service) *chi.Mux {
+	r := chi.NewRouter()
+	r.Get("/{id}", URLGetHandler(service))
+	r.Head("/{id}", URLGetHandler(service))
+	r.Get("/{id}/*", URLGetHandler(service))
+	r.Post("/", URLPostHandler(service))
+	r.Post("/api/shorten", URLPostHandler(service))
+	r.Post("/api/shorten/batch", URLBatchHandler(service))
+	return r
+}
+
+// doRequest sends request with user cookie.
+func doRequest(r http.Handler, method, target, contentType, body string, header http.Header) *http.Response {
+	request := httptest.NewRequest(method, target, strings.NewReader(body))
+	request.AddCookie(&http.Cookie{Name: "userID", Value: "user12"})
+	request.Header.Set("Content-Type", contentType)
+	for key, values := range header {
+		request.Header[key] = values
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, request)
+
+	res := w.Result()
+	res.Body.Close()
+	return res
+}
+
+func TestURLGetHandler_RedirectCode(t *testing.T) {
+	cfg := config.GetTestConfig()
+	cfg.RedirectCode = http.StatusFound
+	cfg.RedirectCacheMaxAge = config.Duration{Duration: time.Hour}
+
+	s, err := storage.NewMapStorage(cfg)
+	assert.NoError(t, err)
+	r := redirectRouter(NewService(cfg, s))
+
+	// link with default code.
+	res := doRequest(r, http.MethodPost, "/", "text/plain", "https://yandex.ru", nil)
+	assert.Equal(t, http.StatusCreated, res.StatusCode)
+
+	// links with own codes.
+	res = doRequest(r, http.MethodPost, "/?redirect_code=308", "text/plain", "https://google.com", nil)
+	assert.Equal(t, http.StatusCreated, res.StatusCode)
+
+	res = doRequest(r, http.MethodPost, "/api/shorten", "application/json", `{"url":"https://dzen.ru","redirect_code":301}`, nil)
+	assert.Equal(t, http.StatusCreated, res.StatusCode)
+
+	res = doRequest(r, http.MethodPost, "/api/shorten/batch", "application/json",
+		`[{"correlation_id":"1","original_url":"https://youtube.com","redirect_code":307}]`, nil)
+	assert.Equal(t, http.StatusCreated, res.StatusCode)
+
+	tests := []struct {
+		id           string
+		code         int
+		cacheControl string
+	}{
+		{id: "1", code: http.StatusFound, cacheControl: "no-store"},
+		{id: "2", code: http.StatusPermanentRedirect, cacheControl: "public, max-age=3600"},
+		{id: "3", code: http.StatusMovedPermanently, cacheControl: "public, max-age=3600"},
+		{id: "4", code: http.StatusTemporaryRedirect, cacheControl: "no-store"},
+	}
+
+	for _, tc := range tests {
+		for _, method := range []string{http.MethodGet, http.MethodHead} {
+			res = doRequest(r, method, "/"+tc.id, "", "", nil)
+			assert.Equal(t, tc.code, res.StatusCode, tc.id)
+			assert.Equal(t, tc.cacheControl, res.Header.Get("Cache-Control"), tc.id)
+			assert.NotEmpty(t, res.Header.Get("Expires"), tc.id)
+			assert.NotEmpty(t, res.Header.Get("ETag"), tc.id)
+			assert.NotEmpty(t, res.Header.Get("Location"), tc.id)
+		}
+	}
+
+	// ETag changes with redirect code.
+	first := doRequest(r, http.MethodGet, "/1", "", "", nil).Header.Get("ETag")
+	second := doRequest(r, http.MethodGet, "/2", "", "", nil).Header.Get("ETag")
+	assert.NotEqual(t, first, second)
+
+	// cached redirect isn't sent again.
+	res = doRequest(r, http.MethodGet, "/2", "", "", http.Header{"If-None-Match": {second}})
+	assert.Equal(t, http.StatusNotModified, res.StatusCode)
+	assert.Empty(t, res.Header.Get("Location"))
+}
+
+func TestURLPostHandler_InvalidRedirectCode(t *testing.T) {
+	cfg := config.GetTestConfig()
+	s, err := storage.NewMapStorage(cfg)
+	assert.NoError(t, err)
+	r := redirectRouter(NewService(cfg, s))
+
+	res := doRequest(r, http.MethodPost, "/?redirect_code=abc", "text/plain", "https://yandex.ru", nil)
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+
+	res = doRequest(r, http.MethodPost, "/api/shorten", "application/json", `{"url":"https://yandex.ru","redirect_code":200}`, nil)
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+
+	res = doRequest(r, http.MethodPost, "/api/shorten/batch", "application/json",
+		`[{"correlation_id":"1","original_url":"https://yandex.ru","redirect_code":303}]`, nil)
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+
+	stat, err := s.GetStatistic(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 0, stat.Urls)
+}
+
+func TestService_ShortSingleURL_OptionsOfOtherUser(t *testing.T) {
+	cfg := config.GetTestConfig()
+	s, err := storage.NewMapStorage(cfg)
+	assert.NoError(t, err)
+	service := NewService(cfg, s)
+
+	id, err := service.ShortSingleURL(context.Background(), "user12", storage.RequestJSON{URL: "https://yandex.ru", LinkOptions: storage.LinkOptions{RedirectCode: 301}})
+	assert.NoError(t, err)
+
+	// other user gets existing link, but can't change its options.
+	_, err = service.ShortSingleURL(context.Background(), "user13", storage.RequestJSON{URL: "https://yandex.ru", LinkOptions: storage.LinkOptions{RedirectCode: 302}})
+	assert.Equal(t, storage.Err409, err)
+
+	redirect, err := service.GetRedirect(context.Background(), id, "", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusMovedPermanently, redirect.Code)
+	assert.True(t, redirect.IsPermanent())
+}
+
+func TestURLGetHandler_Forwarding(t *testing.T) {
+	cfg := config.GetTestConfig()
+	s, err := storage.NewMapStorage(cfg)
+	assert.NoError(t, err)
+	r := redirectRouter(NewService(cfg, s))
+
+	links := []string{
+		`{"url":"https://site.ru/plain?utm_source=a&lang=ru"}`,
+		`{"url":"https://site.ru/docs?utm_source=a&lang=ru","query_mode":"append","forward_path":true}`,
+		`{"url":"https://site.ru/docs/?utm_source=a&lang=ru","query_mode":"override","forward_path":true}`,
+	}
+	for _, link := range links {
+		res := doRequest(r, http.MethodPost, "/api/shorten", "application/json", link, nil)
+		assert.Equal(t, http.StatusCreated, res.StatusCode)
+	}
+
+	tests := []struct {
+		name     string
+		target   string
+		code     int
+		location string
+	}{
+		{"query isn't forwarded by default", "/1?utm_source=x", 307, "https://site.ru/plain?utm_source=a&lang=ru"},
+		{"path isn't forwarded by default", "/1/page", 404, ""},
+		{"query is appended", "/2?utm_source=x&b=1", 307, "https://site.ru/docs?utm_source=a&lang=ru&b=1&utm_source=x"},
+		{"query overrides", "/3?utm_source=x", 307, "https://site.ru/docs/?lang=ru&utm_source=x"},
+		{"path is appended", "/2/api/page", 307, "https://site.ru/docs/api/page?utm_source=a&lang=ru"},
+		{"path with trailing slash", "/3/api/", 307, "https://site.ru/docs/api/?utm_source=a&lang=ru"},
+		{"path can't go above long url", "/2/../../admin", 307, "https://site.ru/docs/admin?utm_source=a&lang=ru"},
+		{"escaped path", "/2/a%2Fb%20c", 307, "https://site.ru/docs/a/b%20c?utm_source=a&lang=ru"},
+		{"path and query", "/3/page?lang=en", 307, "https://site.ru/docs/page?utm_source=a&lang=en"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			res := doRequest(r, http.MethodGet, tc.target, "", "", nil)
+			assert.Equal(t, tc.code, res.StatusCode)
+			assert.Equal(t, tc.location, res.Header.Get("Location"))
+		})
+	}
+}
+
+func TestURLPostHandler_QueryOptions(t *testing.T) {
+	cfg := config.GetTestConfig()
+	s, err := storage.NewMapStorage(cfg)
+	assert.NoError(t, err)
+	r := redirectRouter(NewService(cfg, s))
+
+	res := doRequest(r, http.MethodPost, "/?query_mode=append&forward_path=true", "text/plain", "https://site.ru", nil)
+	assert.Equal(t, http.StatusCreated, res.StatusCode)
+
+	link, err := s.GetLink(context.Background(), "1")
+	assert.NoError(t, err)
+	assert.Equal(t, storage.LinkOptions{QueryMode: storage.QueryModeAppend, ForwardPath: true}, link.Options)
+
+	res = doRequest(r, http.MethodPost, "/?forward_path=maybe", "text/plain", "https://site.ru/2", nil)
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+
+	res = doRequest(r, http.MethodPost, "/?query_mode=merge", "text/plain", "https://site.ru/3", nil)
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+}
@@ -0,0 +1,354 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/size12/url-shortener/internal/logger"
+	"github.com/size12/url-shortener/internal/storage"
+	"go.uber.org/zap"
+)
+
+// maxReportReasonLength is max length of abuse report reason.
+const maxReportReasonLength = 1000
+
+// reportsActor is actor of takedowns, which are made after report threshold is reached.
+const reportsActor = "reports"
+
+// ErrReportReason is returned, if abuse report reason is empty or too long.
+var ErrReportReason = errors.New("report reason must be from 1 to 1000 characters")
+
+// ModerationItem is reported link in moderation queue.
+type ModerationItem struct {
+	LinkID string `json:"link_id"`
+	URL    string `json:"url"`
+	// Disabled is set, if link is taken down, for example after report threshold is reached.
+	Disabled bool `json:"disabled"`
+	// Reporters is count of different IPs, which reported link.
+	Reporters int `json:"reporters"`
+	// Escalated is set, if link is reported from ReportThreshold different IPs and disabled. Such links are first in queue.
+	Escalated bool             `json:"escalated"`
+	Reports   []storage.Report `json:"reports"`
+}
+
+// reportPage is form of abuse report and answer to it.
+var reportPage = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><meta name="robots" content="noindex"><title>Report link</title></head>
+<body>
+<h1>Report link {{.ID}}</h1>
+{{if .Sent}}<p>Thank you, your report is sent to moderators.</p>
+{{else}}<form method="post">
+<p><label for="reason">Why is this link malicious?</label></p>
+<p><textarea id="reason" name="reason" rows="5" cols="60" maxlength="1000" required></textarea></p>
+<p><button type="submit">Report</button></p>
+</form>
+{{end}}</body>
+</html>
+`))
+
+// ReportLink records abuse report of link. IP is address of reporter, see trustedProxies.clientIP.
+// Link is disabled until moderation, when reports from ReportThreshold different IPs are open.
+func (service *Service) ReportLink(ctx context.Context, id, reason, ip string) (storage.Report, error) {
+	reason = strings.TrimSpace(reason)
+	if reason == "" || len(reason) > maxReportReasonLength {
+		return storage.Report{}, ErrReportReason
+	}
+
+	if _, err := service.storage.GetLink(ctx, id); err != nil {
+		return storage.Report{}, err
+	}
+
+	report, err := service.reports.AddReport(ctx, storage.Report{
+		LinkID:     id,
+		Reason:     reason,
+		ReporterIP: ip,
+		CreatedAt:  time.Now().UTC(),
+	})
+	if err != nil {
+		return storage.Report{}, err
+	}
+
+	if service.cfg.ReportThreshold > 0 {
+		if err := service.checkReportThreshold(ctx, id); err != nil {
+			logger.FromContext(ctx).Error("Failed check report threshold", zap.Error(err))
+		}
+	}
+
+	return report, nil
+}
+
+// checkReportThreshold takes link down, if it has open reports from ReportThreshold different IPs.
+// Takedown is made by reportsActor, so it's seen in audit trail and it's restored, when reports are dismissed.
+func (service *Service) checkReportThreshold(ctx context.Context, id string) error {
+	reports, err := service.reports.GetLinkReports(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	n := countReporters(reports)
+	if n < service.cfg.ReportThreshold {
+		return nil
+	}
+
+	if _, err := service.takedowns.GetTakedown(ctx, storage.TakedownLink, id); !errors.Is(err, storage.Err404) {
+		// link is already taken down.
+		return err
+	}
+
+	logger.FromContext(ctx).Info("Link disabled by abuse reports", zap.String("id", id), zap.Int("reporters", n))
+
+	_, err = service.Takedown(ctx, reportsActor, TakedownRequest{
+		Kind:   storage.TakedownLink,
+		Target: id,
+		Reason: fmt.Sprintf("link is disabled after abuse reports from %d IPs and waits for moderation", n),
+		Code:   http.StatusGone,
+	})
+	return err
+}
+
+// countReporters counts different IPs of reports.
+func countReporters(reports []storage.Report) int {
+	reporters := make(map[string]bool)
+	for _, report := range reports {
+		reporters[report.ReporterIP] = true
+	}
+	return len(reporters)
+}
+
+// GetModerationQueue gets links with open reports. Escalated links are first, then links are from the earliest reported.
+func (service *Service) GetModerationQueue(ctx context.Context) ([]ModerationItem, error) {
+	reports, err := service.reports.GetOpenReports(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	queue := make([]ModerationItem, 0)
+	items := make(map[string]int)
+	for _, report := range reports {
+		i, ok := items[report.LinkID]
+		if !ok {
+			i = len(queue)
+			items[report.LinkID] = i
+			queue = append(queue, ModerationItem{LinkID: report.LinkID})
+		}
+		queue[i].Reports = append(queue[i].Reports, report)
+	}
+
+	for i, item := range queue {
+		link, err := service.storage.GetLink(ctx, item.LinkID)
+		if err != nil && !errors.Is(err, storage.Err410) {
+			return nil, err
+		}
+		queue[i].URL = link.URL
+
+		_, err = service.takedowns.GetTakedown(ctx, storage.TakedownLink, item.LinkID)
+		if err != nil && !errors.Is(err, storage.Err404) {
+			return nil, err
+		}
+		queue[i].Disabled = err == nil
+
+		queue[i].Reporters = countReporters(item.Reports)
+		queue[i].Escalated = service.cfg.ReportThreshold > 0 && queue[i].Reporters >= service.cfg.ReportThreshold
+	}
+
+	sort.SliceStable(queue, func(i, j int) bool {
+		return queue[i].Escalated && !queue[j].Escalated
+	})
+
+	return queue, nil
+}
+
+// DismissReports dismisses open reports of link and restores link, if it was disabled by reports.
+func (service *Service) DismissReports(ctx context.Context, actor, id string) error {
+	if err := service.reports.ResolveReports(ctx, id, storage.ReportDismissed); err != nil {
+		return err
+	}
+
+	takedown, err := service.takedowns.GetTakedown(ctx, storage.TakedownLink, id)
+	if errors.Is(err, storage.Err404) || (err == nil && takedown.Actor != reportsActor) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	return service.Restore(ctx, actor, TakedownRequest{Kind: storage.TakedownLink, Target: id, Reason: "abuse reports are dismissed"})
+}
+
+// TakedownReported takes down reported link and closes its open reports.
+func (service *Service) TakedownReported(ctx context.Context, actor, id string, req TakedownRequest) (storage.Takedown, error) {
+	reports, err := service.reports.GetLinkReports(ctx, id)
+	if err != nil {
+		return storage.Takedown{}, err
+	}
+
+	if len(reports) == 0 {
+		return storage.Takedown{}, storage.Err404
+	}
+
+	req.Kind, req.Target = storage.TakedownLink, id
+	takedown, err := service.Takedown(ctx, actor, req)
+	if err != nil {
+		return storage.Takedown{}, err
+	}
+
+	return takedown, service.reports.ResolveReports(ctx, id, storage.ReportTakenDown)
+}
+
+// writeReportPage writes report form or answer to report.
+func writeReportPage(w http.ResponseWriter, code int, id string, sent bool) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("X-Robots-Tag", "noindex")
+	w.WriteHeader(code)
+
+	page := struct {
+		ID   string
+		Sent bool
+	}{ID: id, Sent: sent}
+
+	if err := reportPage.Execute(w, page); err != nil {
+		logger.Log.Error("Failed write report page", zap.Error(err))
+	}
+}
+
+// ReportFormHandler shows form of abuse report.
+func ReportFormHandler(w http.ResponseWriter, r *http.Request) {
+	writeReportPage(w, http.StatusOK, chi.URLParam(r, "id"), false)
+}
+
+// ReportHandler records abuse report of link from JSON body {"reason": "..."} or from report form.
+func ReportHandler(service *Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		resBody, ok := readBody(w, r)
+		if !ok {
+			return
+		}
+
+		isJSON := strings.HasPrefix(r.Header.Get("Content-Type"), "application/json")
+
+		var reason string
+		if isJSON {
+			var req struct {
+				Reason string `json:"reason"`
+			}
+			if err := json.Unmarshal(resBody, &req); err != nil {
+				writeError(w, r, invalidBody(err))
+				return
+			}
+			reason = req.Reason
+		} else {
+			form, err := url.ParseQuery(string(resBody))
+			if err != nil {
+				writeError(w, r, invalidBody(err))
+				return
+			}
+			reason = form.Get("reason")
+		}
+
+		id := chi.URLParam(r, "id")
+		report, err := service.ReportLink(r.Context(), id, reason, service.proxies.clientIP(r))
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		if !isJSON {
+			writeReportPage(w, http.StatusCreated, id, true)
+			return
+		}
+
+		data, err := json.Marshal(struct {
+			ID     int64  `json:"id"`
+			Status string `json:"status"`
+		}{ID: report.ID, Status: report.Status})
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		w.Write(data)
+	}
+}
+
+// ModerationQueueHandler returns reported links with their open reports.
+func ModerationQueueHandler(service *Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		queue, err := service.GetModerationQueue(r.Context())
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		data, err := json.Marshal(queue)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	}
+}
+
+// DismissReportsHandler dismisses open reports of link.
+func DismissReportsHandler(service *Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		err := service.DismissReports(r.Context(), service.adminActor(r), chi.URLParam(r, "id"))
+
+		if errors.Is(err, storage.Err404) {
+			writeError(w, r, &Error{Code: CodeNotFound, Message: "no open reports", Err: err})
+			return
+		}
+
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// TakedownReportedHandler takes down reported link with reason and code from JSON body.
+func TakedownReportedHandler(service *Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		req, ok := readTakedownRequest(w, r)
+		if !ok {
+			return
+		}
+
+		takedown, err := service.TakedownReported(r.Context(), service.adminActor(r), chi.URLParam(r, "id"), req)
+
+		if errors.Is(err, storage.Err404) {
+			writeError(w, r, &Error{Code: CodeNotFound, Message: "no open reports", Err: err})
+			return
+		}
+
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		data, err := json.Marshal(takedown)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		w.Write(data)
+	}
+}
@@ -0,0 +1,209 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/size12/url-shortener/internal/config"
+	"github.com/size12/url-shortener/internal/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+// reportRouter gets router with redirect, report and moderation routes.
+func reportRouter(service *Service) *chi.Mux {
+	r := takedownRouter(service)
+	r.Get("/{id}/report", ReportFormHandler)
+	r.Post("/{id}/report", ReportHandler(service))
+	r.Get("/api/admin/reports", ModerationQueueHandler(service))
+	r.Post("/api/admin/reports/{id}/dismiss", DismissReportsHandler(service))
+	r.Post("/api/admin/reports/{id}/takedown", TakedownReportedHandler(service))
+	return r
+}
+
+// getQueue gets moderation queue.
+func getQueue(t *testing.T, r http.Handler) []ModerationItem {
+	request := httptest.NewRequest(http.MethodGet, "/api/admin/reports", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, request)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var queue []ModerationItem
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &queue))
+	return queue
+}
+
+func TestReportHandler(t *testing.T) {
+	cfg := config.GetTestConfig()
+	// requests of httptest come from trusted proxy 192.0.2.1.
+	cfg.TrustedProxies = "192.0.2.0/24"
+	s, err := storage.NewMapStorage(cfg)
+	assert.NoError(t, err)
+	r := reportRouter(NewService(cfg, s))
+
+	res := doRequest(r, http.MethodPost, "/", "text/plain", "https://phish.ru", nil)
+	assert.Equal(t, http.StatusCreated, res.StatusCode)
+
+	// form.
+	request := httptest.NewRequest(http.MethodGet, "/1/report", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, request)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `<form method="post">`)
+
+	// invalid reports.
+	res = doRequest(r, http.MethodPost, "/1/report", "application/json", `{"reason":" "}`, nil)
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+	res = doRequest(r, http.MethodPost, "/1/report", "application/json", `{"reason":"`+strings.Repeat("a", 1001)+`"}`, nil)
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+	res = doRequest(r, http.MethodPost, "/100/report", "application/json", `{"reason":"phishing"}`, nil)
+	assert.Equal(t, http.StatusNotFound, res.StatusCode)
+
+	// JSON report.
+	request = httptest.NewRequest(http.MethodPost, "/1/report", strings.NewReader(`{"reason":"phishing"}`))
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("X-Real-IP", "1.1.1.1")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, request)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.JSONEq(t, `{"id":1,"status":"open"}`, w.Body.String())
+
+	// form report.
+	request = httptest.NewRequest(http.MethodPost, "/1/report", strings.NewReader("reason=steals+passwords"))
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, request)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	body, err := io.ReadAll(w.Body)
+	assert.NoError(t, err)
+	assert.Contains(t, string(body), "Thank you")
+
+	queue := getQueue(t, r)
+	assert.Len(t, queue, 1)
+	assert.Equal(t, "1", queue[0].LinkID)
+	assert.Equal(t, "https://phish.ru", queue[0].URL)
+	assert.False(t, queue[0].Disabled)
+	assert.Len(t, queue[0].Reports, 2)
+	assert.Equal(t, "1.1.1.1", queue[0].Reports[0].ReporterIP)
+	assert.Equal(t, "steals passwords", queue[0].Reports[1].Reason)
+
+	// link isn't disabled without threshold.
+	res = doRequest(r, http.MethodGet, "/1", "", "", nil)
+	assert.Equal(t, http.StatusTemporaryRedirect, res.StatusCode)
+
+	// take down from queue.
+	res = doRequest(r, http.MethodPost, "/api/admin/reports/1/takedown", "application/json", `{"reason":"phishing"}`, nil)
+	assert.Equal(t, http.StatusCreated, res.StatusCode)
+	res = doRequest(r, http.MethodPost, "/api/admin/reports/1/takedown", "application/json", `{"reason":"phishing"}`, nil)
+	assert.Equal(t, http.StatusNotFound, res.StatusCode)
+
+	res = doRequest(r, http.MethodGet, "/1", "", "", nil)
+	assert.Equal(t, http.StatusUnavailableForLegalReasons, res.StatusCode)
+	assert.Empty(t, getQueue(t, r))
+}
+
+func TestReportHandler_Threshold(t *testing.T) {
+	cfg := config.GetTestConfig()
+	// requests of httptest come from trusted proxy 192.0.2.1.
+	cfg.TrustedProxies = "192.0.2.0/24"
+	cfg.ReportThreshold = 2
+	s, err := storage.NewMapStorage(cfg)
+	assert.NoError(t, err)
+	service := NewService(cfg, s)
+	r := reportRouter(service)
+
+	res := doRequest(r, http.MethodPost, "/", "text/plain", "https://phish.ru", nil)
+	assert.Equal(t, http.StatusCreated, res.StatusCode)
+	res = doRequest(r, http.MethodPost, "/", "text/plain", "https://scam.ru", nil)
+	assert.Equal(t, http.StatusCreated, res.StatusCode)
+
+	report := func(id, ip string) {
+		res := doRequest(r, http.MethodPost, "/"+id+"/report", "application/json", `{"reason":"phishing"}`,
+			http.Header{"X-Real-Ip": []string{ip}})
+		assert.Equal(t, http.StatusCreated, res.StatusCode)
+	}
+
+	// reports from the same IP are counted once.
+	report("1", "1.1.1.1")
+	report("1", "1.1.1.1")
+	report("2", "1.1.1.1")
+
+	queue := getQueue(t, r)
+	assert.Len(t, queue, 2)
+	assert.Equal(t, "1", queue[0].LinkID)
+	assert.Equal(t, 1, queue[0].Reporters)
+	assert.False(t, queue[0].Escalated)
+
+	res = doRequest(r, http.MethodGet, "/2", "", "", nil)
+	assert.Equal(t, http.StatusTemporaryRedirect, res.StatusCode)
+
+	// report of the second IP disables link until moderation.
+	report("2", "2.2.2.2")
+	res = doRequest(r, http.MethodGet, "/2", "", "", nil)
+	assert.Equal(t, http.StatusGone, res.StatusCode)
+
+	queue = getQueue(t, r)
+	assert.Len(t, queue, 2)
+	assert.Equal(t, "2", queue[0].LinkID)
+	assert.Equal(t, 2, queue[0].Reporters)
+	assert.True(t, queue[0].Escalated)
+	assert.True(t, queue[0].Disabled)
+	assert.Equal(t, "1", queue[1].LinkID)
+	assert.False(t, queue[1].Escalated)
+	assert.False(t, queue[1].Disabled)
+
+	audit, err := service.takedowns.GetAudit(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, audit, 1)
+	assert.Equal(t, storage.AuditTakedown, audit[0].Action)
+	assert.Equal(t, reportsActor, audit[0].Actor)
+
+	// dismiss restores link and removes it from queue.
+	res = doRequest(r, http.MethodPost, "/api/admin/reports/2/dismiss", "", "", nil)
+	assert.Equal(t, http.StatusNoContent, res.StatusCode)
+	res = doRequest(r, http.MethodPost, "/api/admin/reports/2/dismiss", "", "", nil)
+	assert.Equal(t, http.StatusNotFound, res.StatusCode)
+
+	res = doRequest(r, http.MethodGet, "/2", "", "", nil)
+	assert.Equal(t, http.StatusTemporaryRedirect, res.StatusCode)
+	queue = getQueue(t, r)
+	assert.Len(t, queue, 1)
+	assert.Equal(t, "1", queue[0].LinkID)
+
+	audit, err = service.takedowns.GetAudit(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, audit, 2)
+	assert.Equal(t, storage.AuditRestore, audit[1].Action)
+}
+
+func TestReportHandler_SpoofedIP(t *testing.T) {
+	cfg := config.GetTestConfig()
+	cfg.ReportThreshold = 2
+	s, err := storage.NewMapStorage(cfg)
+	assert.NoError(t, err)
+	r := reportRouter(NewService(cfg, s))
+
+	res := doRequest(r, http.MethodPost, "/", "text/plain", "https://yandex.ru", nil)
+	assert.Equal(t, http.StatusCreated, res.StatusCode)
+
+	// client, which isn't trusted proxy, can't pretend to be different reporters.
+	for _, ip := range []string{"1.1.1.1", "2.2.2.2", "3.3.3.3"} {
+		res := doRequest(r, http.MethodPost, "/1/report", "application/json", `{"reason":"phishing"}`,
+			http.Header{"X-Real-Ip": []string{ip}, "X-Forwarded-For": []string{ip}})
+		assert.Equal(t, http.StatusCreated, res.StatusCode)
+	}
+
+	queue := getQueue(t, r)
+	assert.Len(t, queue, 1)
+	assert.Equal(t, 1, queue[0].Reporters)
+	assert.False(t, queue[0].Escalated)
+	assert.Equal(t, "192.0.2.1", queue[0].Reports[2].ReporterIP)
+
+	res = doRequest(r, http.MethodGet, "/1", "", "", nil)
+	assert.Equal(t, http.StatusTemporaryRedirect, res.StatusCode)
+}
@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/size12/url-shortener/internal/logger"
+	"github.com/size12/url-shortener/internal/storage"
+	"go.uber.org/zap"
+)
+
+// LinkStatsJSON is answer to statistics request of link.
+type LinkStatsJSON struct {
+	ID        string    `json:"id"`
+	ShortURL  string    `json:"short_url"`
+	LongURL   string    `json:"original_url"`
+	CreatedAt time.Time `json:"created_at"`
+	storage.LinkStats
+}
+
+// countClick counts visit of link. Visit is redirected anyway, if it isn't counted.
+func (service *Service) countClick(ctx context.Context, id string) {
+	if err := service.clicks.AddClick(ctx, id, time.Now().UTC()); err != nil {
+		logger.FromContext(ctx).Error("Failed count click", zap.String("id", id), zap.Error(err))
+	}
+}
+
+// GetLinkStats gets statistics of user's link. Links of other users aren't found.
+func (service *Service) GetLinkStats(ctx context.Context, userID, id string) (LinkStatsJSON, error) {
+	link, err := service.getUserLink(ctx, userID, id)
+	if err != nil {
+		return LinkStatsJSON{}, err
+	}
+
+	stats, err := service.clicks.GetLinkStats(ctx, id)
+	if err != nil {
+		return LinkStatsJSON{}, err
+	}
+
+	return LinkStatsJSON{
+		ID:        id,
+		ShortURL:  service.cfg.BaseURL + "/" + id,
+		LongURL:   link.URL,
+		CreatedAt: link.CreatedAt,
+		LinkStats: stats,
+	}, nil
+}
+
+// LinkStatsHandler returns number of visits of user's link and time of the last one.
+func LinkStatsHandler(service *Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := requestUser(r)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		stats, err := service.GetLinkStats(r.Context(), userID, chi.URLParam(r, "id"))
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		data, err := json.Marshal(stats)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	}
+}
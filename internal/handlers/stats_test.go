@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/size12/url-shortener/internal/config"
+	"github.com/size12/url-shortener/internal/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+// statsRouter gets router with redirect, preview and link statistics routes.
+func statsRouter(service *Service) *chi.Mux {
+	r := previewRouter(service)
+	r.Get("/api/user/urls/{id}/stats", LinkStatsHandler(service))
+	return r
+}
+
+// getStats gets statistics of link for user.
+func getStats(r http.Handler, id, userID string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(http.MethodGet, "/api/user/urls/"+id+"/stats", nil)
+	request.AddCookie(&http.Cookie{Name: "userID", Value: userID})
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, request)
+	return w
+}
+
+func TestLinkStatsHandler(t *testing.T) {
+	cfg := config.GetTestConfig()
+	s, err := storage.NewMapStorage(cfg)
+	assert.NoError(t, err)
+	r := statsRouter(NewService(cfg, s))
+
+	res := doRequest(r, http.MethodPost, "/", "text/plain", "https://yandex.ru/news", nil)
+	assert.Equal(t, http.StatusCreated, res.StatusCode)
+
+	w := getStats(r, "1", "user12")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+
+	var stats LinkStatsJSON
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &stats))
+	assert.Equal(t, cfg.BaseURL+"/1", stats.ShortURL)
+	assert.Equal(t, "https://yandex.ru/news", stats.LongURL)
+	assert.Equal(t, int64(0), stats.Clicks)
+	assert.Nil(t, stats.LastClick)
+
+	// redirects are counted, HEAD requests and preview pages aren't.
+	res = doRequest(r, http.MethodGet, "/1", "", "", nil)
+	assert.Equal(t, http.StatusTemporaryRedirect, res.StatusCode)
+	res = doRequest(r, http.MethodGet, "/1?a=b", "", "", nil)
+	assert.Equal(t, http.StatusTemporaryRedirect, res.StatusCode)
+	res = doRequest(r, http.MethodHead, "/1", "", "", nil)
+	assert.Equal(t, http.StatusTemporaryRedirect, res.StatusCode)
+	res = doRequest(r, http.MethodGet, "/1+", "", "", nil)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	res = doRequest(r, http.MethodGet, "/100", "", "", nil)
+	assert.Equal(t, http.StatusNotFound, res.StatusCode)
+
+	w = getStats(r, "1", "user12")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &stats))
+	assert.Equal(t, int64(2), stats.Clicks)
+	assert.NotNil(t, stats.LastClick)
+
+	// statistics of other users' links aren't shown.
+	w = getStats(r, "1", "user13")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = getStats(r, "100", "user12")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
@@ -0,0 +1,307 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/size12/url-shortener/internal/logger"
+	"github.com/size12/url-shortener/internal/storage"
+	"github.com/size12/url-shortener/internal/urlnorm"
+	"go.uber.org/zap"
+)
+
+// Errors of takedown requests.
+var (
+	ErrInvalidTakedownKind   = errors.New("takedown kind must be link or domain")
+	ErrInvalidTakedownTarget = errors.New("takedown target must be link ID or domain")
+	ErrInvalidTakedownCode   = errors.New("takedown code must be 451 or 410")
+	ErrTakedownReason        = errors.New("takedown reason is required")
+)
+
+// TakedownError is returned instead of long url, if link or its domain is taken down.
+type TakedownError struct {
+	Takedown storage.Takedown
+}
+
+// Error returns reason of takedown.
+func (err *TakedownError) Error() string {
+	return "link is unavailable: " + err.Takedown.Reason
+}
+
+// TakedownRequest is request to take down or restore link or domain.
+type TakedownRequest struct {
+	Kind   string `json:"kind"`
+	Target string `json:"target"`
+	Reason string `json:"reason"`
+	// Code is status code of blocked links: 451 (default) or 410.
+	Code int `json:"code,omitempty"`
+}
+
+// takedownTarget validates and normalizes target of takedown request.
+func (service *Service) takedownTarget(ctx context.Context, req TakedownRequest) (string, error) {
+	target := strings.TrimSpace(req.Target)
+
+	switch req.Kind {
+	case storage.TakedownLink:
+		if target == "" {
+			return "", ErrInvalidTakedownTarget
+		}
+
+		_, err := service.storage.GetLink(ctx, target)
+		if err != nil && !errors.Is(err, storage.Err410) {
+			return "", err
+		}
+		return target, nil
+	case storage.TakedownDomain:
+		domain, err := urlnorm.NormalizeHost(strings.Trim(target, "."))
+		if err != nil || domain == "" || strings.ContainsAny(domain, " /:?#@") {
+			return "", ErrInvalidTakedownTarget
+		}
+		return domain, nil
+	default:
+		return "", ErrInvalidTakedownKind
+	}
+}
+
+// Takedown blocks link or all links to domain. Takedown of the same target is replaced.
+func (service *Service) Takedown(ctx context.Context, actor string, req TakedownRequest) (storage.Takedown, error) {
+	target, err := service.takedownTarget(ctx, req)
+	if err != nil {
+		return storage.Takedown{}, err
+	}
+
+	reason := strings.TrimSpace(req.Reason)
+	if reason == "" {
+		return storage.Takedown{}, ErrTakedownReason
+	}
+
+	code := req.Code
+	if code == 0 {
+		code = http.StatusUnavailableForLegalReasons
+	}
+	if code != http.StatusUnavailableForLegalReasons && code != http.StatusGone {
+		return storage.Takedown{}, ErrInvalidTakedownCode
+	}
+
+	takedown := storage.Takedown{
+		Kind:      req.Kind,
+		Target:    target,
+		Reason:    reason,
+		Code:      code,
+		Actor:     actor,
+		CreatedAt: time.Now().UTC(),
+	}
+
+	return takedown, service.takedowns.AddTakedown(ctx, takedown)
+}
+
+// Restore removes takedown of link or domain. Reason of restore is optional, it's kept in audit trail.
+func (service *Service) Restore(ctx context.Context, actor string, req TakedownRequest) error {
+	if req.Kind != storage.TakedownLink && req.Kind != storage.TakedownDomain {
+		return ErrInvalidTakedownKind
+	}
+
+	target := strings.TrimSpace(req.Target)
+	if req.Kind == storage.TakedownDomain {
+		domain, err := urlnorm.NormalizeHost(strings.Trim(target, "."))
+		if err != nil {
+			return ErrInvalidTakedownTarget
+		}
+		target = domain
+	}
+
+	return service.takedowns.RemoveTakedown(ctx, storage.Takedown{
+		Kind:      req.Kind,
+		Target:    target,
+		Reason:    strings.TrimSpace(req.Reason),
+		Actor:     actor,
+		CreatedAt: time.Now().UTC(),
+	})
+}
+
+// GetTakedowns gets active takedowns.
+func (service *Service) GetTakedowns(ctx context.Context) ([]storage.Takedown, error) {
+	return service.takedowns.GetTakedowns(ctx)
+}
+
+// GetTakedownAudit gets audit trail of takedowns and restores.
+func (service *Service) GetTakedownAudit(ctx context.Context) ([]storage.AuditEntry, error) {
+	return service.takedowns.GetAudit(ctx)
+}
+
+// checkTakedown returns *TakedownError, if link or domain of its long url is taken down.
+func (service *Service) checkTakedown(ctx context.Context, id, long string) error {
+	takedown, err := service.takedowns.GetTakedown(ctx, storage.TakedownLink, id)
+	if err == nil {
+		return &TakedownError{Takedown: takedown}
+	}
+	if !errors.Is(err, storage.Err404) {
+		return err
+	}
+
+	u, err := url.Parse(long)
+	if err != nil || u.Hostname() == "" {
+		return nil
+	}
+
+	for _, domain := range parentDomains(u.Hostname()) {
+		takedown, err := service.takedowns.GetTakedown(ctx, storage.TakedownDomain, domain)
+		if err == nil {
+			return &TakedownError{Takedown: takedown}
+		}
+		if !errors.Is(err, storage.Err404) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// parentDomains gets host and all its parent domains.
+func parentDomains(host string) []string {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if net.ParseIP(host) != nil {
+		return []string{host}
+	}
+
+	domains := []string{host}
+	for i := strings.IndexByte(host, '.'); i >= 0; i = strings.IndexByte(host, '.') {
+		host = host[i+1:]
+		domains = append(domains, host)
+	}
+	return domains
+}
+
+// adminActor gets who makes admin request for audit trail.
+func (service *Service) adminActor(r *http.Request) string {
+	if validAdminKey(service.cfg.AdminAPIKey, r) {
+		return "api-key"
+	}
+	return "ip:" + service.proxies.clientIP(r)
+}
+
+// readTakedownRequest reads takedown request from JSON body.
+func readTakedownRequest(w http.ResponseWriter, r *http.Request) (TakedownRequest, bool) {
+	var req TakedownRequest
+
+	resBody, ok := readBody(w, r)
+	if !ok {
+		return req, false
+	}
+
+	if err := json.Unmarshal(resBody, &req); err != nil {
+		writeError(w, r, invalidBody(err))
+		return req, false
+	}
+
+	return req, true
+}
+
+// TakedownHandler takes down link or domain from JSON body.
+func TakedownHandler(service *Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		req, ok := readTakedownRequest(w, r)
+		if !ok {
+			return
+		}
+
+		takedown, err := service.Takedown(r.Context(), service.adminActor(r), req)
+
+		if errors.Is(err, storage.Err404) {
+			writeError(w, r, &Error{Code: CodeNotFound, Message: "link not found", Err: err})
+			return
+		}
+
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		logger.FromContext(r.Context()).Info("Takedown added",
+			zap.String("kind", takedown.Kind), zap.String("target", takedown.Target), zap.String("actor", takedown.Actor))
+
+		data, err := json.Marshal(takedown)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		w.Write(data)
+	}
+}
+
+// RestoreHandler removes takedown of link or domain from JSON body.
+func RestoreHandler(service *Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		req, ok := readTakedownRequest(w, r)
+		if !ok {
+			return
+		}
+
+		actor := service.adminActor(r)
+		err := service.Restore(r.Context(), actor, req)
+
+		if errors.Is(err, storage.Err404) {
+			writeError(w, r, &Error{Code: CodeNotFound, Message: "takedown not found", Err: err})
+			return
+		}
+
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		logger.FromContext(r.Context()).Info("Takedown removed",
+			zap.String("kind", req.Kind), zap.String("target", req.Target), zap.String("actor", actor))
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// TakedownsHandler returns active takedowns.
+func TakedownsHandler(service *Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		takedowns, err := service.GetTakedowns(r.Context())
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		data, err := json.Marshal(takedowns)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	}
+}
+
+// TakedownAuditHandler returns audit trail of takedowns.
+func TakedownAuditHandler(service *Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		audit, err := service.GetTakedownAudit(r.Context())
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		data, err := json.Marshal(audit)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	}
+}
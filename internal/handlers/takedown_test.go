@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/size12/url-shortener/internal/config"
+	"github.com/size12/url-shortener/internal/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+// takedownRouter gets router with redirect and admin routes.
+func takedownRouter(service *Service) *chi.Mux {
+	r := redirectRouter(service)
+	r.Get("/api/admin/takedowns", TakedownsHandler(service))
+	r.Post("/api/admin/takedowns", TakedownHandler(service))
+	r.Delete("/api/admin/takedowns", RestoreHandler(service))
+	r.Get("/api/admin/takedowns/audit", TakedownAuditHandler(service))
+	return r
+}
+
+func TestTakedownHandler(t *testing.T) {
+	cfg := config.GetTestConfig()
+	cfg.AdminAPIKey = "secret"
+	// requests of httptest come from trusted proxy 192.0.2.1.
+	cfg.TrustedProxies = "192.0.2.0/24"
+	s, err := storage.NewMapStorage(cfg)
+	assert.NoError(t, err)
+	r := takedownRouter(NewService(cfg, s))
+	admin := http.Header{"Authorization": []string{"Bearer secret"}}
+
+	res := doRequest(r, http.MethodPost, "/", "text/plain", "https://yandex.ru/news", nil)
+	assert.Equal(t, http.StatusCreated, res.StatusCode)
+	res = doRequest(r, http.MethodPost, "/", "text/plain", "https://mail.evil.ru/login", nil)
+	assert.Equal(t, http.StatusCreated, res.StatusCode)
+
+	// invalid requests.
+	res = doRequest(r, http.MethodPost, "/api/admin/takedowns", "application/json", `{"kind":"user","target":"1","reason":"x"}`, admin)
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+	res = doRequest(r, http.MethodPost, "/api/admin/takedowns", "application/json", `{"kind":"link","target":"1"}`, admin)
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+	res = doRequest(r, http.MethodPost, "/api/admin/takedowns", "application/json", `{"kind":"link","target":"1","reason":"x","code":404}`, admin)
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+	res = doRequest(r, http.MethodPost, "/api/admin/takedowns", "application/json", `{"kind":"domain","target":"evil.ru/login","reason":"x"}`, admin)
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+	res = doRequest(r, http.MethodPost, "/api/admin/takedowns", "application/json", `{"kind":"link","target":"100","reason":"x"}`, admin)
+	assert.Equal(t, http.StatusNotFound, res.StatusCode)
+
+	// link takedown.
+	request := httptest.NewRequest(http.MethodPost, "/api/admin/takedowns",
+		strings.NewReader(`{"kind":"link","target":"1","reason":"court order 12"}`))
+	request.Header = admin.Clone()
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, request)
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	var takedown storage.Takedown
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &takedown))
+	assert.Equal(t, http.StatusUnavailableForLegalReasons, takedown.Code)
+	assert.Equal(t, "api-key", takedown.Actor)
+
+	request = httptest.NewRequest(http.MethodGet, "/1", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, request)
+	assert.Equal(t, http.StatusUnavailableForLegalReasons, w.Code)
+	assert.Empty(t, w.Header().Get("Location"))
+	assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+	body, err := io.ReadAll(w.Body)
+	assert.NoError(t, err)
+	assert.Contains(t, string(body), "court order 12")
+
+	res = doRequest(r, http.MethodHead, "/1", "", "", nil)
+	assert.Equal(t, http.StatusUnavailableForLegalReasons, res.StatusCode)
+
+	// domain takedown blocks subdomains.
+	res = doRequest(r, http.MethodPost, "/api/admin/takedowns", "application/json",
+		`{"kind":"domain","target":"EVIL.ru","reason":"phishing","code":410}`, admin)
+	assert.Equal(t, http.StatusCreated, res.StatusCode)
+
+	res = doRequest(r, http.MethodGet, "/2", "", "", nil)
+	assert.Equal(t, http.StatusGone, res.StatusCode)
+
+	// active takedowns.
+	request = httptest.NewRequest(http.MethodGet, "/api/admin/takedowns", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, request)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var takedowns []storage.Takedown
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &takedowns))
+	assert.Len(t, takedowns, 2)
+	assert.Equal(t, "evil.ru", takedowns[1].Target)
+
+	// restore.
+	res = doRequest(r, http.MethodDelete, "/api/admin/takedowns", "application/json",
+		`{"kind":"link","target":"1","reason":"order is cancelled"}`, http.Header{"X-Real-Ip": []string{"127.0.0.1"}})
+	assert.Equal(t, http.StatusNoContent, res.StatusCode)
+	res = doRequest(r, http.MethodDelete, "/api/admin/takedowns", "application/json", `{"kind":"link","target":"1"}`, admin)
+	assert.Equal(t, http.StatusNotFound, res.StatusCode)
+
+	res = doRequest(r, http.MethodGet, "/1", "", "", nil)
+	assert.Equal(t, http.StatusTemporaryRedirect, res.StatusCode)
+
+	// audit trail.
+	request = httptest.NewRequest(http.MethodGet, "/api/admin/takedowns/audit", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, request)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var audit []storage.AuditEntry
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &audit))
+	assert.Len(t, audit, 3)
+	assert.Equal(t, storage.AuditRestore, audit[2].Action)
+	assert.Equal(t, "order is cancelled", audit[2].Reason)
+	assert.Equal(t, "ip:127.0.0.1", audit[2].Actor)
+
+	// actor of untrusted client is its connection address.
+	request = httptest.NewRequest(http.MethodGet, "/api/admin/takedowns", nil)
+	request.RemoteAddr = "9.9.9.9:5000"
+	request.Header.Set("X-Real-IP", "127.0.0.1")
+	assert.Equal(t, "ip:9.9.9.9", NewService(cfg, s).adminActor(request))
+}
+
+func TestService_GetLongURLTakedown(t *testing.T) {
+	cfg := config.GetTestConfig()
+	s, err := storage.NewMapStorage(cfg)
+	assert.NoError(t, err)
+	service := NewService(cfg, s)
+
+	id, err := service.ShortSingleURL(context.Background(), "user12", storage.RequestJSON{URL: "https://a.b.evil.ru"})
+	assert.NoError(t, err)
+
+	_, err = service.Takedown(context.Background(), "legal", TakedownRequest{Kind: storage.TakedownDomain, Target: "b.evil.ru", Reason: "malware"})
+	assert.NoError(t, err)
+
+	_, err = service.GetLongURL(context.Background(), id)
+	var takedownErr *TakedownError
+	assert.ErrorAs(t, err, &takedownErr)
+	assert.Equal(t, "malware", takedownErr.Takedown.Reason)
+}
+
+func TestParentDomains(t *testing.T) {
+	assert.Equal(t, []string{"a.b.ru", "b.ru", "ru"}, parentDomains("A.b.ru."))
+	assert.Equal(t, []string{"127.0.0.1"}, parentDomains("127.0.0.1"))
+}
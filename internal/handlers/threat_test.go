@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/size12/url-shortener/internal/config"
+	"github.com/size12/url-shortener/internal/storage"
+	"github.com/size12/url-shortener/internal/threat"
+	"github.com/stretchr/testify/assert"
+)
+
+// hostChecker flags urls, which contain one of hosts.
+type hostChecker struct {
+	hosts []string
+}
+
+func (c *hostChecker) CheckURL(ctx context.Context, rawURL string) (threat.Verdict, error) {
+	for _, host := range c.hosts {
+		if strings.Contains(rawURL, host) {
+			return threat.Verdict{Malicious: true, Reason: "phishing"}, nil
+		}
+	}
+	return threat.Verdict{}, nil
+}
+
+func TestURLPostHandler_URLChecker(t *testing.T) {
+	cfg := config.GetTestConfig()
+	s, err := storage.NewMapStorage(cfg)
+	assert.NoError(t, err)
+	r := redirectRouter(NewService(cfg, s, WithURLChecker(&hostChecker{hosts: []string{"evil.ru"}})))
+
+	res := doRequest(r, http.MethodPost, "/", "text/plain", "https://evil.ru/login", nil)
+	assert.Equal(t, http.StatusUnprocessableEntity, res.StatusCode)
+
+	res = doRequest(r, http.MethodPost, "/api/shorten", "application/json", `{"url":"https://evil.ru/login"}`, nil)
+	assert.Equal(t, http.StatusUnprocessableEntity, res.StatusCode)
+
+	res = doRequest(r, http.MethodPost, "/api/shorten/batch", "application/json",
+		`[{"correlation_id":"1","original_url":"https://yandex.ru"},{"correlation_id":"2","original_url":"https://evil.ru"}]`, nil)
+	assert.Equal(t, http.StatusUnprocessableEntity, res.StatusCode)
+
+	res = doRequest(r, http.MethodPost, "/", "text/plain", "https://yandex.ru", nil)
+	assert.Equal(t, http.StatusCreated, res.StatusCode)
+}
+
+func TestURLGetHandler_URLCheckerWarning(t *testing.T) {
+	cfg := config.GetTestConfig()
+	cfg.ThreatCheckRedirects = true
+	s, err := storage.NewMapStorage(cfg)
+	assert.NoError(t, err)
+
+	checker := &hostChecker{}
+	r := redirectRouter(NewService(cfg, s, WithURLChecker(checker)))
+
+	res := doRequest(r, http.MethodPost, "/", "text/plain", "https://phish.ru/login?a=1&b=2", nil)
+	assert.Equal(t, http.StatusCreated, res.StatusCode)
+
+	res = doRequest(r, http.MethodGet, "/1", "", "", nil)
+	assert.Equal(t, http.StatusTemporaryRedirect, res.StatusCode)
+
+	// threat feed is updated after link is created.
+	checker.hosts = []string{"phish.ru"}
+
+	request := httptest.NewRequest(http.MethodGet, "/1", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, request)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get("Location"))
+	assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+	assert.Contains(t, w.Header().Get("Content-Type"), "text/html")
+
+	body, err := io.ReadAll(w.Body)
+	assert.NoError(t, err)
+	assert.Contains(t, string(body), "phishing")
+	assert.Contains(t, string(body), `href="https://phish.ru/login?a=1&amp;b=2"`)
+
+	// redirects aren't checked, if it's disabled.
+	cfg.ThreatCheckRedirects = false
+	r = redirectRouter(NewService(cfg, s, WithURLChecker(checker)))
+	res = doRequest(r, http.MethodGet, "/1", "", "", nil)
+	assert.Equal(t, http.StatusTemporaryRedirect, res.StatusCode)
+}
@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/size12/url-shortener/internal/config"
+	"github.com/size12/url-shortener/internal/storage"
+	"github.com/size12/url-shortener/internal/urlnorm"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestService_ShortSingleURL_Normalization(t *testing.T) {
+	cfg := config.GetTestConfig()
+	cfg.NormalizeDropFragment = true
+	s, err := storage.NewMapStorage(cfg)
+	assert.NoError(t, err)
+	service := NewService(cfg, s)
+	ctx := context.Background()
+
+	id, err := service.ShortSingleURL(ctx, "user12", storage.RequestJSON{URL: "http://Example.com#top"})
+	assert.NoError(t, err)
+
+	// different spellings of the same url are duplicates.
+	for _, long := range []string{"http://example.com/", "http://example.com:80", "HTTP://EXAMPLE.COM/./#bottom"} {
+		got, err := service.ShortSingleURL(ctx, "user13", storage.RequestJSON{URL: long})
+		assert.Equal(t, storage.Err409, err, long)
+		assert.Equal(t, id, got, long)
+	}
+
+	// link leads to canonical url, but owner sees url as it was sent.
+	link, err := s.GetLink(ctx, id)
+	assert.NoError(t, err)
+	assert.Equal(t, "http://example.com", link.URL)
+	assert.Equal(t, "http://Example.com#top", link.OriginalURL)
+
+	history, err := s.GetHistory(ctx, "user12")
+	assert.NoError(t, err)
+	assert.Equal(t, "http://Example.com#top", history[0].LongURL)
+
+	// IDN host is stored in punycode.
+	id, err = service.ShortSingleURL(ctx, "user12", storage.RequestJSON{URL: "https://пример.рф/Путь"})
+	assert.NoError(t, err)
+	link, err = s.GetLink(ctx, id)
+	assert.NoError(t, err)
+	assert.Equal(t, "https://xn--e1afmkfd.xn--p1ai/%D0%9F%D1%83%D1%82%D1%8C", link.URL)
+
+	_, err = service.ShortSingleURL(ctx, "user12", storage.RequestJSON{URL: "https://a\u200d.com"})
+	assert.ErrorIs(t, err, urlnorm.ErrInvalidHost)
+}
+
+func TestService_ShortSingleURL_NormalizationDisabled(t *testing.T) {
+	cfg := config.GetTestConfig()
+	cfg.DisableURLNormalization = true
+	s, err := storage.NewMapStorage(cfg)
+	assert.NoError(t, err)
+	service := NewService(cfg, s)
+
+	first, err := service.ShortSingleURL(context.Background(), "user12", storage.RequestJSON{URL: "http://Example.com"})
+	assert.NoError(t, err)
+
+	second, err := service.ShortSingleURL(context.Background(), "user12", storage.RequestJSON{URL: "http://example.com/"})
+	assert.NoError(t, err)
+	assert.NotEqual(t, first, second)
+}
+
+func TestService_ShortURLs_Normalization(t *testing.T) {
+	cfg := config.GetTestConfig()
+	cfg.NormalizeSortQuery = true
+	s, err := storage.NewMapStorage(cfg)
+	assert.NoError(t, err)
+	service := NewService(cfg, s)
+
+	result, err := service.ShortURLs(context.Background(), "user12", []storage.BatchJSON{
+		{CorrelationID: "1", URL: "https://Site.ru/?b=2&a=1"},
+		{CorrelationID: "2", URL: "https://site.ru:443?a=1&b=2"},
+	})
+	assert.Equal(t, storage.Err409, err)
+	assert.Equal(t, result[0].ShortURL, result[1].ShortURL)
+
+	r := redirectRouter(service)
+	res := doRequest(r, http.MethodGet, "/1", "", "", nil)
+	assert.Equal(t, "https://site.ru?a=1&b=2", res.Header.Get("Location"))
+
+	res = doRequest(r, http.MethodPost, "/api/shorten/batch", "application/json",
+		`[{"correlation_id":"1","original_url":"https://a\u200d.com"}]`, nil)
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+}
@@ -0,0 +1,167 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/size12/url-shortener/internal/storage"
+)
+
+// maxUTMPresetNameLength is max length of UTM preset name.
+const maxUTMPresetNameLength = 64
+
+// ErrInvalidUTMPresetName is returned, if name of UTM preset is empty or too long.
+var ErrInvalidUTMPresetName = errors.New("UTM preset name must be from 1 to 64 characters")
+
+// buildURL adds UTM parameters of preset and request to long url.
+// UTM parameters replace parameters with the same name in long url, other parameters are kept.
+func (service *Service) buildURL(ctx context.Context, userID, long string, req storage.UTMRequest) (string, error) {
+	if req.UTM == nil && req.UTMPreset == "" {
+		return long, nil
+	}
+
+	var utm storage.UTM
+	if req.UTMPreset != "" {
+		preset, err := service.utmPresets.GetUTMPreset(ctx, userID, req.UTMPreset)
+		if errors.Is(err, storage.Err404) {
+			return "", ErrUnknownUTMPreset
+		}
+		if err != nil {
+			return "", err
+		}
+		utm = preset
+	}
+
+	if req.UTM != nil {
+		utm = utm.Merge(*req.UTM)
+	}
+
+	values := utm.Values()
+	if len(values) == 0 {
+		return long, nil
+	}
+
+	location, err := url.Parse(long)
+	if err != nil {
+		// invalid url is rejected by storage.
+		return long, nil
+	}
+
+	mergeQuery(location, values, storage.QueryModeOverride)
+	return location.String(), nil
+}
+
+// queryUTM gets UTM parameters of new link from query parameters of plain text request.
+func queryUTM(r *http.Request) storage.UTMRequest {
+	query := r.URL.Query()
+	utm := storage.UTM{
+		Source:   query.Get("utm_source"),
+		Medium:   query.Get("utm_medium"),
+		Campaign: query.Get("utm_campaign"),
+		Term:     query.Get("utm_term"),
+		Content:  query.Get("utm_content"),
+	}
+
+	req := storage.UTMRequest{UTMPreset: query.Get("utm_preset")}
+	if utm != (storage.UTM{}) {
+		req.UTM = &utm
+	}
+	return req
+}
+
+// GetUTMPresets gets UTM presets of user.
+func (service *Service) GetUTMPresets(ctx context.Context, userID string) (map[string]storage.UTM, error) {
+	return service.utmPresets.GetUTMPresets(ctx, userID)
+}
+
+// SetUTMPreset creates or replaces UTM preset of user.
+func (service *Service) SetUTMPreset(ctx context.Context, userID, name string, utm storage.UTM) error {
+	if name == "" || len(name) > maxUTMPresetNameLength {
+		return ErrInvalidUTMPresetName
+	}
+	return service.utmPresets.SetUTMPreset(ctx, userID, name, utm)
+}
+
+// DeleteUTMPreset deletes UTM preset of user.
+func (service *Service) DeleteUTMPreset(ctx context.Context, userID, name string) error {
+	return service.utmPresets.DeleteUTMPreset(ctx, userID, name)
+}
+
+// UTMPresetsHandler returns UTM presets of user.
+func UTMPresetsHandler(service *Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := requestUser(r)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		presets, err := service.GetUTMPresets(r.Context(), userID)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		data, err := json.Marshal(presets)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	}
+}
+
+// SetUTMPresetHandler creates or replaces UTM preset of user from JSON body.
+func SetUTMPresetHandler(service *Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := requestUser(r)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		resBody, ok := readBody(w, r)
+		if !ok {
+			return
+		}
+
+		var utm storage.UTM
+		if err := json.Unmarshal(resBody, &utm); err != nil {
+			writeError(w, r, invalidBody(err))
+			return
+		}
+
+		err = service.SetUTMPreset(r.Context(), userID, chi.URLParam(r, "name"), utm)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// DeleteUTMPresetHandler deletes UTM preset of user.
+func DeleteUTMPresetHandler(service *Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := requestUser(r)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		err = service.DeleteUTMPreset(r.Context(), userID, chi.URLParam(r, "name"))
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/size12/url-shortener/internal/config"
+	"github.com/size12/url-shortener/internal/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+// utmRouter creates router with create and UTM presets routes.
+func utmRouter(service *Service) *chi.Mux {
+	r := redirectRouter(service)
+	r.Get("/api/user/utm-presets", UTMPresetsHandler(service))
+	r.Put("/api/user/utm-presets/{name}", SetUTMPresetHandler(service))
+	r.Delete("/api/user/utm-presets/{name}", DeleteUTMPresetHandler(service))
+	return r
+}
+
+func TestUTMPresetHandlers(t *testing.T) {
+	cfg := config.GetTestConfig()
+	s, err := storage.NewMapStorage(cfg)
+	assert.NoError(t, err)
+	r := utmRouter(NewService(cfg, s))
+
+	res := doRequest(r, http.MethodPut, "/api/user/utm-presets/newsletter", "application/json", `{"source":"newsletter","medium":"email"}`, nil)
+	assert.Equal(t, http.StatusNoContent, res.StatusCode)
+
+	res = doRequest(r, http.MethodPut, "/api/user/utm-presets/bad", "application/json", `{"source":`, nil)
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+
+	res = doRequest(r, http.MethodPut, "/api/user/utm-presets/"+strings.Repeat("a", 65), "application/json", `{}`, nil)
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+
+	request := httptest.NewRequest(http.MethodGet, "/api/user/utm-presets", nil)
+	request.AddCookie(&http.Cookie{Name: "userID", Value: "user12"})
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, request)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	body, err := io.ReadAll(w.Body)
+	assert.NoError(t, err)
+
+	var presets map[string]storage.UTM
+	assert.NoError(t, json.Unmarshal(body, &presets))
+	assert.Equal(t, map[string]storage.UTM{"newsletter": {Source: "newsletter", Medium: "email"}}, presets)
+
+	res = doRequest(r, http.MethodDelete, "/api/user/utm-presets/newsletter", "", "", nil)
+	assert.Equal(t, http.StatusNoContent, res.StatusCode)
+
+	res = doRequest(r, http.MethodDelete, "/api/user/utm-presets/newsletter", "", "", nil)
+	assert.Equal(t, http.StatusNotFound, res.StatusCode)
+}
+
+func TestURLPostHandler_UTM(t *testing.T) {
+	cfg := config.GetTestConfig()
+	s, err := storage.NewMapStorage(cfg)
+	assert.NoError(t, err)
+	r := utmRouter(NewService(cfg, s))
+
+	res := doRequest(r, http.MethodPut, "/api/user/utm-presets/newsletter", "application/json", `{"source":"newsletter","medium":"email"}`, nil)
+	assert.Equal(t, http.StatusNoContent, res.StatusCode)
+
+	tests := []struct {
+		name        string
+		target      string
+		contentType string
+		body        string
+		code        int
+		long        string
+	}{
+		{
+			name:        "plain with query parameters",
+			target:      "/?utm_source=ads&utm_campaign=sale",
+			contentType: "text/plain",
+			body:        "https://site.ru/1?lang=ru",
+			code:        http.StatusCreated,
+			long:        "https://site.ru/1?lang=ru&utm_campaign=sale&utm_source=ads",
+		},
+		{
+			name:        "json with preset",
+			target:      "/api/shorten",
+			contentType: "application/json",
+			body:        `{"url":"https://site.ru/2","utm_preset":"newsletter"}`,
+			code:        http.StatusCreated,
+			long:        "https://site.ru/2?utm_medium=email&utm_source=newsletter",
+		},
+		{
+			name:        "utm overrides preset and long url",
+			target:      "/api/shorten",
+			contentType: "application/json",
+			body:        `{"url":"https://site.ru/3?utm_source=old","utm_preset":"newsletter","utm":{"source":"blog"}}`,
+			code:        http.StatusCreated,
+			long:        "https://site.ru/3?utm_medium=email&utm_source=blog",
+		},
+		{
+			name:        "batch",
+			target:      "/api/shorten/batch",
+			contentType: "application/json",
+			body:        `[{"correlation_id":"1","original_url":"https://site.ru/4","utm":{"term":"shoes"}}]`,
+			code:        http.StatusCreated,
+			long:        "https://site.ru/4?utm_term=shoes",
+		},
+		{
+			name:        "same final url is duplicate",
+			target:      "/?utm_preset=newsletter",
+			contentType: "text/plain",
+			body:        "https://site.ru/2",
+			code:        http.StatusConflict,
+		},
+		{
+			name:        "unknown preset",
+			target:      "/api/shorten",
+			contentType: "application/json",
+			body:        `{"url":"https://site.ru/5","utm_preset":"unknown"}`,
+			code:        http.StatusBadRequest,
+		},
+		{
+			name:        "unknown preset in batch",
+			target:      "/api/shorten/batch",
+			contentType: "application/json",
+			body:        `[{"correlation_id":"1","original_url":"https://site.ru/5","utm_preset":"unknown"}]`,
+			code:        http.StatusBadRequest,
+		},
+	}
+
+	for i, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			res := doRequest(r, http.MethodPost, tc.target, tc.contentType, tc.body, nil)
+			assert.Equal(t, tc.code, res.StatusCode)
+
+			if tc.long == "" {
+				return
+			}
+
+			link, err := s.GetLink(context.Background(), strconv.Itoa(i+1))
+			assert.NoError(t, err)
+			assert.Equal(t, tc.long, link.URL)
+		})
+	}
+}
@@ -0,0 +1,465 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/size12/url-shortener/internal/storage"
+)
+
+// APIv2Prefix is path prefix of REST API v2.
+const APIv2Prefix = "/api/v2"
+
+// LinkResource is short link in API v2.
+type LinkResource struct {
+	ID        string    `json:"id"`
+	ShortURL  string    `json:"short_url"`
+	LongURL   string    `json:"original_url"`
+	CreatedAt time.Time `json:"created_at"`
+	storage.LinkOptions
+}
+
+// LinkList is list of user's links in API v2.
+type LinkList struct {
+	Links []LinkResource `json:"links"`
+}
+
+// CreateLinkRequest is request to create link in API v2.
+type CreateLinkRequest storage.RequestJSON
+
+// UserResource is user of API v2, who is identified by userID cookie.
+type UserResource struct {
+	ID    string `json:"id"`
+	Links int    `json:"links"`
+}
+
+// linkResource gets API v2 resource of link.
+func (service *Service) linkResource(link storage.Link) LinkResource {
+	return LinkResource{
+		ID:          link.ID,
+		ShortURL:    service.cfg.BaseURL + "/" + link.ID,
+		LongURL:     link.DisplayURL(),
+		CreatedAt:   link.CreatedAt,
+		LinkOptions: link.Options,
+	}
+}
+
+// getUserLink gets link of user. Links of other users aren't found, deleted links of user return storage.Err410.
+func (service *Service) getUserLink(ctx context.Context, userID, id string) (storage.Link, error) {
+	link, err := service.storage.GetLink(ctx, id)
+	if err != nil && !errors.Is(err, storage.Err410) {
+		return storage.Link{}, err
+	}
+
+	if link.UserID != userID {
+		return storage.Link{}, storage.Err404
+	}
+
+	return link, err
+}
+
+// CreateLink creates link of user. Link, which is already shortened, is returned with storage.Err409.
+func (service *Service) CreateLink(ctx context.Context, userID string, req CreateLinkRequest) (LinkResource, error) {
+	id, err := service.ShortSingleURL(ctx, userID, storage.RequestJSON(req))
+	if err != nil && !errors.Is(err, storage.Err409) {
+		return LinkResource{}, err
+	}
+
+	link, getErr := service.storage.GetLink(ctx, id)
+	if getErr != nil {
+		return LinkResource{}, getErr
+	}
+
+	return service.linkResource(link), err
+}
+
+// GetLinks gets links of user, which aren't deleted.
+func (service *Service) GetLinks(ctx context.Context, userID string) ([]LinkResource, error) {
+	history, err := service.storage.GetHistory(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	links := make([]LinkResource, 0, len(history))
+	for _, elem := range history {
+		id := strings.TrimPrefix(elem.ShortURL, service.cfg.BaseURL+"/")
+
+		link, err := service.storage.GetLink(ctx, id)
+		if errors.Is(err, storage.Err410) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		links = append(links, service.linkResource(link))
+	}
+
+	return links, nil
+}
+
+// GetLink gets link of user.
+func (service *Service) GetLink(ctx context.Context, userID, id string) (LinkResource, error) {
+	link, err := service.getUserLink(ctx, userID, id)
+	if err != nil {
+		return LinkResource{}, err
+	}
+	return service.linkResource(link), nil
+}
+
+// UpdateLink replaces options of user's link.
+func (service *Service) UpdateLink(ctx context.Context, userID, id string, opts storage.LinkOptions) (LinkResource, error) {
+	link, err := service.getUserLink(ctx, userID, id)
+	if err != nil {
+		return LinkResource{}, err
+	}
+
+	if err := service.checkOptions(opts); err != nil {
+		return LinkResource{}, err
+	}
+
+	if err := service.storage.SetLinkOptions(ctx, id, opts); err != nil {
+		return LinkResource{}, err
+	}
+
+	link.Options = opts
+	return service.linkResource(link), nil
+}
+
+// DeleteLink deletes link of user.
+func (service *Service) DeleteLink(ctx context.Context, userID, id string) error {
+	if _, err := service.getUserLink(ctx, userID, id); err != nil {
+		return err
+	}
+	return service.DeleteURL(ctx, userID, []string{id})
+}
+
+// GetUser gets user with number of links, which aren't deleted.
+func (service *Service) GetUser(ctx context.Context, userID string) (UserResource, error) {
+	links, err := service.GetLinks(ctx, userID)
+	if err != nil {
+		return UserResource{}, err
+	}
+	return UserResource{ID: userID, Links: len(links)}, nil
+}
+
+// writeJSON writes value as JSON response with status code.
+func writeJSON(w http.ResponseWriter, r *http.Request, code int, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	w.Write(data)
+}
+
+// decodeJSON reads JSON body into v. Unknown fields are errors, so typos in requests aren't ignored.
+func decodeJSON(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	resBody, ok := readBody(w, r)
+	if !ok {
+		return false
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(resBody))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		writeError(w, r, invalidBody(err))
+		return false
+	}
+
+	return true
+}
+
+// CreateLinkHandler creates link from JSON body.
+// New link is answered with 201 Created, link, which is already shortened, with 200 OK.
+func CreateLinkHandler(service *Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := requestUser(r)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		var req CreateLinkRequest
+		if !decodeJSON(w, r, &req) {
+			return
+		}
+
+		link, err := service.CreateLink(r.Context(), userID, req)
+		if errors.Is(err, storage.Err409) {
+			writeJSON(w, r, http.StatusOK, link)
+			return
+		}
+
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		w.Header().Set("Location", APIv2Prefix+"/links/"+link.ID)
+		writeJSON(w, r, http.StatusCreated, link)
+	}
+}
+
+// LinksHandler returns links of user.
+func LinksHandler(service *Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := requestUser(r)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		links, err := service.GetLinks(r.Context(), userID)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		writeJSON(w, r, http.StatusOK, LinkList{Links: links})
+	}
+}
+
+// LinkHandler returns link of user.
+func LinkHandler(service *Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := requestUser(r)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		link, err := service.GetLink(r.Context(), userID, chi.URLParam(r, "id"))
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		writeJSON(w, r, http.StatusOK, link)
+	}
+}
+
+// UpdateLinkHandler updates options of user's link from JSON body.
+// Only options in body are changed, null resets option.
+func UpdateLinkHandler(service *Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := requestUser(r)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		id := chi.URLParam(r, "id")
+		link, err := service.GetLink(r.Context(), userID, id)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		// options from body are merged into current ones.
+		opts := link.LinkOptions
+		if !decodeJSON(w, r, &opts) {
+			return
+		}
+
+		link, err = service.UpdateLink(r.Context(), userID, id, opts)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		writeJSON(w, r, http.StatusOK, link)
+	}
+}
+
+// DeleteLinkHandler deletes link of user.
+func DeleteLinkHandler(service *Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := requestUser(r)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		if err := service.DeleteLink(r.Context(), userID, chi.URLParam(r, "id")); err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// LinkStatsV2Handler returns statistics of user's link.
+func LinkStatsV2Handler(service *Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := requestUser(r)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		stats, err := service.GetLinkStats(r.Context(), userID, chi.URLParam(r, "id"))
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		writeJSON(w, r, http.StatusOK, stats)
+	}
+}
+
+// CurrentUserHandler returns user of request.
+func CurrentUserHandler(service *Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := requestUser(r)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		user, err := service.GetUser(r.Context(), userID)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		writeJSON(w, r, http.StatusOK, user)
+	}
+}
+
+// StatisticV2Handler returns total urls and users.
+func StatisticV2Handler(service *Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		stats, err := service.GetStatistic(r.Context())
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		writeJSON(w, r, http.StatusOK, stats)
+	}
+}
+
+// apiV2Route is endpoint of API v2. Router and OpenAPI document are built from the same routes,
+// so document always describes served endpoints.
+type apiV2Route struct {
+	method  string
+	pattern string
+	// class is rate limit class of route. Empty class isn't limited.
+	class string
+	// trusted routes are served only to trusted subnet.
+	trusted bool
+	// idempotent routes replay response to retry with the same Idempotency-Key.
+	idempotent bool
+	handler    func(service *Service) http.HandlerFunc
+	doc        routeDoc
+}
+
+// apiV2Routes are endpoints of API v2.
+var apiV2Routes = []apiV2Route{
+	{
+		method: http.MethodGet, pattern: "/links", handler: LinksHandler,
+		doc: routeDoc{
+			id: "listLinks", summary: "List links of user", tag: "links",
+			responses: []routeResponse{{http.StatusOK, "Links of user, which aren't deleted.", LinkList{}}},
+		},
+	},
+	{
+		method: http.MethodPost, pattern: "/links", class: RouteCreate, idempotent: true, handler: CreateLinkHandler,
+		doc: routeDoc{
+			id: "createLink", summary: "Create link", tag: "links", request: CreateLinkRequest{},
+			responses: []routeResponse{
+				{http.StatusCreated, "Link is created.", LinkResource{}},
+				{http.StatusOK, "URL is already shortened, existing link is returned.", LinkResource{}},
+			},
+			errors: []ErrorCode{
+				CodeBodyTooLarge, CodeInvalidURL, CodeURLTooLong, CodeForbiddenURL, CodeMaliciousURL,
+				CodeInvalidOptions, CodeUnknownUTMPreset,
+			},
+		},
+	},
+	{
+		method: http.MethodGet, pattern: "/links/{id}", handler: LinkHandler,
+		doc: routeDoc{
+			id: "getLink", summary: "Get link", tag: "links",
+			responses: []routeResponse{{http.StatusOK, "Link.", LinkResource{}}},
+			errors:    []ErrorCode{CodeNotFound, CodeLinkDeleted},
+		},
+	},
+	{
+		method: http.MethodPatch, pattern: "/links/{id}", handler: UpdateLinkHandler,
+		doc: routeDoc{
+			id: "updateLink", summary: "Update options of link", tag: "links", request: storage.LinkOptions{},
+			responses: []routeResponse{{http.StatusOK, "Updated link.", LinkResource{}}},
+			errors:    []ErrorCode{CodeBodyTooLarge, CodeInvalidOptions, CodeNotFound, CodeLinkDeleted},
+		},
+	},
+	{
+		method: http.MethodDelete, pattern: "/links/{id}", class: RouteDelete, handler: DeleteLinkHandler,
+		doc: routeDoc{
+			id: "deleteLink", summary: "Delete link", tag: "links",
+			responses: []routeResponse{{http.StatusNoContent, "Link is deleted.", nil}},
+			errors:    []ErrorCode{CodeNotFound, CodeLinkDeleted},
+		},
+	},
+	{
+		method: http.MethodGet, pattern: "/links/{id}/stats", handler: LinkStatsV2Handler,
+		doc: routeDoc{
+			id: "getLinkStats", summary: "Get visits of link", tag: "stats",
+			responses: []routeResponse{{http.StatusOK, "Statistics of link.", LinkStatsJSON{}}},
+			errors:    []ErrorCode{CodeNotFound, CodeLinkDeleted},
+		},
+	},
+	{
+		method: http.MethodGet, pattern: "/users/me", handler: CurrentUserHandler,
+		doc: routeDoc{
+			id: "getCurrentUser", summary: "Get current user", tag: "users",
+			responses: []routeResponse{{http.StatusOK, "User of request.", UserResource{}}},
+		},
+	},
+	{
+		method: http.MethodGet, pattern: "/stats", trusted: true, handler: StatisticV2Handler,
+		doc: routeDoc{
+			id: "getStats", summary: "Get total links and users", tag: "stats",
+			responses: []routeResponse{{http.StatusOK, "Statistics of service.", storage.Statistic{}}},
+		},
+	},
+}
+
+// APIv2Routes gets routes of REST API v2, which should be mounted at APIv2Prefix.
+// Every error of API v2, including unknown routes, is problem JSON.
+func APIv2Routes(service *Service, limiter *RateLimiter) func(r chi.Router) {
+	return func(r chi.Router) {
+		r.NotFound(func(w http.ResponseWriter, r *http.Request) {
+			writeError(w, r, NewError(CodeNotFound, "not found"))
+		})
+		r.MethodNotAllowed(URLErrorHandler)
+
+		trusted := NewIPPermissionsChecker(service.cfg)
+		for _, route := range apiV2Routes {
+			var handler http.Handler = route.handler(service)
+			if route.class != "" {
+				handler = limiter.Limit(route.class)(handler)
+			}
+			if route.idempotent {
+				handler = IdempotencyMiddleware(service)(handler)
+			}
+			if route.trusted {
+				handler = trusted(handler)
+			}
+			r.Method(route.method, route.pattern, handler)
+		}
+
+		r.Get("/openapi.json", OpenAPIHandler(service.cfg.BaseURL+APIv2Prefix))
+	}
+}
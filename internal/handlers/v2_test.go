@@ -0,0 +1,170 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/size12/url-shortener/internal/config"
+	"github.com/size12/url-shortener/internal/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+// apiV2Router gets router with API v2 routes.
+func apiV2Router(service *Service) *chi.Mux {
+	r := chi.NewRouter()
+	r.Route(APIv2Prefix, APIv2Routes(service, NewRateLimiter(service.cfg)))
+	return r
+}
+
+// apiV2Request sends request with JSON body to API v2 as user.
+func apiV2Request(r http.Handler, method, path, body, userID string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(method, APIv2Prefix+path, strings.NewReader(body))
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("X-Real-IP", "127.0.0.1")
+	request.AddCookie(&http.Cookie{Name: "userID", Value: userID})
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, request)
+	return w
+}
+
+// assertProblem checks that response is problem JSON with status and code.
+func assertProblem(t *testing.T, w *httptest.ResponseRecorder, status int, code ErrorCode) {
+	t.Helper()
+	assert.Equal(t, status, w.Code)
+	assert.Equal(t, ProblemContentType, w.Header().Get("Content-Type"))
+
+	var problem Problem
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &problem))
+	assert.Equal(t, code, problem.Code)
+}
+
+func TestAPIv2_Links(t *testing.T) {
+	cfg := config.GetTestConfig()
+	s, err := storage.NewMapStorage(cfg)
+	assert.NoError(t, err)
+	r := apiV2Router(NewService(cfg, s))
+
+	// no links yet.
+	w := apiV2Request(r, http.MethodGet, "/links", "", "user12")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"links":[]}`, w.Body.String())
+
+	// create.
+	w = apiV2Request(r, http.MethodPost, "/links", `{"url":"https://yandex.ru/news","title":"News"}`, "user12")
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	assert.Equal(t, APIv2Prefix+"/links/1", w.Header().Get("Location"))
+
+	var link LinkResource
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &link))
+	assert.Equal(t, "1", link.ID)
+	assert.Equal(t, cfg.BaseURL+"/1", link.ShortURL)
+	assert.Equal(t, "https://yandex.ru/news", link.LongURL)
+	assert.Equal(t, "News", link.Title)
+
+	// the same url returns existing link.
+	w = apiV2Request(r, http.MethodPost, "/links", `{"url":"https://yandex.ru/news"}`, "user12")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &link))
+	assert.Equal(t, "1", link.ID)
+
+	w = apiV2Request(r, http.MethodPost, "/links", `{"url":"https://yandex.ru","redirect":301}`, "user12")
+	assertProblem(t, w, http.StatusBadRequest, CodeInvalidBody)
+
+	w = apiV2Request(r, http.MethodPost, "/links", `{"url":"https://yandex.ru","redirect_code":200}`, "user12")
+	assertProblem(t, w, http.StatusBadRequest, CodeInvalidOptions)
+
+	// read.
+	w = apiV2Request(r, http.MethodGet, "/links/1", "", "user12")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = apiV2Request(r, http.MethodGet, "/links", "", "user12")
+	var list LinkList
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	assert.Len(t, list.Links, 1)
+
+	// links of other users aren't found.
+	w = apiV2Request(r, http.MethodGet, "/links/1", "", "user13")
+	assertProblem(t, w, http.StatusNotFound, CodeNotFound)
+
+	// update changes only options in body.
+	w = apiV2Request(r, http.MethodPatch, "/links/1", `{"redirect_code":308,"expires_at":"2120-01-01T00:00:00Z"}`, "user12")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &link))
+	assert.Equal(t, 308, link.RedirectCode)
+	assert.Equal(t, "News", link.Title)
+	assert.True(t, time.Date(2120, 1, 1, 0, 0, 0, 0, time.UTC).Equal(*link.ExpiresAt))
+
+	w = apiV2Request(r, http.MethodPatch, "/links/1", `{"expires_at":null,"title":""}`, "user12")
+	assert.Equal(t, http.StatusOK, w.Code)
+	link = LinkResource{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &link))
+	assert.Nil(t, link.ExpiresAt)
+	assert.Empty(t, link.Title)
+	assert.Equal(t, 308, link.RedirectCode)
+
+	stored, err := s.GetLink(context.Background(), "1")
+	assert.NoError(t, err)
+	assert.Equal(t, 308, stored.Options.RedirectCode)
+
+	w = apiV2Request(r, http.MethodPatch, "/links/1", `{"query_mode":"replace"}`, "user12")
+	assertProblem(t, w, http.StatusBadRequest, CodeInvalidOptions)
+
+	w = apiV2Request(r, http.MethodPatch, "/links/1", `{"redirect_code":301}`, "user13")
+	assertProblem(t, w, http.StatusNotFound, CodeNotFound)
+
+	// stats and user.
+	w = apiV2Request(r, http.MethodGet, "/links/1/stats", "", "user12")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"clicks":0`)
+
+	w = apiV2Request(r, http.MethodGet, "/users/me", "", "user12")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"id":"user12","links":1}`, w.Body.String())
+
+	// delete.
+	w = apiV2Request(r, http.MethodDelete, "/links/1", "", "user13")
+	assertProblem(t, w, http.StatusNotFound, CodeNotFound)
+
+	w = apiV2Request(r, http.MethodDelete, "/links/1", "", "user12")
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	w = apiV2Request(r, http.MethodGet, "/links/1", "", "user12")
+	assertProblem(t, w, http.StatusGone, CodeLinkDeleted)
+
+	w = apiV2Request(r, http.MethodGet, "/links", "", "user12")
+	assert.JSONEq(t, `{"links":[]}`, w.Body.String())
+
+	// unknown routes and methods.
+	w = apiV2Request(r, http.MethodGet, "/unknown", "", "user12")
+	assertProblem(t, w, http.StatusNotFound, CodeNotFound)
+
+	w = apiV2Request(r, http.MethodPut, "/links/1", "", "user12")
+	assertProblem(t, w, http.StatusMethodNotAllowed, CodeMethodNotAllowed)
+}
+
+func TestAPIv2_Stats(t *testing.T) {
+	cfg := config.GetTestConfig()
+	cfg.TrustedSubnet = "127.0.0.0/24"
+	// requests of httptest come from trusted proxy 192.0.2.1.
+	cfg.TrustedProxies = "192.0.2.0/24"
+	s, err := storage.NewMapStorage(cfg)
+	assert.NoError(t, err)
+	r := apiV2Router(NewService(cfg, s))
+
+	w := apiV2Request(r, http.MethodGet, "/stats", "", "user12")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"urls":0,"users":0}`, w.Body.String())
+
+	request := httptest.NewRequest(http.MethodGet, APIv2Prefix+"/stats", nil)
+	request.Header.Set("X-Real-IP", "10.0.0.1")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, request)
+	assertProblem(t, w, http.StatusForbidden, CodeForbidden)
+}
@@ -0,0 +1,771 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/size12/url-shortener/internal/logger"
+	"github.com/size12/url-shortener/internal/policy"
+	"github.com/size12/url-shortener/internal/storage"
+	"go.uber.org/zap"
+)
+
+// Headers of webhook requests. Signature is HMAC-SHA256 of timestamp, dot and body, see SignWebhook.
+const (
+	WebhookEventHeader     = "X-Webhook-Event"
+	WebhookDeliveryHeader  = "X-Webhook-Delivery"
+	WebhookTimestampHeader = "X-Webhook-Timestamp"
+	WebhookSignatureHeader = "X-Webhook-Signature"
+)
+
+const (
+	// maxWebhooks is how many webhooks user can have.
+	maxWebhooks = 10
+	// webhookEventsQueue is how many events wait for dispatcher. Events are dropped, if queue is full.
+	webhookEventsQueue = 1024
+	// webhookPollInterval is how often dispatcher checks deliveries, which should be retried.
+	webhookPollInterval = time.Second
+	// webhookBatch is how many deliveries dispatcher takes at once, webhookSenders of them are sent at the same time.
+	webhookBatch   = 100
+	webhookSenders = 4
+	// maxWebhookRetryDelay is max delay between attempts of delivery.
+	maxWebhookRetryDelay = 6 * time.Hour
+	// clickSubscriptionTTL is how long it's cached, if user has webhooks of clicks.
+	// Webhooks, which are created or deleted by other instances, are seen after it.
+	clickSubscriptionTTL = time.Minute
+	// maxClickSubscriptions is how many users are cached, expired users are removed, when cache is full.
+	maxClickSubscriptions = 100000
+	// defaultDeliveriesLimit and maxDeliveriesLimit are how many deliveries are listed by default and at most.
+	defaultDeliveriesLimit = 50
+	maxDeliveriesLimit     = 500
+)
+
+// Errors of webhooks.
+var (
+	ErrInvalidWebhookEvents  = errors.New("events must be link.created, link.clicked or link.deleted")
+	ErrInvalidWebhookSecret  = errors.New("secret must be 16 to 255 characters")
+	ErrTooManyWebhooks       = fmt.Errorf("user can have at most %d webhooks", maxWebhooks)
+	ErrInvalidDeliveryStatus = errors.New("status must be pending, delivered or dead")
+	ErrInvalidDeliveryLimit  = fmt.Errorf("limit must be from 1 to %d", maxDeliveriesLimit)
+	ErrWebhookDeleted        = errors.New("webhook is deleted")
+	ErrInvalidWebhookID      = errors.New("wrong webhook ID")
+	ErrInvalidDeliveryID     = errors.New("wrong delivery ID")
+)
+
+// webhookEvents are events, which webhooks can subscribe to.
+var webhookEvents = map[string]bool{
+	storage.EventLinkCreated: true,
+	storage.EventLinkClicked: true,
+	storage.EventLinkDeleted: true,
+}
+
+// WebhookRequest is request to create webhook. Secret is generated, if it's empty.
+type WebhookRequest struct {
+	URL    string   `json:"url"`
+	Secret string   `json:"secret,omitempty"`
+	Events []string `json:"events"`
+}
+
+// WebhookResource is webhook in responses. Secret is shown only when webhook is created.
+type WebhookResource struct {
+	ID        int64     `json:"id"`
+	URL       string    `json:"url"`
+	Events    []string  `json:"events"`
+	Secret    string    `json:"secret,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// DeliveryResource is delivery of event to webhook in responses. NextAttempt is set for pending deliveries.
+type DeliveryResource struct {
+	ID           int64           `json:"id"`
+	WebhookID    int64           `json:"webhook_id"`
+	Event        string          `json:"event"`
+	Status       string          `json:"status"`
+	Attempts     int             `json:"attempts"`
+	ResponseCode int             `json:"response_code,omitempty"`
+	LastError    string          `json:"last_error,omitempty"`
+	NextAttempt  *time.Time      `json:"next_attempt,omitempty"`
+	CreatedAt    time.Time       `json:"created_at"`
+	UpdatedAt    time.Time       `json:"updated_at"`
+	Payload      json.RawMessage `json:"payload"`
+}
+
+// WebhookEvent is payload of webhook request. ID is the same for every delivery and replay of event.
+type WebhookEvent struct {
+	ID        string       `json:"id"`
+	Type      string       `json:"type"`
+	CreatedAt time.Time    `json:"created_at"`
+	Data      LinkResource `json:"data"`
+}
+
+// linkEvent is event of link, which is waiting for dispatcher.
+// UserID is user, who caused event, or owner of link for clicks.
+// Created event with since is sent, only if link is created since then, because batch doesn't tell, which links are new.
+type linkEvent struct {
+	Type   string
+	UserID string
+	LinkID string
+	At     time.Time
+	Since  time.Time
+}
+
+// clickSubscriptions caches, which users have webhooks of clicks.
+// Redirects are frequent, so clicks are queued only for users with such webhooks.
+type clickSubscriptions struct {
+	users map[string]clickSubscription
+	*sync.Mutex
+}
+
+// clickSubscription is if user has webhooks of clicks at checkedAt.
+type clickSubscription struct {
+	subscribed bool
+	checkedAt  time.Time
+}
+
+// newClickSubscriptions creates empty cache of click subscriptions.
+func newClickSubscriptions() *clickSubscriptions {
+	return &clickSubscriptions{users: make(map[string]clickSubscription), Mutex: &sync.Mutex{}}
+}
+
+// get gets if user has webhooks of clicks. It returns false ok, if user isn't cached or cache is expired.
+func (c *clickSubscriptions) get(userID string, now time.Time) (subscribed, ok bool) {
+	c.Lock()
+	defer c.Unlock()
+
+	sub, ok := c.users[userID]
+	if !ok || now.Sub(sub.checkedAt) >= clickSubscriptionTTL {
+		return false, false
+	}
+	return sub.subscribed, true
+}
+
+// set caches if user has webhooks of clicks.
+func (c *clickSubscriptions) set(userID string, subscribed bool, now time.Time) {
+	c.Lock()
+	defer c.Unlock()
+
+	if len(c.users) >= maxClickSubscriptions {
+		for id, sub := range c.users {
+			if now.Sub(sub.checkedAt) >= clickSubscriptionTTL {
+				delete(c.users, id)
+			}
+		}
+		if len(c.users) >= maxClickSubscriptions {
+			return
+		}
+	}
+	c.users[userID] = clickSubscription{subscribed: subscribed, checkedAt: now}
+}
+
+// forget removes user from cache, so its webhooks are checked again.
+func (c *clickSubscriptions) forget(userID string) {
+	c.Lock()
+	defer c.Unlock()
+
+	delete(c.users, userID)
+}
+
+// SignWebhook gets signature of webhook payload, which is sent at timestamp. Receivers check X-Webhook-Signature with it.
+func SignWebhook(secret string, timestamp int64, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10) + "."))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// newWebhookClient creates client of webhook requests. Redirects aren't followed, so webhook can't lead to other host.
+// Unless private addresses are allowed, connections to them are rejected after host of webhook is resolved.
+// Proxy from environment isn't used, because check would see address of proxy.
+func newWebhookClient(timeout time.Duration, allowPrivate bool) *http.Client {
+	dialer := &net.Dialer{Timeout: timeout}
+	if !allowPrivate {
+		dialer.Control = policy.DialControl
+	}
+
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: &http.Transport{DialContext: dialer.DialContext, TLSHandshakeTimeout: timeout},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// webhookResource gets webhook in response format.
+func webhookResource(hook storage.Webhook) WebhookResource {
+	return WebhookResource{ID: hook.ID, URL: hook.URL, Events: hook.Events, CreatedAt: hook.CreatedAt}
+}
+
+// deliveryResource gets delivery in response format.
+func deliveryResource(d storage.Delivery) DeliveryResource {
+	resource := DeliveryResource{
+		ID:           d.ID,
+		WebhookID:    d.WebhookID,
+		Event:        d.Event,
+		Status:       d.Status,
+		Attempts:     d.Attempts,
+		ResponseCode: d.ResponseCode,
+		LastError:    d.LastError,
+		CreatedAt:    d.CreatedAt,
+		UpdatedAt:    d.UpdatedAt,
+		Payload:      d.Payload,
+	}
+	if d.Status == storage.DeliveryPending {
+		next := d.NextAttempt
+		resource.NextAttempt = &next
+	}
+	return resource
+}
+
+// CreateWebhook adds webhook of user. Url of webhook is checked by the same policy as long urls.
+func (service *Service) CreateWebhook(ctx context.Context, userID string, req WebhookRequest) (storage.Webhook, error) {
+	if err := service.policy.Check(req.URL); err != nil {
+		return storage.Webhook{}, err
+	}
+
+	if len(req.Events) == 0 {
+		return storage.Webhook{}, ErrInvalidWebhookEvents
+	}
+
+	events := make([]string, 0, len(req.Events))
+	seen := make(map[string]bool)
+	for _, event := range req.Events {
+		if !webhookEvents[event] {
+			return storage.Webhook{}, ErrInvalidWebhookEvents
+		}
+		if !seen[event] {
+			seen[event] = true
+			events = append(events, event)
+		}
+	}
+
+	secret := req.Secret
+	if secret == "" {
+		random, err := generateRandom(24)
+		if err != nil {
+			return storage.Webhook{}, err
+		}
+		secret = hex.EncodeToString(random)
+	}
+	if len(secret) < 16 || len(secret) > 255 {
+		return storage.Webhook{}, ErrInvalidWebhookSecret
+	}
+
+	hooks, err := service.webhooks.GetWebhooks(ctx, userID)
+	if err != nil {
+		return storage.Webhook{}, err
+	}
+	if len(hooks) >= maxWebhooks {
+		return storage.Webhook{}, ErrTooManyWebhooks
+	}
+
+	hook, err := service.webhooks.AddWebhook(ctx, storage.Webhook{
+		UserID:    userID,
+		URL:       req.URL,
+		Secret:    secret,
+		Events:    events,
+		CreatedAt: time.Now().UTC(),
+	})
+	service.clickSubscriptions.forget(userID)
+	return hook, err
+}
+
+// GetDeliveries gets the newest deliveries of user with status. Empty status gets deliveries of any status.
+func (service *Service) GetDeliveries(ctx context.Context, userID, status string, limit int) ([]storage.Delivery, error) {
+	switch status {
+	case "", storage.DeliveryPending, storage.DeliveryDelivered, storage.DeliveryDead:
+	default:
+		return nil, ErrInvalidDeliveryStatus
+	}
+
+	if limit < 1 || limit > maxDeliveriesLimit {
+		return nil, ErrInvalidDeliveryLimit
+	}
+
+	return service.webhooks.GetDeliveries(ctx, userID, status, limit)
+}
+
+// ReplayDelivery sends payload of user's delivery again as new delivery. Delivery of deleted webhook can't be replayed.
+func (service *Service) ReplayDelivery(ctx context.Context, userID string, id int64) (storage.Delivery, error) {
+	d, err := service.webhooks.GetDelivery(ctx, id)
+	if err != nil {
+		return storage.Delivery{}, err
+	}
+
+	if d.UserID != userID {
+		return storage.Delivery{}, storage.Err404
+	}
+
+	if _, err := service.webhooks.GetWebhook(ctx, d.WebhookID); err != nil {
+		if errors.Is(err, storage.Err404) {
+			return storage.Delivery{}, &Error{Code: CodeNotFound, Message: ErrWebhookDeleted.Error(), Err: err}
+		}
+		return storage.Delivery{}, err
+	}
+
+	now := time.Now().UTC()
+	replay, err := service.webhooks.AddDelivery(ctx, storage.Delivery{
+		WebhookID:   d.WebhookID,
+		UserID:      d.UserID,
+		Event:       d.Event,
+		Payload:     d.Payload,
+		Status:      storage.DeliveryPending,
+		NextAttempt: now,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	})
+	if err != nil {
+		return storage.Delivery{}, err
+	}
+
+	service.wakeWebhooks()
+	return replay, nil
+}
+
+// emitLinkEvent queues event of link for webhooks. It doesn't block, so event is dropped, if queue is full.
+func (service *Service) emitLinkEvent(event linkEvent) {
+	if event.At.IsZero() {
+		event.At = time.Now().UTC()
+	}
+
+	select {
+	case service.webhookEvents <- event:
+	default:
+		logger.Log.Warn("Webhook events queue is full, event is dropped",
+			zap.String("event", event.Type), zap.String("id", event.LinkID))
+	}
+}
+
+// emitClickEvent queues click of link for webhooks, only if owner of link has webhooks of clicks.
+func (service *Service) emitClickEvent(ctx context.Context, userID, id string) {
+	if service.hasClickWebhooks(ctx, userID) {
+		service.emitLinkEvent(linkEvent{Type: storage.EventLinkClicked, UserID: userID, LinkID: id})
+	}
+}
+
+// hasClickWebhooks checks if user has webhooks of clicks. Result is cached for clickSubscriptionTTL.
+// If webhooks can't be got, click is queued, so dispatcher checks them again.
+func (service *Service) hasClickWebhooks(ctx context.Context, userID string) bool {
+	now := time.Now()
+	if subscribed, ok := service.clickSubscriptions.get(userID, now); ok {
+		return subscribed
+	}
+
+	hooks, err := service.webhooks.GetWebhooks(ctx, userID)
+	if err != nil {
+		logger.FromContext(ctx).Error("Failed get webhooks of clicks", zap.Error(err))
+		return true
+	}
+
+	subscribed := false
+	for _, hook := range hooks {
+		if hook.HasEvent(storage.EventLinkClicked) {
+			subscribed = true
+			break
+		}
+	}
+	service.clickSubscriptions.set(userID, subscribed, now)
+	return subscribed
+}
+
+// CheckWebhookBacklog checks if queue of webhook events is shorter than MaxQueueBacklog. It's readiness check.
+func (service *Service) CheckWebhookBacklog(ctx context.Context) error {
+	if n := len(service.webhookEvents); service.cfg.MaxQueueBacklog > 0 && n > service.cfg.MaxQueueBacklog {
+		return fmt.Errorf("%d webhook events are queued, max backlog is %d", n, service.cfg.MaxQueueBacklog)
+	}
+	return nil
+}
+
+// wakeWebhooks wakes dispatcher, so new deliveries are sent without waiting for poll.
+func (service *Service) wakeWebhooks() {
+	select {
+	case service.webhookWake <- struct{}{}:
+	default:
+	}
+}
+
+// RunWebhooks dispatches events of links to webhooks until ctx is done:
+// it creates deliveries of events and sends them, failed deliveries are retried with exponential backoff.
+// Deliveries are stored, so pending ones are sent after restart.
+func (service *Service) RunWebhooks(ctx context.Context) {
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		service.addDeliveries(ctx)
+	}()
+
+	ticker := time.NewTicker(webhookPollInterval)
+	defer ticker.Stop()
+
+	for {
+		service.sendDueDeliveries(ctx)
+
+		select {
+		case <-ctx.Done():
+			wg.Wait()
+			return
+		case <-ticker.C:
+		case <-service.webhookWake:
+		}
+	}
+}
+
+// addDeliveries creates deliveries of queued events until ctx is done. Events, which are queued then, are added too.
+func (service *Service) addDeliveries(ctx context.Context) {
+	for {
+		select {
+		case event := <-service.webhookEvents:
+			service.addEventDeliveries(event)
+		case <-ctx.Done():
+			for {
+				select {
+				case event := <-service.webhookEvents:
+					service.addEventDeliveries(event)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// addEventDeliveries creates deliveries of event to webhooks of user, which are subscribed to it.
+func (service *Service) addEventDeliveries(event linkEvent) {
+	ctx := context.Background()
+	log := logger.Log.With(zap.String("event", event.Type), zap.String("id", event.LinkID))
+
+	hooks, err := service.webhooks.GetWebhooks(ctx, event.UserID)
+	if err != nil {
+		log.Error("Failed get webhooks", zap.Error(err))
+		return
+	}
+
+	subscribed := make([]storage.Webhook, 0, len(hooks))
+	for _, hook := range hooks {
+		if hook.HasEvent(event.Type) {
+			subscribed = append(subscribed, hook)
+		}
+	}
+	if len(subscribed) == 0 {
+		return
+	}
+
+	link, err := service.storage.GetLink(ctx, event.LinkID)
+	if err != nil && !errors.Is(err, storage.Err410) {
+		log.Error("Failed get link of event", zap.Error(err))
+		return
+	}
+	link.ID = event.LinkID
+
+	switch event.Type {
+	case storage.EventLinkCreated:
+		if link.UserID != event.UserID || (!event.Since.IsZero() && link.CreatedAt.Before(event.Since)) {
+			return
+		}
+	case storage.EventLinkDeleted:
+		// links of other users aren't deleted.
+		if link.UserID != event.UserID || !link.Deleted {
+			return
+		}
+	}
+
+	random, err := generateRandom(12)
+	if err != nil {
+		log.Error("Failed generate event ID", zap.Error(err))
+		return
+	}
+
+	payload, err := json.Marshal(WebhookEvent{
+		ID:        "evt_" + hex.EncodeToString(random),
+		Type:      event.Type,
+		CreatedAt: event.At,
+		Data:      service.linkResource(link),
+	})
+	if err != nil {
+		log.Error("Failed marshal event", zap.Error(err))
+		return
+	}
+
+	now := time.Now().UTC()
+	for _, hook := range subscribed {
+		_, err := service.webhooks.AddDelivery(ctx, storage.Delivery{
+			WebhookID:   hook.ID,
+			UserID:      hook.UserID,
+			Event:       event.Type,
+			Payload:     payload,
+			Status:      storage.DeliveryPending,
+			NextAttempt: now,
+			CreatedAt:   now,
+			UpdatedAt:   now,
+		})
+		if err != nil {
+			log.Error("Failed add delivery", zap.Int64("webhook", hook.ID), zap.Error(err))
+		}
+	}
+
+	service.wakeWebhooks()
+}
+
+// sendDueDeliveries sends deliveries, which should be sent now, until there are no such deliveries or ctx is done.
+func (service *Service) sendDueDeliveries(ctx context.Context) {
+	for ctx.Err() == nil {
+		deliveries, err := service.webhooks.GetDueDeliveries(context.Background(), time.Now().UTC(), webhookBatch)
+		if err != nil {
+			logger.Log.Error("Failed get due deliveries", zap.Error(err))
+			return
+		}
+
+		senders := make(chan struct{}, webhookSenders)
+		var wg sync.WaitGroup
+		for _, d := range deliveries {
+			wg.Add(1)
+			senders <- struct{}{}
+			go func(d storage.Delivery) {
+				defer func() {
+					<-senders
+					wg.Done()
+				}()
+				service.sendDelivery(d)
+			}(d)
+		}
+		wg.Wait()
+
+		if len(deliveries) < webhookBatch {
+			return
+		}
+	}
+}
+
+// retryDelay gets delay after failed attempt of delivery: retry delay of config, which doubles after every attempt.
+func (service *Service) retryDelay(attempts int) time.Duration {
+	delay := service.cfg.WebhookRetryDelay.Duration
+	for i := 1; i < attempts && delay < maxWebhookRetryDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxWebhookRetryDelay {
+		delay = maxWebhookRetryDelay
+	}
+	return delay
+}
+
+// sendDelivery makes attempt of delivery and saves its result.
+// Delivery is dead, when it fails the last attempt or its webhook is deleted.
+func (service *Service) sendDelivery(d storage.Delivery) {
+	ctx := context.Background()
+	log := logger.Log.With(zap.Int64("delivery", d.ID), zap.Int64("webhook", d.WebhookID))
+
+	d.Attempts++
+	d.ResponseCode = 0
+
+	hook, err := service.webhooks.GetWebhook(ctx, d.WebhookID)
+	switch {
+	case errors.Is(err, storage.Err404):
+		err = ErrWebhookDeleted
+		d.Attempts = service.maxWebhookAttempts()
+	case err == nil:
+		d.ResponseCode, err = service.postWebhook(ctx, hook, d)
+	}
+
+	now := time.Now().UTC()
+	d.UpdatedAt = now
+	switch {
+	case err == nil:
+		d.Status, d.LastError = storage.DeliveryDelivered, ""
+	case d.Attempts >= service.maxWebhookAttempts():
+		d.Status, d.LastError = storage.DeliveryDead, err.Error()
+	default:
+		d.Status, d.LastError = storage.DeliveryPending, err.Error()
+		d.NextAttempt = now.Add(service.retryDelay(d.Attempts))
+	}
+
+	if err != nil {
+		log.Info("Failed deliver webhook", zap.Int("attempts", d.Attempts), zap.Error(err))
+	}
+
+	if err := service.webhooks.UpdateDelivery(ctx, d); err != nil {
+		log.Error("Failed save delivery", zap.Error(err))
+	}
+}
+
+// maxWebhookAttempts gets how many times delivery is attempted.
+func (service *Service) maxWebhookAttempts() int {
+	if service.cfg.WebhookMaxAttempts < 1 {
+		return 1
+	}
+	return service.cfg.WebhookMaxAttempts
+}
+
+// postWebhook sends signed payload of delivery to webhook. Any status except 2xx is error.
+func (service *Service) postWebhook(ctx context.Context, hook storage.Webhook, d storage.Delivery) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.URL, bytes.NewReader(d.Payload))
+	if err != nil {
+		return 0, err
+	}
+
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "url-shortener-webhooks")
+	req.Header.Set(WebhookEventHeader, d.Event)
+	req.Header.Set(WebhookDeliveryHeader, strconv.FormatInt(d.ID, 10))
+	req.Header.Set(WebhookTimestampHeader, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(WebhookSignatureHeader, SignWebhook(hook.Secret, timestamp, d.Payload))
+
+	resp, err := service.webhookClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("webhook responded with status %d", resp.StatusCode)
+	}
+
+	return resp.StatusCode, nil
+}
+
+// WebhooksHandler gets webhooks of user.
+func WebhooksHandler(service *Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := requestUser(r)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		hooks, err := service.webhooks.GetWebhooks(r.Context(), userID)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		resources := make([]WebhookResource, len(hooks))
+		for i, hook := range hooks {
+			resources[i] = webhookResource(hook)
+		}
+
+		writeJSON(w, r, http.StatusOK, resources)
+	}
+}
+
+// CreateWebhookHandler creates webhook of user. Response has secret of webhook, it isn't shown later.
+func CreateWebhookHandler(service *Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := requestUser(r)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		var req WebhookRequest
+		if !decodeJSON(w, r, &req) {
+			return
+		}
+
+		hook, err := service.CreateWebhook(r.Context(), userID, req)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		resource := webhookResource(hook)
+		resource.Secret = hook.Secret
+		writeJSON(w, r, http.StatusCreated, resource)
+	}
+}
+
+// DeleteWebhookHandler deletes webhook of user. Its pending deliveries aren't sent.
+func DeleteWebhookHandler(service *Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := requestUser(r)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		id, err := pathID(r, ErrInvalidWebhookID)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		if err := service.webhooks.DeleteWebhook(r.Context(), userID, id); err != nil {
+			writeError(w, r, err)
+			return
+		}
+		service.clickSubscriptions.forget(userID)
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// DeliveriesHandler gets the newest deliveries of user. Query status=dead gets dead-letter list.
+func DeliveriesHandler(service *Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := requestUser(r)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		limit := defaultDeliveriesLimit
+		if raw := r.URL.Query().Get("limit"); raw != "" {
+			limit, err = strconv.Atoi(raw)
+			if err != nil {
+				writeError(w, r, ErrInvalidDeliveryLimit)
+				return
+			}
+		}
+
+		deliveries, err := service.GetDeliveries(r.Context(), userID, r.URL.Query().Get("status"), limit)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		resources := make([]DeliveryResource, len(deliveries))
+		for i, d := range deliveries {
+			resources[i] = deliveryResource(d)
+		}
+
+		writeJSON(w, r, http.StatusOK, resources)
+	}
+}
+
+// ReplayDeliveryHandler sends user's delivery again. Response is new delivery, which is sent in background.
+func ReplayDeliveryHandler(service *Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := requestUser(r)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		id, err := pathID(r, ErrInvalidDeliveryID)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		replay, err := service.ReplayDelivery(r.Context(), userID, id)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		writeJSON(w, r, http.StatusAccepted, deliveryResource(replay))
+	}
+}
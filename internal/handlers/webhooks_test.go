@@ -0,0 +1,371 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/size12/url-shortener/internal/config"
+	"github.com/size12/url-shortener/internal/policy"
+	"github.com/size12/url-shortener/internal/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+// webhookReceiver is local receiver of webhooks, which checks their signatures.
+type webhookReceiver struct {
+	*httptest.Server
+	secret string
+
+	mu      sync.Mutex
+	status  int
+	events  []WebhookEvent
+	invalid int
+}
+
+// newWebhookReceiver starts receiver of webhooks signed by secret.
+func newWebhookReceiver(secret string) *webhookReceiver {
+	receiver := &webhookReceiver{secret: secret, status: http.StatusOK}
+	receiver.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		timestamp, _ := strconv.ParseInt(r.Header.Get(WebhookTimestampHeader), 10, 64)
+
+		var event WebhookEvent
+		err := json.Unmarshal(body, &event)
+
+		receiver.mu.Lock()
+		defer receiver.mu.Unlock()
+		if err != nil || r.Header.Get(WebhookSignatureHeader) != SignWebhook(receiver.secret, timestamp, body) ||
+			r.Header.Get(WebhookEventHeader) != event.Type {
+			receiver.invalid++
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if receiver.status == http.StatusOK {
+			receiver.events = append(receiver.events, event)
+		}
+		w.WriteHeader(receiver.status)
+	}))
+	return receiver
+}
+
+// setStatus sets status of receiver's responses.
+func (receiver *webhookReceiver) setStatus(status int) {
+	receiver.mu.Lock()
+	defer receiver.mu.Unlock()
+	receiver.status = status
+}
+
+// getEvents gets events, which are received successfully.
+func (receiver *webhookReceiver) getEvents() []WebhookEvent {
+	receiver.mu.Lock()
+	defer receiver.mu.Unlock()
+	return append([]WebhookEvent(nil), receiver.events...)
+}
+
+// webhooksRouter gets router with webhooks routes and routes, which cause events of links.
+func webhooksRouter(service *Service) *chi.Mux {
+	r := chi.NewRouter()
+	r.Post("/", URLPostHandler(service))
+	r.Get("/{id}", URLGetHandler(service))
+	r.Delete("/api/user/urls", DeleteHandler(service))
+	r.Get("/api/user/webhooks", WebhooksHandler(service))
+	r.Post("/api/user/webhooks", CreateWebhookHandler(service))
+	r.Delete("/api/user/webhooks/{id}", DeleteWebhookHandler(service))
+	r.Get("/api/user/webhooks/deliveries", DeliveriesHandler(service))
+	r.Post("/api/user/webhooks/deliveries/{id}/replay", ReplayDeliveryHandler(service))
+	return r
+}
+
+// runWebhooks runs webhooks dispatcher until test is finished.
+func runWebhooks(t *testing.T, service *Service) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		service.RunWebhooks(ctx)
+	}()
+
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+}
+
+// getDeliveries gets deliveries of user from handler.
+func getDeliveries(t *testing.T, r http.Handler, query, userID string) []DeliveryResource {
+	w := jobsRequest(r, http.MethodGet, "/api/user/webhooks/deliveries"+query, "", "", userID)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var deliveries []DeliveryResource
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &deliveries))
+	return deliveries
+}
+
+func TestWebhooks(t *testing.T) {
+	secret := "0123456789abcdef"
+	receiver := newWebhookReceiver(secret)
+	defer receiver.Close()
+
+	cfg := config.GetTestConfig()
+	cfg.AllowPrivateDestinations = true
+	cfg.WebhookTimeout = config.Duration{Duration: time.Second}
+	cfg.WebhookRetryDelay = config.Duration{Duration: 10 * time.Millisecond}
+	cfg.WebhookMaxAttempts = 2
+	s, err := storage.NewMapStorage(cfg)
+	assert.NoError(t, err)
+	service := NewService(cfg, s)
+	r := webhooksRouter(service)
+	runWebhooks(t, service)
+
+	body := `{"url":"` + receiver.URL + `","secret":"` + secret + `","events":["link.created","link.clicked","link.deleted"]}`
+	w := jobsRequest(r, http.MethodPost, "/api/user/webhooks", "application/json", body, "user12")
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var hook WebhookResource
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &hook))
+	assert.Equal(t, int64(1), hook.ID)
+	assert.Equal(t, secret, hook.Secret)
+
+	// secret isn't shown in list.
+	w = jobsRequest(r, http.MethodGet, "/api/user/webhooks", "", "", "user12")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var hooks []WebhookResource
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &hooks))
+	hook.Secret = ""
+	assert.Equal(t, []WebhookResource{hook}, hooks)
+
+	// link is created, clicked and deleted.
+	w = jobsRequest(r, http.MethodPost, "/", "text/plain", "https://yandex.ru", "user12")
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Eventually(t, func() bool { return len(receiver.getEvents()) == 1 }, 5*time.Second, 10*time.Millisecond)
+
+	w = jobsRequest(r, http.MethodGet, "/1", "", "", "user13")
+	assert.Equal(t, http.StatusTemporaryRedirect, w.Code)
+	assert.Eventually(t, func() bool { return len(receiver.getEvents()) == 2 }, 5*time.Second, 10*time.Millisecond)
+
+	w = jobsRequest(r, http.MethodDelete, "/api/user/urls", "application/json", `["1"]`, "user12")
+	assert.Equal(t, http.StatusAccepted, w.Code)
+	assert.Eventually(t, func() bool { return len(receiver.getEvents()) == 3 }, 5*time.Second, 10*time.Millisecond)
+
+	events := receiver.getEvents()
+	for i, event := range []string{storage.EventLinkCreated, storage.EventLinkClicked, storage.EventLinkDeleted} {
+		assert.Equal(t, event, events[i].Type)
+		assert.Equal(t, "1", events[i].Data.ID)
+		assert.Equal(t, "https://yandex.ru", events[i].Data.LongURL)
+		assert.Equal(t, "http://127.0.0.1:8081/1", events[i].Data.ShortURL)
+	}
+
+	// other user's links don't cause events.
+	w = jobsRequest(r, http.MethodPost, "/", "text/plain", "https://google.com", "user13")
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	// failed delivery is retried, then it's dead.
+	receiver.setStatus(http.StatusInternalServerError)
+	w = jobsRequest(r, http.MethodPost, "/", "text/plain", "https://dzen.ru", "user12")
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	var dead []DeliveryResource
+	assert.Eventually(t, func() bool {
+		dead = getDeliveries(t, r, "?status=dead", "user12")
+		return len(dead) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, storage.EventLinkCreated, dead[0].Event)
+	assert.Equal(t, 2, dead[0].Attempts)
+	assert.Equal(t, http.StatusInternalServerError, dead[0].ResponseCode)
+	assert.Equal(t, "webhook responded with status 500", dead[0].LastError)
+	assert.Nil(t, dead[0].NextAttempt)
+
+	deliveries := getDeliveries(t, r, "", "user12")
+	assert.Len(t, deliveries, 4)
+	assert.Equal(t, storage.DeliveryDelivered, deliveries[1].Status)
+	assert.Len(t, getDeliveries(t, r, "?limit=2", "user12"), 2)
+	assert.Empty(t, getDeliveries(t, r, "", "user13"))
+
+	// dead delivery is replayed with the same event.
+	receiver.setStatus(http.StatusOK)
+	replayPath := "/api/user/webhooks/deliveries/" + strconv.FormatInt(dead[0].ID, 10) + "/replay"
+	w = jobsRequest(r, http.MethodPost, replayPath, "", "", "user13")
+	assertProblem(t, w, http.StatusNotFound, CodeNotFound)
+
+	w = jobsRequest(r, http.MethodPost, replayPath, "", "", "user12")
+	assert.Equal(t, http.StatusAccepted, w.Code)
+	var replay DeliveryResource
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &replay))
+	assert.Equal(t, storage.DeliveryPending, replay.Status)
+	assert.JSONEq(t, string(dead[0].Payload), string(replay.Payload))
+
+	assert.Eventually(t, func() bool { return len(receiver.getEvents()) == 4 }, 5*time.Second, 10*time.Millisecond)
+	var deadEvent WebhookEvent
+	assert.NoError(t, json.Unmarshal(dead[0].Payload, &deadEvent))
+	assert.Equal(t, deadEvent.ID, receiver.getEvents()[3].ID)
+	assert.Equal(t, "3", receiver.getEvents()[3].Data.ID)
+
+	// deliveries of deleted webhook can't be replayed.
+	w = jobsRequest(r, http.MethodDelete, "/api/user/webhooks/1", "", "", "user13")
+	assertProblem(t, w, http.StatusNotFound, CodeNotFound)
+	w = jobsRequest(r, http.MethodDelete, "/api/user/webhooks/1", "", "", "user12")
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	w = jobsRequest(r, http.MethodPost, replayPath, "", "", "user12")
+	assertProblem(t, w, http.StatusNotFound, CodeNotFound)
+
+	receiver.mu.Lock()
+	receiver.mu.Unlock()
+}
+
+func TestWebhooks_DeletedWebhook(t *testing.T) {
+	cfg := config.GetTestConfig()
+	cfg.WebhookMaxAttempts = 5
+	s, err := storage.NewMapStorage(cfg)
+	assert.NoError(t, err)
+	webhooks := storage.NewMapWebhooks()
+	service := NewService(cfg, s, WithWebhooks(webhooks))
+	ctx := context.Background()
+
+	// pending delivery of deleted webhook is dead without attempts.
+	now := time.Now().UTC()
+	d, err := webhooks.AddDelivery(ctx, storage.Delivery{WebhookID: 1, UserID: "user12", Event: storage.EventLinkCreated,
+		Payload: json.RawMessage(`{}`), Status: storage.DeliveryPending, NextAttempt: now, CreatedAt: now, UpdatedAt: now})
+	assert.NoError(t, err)
+
+	service.sendDueDeliveries(ctx)
+
+	d, err = webhooks.GetDelivery(ctx, d.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, storage.DeliveryDead, d.Status)
+	assert.Equal(t, ErrWebhookDeleted.Error(), d.LastError)
+}
+
+func TestWebhooks_ClickSubscriptions(t *testing.T) {
+	cfg := config.GetTestConfig()
+	cfg.AllowPrivateDestinations = true
+	s, err := storage.NewMapStorage(cfg)
+	assert.NoError(t, err)
+	service := NewService(cfg, s)
+	r := webhooksRouter(service)
+
+	w := jobsRequest(r, http.MethodPost, "/", "text/plain", "https://yandex.ru", "user12")
+	assert.Equal(t, http.StatusCreated, w.Code)
+	<-service.webhookEvents
+
+	// clicks of user without webhooks of clicks aren't queued.
+	w = jobsRequest(r, http.MethodPost, "/api/user/webhooks", "application/json",
+		`{"url":"http://127.0.0.1:8080/hook","events":["link.created"]}`, "user12")
+	assert.Equal(t, http.StatusCreated, w.Code)
+	w = jobsRequest(r, http.MethodGet, "/1", "", "", "user13")
+	assert.Equal(t, http.StatusTemporaryRedirect, w.Code)
+	assert.Len(t, service.webhookEvents, 0)
+
+	// cached subscription is forgotten, when webhook is created.
+	w = jobsRequest(r, http.MethodPost, "/api/user/webhooks", "application/json",
+		`{"url":"http://127.0.0.1:8080/hook","events":["link.clicked"]}`, "user12")
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var hook WebhookResource
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &hook))
+	w = jobsRequest(r, http.MethodGet, "/1", "", "", "user13")
+	assert.Equal(t, http.StatusTemporaryRedirect, w.Code)
+	assert.Len(t, service.webhookEvents, 1)
+	event := <-service.webhookEvents
+	assert.Equal(t, linkEvent{Type: storage.EventLinkClicked, UserID: "user12", LinkID: "1", At: event.At}, event)
+
+	// and when it's deleted.
+	w = jobsRequest(r, http.MethodDelete, "/api/user/webhooks/"+strconv.FormatInt(hook.ID, 10), "", "", "user12")
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	w = jobsRequest(r, http.MethodGet, "/1", "", "", "user13")
+	assert.Equal(t, http.StatusTemporaryRedirect, w.Code)
+	assert.Len(t, service.webhookEvents, 0)
+}
+
+func TestWebhooks_PrivateAddress(t *testing.T) {
+	receiver := newWebhookReceiver("0123456789abcdef")
+	defer receiver.Close()
+	_, port, err := net.SplitHostPort(receiver.Listener.Addr().String())
+	assert.NoError(t, err)
+
+	cfg := config.GetTestConfig()
+	s, err := storage.NewMapStorage(cfg)
+	assert.NoError(t, err)
+	webhooks := storage.NewMapWebhooks()
+	service := NewService(cfg, s, WithWebhooks(webhooks))
+	ctx := context.Background()
+
+	// policy doesn't resolve hosts, so name of loopback address is rejected, when webhook is sent.
+	for _, host := range []string{"localhost", "127.0.0.1"} {
+		hook, err := webhooks.AddWebhook(ctx, storage.Webhook{UserID: "user12", URL: "http://" + net.JoinHostPort(host, port) + "/hook",
+			Secret: "0123456789abcdef", Events: []string{storage.EventLinkCreated}})
+		assert.NoError(t, err)
+
+		_, err = service.postWebhook(ctx, hook, storage.Delivery{ID: 1, Event: storage.EventLinkCreated,
+			Payload: json.RawMessage(`{"type":"link.created"}`)})
+		assert.ErrorIs(t, err, policy.ErrPrivateAddress, host)
+	}
+	assert.Empty(t, receiver.getEvents())
+}
+
+func TestService_RetryDelay(t *testing.T) {
+	cfg := config.GetTestConfig()
+	cfg.WebhookRetryDelay = config.Duration{Duration: 30 * time.Second}
+	service := NewService(cfg, nil)
+
+	assert.Equal(t, 30*time.Second, service.retryDelay(1))
+	assert.Equal(t, time.Minute, service.retryDelay(2))
+	assert.Equal(t, 4*time.Minute, service.retryDelay(4))
+	assert.Equal(t, maxWebhookRetryDelay, service.retryDelay(100))
+}
+
+func TestWebhooks_Validation(t *testing.T) {
+	cfg := config.GetTestConfig()
+	cfg.AllowPrivateDestinations = true
+	s, err := storage.NewMapStorage(cfg)
+	assert.NoError(t, err)
+	r := webhooksRouter(NewService(cfg, s))
+
+	tests := []struct {
+		name string
+		body string
+		code ErrorCode
+	}{
+		{"no events", `{"url":"https://crm.example.com/hook","events":[]}`, CodeInvalidRequest},
+		{"unknown event", `{"url":"https://crm.example.com/hook","events":["link.updated"]}`, CodeInvalidRequest},
+		{"short secret", `{"url":"https://crm.example.com/hook","secret":"secret","events":["link.created"]}`, CodeInvalidRequest},
+		{"invalid url", `{"url":"crm","events":["link.created"]}`, CodeInvalidURL},
+		{"unknown field", `{"url":"https://crm.example.com/hook","events":["link.created"],"active":true}`, CodeInvalidBody},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := jobsRequest(r, http.MethodPost, "/api/user/webhooks", "application/json", tt.body, "user12")
+			assertProblem(t, w, http.StatusBadRequest, tt.code)
+		})
+	}
+
+	// secret is generated, events are deduplicated.
+	for i := 0; i < maxWebhooks; i++ {
+		w := jobsRequest(r, http.MethodPost, "/api/user/webhooks", "application/json",
+			`{"url":"https://crm.example.com/hook","events":["link.created","link.created"]}`, "user12")
+		assert.Equal(t, http.StatusCreated, w.Code)
+		var hook WebhookResource
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &hook))
+		assert.Len(t, hook.Secret, 48)
+		assert.Equal(t, []string{storage.EventLinkCreated}, hook.Events)
+	}
+
+	w := jobsRequest(r, http.MethodPost, "/api/user/webhooks", "application/json",
+		`{"url":"https://crm.example.com/hook","events":["link.created"]}`, "user12")
+	assertProblem(t, w, http.StatusBadRequest, CodeInvalidRequest)
+
+	w = jobsRequest(r, http.MethodGet, "/api/user/webhooks/deliveries?status=failed", "", "", "user12")
+	assertProblem(t, w, http.StatusBadRequest, CodeInvalidRequest)
+	w = jobsRequest(r, http.MethodGet, "/api/user/webhooks/deliveries?limit=0", "", "", "user12")
+	assertProblem(t, w, http.StatusBadRequest, CodeInvalidRequest)
+	w = jobsRequest(r, http.MethodGet, "/api/user/webhooks/deliveries?limit=abc", "", "", "user12")
+	assertProblem(t, w, http.StatusBadRequest, CodeInvalidRequest)
+	w = jobsRequest(r, http.MethodPost, "/api/user/webhooks/deliveries/abc/replay", "", "", "user12")
+	assertProblem(t, w, http.StatusNotFound, CodeNotFound)
+}
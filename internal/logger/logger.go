@@ -0,0 +1,46 @@
+// Package logger creates structured JSON logger and passes request-scoped logger through context.
+package logger
+
+import (
+	"context"
+
+	"go.uber.org/zap"
+)
+
+// ctxKey is key of logger in context.
+type ctxKey struct{}
+
+// Log is base logger of service. It does nothing until Initialize is called.
+var Log = zap.NewNop()
+
+// Initialize creates base JSON logger with given level.
+func Initialize(level string) error {
+	lvl, err := zap.ParseAtomicLevel(level)
+	if err != nil {
+		return err
+	}
+
+	cfg := zap.NewProductionConfig()
+	cfg.Level = lvl
+
+	l, err := cfg.Build()
+	if err != nil {
+		return err
+	}
+
+	Log = l
+	return nil
+}
+
+// WithContext stores logger in context.
+func WithContext(ctx context.Context, l *zap.Logger) context.Context {
+	return context.WithValue(ctx, ctxKey{}, l)
+}
+
+// FromContext gets request-scoped logger from context or base logger, if there is no one.
+func FromContext(ctx context.Context) *zap.Logger {
+	if l, ok := ctx.Value(ctxKey{}).(*zap.Logger); ok {
+		return l
+	}
+	return Log
+}
@@ -0,0 +1,29 @@
+package logger
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestInitialize(t *testing.T) {
+	base := Log
+	defer func() { Log = base }()
+
+	assert.Error(t, Initialize("loud"))
+	assert.Equal(t, base, Log)
+
+	assert.NoError(t, Initialize("debug"))
+	assert.NotEqual(t, base, Log)
+}
+
+func TestFromContext(t *testing.T) {
+	// base logger without logger in context.
+	assert.Equal(t, Log, FromContext(context.Background()))
+
+	l := zap.NewExample()
+	ctx := WithContext(context.Background(), l)
+	assert.Equal(t, l, FromContext(ctx))
+}
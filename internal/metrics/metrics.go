@@ -0,0 +1,167 @@
+// Package metrics collects service metrics in Prometheus format.
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/size12/url-shortener/internal/storage"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// namespace is prefix of all metrics.
+const namespace = "shortener"
+
+// Metrics contains all collectors of service.
+type Metrics struct {
+	registry *prometheus.Registry
+
+	httpRequests *prometheus.CounterVec
+	httpDuration *prometheus.HistogramVec
+
+	grpcRequests *prometheus.CounterVec
+	grpcDuration *prometheus.HistogramVec
+
+	storageOperations *prometheus.CounterVec
+	storageDuration   *prometheus.HistogramVec
+}
+
+// New creates metrics with own registry.
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+
+		httpRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "Total number of HTTP requests.",
+		}, []string{"method", "route", "status"}),
+		httpDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "Latency of HTTP requests.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "route"}),
+
+		grpcRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "grpc_requests_total",
+			Help:      "Total number of gRPC requests.",
+		}, []string{"method", "code"}),
+		grpcDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "grpc_request_duration_seconds",
+			Help:      "Latency of gRPC requests.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method"}),
+
+		storageOperations: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "storage_operations_total",
+			Help:      "Total number of storage operations.",
+		}, []string{"backend", "operation", "outcome"}),
+		storageDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "storage_operation_duration_seconds",
+			Help:      "Latency of storage operations.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"backend", "operation", "outcome"}),
+	}
+
+	m.registry.MustRegister(
+		m.httpRequests, m.httpDuration,
+		m.grpcRequests, m.grpcDuration,
+		m.storageOperations, m.storageDuration,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+
+	return m
+}
+
+// Handler returns handler, which exposes metrics in Prometheus text format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// Middleware counts HTTP requests and their latency by chi route.
+func (m *Metrics) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+
+		next.ServeHTTP(ww, r)
+
+		route := "unmatched"
+		if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+			route = rctx.RoutePattern()
+		}
+
+		code := ww.Status()
+		if code == 0 {
+			code = http.StatusOK
+		}
+
+		m.httpRequests.WithLabelValues(r.Method, route, strconv.Itoa(code)).Inc()
+		m.httpDuration.WithLabelValues(r.Method, route).Observe(time.Since(start).Seconds())
+	})
+}
+
+// UnaryInterceptor counts gRPC requests and their latency by method.
+func (m *Metrics) UnaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	start := time.Now()
+
+	resp, err := handler(ctx, req)
+
+	m.grpcRequests.WithLabelValues(info.FullMethod, status.Code(err).String()).Inc()
+	m.grpcDuration.WithLabelValues(info.FullMethod).Observe(time.Since(start).Seconds())
+
+	return resp, err
+}
+
+// RegisterStatistic adds gauges of total links and users, which are read from storage on every scrape.
+func (m *Metrics) RegisterStatistic(s storage.Storage) {
+	m.registry.MustRegister(newStatisticCollector(s))
+}
+
+// statisticCollector collects total links and users from storage.
+type statisticCollector struct {
+	storage storage.Storage
+	links   *prometheus.Desc
+	users   *prometheus.Desc
+}
+
+// newStatisticCollector creates new statistic collector.
+func newStatisticCollector(s storage.Storage) *statisticCollector {
+	return &statisticCollector{
+		storage: s,
+		links:   prometheus.NewDesc(namespace+"_links", "Total number of shortened links.", nil, nil),
+		users:   prometheus.NewDesc(namespace+"_users", "Total number of users.", nil, nil),
+	}
+}
+
+// Describe sends descriptors of gauges.
+func (c *statisticCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.links
+	ch <- c.users
+}
+
+// Collect gets statistic from storage.
+func (c *statisticCollector) Collect(ch chan<- prometheus.Metric) {
+	stat, err := c.storage.GetStatistic(context.Background())
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(c.links, err)
+		return
+	}
+
+	ch <- prometheus.MustNewConstMetric(c.links, prometheus.GaugeValue, float64(stat.Urls))
+	ch <- prometheus.MustNewConstMetric(c.users, prometheus.GaugeValue, float64(stat.Users))
+}
@@ -0,0 +1,114 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/size12/url-shortener/internal/config"
+	"github.com/size12/url-shortener/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestMetrics_Middleware(t *testing.T) {
+	m := New()
+
+	r := chi.NewRouter()
+	r.Use(m.Middleware)
+	r.Get("/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTemporaryRedirect)
+	})
+	r.Get("/ping", func(w http.ResponseWriter, r *http.Request) {})
+
+	for _, path := range []string{"/1", "/2", "/ping", "/api/unknown"} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	assert.Equal(t, 2.0, testutil.ToFloat64(m.httpRequests.WithLabelValues("GET", "/{id}", "307")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.httpRequests.WithLabelValues("GET", "/ping", "200")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.httpRequests.WithLabelValues("GET", "unmatched", "404")))
+}
+
+func TestMetrics_UnaryInterceptor(t *testing.T) {
+	m := New()
+	info := &grpc.UnaryServerInfo{FullMethod: "/url_shortener.Shortener/GetLong"}
+
+	_, err := m.UnaryInterceptor(context.Background(), nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, status.Error(codes.NotFound, "not found")
+	})
+	assert.Error(t, err)
+
+	_, err = m.UnaryInterceptor(context.Background(), nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, nil
+	})
+	assert.NoError(t, err)
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.grpcRequests.WithLabelValues(info.FullMethod, "NotFound")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.grpcRequests.WithLabelValues(info.FullMethod, "OK")))
+}
+
+func TestStorage(t *testing.T) {
+	m := New()
+	cfg := config.GetTestConfig()
+	ms, err := storage.NewMapStorage(cfg)
+	assert.NoError(t, err)
+
+	s := m.WrapStorage(ms)
+	assert.Equal(t, "map", s.backend)
+
+	_, err = s.CreateShort(context.Background(), "user12", "https://yandex.ru")
+	assert.NoError(t, err)
+	_, err = s.CreateShort(context.Background(), "user12", "https://yandex.ru")
+	assert.ErrorIs(t, err, storage.Err409)
+
+	_, err = s.GetLong(context.Background(), "1")
+	assert.NoError(t, err)
+	_, err = s.GetLong(context.Background(), "2")
+	assert.ErrorIs(t, err, storage.Err404)
+
+	assert.NoError(t, s.Delete(context.Background(), "user12", "1"))
+	_, err = s.GetLong(context.Background(), "1")
+	assert.ErrorIs(t, err, storage.Err410)
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.storageOperations.WithLabelValues("map", "create_short", "ok")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.storageOperations.WithLabelValues("map", "create_short", "409")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.storageOperations.WithLabelValues("map", "get_long", "ok")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.storageOperations.WithLabelValues("map", "get_long", "404")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.storageOperations.WithLabelValues("map", "get_long", "410")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.storageOperations.WithLabelValues("map", "delete", "ok")))
+
+	assert.Equal(t, "error", outcome(errors.New("connection refused")))
+}
+
+func TestMetrics_Handler(t *testing.T) {
+	m := New()
+	cfg := config.GetTestConfig()
+	s, err := storage.NewMapStorage(cfg)
+	assert.NoError(t, err)
+
+	_, err = s.CreateShort(context.Background(), "user12", "https://yandex.ru", "https://google.com")
+	assert.NoError(t, err)
+
+	m.RegisterStatistic(s)
+
+	w := httptest.NewRecorder()
+	m.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	res := w.Result()
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	assert.NoError(t, err)
+
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Contains(t, string(body), "shortener_links 2")
+	assert.Contains(t, string(body), "shortener_users 1")
+}
@@ -0,0 +1,140 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/size12/url-shortener/internal/config"
+	"github.com/size12/url-shortener/internal/storage"
+)
+
+// Storage is storage.Storage decorator, which times every call by backend and outcome.
+type Storage struct {
+	storage.Storage
+	backend string
+	metrics *Metrics
+}
+
+// WrapStorage wraps storage, so every call is measured.
+func (m *Metrics) WrapStorage(s storage.Storage) *Storage {
+	return &Storage{
+		Storage: s,
+		backend: backendName(s),
+		metrics: m,
+	}
+}
+
+// backendName gets name of storage backend.
+func backendName(s storage.Storage) string {
+	switch s.(type) {
+	case *storage.DBStorage:
+		return "db"
+	case *storage.FileStorage:
+		return "file"
+	case *storage.MapStorage:
+		return "map"
+	default:
+		return "unknown"
+	}
+}
+
+// outcome converts storage error to metric label.
+func outcome(err error) string {
+	switch {
+	case err == nil:
+		return "ok"
+	case errors.Is(err, storage.Err404):
+		return "404"
+	case errors.Is(err, storage.Err409):
+		return "409"
+	case errors.Is(err, storage.Err410):
+		return "410"
+	default:
+		return "error"
+	}
+}
+
+// observe saves result of storage operation.
+func (s *Storage) observe(operation string, start time.Time, err error) {
+	result := outcome(err)
+	s.metrics.storageOperations.WithLabelValues(s.backend, operation, result).Inc()
+	s.metrics.storageDuration.WithLabelValues(s.backend, operation, result).Observe(time.Since(start).Seconds())
+}
+
+// CreateShort creates short url from long.
+func (s *Storage) CreateShort(ctx context.Context, userID string, urls ...string) ([]string, error) {
+	start := time.Now()
+	result, err := s.Storage.CreateShort(ctx, userID, urls...)
+	s.observe("create_short", start, err)
+	return result, err
+}
+
+// GetLong gets long url from short.
+func (s *Storage) GetLong(ctx context.Context, id string) (string, error) {
+	start := time.Now()
+	long, err := s.Storage.GetLong(ctx, id)
+	s.observe("get_long", start, err)
+	return long, err
+}
+
+// Delete deletes urls.
+func (s *Storage) Delete(ctx context.Context, userID string, ids ...string) error {
+	start := time.Now()
+	err := s.Storage.Delete(ctx, userID, ids...)
+	s.observe("delete", start, err)
+	return err
+}
+
+// GetHistory gets history of links.
+func (s *Storage) GetHistory(ctx context.Context, userID string) ([]storage.LinkJSON, error) {
+	start := time.Now()
+	history, err := s.Storage.GetHistory(ctx, userID)
+	s.observe("get_history", start, err)
+	return history, err
+}
+
+// Ping checks connection to storage.
+func (s *Storage) Ping(ctx context.Context) error {
+	start := time.Now()
+	err := s.Storage.Ping(ctx)
+	s.observe("ping", start, err)
+	return err
+}
+
+// GetConfig gets config from storage.
+func (s *Storage) GetConfig() config.Config {
+	return s.Storage.GetConfig()
+}
+
+// GetStatistic gets total count of users and urls.
+func (s *Storage) GetStatistic(ctx context.Context) (storage.Statistic, error) {
+	start := time.Now()
+	stat, err := s.Storage.GetStatistic(ctx)
+	s.observe("get_statistic", start, err)
+	return stat, err
+}
+
+// GetLink gets link with its metadata.
+func (s *Storage) GetLink(ctx context.Context, id string) (storage.Link, error) {
+	start := time.Now()
+	link, err := s.Storage.GetLink(ctx, id)
+	s.observe("get_link", start, err)
+	return link, err
+}
+
+// SetLinkOptions sets options of link.
+func (s *Storage) SetLinkOptions(ctx context.Context, id string, opts storage.LinkOptions) error {
+	start := time.Now()
+	err := s.Storage.SetLinkOptions(ctx, id, opts)
+	s.observe("set_link_options", start, err)
+	return err
+}
+
+// SetOriginalURL sets url of link as it was sent by owner.
+func (s *Storage) SetOriginalURL(ctx context.Context, id, original string) error {
+	start := time.Now()
+	err := s.Storage.SetOriginalURL(ctx, id, original)
+	s.observe("set_original_url", start, err)
+	return err
+}
@@ -0,0 +1,156 @@
+package policy
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/size12/url-shortener/internal/logger"
+	"github.com/size12/url-shortener/internal/urlnorm"
+	"go.uber.org/zap"
+)
+
+// checkInterval is how often domains file is checked for changes.
+const checkInterval = 5 * time.Second
+
+// DomainList is allow and deny lists of domains, which are loaded from file and reloaded, when file is modified.
+//
+// Every line of file is "allow <domain>" or "deny <domain>", lines starting with "#" are comments.
+// Domain matches itself and its subdomains. Denied domains are always blocked,
+// and if there are allowed domains, urls must lead to one of them.
+type DomainList struct {
+	*sync.Mutex
+	file     string
+	allow    []string
+	deny     []string
+	modTime  time.Time
+	checked  time.Time
+	interval time.Duration
+	now      func() time.Time
+}
+
+// NewDomainList loads domains list from file.
+func NewDomainList(file string) (*DomainList, error) {
+	l := &DomainList{
+		Mutex:    &sync.Mutex{},
+		file:     file,
+		interval: checkInterval,
+		now:      time.Now,
+	}
+
+	info, err := os.Stat(file)
+	if err != nil {
+		return nil, err
+	}
+
+	err = l.load(info.ModTime())
+	if err != nil {
+		return nil, err
+	}
+
+	return l, nil
+}
+
+// load loads domains from file.
+func (l *DomainList) load(modTime time.Time) error {
+	file, err := os.Open(l.file)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var allow, deny []string
+
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		fields := strings.Fields(text)
+		if len(fields) != 2 {
+			return fmt.Errorf("line %d: want \"allow <domain>\" or \"deny <domain>\"", line)
+		}
+
+		domain, err := urlnorm.NormalizeHost(strings.Trim(fields[1], "."))
+		if err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+
+		switch fields[0] {
+		case "allow":
+			allow = append(allow, domain)
+		case "deny":
+			deny = append(deny, domain)
+		default:
+			return fmt.Errorf("line %d: unknown action %q", line, fields[0])
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	l.allow, l.deny = allow, deny
+	l.modTime = modTime
+	l.checked = l.now()
+	return nil
+}
+
+// reload reloads domains, if file was modified. If new file is invalid, old domains are kept.
+func (l *DomainList) reload() {
+	if l.now().Sub(l.checked) < l.interval {
+		return
+	}
+	l.checked = l.now()
+
+	info, err := os.Stat(l.file)
+	if err != nil {
+		logger.Log.Error("Failed check domains file", zap.Error(err))
+		return
+	}
+
+	if info.ModTime().Equal(l.modTime) {
+		return
+	}
+
+	if err := l.load(info.ModTime()); err != nil {
+		logger.Log.Error("Failed reload domains file", zap.Error(err))
+		return
+	}
+
+	logger.Log.Info("Domains file reloaded", zap.String("file", l.file))
+}
+
+// Check checks if host is allowed by domains list.
+func (l *DomainList) Check(host string) error {
+	l.Lock()
+	defer l.Unlock()
+
+	l.reload()
+
+	if matchDomain(host, l.deny) {
+		return fmt.Errorf("%w: %s", ErrDomainBlocked, host)
+	}
+
+	if len(l.allow) != 0 && !matchDomain(host, l.allow) {
+		return fmt.Errorf("%w: %s isn't in allow list", ErrDomainBlocked, host)
+	}
+
+	return nil
+}
+
+// matchDomain checks if host is one of domains or their subdomain.
+func matchDomain(host string, domains []string) bool {
+	host = strings.TrimSuffix(host, ".")
+	for _, domain := range domains {
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,177 @@
+// Package policy checks destinations of new links: scheme, domain, private addresses and redirect loops.
+package policy
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"syscall"
+
+	"github.com/size12/url-shortener/internal/config"
+	"github.com/size12/url-shortener/internal/urlnorm"
+)
+
+// Errors of policy. ErrInvalidURL means url is malformed,
+// other errors wrap ErrForbiddenURL and mean url is valid, but can't be shortened.
+var (
+	ErrInvalidURL = errors.New("wrong link: url must be absolute and have host")
+
+	ErrForbiddenURL     = errors.New("url is forbidden by policy")
+	ErrSchemeNotAllowed = fmt.Errorf("%w: scheme isn't allowed", ErrForbiddenURL)
+	ErrDomainBlocked    = fmt.Errorf("%w: domain is blocked", ErrForbiddenURL)
+	ErrPrivateAddress   = fmt.Errorf("%w: private addresses are blocked", ErrForbiddenURL)
+	ErrRedirectLoop     = fmt.Errorf("%w: url leads to short link", ErrForbiddenURL)
+	ErrNumericHost      = fmt.Errorf("%w: IPv4 address must be in dotted decimal form", ErrForbiddenURL)
+)
+
+// defaultSchemes are allowed schemes, if config doesn't set them.
+var defaultSchemes = []string{"http", "https"}
+
+// defaultPorts are ports of schemes, which are used when url has no port.
+var defaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+	"ws":    "80",
+	"wss":   "443",
+	"ftp":   "21",
+}
+
+// webPorts are ports, which browsers use for http and https. Short links are served on both of them,
+// because http is redirected to https.
+var webPorts = map[string]bool{"80": true, "443": true}
+
+// sharedAddressSpace is carrier-grade NAT network, which isn't reachable from internet (RFC 6598).
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// Policy checks destinations of new links.
+type Policy struct {
+	schemes      map[string]bool
+	allowPrivate bool
+	baseHost     string
+	basePort     string
+	domains      *DomainList
+}
+
+// New creates policy from config. Domains list can be nil.
+func New(cfg config.Config, domains *DomainList) *Policy {
+	p := &Policy{
+		schemes:      make(map[string]bool),
+		allowPrivate: cfg.AllowPrivateDestinations,
+		domains:      domains,
+	}
+
+	schemes := defaultSchemes
+	if cfg.AllowedSchemes != "" {
+		schemes = strings.Split(cfg.AllowedSchemes, ",")
+	}
+	for _, scheme := range schemes {
+		if scheme = strings.ToLower(strings.TrimSpace(scheme)); scheme != "" {
+			p.schemes[scheme] = true
+		}
+	}
+
+	if base, err := urlnorm.Normalize(cfg.BaseURL, urlnorm.Rules{}); err == nil {
+		if u, err := url.Parse(base); err == nil {
+			p.baseHost, p.basePort = hostPort(u)
+		}
+	}
+
+	return p
+}
+
+// Check checks that link can lead to url.
+func (p *Policy) Check(raw string) error {
+	canonical, err := urlnorm.Normalize(raw, urlnorm.Rules{})
+	if err != nil {
+		return err
+	}
+
+	u, err := url.Parse(canonical)
+	if err != nil || u.Scheme == "" {
+		return ErrInvalidURL
+	}
+
+	if !p.schemes[u.Scheme] {
+		return fmt.Errorf("%w: %s", ErrSchemeNotAllowed, u.Scheme)
+	}
+
+	if u.Host == "" {
+		return ErrInvalidURL
+	}
+
+	host, port := hostPort(u)
+	if p.baseHost != "" && host == p.baseHost && (port == p.basePort || webPorts[port] && webPorts[p.basePort]) {
+		return ErrRedirectLoop
+	}
+
+	if isNumericHost(host) {
+		return fmt.Errorf("%w: %s", ErrNumericHost, host)
+	}
+
+	if !p.allowPrivate && isPrivate(host) {
+		return fmt.Errorf("%w: %s", ErrPrivateAddress, host)
+	}
+
+	if p.domains != nil {
+		return p.domains.Check(host)
+	}
+
+	return nil
+}
+
+// hostPort gets host of url without trailing dot and port, which is default port of scheme, if url has no port.
+func hostPort(u *url.URL) (string, string) {
+	port := u.Port()
+	if port == "" {
+		port = defaultPorts[u.Scheme]
+	}
+	return strings.TrimSuffix(u.Hostname(), "."), port
+}
+
+// isNumericHost checks if host is IPv4 address in form, which isn't dotted decimal, like 2130706433, 0x7f000001 or 0177.0.0.1.
+// Browsers and resolvers treat such hosts as IPv4 addresses, so they can hide private addresses.
+func isNumericHost(host string) bool {
+	if net.ParseIP(host) != nil {
+		return false
+	}
+
+	last := host[strings.LastIndex(host, ".")+1:]
+	if len(last) > 1 && (last[:2] == "0x" || last[:2] == "0X") {
+		return strings.Trim(last[2:], "0123456789abcdefABCDEF") == ""
+	}
+	return last != "" && strings.Trim(last, "0123456789") == ""
+}
+
+// isPrivate checks if host is local name or IP address, which isn't reachable from internet.
+// Host names aren't resolved, so names of private addresses must be blocked by domains list.
+func isPrivate(host string) bool {
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return true
+	}
+
+	ip := net.ParseIP(host)
+	return ip != nil && IsPrivateIP(ip)
+}
+
+// IsPrivateIP checks if IP address isn't reachable from internet:
+// loopback, private, link-local, carrier-grade NAT or unspecified address.
+func IsPrivateIP(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || sharedAddressSpace.Contains(ip) ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast()
+}
+
+// DialControl is Control of net.Dialer, which rejects connections to private addresses.
+// It's called after host is resolved, so it blocks names of private addresses, which Check can't see.
+func DialControl(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+
+	if ip := net.ParseIP(host); ip == nil || IsPrivateIP(ip) {
+		return fmt.Errorf("%w: %s", ErrPrivateAddress, host)
+	}
+	return nil
+}
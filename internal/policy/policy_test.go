@@ -0,0 +1,129 @@
+package policy
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/size12/url-shortener/internal/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPolicy_Check(t *testing.T) {
+	cfg := config.GetTestConfig()
+	cfg.BaseURL = "https://Short.ru:443"
+	p := New(cfg, nil)
+
+	tests := []struct {
+		url string
+		err error
+	}{
+		{url: "https://yandex.ru/page", err: nil},
+		{url: "http://8.8.8.8/", err: nil},
+		{url: "efjwejfekw", err: ErrInvalidURL},
+		{url: "https://", err: ErrInvalidURL},
+		{url: "javascript:alert(1)", err: ErrSchemeNotAllowed},
+		{url: "ftp://files.ru/file", err: ErrSchemeNotAllowed},
+		{url: "https://short.ru/1", err: ErrRedirectLoop},
+		{url: "HTTPS://SHORT.RU:443/1", err: ErrRedirectLoop},
+		{url: "http://short.ru/1", err: ErrRedirectLoop},
+		{url: "https://short.ru:8443/1", err: nil},
+		{url: "https://short.ru./1", err: ErrRedirectLoop},
+		{url: "https://SHORT.RU.:443/1", err: ErrRedirectLoop},
+		{url: "http://short.ru:80/1", err: ErrRedirectLoop},
+		{url: "http://short.ru:443/1", err: ErrRedirectLoop},
+		{url: "http://localhost:8080/", err: ErrPrivateAddress},
+		{url: "http://api.localhost/", err: ErrPrivateAddress},
+		{url: "http://127.0.0.1/", err: ErrPrivateAddress},
+		{url: "http://10.0.0.1/", err: ErrPrivateAddress},
+		{url: "http://192.168.1.1/", err: ErrPrivateAddress},
+		{url: "http://169.254.169.254/latest/meta-data", err: ErrPrivateAddress},
+		{url: "http://[::1]/", err: ErrPrivateAddress},
+		{url: "http://[fd00::1]/", err: ErrPrivateAddress},
+		{url: "http://localhost./", err: ErrPrivateAddress},
+		{url: "http://api.localhost./", err: ErrPrivateAddress},
+		{url: "http://127.0.0.1./", err: ErrPrivateAddress},
+		{url: "http://100.64.0.1/", err: ErrPrivateAddress},
+		{url: "http://100.127.255.254/", err: ErrPrivateAddress},
+		{url: "http://100.128.0.1/", err: nil},
+		{url: "http://2130706433/", err: ErrNumericHost},
+		{url: "http://0x7f000001/", err: ErrNumericHost},
+		{url: "http://0X7F.1/", err: ErrNumericHost},
+		{url: "http://0177.0.0.1/", err: ErrNumericHost},
+		{url: "http://127.1/", err: ErrNumericHost},
+		{url: "http://2130706433./", err: ErrNumericHost},
+		{url: "https://yandex.ru./page", err: nil},
+		{url: "https://1password.com/", err: nil},
+		{url: "https://0xabc.ru/", err: nil},
+	}
+
+	for _, tc := range tests {
+		err := p.Check(tc.url)
+		if tc.err == nil {
+			assert.NoError(t, err, tc.url)
+			continue
+		}
+		assert.ErrorIs(t, err, tc.err, tc.url)
+		if tc.err != ErrInvalidURL {
+			assert.ErrorIs(t, err, ErrForbiddenURL, tc.url)
+		}
+	}
+
+	// schemes and private addresses are configurable.
+	cfg.AllowedSchemes = "https, FTP"
+	cfg.AllowPrivateDestinations = true
+	p = New(cfg, nil)
+
+	assert.NoError(t, p.Check("ftp://files.ru/file"))
+	assert.NoError(t, p.Check("https://127.0.0.1/"))
+	assert.ErrorIs(t, p.Check("http://yandex.ru"), ErrSchemeNotAllowed)
+}
+
+func TestDialControl(t *testing.T) {
+	for _, address := range []string{"127.0.0.1:80", "[::1]:443", "10.1.2.3:80", "169.254.169.254:80", "100.64.0.1:80",
+		"0.0.0.0:80", "[::ffff:127.0.0.1]:80", "[fe80::1]:80"} {
+		assert.ErrorIs(t, DialControl("tcp", address, nil), ErrPrivateAddress, address)
+	}
+
+	assert.NoError(t, DialControl("tcp", "8.8.8.8:443", nil))
+	assert.NoError(t, DialControl("tcp6", "[2a00:1450:4010:c05::8a]:443", nil))
+}
+
+func TestDomainList(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "domains.txt")
+	assert.NoError(t, os.WriteFile(file, []byte("# blocked\ndeny evil.ru\ndeny Плохой.рф\n"), 0600))
+
+	l, err := NewDomainList(file)
+	assert.NoError(t, err)
+	l.interval = 0
+
+	p := New(config.GetTestConfig(), l)
+	assert.NoError(t, p.Check("https://yandex.ru"))
+	assert.ErrorIs(t, p.Check("https://evil.ru/page"), ErrDomainBlocked)
+	assert.ErrorIs(t, p.Check("https://www.EVIL.ru/page"), ErrDomainBlocked)
+	assert.ErrorIs(t, p.Check("https://evil.ru./page"), ErrDomainBlocked)
+	assert.ErrorIs(t, p.Check("https://плохой.рф"), ErrDomainBlocked)
+	assert.NoError(t, p.Check("https://notevil.ru"))
+
+	// allow list is reloaded.
+	modTime := time.Now().Add(time.Minute)
+	assert.NoError(t, os.WriteFile(file, []byte("allow yandex.ru\ndeny mail.yandex.ru\n"), 0600))
+	assert.NoError(t, os.Chtimes(file, modTime, modTime))
+
+	assert.NoError(t, p.Check("https://yandex.ru"))
+	assert.NoError(t, p.Check("https://music.yandex.ru"))
+	assert.ErrorIs(t, p.Check("https://mail.yandex.ru"), ErrDomainBlocked)
+	assert.ErrorIs(t, p.Check("https://google.com"), ErrDomainBlocked)
+
+	// invalid file doesn't replace loaded lists.
+	modTime = modTime.Add(time.Minute)
+	assert.NoError(t, os.WriteFile(file, []byte("block google.com\n"), 0600))
+	assert.NoError(t, os.Chtimes(file, modTime, modTime))
+
+	assert.NoError(t, p.Check("https://yandex.ru"))
+	assert.ErrorIs(t, p.Check("https://google.com"), ErrDomainBlocked)
+
+	_, err = NewDomainList(file)
+	assert.Error(t, err)
+}
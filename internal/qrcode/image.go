@@ -0,0 +1,72 @@
+package qrcode
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+)
+
+// modulesWithMargin gets number of modules on side of image with margin.
+func (c *Code) modulesWithMargin(margin int) int {
+	return c.Size + 2*margin
+}
+
+// Image renders code with margin of light modules. Module is scale pixels.
+func (c *Code) Image(scale, margin int) image.Image {
+	if scale < 1 {
+		scale = 1
+	}
+
+	side := c.modulesWithMargin(margin) * scale
+	img := image.NewPaletted(image.Rect(0, 0, side, side), color.Palette{color.White, color.Black})
+
+	for y := 0; y < c.Size; y++ {
+		for x := 0; x < c.Size; x++ {
+			if !c.Dark(x, y) {
+				continue
+			}
+
+			for dy := 0; dy < scale; dy++ {
+				row := ((y+margin)*scale + dy) * img.Stride
+				for dx := 0; dx < scale; dx++ {
+					img.Pix[row+(x+margin)*scale+dx] = 1
+				}
+			}
+		}
+	}
+
+	return img
+}
+
+// PNG renders code to PNG image, which side is at most size pixels, but at least one pixel per module.
+func (c *Code) PNG(size, margin int) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := png.Encoder{CompressionLevel: png.BestCompression}
+	if err := encoder.Encode(&buf, c.Image(size/c.modulesWithMargin(margin), margin)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// SVG renders code to SVG image with side of size pixels.
+func (c *Code) SVG(size, margin int) []byte {
+	side := c.modulesWithMargin(margin)
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `<svg xmlns="http://www.w3.org/2000/svg" version="1.1" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`,
+		size, size, side, side)
+	fmt.Fprintf(&buf, `<rect width="%d" height="%d" fill="#ffffff"/><path fill="#000000" d="`, side, side)
+
+	for y := 0; y < c.Size; y++ {
+		for x := 0; x < c.Size; x++ {
+			if c.Dark(x, y) {
+				fmt.Fprintf(&buf, "M%d,%dh1v1h-1z", x+margin, y+margin)
+			}
+		}
+	}
+
+	buf.WriteString(`"/></svg>`)
+	return buf.Bytes()
+}
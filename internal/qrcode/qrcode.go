@@ -0,0 +1,573 @@
+// Package qrcode encodes data to QR codes (ISO/IEC 18004) in byte mode and renders them to PNG and SVG.
+package qrcode
+
+import (
+	"errors"
+	"strings"
+)
+
+// Errors of encoder.
+var (
+	ErrDataTooLong  = errors.New("data is too long for QR code")
+	ErrInvalidLevel = errors.New("error correction level must be L, M, Q or H")
+)
+
+// Level is error correction level. Higher level restores more damaged code, but makes code bigger.
+type Level int
+
+// Error correction levels: codes can be restored with about 7%, 15%, 25% and 30% of damaged codewords.
+const (
+	Low Level = iota
+	Medium
+	Quartile
+	High
+)
+
+// formatBits are bits of error correction level in format information.
+var formatBits = [...]int{Low: 1, Medium: 0, Quartile: 3, High: 2}
+
+// eccCodewordsPerBlock is number of error correction codewords in every block by level and version.
+var eccCodewordsPerBlock = [4][41]int{
+	{-1, 7, 10, 15, 20, 26, 18, 20, 24, 30, 18, 20, 24, 26, 30, 22, 24, 28, 30, 28, 28, 28, 28, 30, 30, 26, 28, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+	{-1, 10, 16, 26, 18, 24, 16, 18, 22, 22, 26, 30, 22, 22, 24, 24, 28, 28, 26, 26, 26, 26, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28},
+	{-1, 13, 22, 18, 26, 18, 24, 18, 22, 20, 24, 28, 26, 24, 20, 30, 24, 28, 28, 26, 30, 28, 30, 30, 30, 30, 28, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+	{-1, 17, 28, 22, 16, 22, 28, 26, 26, 24, 28, 24, 28, 22, 24, 24, 30, 28, 28, 26, 28, 30, 24, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+}
+
+// eccBlocks is number of error correction blocks by level and version.
+var eccBlocks = [4][41]int{
+	{-1, 1, 1, 1, 1, 1, 2, 2, 2, 2, 4, 4, 4, 4, 4, 6, 6, 6, 6, 7, 8, 8, 9, 9, 10, 12, 12, 12, 13, 14, 15, 16, 17, 18, 19, 19, 20, 21, 22, 24, 25},
+	{-1, 1, 1, 1, 2, 2, 4, 4, 4, 5, 5, 5, 8, 9, 9, 10, 10, 11, 13, 14, 16, 17, 17, 18, 20, 21, 23, 25, 26, 28, 29, 31, 33, 35, 37, 38, 40, 43, 45, 47, 49},
+	{-1, 1, 1, 2, 2, 4, 4, 6, 6, 8, 8, 8, 10, 12, 16, 12, 17, 16, 18, 21, 20, 23, 23, 25, 27, 29, 34, 34, 35, 38, 40, 43, 45, 48, 51, 53, 56, 59, 62, 65, 68},
+	{-1, 1, 1, 2, 4, 4, 4, 5, 6, 8, 8, 11, 11, 16, 16, 18, 16, 19, 21, 25, 25, 25, 34, 30, 32, 35, 37, 40, 42, 45, 48, 51, 54, 57, 60, 63, 66, 70, 74, 77, 81},
+}
+
+// Versions of QR code: version v has 17+4v modules on side.
+const (
+	minVersion = 1
+	maxVersion = 40
+)
+
+// Penalty weights of mask evaluation.
+const (
+	penaltyRun     = 3
+	penaltyBlock   = 3
+	penaltyFinder  = 40
+	penaltyBalance = 10
+)
+
+// ParseLevel parses error correction level: L, M, Q or H.
+func ParseLevel(s string) (Level, error) {
+	switch strings.ToUpper(s) {
+	case "L":
+		return Low, nil
+	case "M":
+		return Medium, nil
+	case "Q":
+		return Quartile, nil
+	case "H":
+		return High, nil
+	default:
+		return 0, ErrInvalidLevel
+	}
+}
+
+// Code is QR code matrix. Module (x, y) is dark, if it's true.
+type Code struct {
+	Version int
+	Size    int
+	Level   Level
+	Mask    int
+
+	modules    [][]bool
+	isFunction [][]bool
+}
+
+// Dark checks if module in column x and row y is dark.
+func (c *Code) Dark(x, y int) bool {
+	return c.modules[y][x]
+}
+
+// Encode encodes data in byte mode with the smallest version, which fits data with error correction level.
+func Encode(data []byte, level Level) (*Code, error) {
+	if level < Low || level > High {
+		return nil, ErrInvalidLevel
+	}
+
+	version := minVersion
+	for ; version <= maxVersion; version++ {
+		if 4+countBits(version)+8*len(data) <= 8*numDataCodewords(version, level) {
+			break
+		}
+	}
+	if version > maxVersion {
+		return nil, ErrDataTooLong
+	}
+
+	codewords := encodeData(data, version, level)
+
+	c := &Code{Version: version, Size: 17 + 4*version, Level: level}
+	c.modules = newMatrix(c.Size)
+	c.isFunction = newMatrix(c.Size)
+
+	c.drawFunctionPatterns()
+	c.drawCodewords(addECCAndInterleave(codewords, version, level))
+
+	c.Mask = 0
+	minPenalty := -1
+	for mask := 0; mask < 8; mask++ {
+		c.applyMask(mask)
+		c.drawFormatBits(mask)
+		if penalty := c.penalty(); minPenalty < 0 || penalty < minPenalty {
+			c.Mask, minPenalty = mask, penalty
+		}
+		// mask is XOR, so applying it again removes it.
+		c.applyMask(mask)
+	}
+
+	c.applyMask(c.Mask)
+	c.drawFormatBits(c.Mask)
+	return c, nil
+}
+
+// newMatrix creates square matrix of size.
+func newMatrix(size int) [][]bool {
+	matrix := make([][]bool, size)
+	for i := range matrix {
+		matrix[i] = make([]bool, size)
+	}
+	return matrix
+}
+
+// countBits is length of character count in byte mode.
+func countBits(version int) int {
+	if version <= 9 {
+		return 8
+	}
+	return 16
+}
+
+// numRawDataModules is number of modules, which store data and error correction of version.
+func numRawDataModules(version int) int {
+	result := (16*version+128)*version + 64
+	if version >= 2 {
+		numAlign := version/7 + 2
+		result -= (25*numAlign-10)*numAlign - 55
+		if version >= 7 {
+			result -= 36
+		}
+	}
+	return result
+}
+
+// numDataCodewords is number of data codewords of version and level.
+func numDataCodewords(version int, level Level) int {
+	return numRawDataModules(version)/8 - eccCodewordsPerBlock[level][version]*eccBlocks[level][version]
+}
+
+// bitBuffer is sequence of bits.
+type bitBuffer []bool
+
+// append appends n lower bits of value from the highest one.
+func (b *bitBuffer) append(value, n int) {
+	for i := n - 1; i >= 0; i-- {
+		*b = append(*b, (value>>i)&1 == 1)
+	}
+}
+
+// encodeData encodes data to data codewords: mode, length, data, terminator and padding.
+func encodeData(data []byte, version int, level Level) []byte {
+	capacity := 8 * numDataCodewords(version, level)
+
+	var bits bitBuffer
+	bits.append(0x4, 4)
+	bits.append(len(data), countBits(version))
+	for _, b := range data {
+		bits.append(int(b), 8)
+	}
+
+	terminator := capacity - len(bits)
+	if terminator > 4 {
+		terminator = 4
+	}
+	bits.append(0, terminator)
+	bits.append(0, (8-len(bits)%8)%8)
+
+	for pad := 0xEC; len(bits) < capacity; pad ^= 0xEC ^ 0x11 {
+		bits.append(pad, 8)
+	}
+
+	codewords := make([]byte, len(bits)/8)
+	for i, bit := range bits {
+		if bit {
+			codewords[i>>3] |= 1 << (7 - i&7)
+		}
+	}
+	return codewords
+}
+
+// addECCAndInterleave splits data codewords to blocks, adds error correction codewords to every block and interleaves them.
+func addECCAndInterleave(data []byte, version int, level Level) []byte {
+	numBlocks := eccBlocks[level][version]
+	blockECCLen := eccCodewordsPerBlock[level][version]
+	rawCodewords := numRawDataModules(version) / 8
+	numShortBlocks := numBlocks - rawCodewords%numBlocks
+	shortBlockLen := rawCodewords / numBlocks
+
+	divisor := reedSolomonDivisor(blockECCLen)
+	blocks := make([][]byte, numBlocks)
+	for i, k := 0, 0; i < numBlocks; i++ {
+		dataLen := shortBlockLen - blockECCLen
+		if i >= numShortBlocks {
+			dataLen++
+		}
+
+		block := make([]byte, 0, shortBlockLen+1)
+		block = append(block, data[k:k+dataLen]...)
+		k += dataLen
+
+		ecc := reedSolomonRemainder(block, divisor)
+		if i < numShortBlocks {
+			// short blocks are aligned with long ones, padding is skipped on interleaving.
+			block = append(block, 0)
+		}
+		blocks[i] = append(block, ecc...)
+	}
+
+	result := make([]byte, 0, rawCodewords)
+	for i := 0; i <= shortBlockLen; i++ {
+		for j, block := range blocks {
+			if i != shortBlockLen-blockECCLen || j >= numShortBlocks {
+				result = append(result, block[i])
+			}
+		}
+	}
+	return result
+}
+
+// reedSolomonDivisor gets generator polynomial of degree from the highest coefficient without leading 1.
+func reedSolomonDivisor(degree int) []byte {
+	result := make([]byte, degree)
+	result[degree-1] = 1
+
+	root := byte(1)
+	for i := 0; i < degree; i++ {
+		for j := range result {
+			result[j] = gfMultiply(result[j], root)
+			if j+1 < len(result) {
+				result[j] ^= result[j+1]
+			}
+		}
+		root = gfMultiply(root, 0x02)
+	}
+	return result
+}
+
+// reedSolomonRemainder gets error correction codewords of data.
+func reedSolomonRemainder(data, divisor []byte) []byte {
+	result := make([]byte, len(divisor))
+	for _, b := range data {
+		factor := b ^ result[0]
+		copy(result, result[1:])
+		result[len(result)-1] = 0
+		for i, coefficient := range divisor {
+			result[i] ^= gfMultiply(coefficient, factor)
+		}
+	}
+	return result
+}
+
+// gfMultiply multiplies in GF(2^8) with polynomial 0x11D.
+func gfMultiply(x, y byte) byte {
+	z := 0
+	for i := 7; i >= 0; i-- {
+		z = (z << 1) ^ ((z >> 7) * 0x11D)
+		z ^= int((y>>i)&1) * int(x)
+	}
+	return byte(z)
+}
+
+// setFunction sets module of function pattern.
+func (c *Code) setFunction(x, y int, dark bool) {
+	c.modules[y][x] = dark
+	c.isFunction[y][x] = true
+}
+
+// alignmentPositions gets coordinates of alignment patterns centers.
+func alignmentPositions(version int) []int {
+	if version == 1 {
+		return nil
+	}
+
+	numAlign := version/7 + 2
+	step := (version*8 + numAlign*3 + 5) / (numAlign*4 - 4) * 2
+
+	positions := make([]int, numAlign)
+	positions[0] = 6
+	for i, pos := numAlign-1, 17+4*version-7; i >= 1; i, pos = i-1, pos-step {
+		positions[i] = pos
+	}
+	return positions
+}
+
+// drawFunctionPatterns draws finder, timing and alignment patterns and reserves format and version areas.
+func (c *Code) drawFunctionPatterns() {
+	for i := 0; i < c.Size; i++ {
+		c.setFunction(6, i, i%2 == 0)
+		c.setFunction(i, 6, i%2 == 0)
+	}
+
+	c.drawFinder(3, 3)
+	c.drawFinder(c.Size-4, 3)
+	c.drawFinder(3, c.Size-4)
+
+	positions := alignmentPositions(c.Version)
+	last := len(positions) - 1
+	for i, x := range positions {
+		for j, y := range positions {
+			// alignment patterns don't overlap finder patterns.
+			if (i == 0 && j == 0) || (i == 0 && j == last) || (i == last && j == 0) {
+				continue
+			}
+			c.drawAlignment(x, y)
+		}
+	}
+
+	// format bits are redrawn after mask is chosen.
+	c.drawFormatBits(0)
+	c.drawVersion()
+}
+
+// drawFinder draws finder pattern with separator around center.
+func (c *Code) drawFinder(x, y int) {
+	for dy := -4; dy <= 4; dy++ {
+		for dx := -4; dx <= 4; dx++ {
+			xx, yy := x+dx, y+dy
+			if xx < 0 || xx >= c.Size || yy < 0 || yy >= c.Size {
+				continue
+			}
+			dist := maxAbs(dx, dy)
+			c.setFunction(xx, yy, dist != 2 && dist != 4)
+		}
+	}
+}
+
+// drawAlignment draws alignment pattern around center.
+func (c *Code) drawAlignment(x, y int) {
+	for dy := -2; dy <= 2; dy++ {
+		for dx := -2; dx <= 2; dx++ {
+			c.setFunction(x+dx, y+dy, maxAbs(dx, dy) != 1)
+		}
+	}
+}
+
+// maxAbs gets max of absolute values.
+func maxAbs(a, b int) int {
+	if a < 0 {
+		a = -a
+	}
+	if b < 0 {
+		b = -b
+	}
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// formatInfo gets 15 bits of format information with BCH error correction.
+func formatInfo(level Level, mask int) int {
+	data := formatBits[level]<<3 | mask
+	rem := data
+	for i := 0; i < 10; i++ {
+		rem = (rem << 1) ^ ((rem >> 9) * 0x537)
+	}
+	return (data<<10 | rem) ^ 0x5412
+}
+
+// versionInfo gets 18 bits of version information with BCH error correction.
+func versionInfo(version int) int {
+	rem := version
+	for i := 0; i < 12; i++ {
+		rem = (rem << 1) ^ ((rem >> 11) * 0x1F25)
+	}
+	return version<<12 | rem
+}
+
+// drawFormatBits draws both copies of format information and dark module.
+func (c *Code) drawFormatBits(mask int) {
+	bits := formatInfo(c.Level, mask)
+	bit := func(i int) bool {
+		return (bits>>i)&1 == 1
+	}
+
+	for i := 0; i <= 5; i++ {
+		c.setFunction(8, i, bit(i))
+	}
+	c.setFunction(8, 7, bit(6))
+	c.setFunction(8, 8, bit(7))
+	c.setFunction(7, 8, bit(8))
+	for i := 9; i < 15; i++ {
+		c.setFunction(14-i, 8, bit(i))
+	}
+
+	for i := 0; i < 8; i++ {
+		c.setFunction(c.Size-1-i, 8, bit(i))
+	}
+	for i := 8; i < 15; i++ {
+		c.setFunction(8, c.Size-15+i, bit(i))
+	}
+	c.setFunction(8, c.Size-8, true)
+}
+
+// drawVersion draws both copies of version information. Versions below 7 have no version information.
+func (c *Code) drawVersion() {
+	if c.Version < 7 {
+		return
+	}
+
+	bits := versionInfo(c.Version)
+	for i := 0; i < 18; i++ {
+		dark := (bits>>i)&1 == 1
+		a, b := c.Size-11+i%3, i/3
+		c.setFunction(a, b, dark)
+		c.setFunction(b, a, dark)
+	}
+}
+
+// drawCodewords places codewords in zigzag order from bottom right corner, skipping function patterns.
+func (c *Code) drawCodewords(codewords []byte) {
+	i := 0
+	for right := c.Size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			// vertical timing pattern is skipped.
+			right = 5
+		}
+
+		for vert := 0; vert < c.Size; vert++ {
+			for j := 0; j < 2; j++ {
+				x := right - j
+				y := vert
+				if (right+1)&2 == 0 {
+					y = c.Size - 1 - vert
+				}
+
+				if !c.isFunction[y][x] && i < len(codewords)*8 {
+					c.modules[y][x] = (codewords[i>>3]>>(7-i&7))&1 == 1
+					i++
+				}
+			}
+		}
+	}
+}
+
+// masked checks if mask inverts module in column x and row y.
+func masked(mask, x, y int) bool {
+	switch mask {
+	case 0:
+		return (x+y)%2 == 0
+	case 1:
+		return y%2 == 0
+	case 2:
+		return x%3 == 0
+	case 3:
+		return (x+y)%3 == 0
+	case 4:
+		return (x/3+y/2)%2 == 0
+	case 5:
+		return x*y%2+x*y%3 == 0
+	case 6:
+		return (x*y%2+x*y%3)%2 == 0
+	default:
+		return ((x+y)%2+x*y%3)%2 == 0
+	}
+}
+
+// applyMask inverts data modules by mask.
+func (c *Code) applyMask(mask int) {
+	for y := 0; y < c.Size; y++ {
+		for x := 0; x < c.Size; x++ {
+			if !c.isFunction[y][x] && masked(mask, x, y) {
+				c.modules[y][x] = !c.modules[y][x]
+			}
+		}
+	}
+}
+
+// finderLike are patterns, which look like finder pattern with light area on one side.
+var finderLike = [2][11]bool{
+	{true, false, true, true, true, false, true, false, false, false, false},
+	{false, false, false, false, true, false, true, true, true, false, true},
+}
+
+// penalty evaluates how hard code is to scan: runs and blocks of the same color,
+// patterns similar to finder pattern and unbalanced dark and light modules.
+func (c *Code) penalty() int {
+	result := 0
+	dark := 0
+
+	for i := 0; i < c.Size; i++ {
+		result += c.linePenalty(func(j int) bool { return c.modules[i][j] })
+		result += c.linePenalty(func(j int) bool { return c.modules[j][i] })
+
+		for j := 0; j < c.Size; j++ {
+			if c.modules[i][j] {
+				dark++
+			}
+
+			if i+1 < c.Size && j+1 < c.Size {
+				color := c.modules[i][j]
+				if color == c.modules[i][j+1] && color == c.modules[i+1][j] && color == c.modules[i+1][j+1] {
+					result += penaltyBlock
+				}
+			}
+		}
+	}
+
+	total := c.Size * c.Size
+	k := (abs(dark*20-total*10)+total-1)/total - 1
+	result += k * penaltyBalance
+	return result
+}
+
+// linePenalty evaluates runs of the same color and finder-like patterns in row or column.
+func (c *Code) linePenalty(module func(j int) bool) int {
+	result := 0
+
+	run := 1
+	for j := 1; j <= c.Size; j++ {
+		if j < c.Size && module(j) == module(j-1) {
+			run++
+			continue
+		}
+		if run >= 5 {
+			result += penaltyRun + run - 5
+		}
+		run = 1
+	}
+
+	for j := 0; j+len(finderLike[0]) <= c.Size; j++ {
+		for _, pattern := range finderLike {
+			matched := true
+			for k, dark := range pattern {
+				if module(j+k) != dark {
+					matched = false
+					break
+				}
+			}
+			if matched {
+				result += penaltyFinder
+			}
+		}
+	}
+
+	return result
+}
+
+// abs gets absolute value.
+func abs(a int) int {
+	if a < 0 {
+		return -a
+	}
+	return a
+}
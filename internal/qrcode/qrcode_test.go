@@ -0,0 +1,236 @@
+package qrcode
+
+import (
+	"bytes"
+	"image/png"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// readCodewords reads codewords of code in placement order after removing mask.
+func readCodewords(c *Code) []byte {
+	c.applyMask(c.Mask)
+	defer c.applyMask(c.Mask)
+
+	var codewords []byte
+	i := 0
+	for right := c.Size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		for vert := 0; vert < c.Size; vert++ {
+			for j := 0; j < 2; j++ {
+				x, y := right-j, vert
+				if (right+1)&2 == 0 {
+					y = c.Size - 1 - vert
+				}
+				if c.isFunction[y][x] || i >= numRawDataModules(c.Version)/8*8 {
+					continue
+				}
+				if i%8 == 0 {
+					codewords = append(codewords, 0)
+				}
+				if c.modules[y][x] {
+					codewords[i>>3] |= 1 << (7 - i&7)
+				}
+				i++
+			}
+		}
+	}
+	return codewords
+}
+
+// decode decodes byte mode data from code and checks error correction codewords of every block.
+func decode(t *testing.T, c *Code) []byte {
+	codewords := readCodewords(c)
+
+	numBlocks := eccBlocks[c.Level][c.Version]
+	eccLen := eccCodewordsPerBlock[c.Level][c.Version]
+	numShortBlocks := numBlocks - len(codewords)%numBlocks
+	shortBlockLen := len(codewords) / numBlocks
+
+	blocks := make([][]byte, numBlocks)
+	k := 0
+	for i := 0; i <= shortBlockLen; i++ {
+		for j := range blocks {
+			if i == shortBlockLen-eccLen && j < numShortBlocks {
+				continue
+			}
+			blocks[j] = append(blocks[j], codewords[k])
+			k++
+		}
+	}
+
+	var data []byte
+	divisor := reedSolomonDivisor(eccLen)
+	for _, block := range blocks {
+		dataLen := len(block) - eccLen
+		assert.Equal(t, block[dataLen:], reedSolomonRemainder(block[:dataLen], divisor))
+		data = append(data, block[:dataLen]...)
+	}
+
+	var bits bitBuffer
+	for _, b := range data {
+		bits.append(int(b), 8)
+	}
+	read := func(n int) int {
+		value := 0
+		for _, bit := range bits[:n] {
+			value <<= 1
+			if bit {
+				value |= 1
+			}
+		}
+		bits = bits[n:]
+		return value
+	}
+
+	assert.Equal(t, 0x4, read(4))
+	result := make([]byte, read(countBits(c.Version)))
+	for i := range result {
+		result[i] = byte(read(8))
+	}
+	return result
+}
+
+func TestFormatAndVersionInfo(t *testing.T) {
+	assert.Equal(t, 0b111011111000100, formatInfo(Low, 0))
+	assert.Equal(t, 0b101010000010010, formatInfo(Medium, 0))
+	assert.Equal(t, 0b011010101011111, formatInfo(Quartile, 0))
+	assert.Equal(t, 0b001011010001001, formatInfo(High, 0))
+	assert.Equal(t, 0b100101010100000, formatInfo(Medium, 7))
+
+	assert.Equal(t, 0b000111110010010100, versionInfo(7))
+	assert.Equal(t, 0b101000110001101001, versionInfo(40))
+}
+
+func TestReedSolomon(t *testing.T) {
+	// "HELLO WORLD" in version 1-M.
+	data := []byte{32, 91, 11, 120, 209, 114, 220, 77, 67, 64, 236, 17, 236, 17, 236, 17}
+	assert.Equal(t, []byte{196, 35, 39, 119, 235, 215, 231, 226, 93, 23}, reedSolomonRemainder(data, reedSolomonDivisor(10)))
+}
+
+func TestCapacity(t *testing.T) {
+	tt := []struct {
+		version int
+		level   Level
+		bytes   int
+	}{
+		{version: 1, level: Low, bytes: 17},
+		{version: 1, level: High, bytes: 7},
+		{version: 10, level: Medium, bytes: 213},
+		{version: 40, level: Low, bytes: 2953},
+		{version: 40, level: High, bytes: 1273},
+	}
+
+	for _, tc := range tt {
+		c, err := Encode(bytes.Repeat([]byte("a"), tc.bytes), tc.level)
+		assert.NoError(t, err)
+		assert.Equal(t, tc.version, c.Version)
+
+		if tc.version < maxVersion {
+			c, err = Encode(bytes.Repeat([]byte("a"), tc.bytes+1), tc.level)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.version+1, c.Version)
+		}
+	}
+
+	_, err := Encode(bytes.Repeat([]byte("a"), 2954), Low)
+	assert.ErrorIs(t, err, ErrDataTooLong)
+}
+
+func TestAlignmentPositions(t *testing.T) {
+	assert.Empty(t, alignmentPositions(1))
+	assert.Equal(t, []int{6, 18}, alignmentPositions(2))
+	assert.Equal(t, []int{6, 22, 38}, alignmentPositions(7))
+	assert.Equal(t, []int{6, 34, 60, 86, 112, 138}, alignmentPositions(32))
+	assert.Equal(t, []int{6, 30, 58, 86, 114, 142, 170}, alignmentPositions(40))
+}
+
+func TestEncode(t *testing.T) {
+	for _, data := range []string{"", "https://short.ru/1", strings.Repeat("https://short.ru/abc?x=1&", 20), strings.Repeat("я", 600)} {
+		for _, level := range []Level{Low, Medium, Quartile, High} {
+			c, err := Encode([]byte(data), level)
+			assert.NoError(t, err)
+			assert.Equal(t, 17+4*c.Version, c.Size)
+			assert.Equal(t, data, string(decode(t, c)))
+
+			// finder pattern and dark module.
+			assert.True(t, c.Dark(0, 0))
+			assert.False(t, c.Dark(1, 1))
+			assert.True(t, c.Dark(3, 3))
+			assert.True(t, c.Dark(8, c.Size-8))
+
+			// format information in both copies.
+			var first, second int
+			for i := 0; i <= 5; i++ {
+				first |= boolBit(c.Dark(8, i)) << i
+			}
+			first |= boolBit(c.Dark(8, 7))<<6 | boolBit(c.Dark(8, 8))<<7 | boolBit(c.Dark(7, 8))<<8
+			for i := 9; i < 15; i++ {
+				first |= boolBit(c.Dark(14-i, 8)) << i
+			}
+			for i := 0; i < 8; i++ {
+				second |= boolBit(c.Dark(c.Size-1-i, 8)) << i
+			}
+			for i := 8; i < 15; i++ {
+				second |= boolBit(c.Dark(8, c.Size-15+i)) << i
+			}
+			assert.Equal(t, formatInfo(level, c.Mask), first)
+			assert.Equal(t, first, second)
+		}
+	}
+
+	_, err := Encode(nil, Level(4))
+	assert.ErrorIs(t, err, ErrInvalidLevel)
+}
+
+func boolBit(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func TestParseLevel(t *testing.T) {
+	for s, want := range map[string]Level{"L": Low, "m": Medium, "Q": Quartile, "h": High} {
+		level, err := ParseLevel(s)
+		assert.NoError(t, err)
+		assert.Equal(t, want, level)
+	}
+
+	_, err := ParseLevel("X")
+	assert.ErrorIs(t, err, ErrInvalidLevel)
+}
+
+func TestCode_Render(t *testing.T) {
+	c, err := Encode([]byte("https://short.ru/1"), Medium)
+	assert.NoError(t, err)
+
+	data, err := c.PNG(256, 4)
+	assert.NoError(t, err)
+	img, err := png.Decode(bytes.NewReader(data))
+	assert.NoError(t, err)
+
+	// version 2 has 25 modules, with 8 margin modules they are 7 pixels each.
+	assert.Equal(t, 2, c.Version)
+	assert.Equal(t, 33*7, img.Bounds().Dx())
+	r, _, _, _ := img.At(4*7, 4*7).RGBA()
+	assert.Equal(t, uint32(0), r)
+	r, _, _, _ = img.At(0, 0).RGBA()
+	assert.Equal(t, uint32(0xffff), r)
+
+	// size smaller than modules.
+	data, err = c.PNG(10, 4)
+	assert.NoError(t, err)
+	img, err = png.Decode(bytes.NewReader(data))
+	assert.NoError(t, err)
+	assert.Equal(t, 33, img.Bounds().Dx())
+
+	svg := string(c.SVG(256, 2))
+	assert.True(t, strings.HasPrefix(svg, `<svg xmlns="http://www.w3.org/2000/svg"`))
+	assert.Contains(t, svg, `width="256" height="256" viewBox="0 0 29 29"`)
+	assert.Contains(t, svg, "M2,2h1v1h-1z")
+}
@@ -0,0 +1,157 @@
+// Package ratelimit limits request rates and daily quotas.
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// sweepInterval is how often limiter removes buckets of idle clients.
+const sweepInterval = time.Minute
+
+// bucket is token bucket of single key.
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// Limiter is token bucket limiter keyed by string (user ID, IP and so on).
+// Limiter with zero rate allows everything.
+type Limiter struct {
+	rate      float64
+	burst     float64
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	now       func() time.Time
+	*sync.Mutex
+}
+
+// NewLimiter creates new limiter, which allows rate requests per second with bursts of burst requests.
+func NewLimiter(rate float64, burst int) *Limiter {
+	if burst < 1 {
+		burst = int(math.Ceil(rate))
+	}
+
+	if burst < 1 {
+		burst = 1
+	}
+
+	return &Limiter{
+		rate:    rate,
+		burst:   float64(burst),
+		buckets: make(map[string]*bucket),
+		now:     time.Now,
+		Mutex:   &sync.Mutex{},
+	}
+}
+
+// Allow takes token from bucket of key.
+// If bucket is empty, returns false and time after which request can be retried.
+func (l *Limiter) Allow(key string) (bool, time.Duration) {
+	if l == nil || l.rate <= 0 {
+		return true, 0
+	}
+
+	l.Lock()
+	defer l.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+
+	wait := time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+	return false, wait
+}
+
+// sweep removes buckets which are full again, so limiter doesn't grow with every client it has seen.
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < sweepInterval {
+		return
+	}
+	l.lastSweep = now
+
+	for key, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// Quota counts daily usage by key. Quota resets at midnight UTC.
+// Quota with zero limit allows everything.
+type Quota struct {
+	limit int
+	day   time.Time
+	used  map[string]int
+	now   func() time.Time
+	*sync.Mutex
+}
+
+// NewQuota creates new quota, which allows limit units per key per day.
+func NewQuota(limit int) *Quota {
+	return &Quota{
+		limit: limit,
+		used:  make(map[string]int),
+		now:   time.Now,
+		Mutex: &sync.Mutex{},
+	}
+}
+
+// Take reserves n units of key's quota.
+// If quota is exceeded, nothing is reserved and Take returns false and time until quota resets.
+func (q *Quota) Take(key string, n int) (bool, time.Duration) {
+	if q == nil || q.limit <= 0 {
+		return true, 0
+	}
+
+	q.Lock()
+	defer q.Unlock()
+
+	now := q.now().UTC()
+	day := now.Truncate(24 * time.Hour)
+	if !day.Equal(q.day) {
+		q.day = day
+		q.used = make(map[string]int)
+	}
+
+	if q.used[key]+n > q.limit {
+		return false, day.Add(24 * time.Hour).Sub(now)
+	}
+
+	q.used[key] += n
+	return true, 0
+}
+
+// Refund returns n units, which were taken by key today, for example when links weren't created.
+func (q *Quota) Refund(key string, n int) {
+	if q == nil || q.limit <= 0 || n <= 0 {
+		return
+	}
+
+	q.Lock()
+	defer q.Unlock()
+
+	// units taken yesterday are already reset.
+	if !q.now().UTC().Truncate(24 * time.Hour).Equal(q.day) {
+		return
+	}
+
+	q.used[key] -= n
+	if q.used[key] <= 0 {
+		delete(q.used, key)
+	}
+}
@@ -0,0 +1,121 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLimiter_Allow(t *testing.T) {
+	now := time.Date(2023, 3, 12, 10, 0, 0, 0, time.UTC)
+
+	l := NewLimiter(1, 2)
+	l.now = func() time.Time { return now }
+
+	// burst of two requests is allowed.
+	ok, _ := l.Allow("user12")
+	assert.True(t, ok)
+	ok, _ = l.Allow("user12")
+	assert.True(t, ok)
+
+	// third request should wait for a second.
+	ok, wait := l.Allow("user12")
+	assert.False(t, ok)
+	assert.Equal(t, time.Second, wait)
+
+	// other keys have own buckets.
+	ok, _ = l.Allow("127.0.0.1")
+	assert.True(t, ok)
+
+	// bucket refills with time.
+	now = now.Add(time.Second)
+	ok, _ = l.Allow("user12")
+	assert.True(t, ok)
+	ok, _ = l.Allow("user12")
+	assert.False(t, ok)
+
+	// idle buckets are removed.
+	now = now.Add(2 * sweepInterval)
+	l.Allow("user12")
+	assert.Len(t, l.buckets, 1)
+}
+
+func TestLimiter_Disabled(t *testing.T) {
+	l := NewLimiter(0, 0)
+	for i := 0; i < 100; i++ {
+		ok, _ := l.Allow("user12")
+		assert.True(t, ok)
+	}
+
+	var nilLimiter *Limiter
+	ok, _ := nilLimiter.Allow("user12")
+	assert.True(t, ok)
+}
+
+func TestQuota_Take(t *testing.T) {
+	now := time.Date(2023, 3, 12, 22, 0, 0, 0, time.UTC)
+
+	q := NewQuota(3)
+	q.now = func() time.Time { return now }
+
+	ok, _ := q.Take("user12", 2)
+	assert.True(t, ok)
+
+	// batch which doesn't fit into quota is rejected as whole.
+	ok, retry := q.Take("user12", 2)
+	assert.False(t, ok)
+	assert.Equal(t, 2*time.Hour, retry)
+
+	ok, _ = q.Take("user12", 1)
+	assert.True(t, ok)
+
+	ok, _ = q.Take("user13", 3)
+	assert.True(t, ok)
+
+	// quota resets next day.
+	now = now.Add(3 * time.Hour)
+	ok, _ = q.Take("user12", 3)
+	assert.True(t, ok)
+
+	// zero quota allows everything.
+	ok, _ = NewQuota(0).Take("user12", 1000)
+	assert.True(t, ok)
+}
+
+func TestQuota_Refund(t *testing.T) {
+	now := time.Date(2023, 3, 12, 22, 0, 0, 0, time.UTC)
+
+	q := NewQuota(2)
+	q.now = func() time.Time { return now }
+
+	ok, _ := q.Take("user12", 2)
+	assert.True(t, ok)
+
+	q.Refund("user12", 1)
+	ok, _ = q.Take("user12", 1)
+	assert.True(t, ok)
+	ok, _ = q.Take("user12", 1)
+	assert.False(t, ok)
+
+	// refund doesn't make quota larger than limit.
+	q.Refund("user12", 5)
+	ok, _ = q.Take("user12", 3)
+	assert.False(t, ok)
+
+	// links taken yesterday aren't refunded today.
+	ok, _ = q.Take("user13", 2)
+	assert.True(t, ok)
+	now = now.Add(3 * time.Hour)
+	ok, _ = q.Take("user13", 2)
+	assert.True(t, ok)
+	now = now.Add(24 * time.Hour)
+	q.Refund("user13", 2)
+	ok, _ = q.Take("user13", 2)
+	assert.True(t, ok)
+	ok, _ = q.Take("user13", 1)
+	assert.False(t, ok)
+
+	var nilQuota *Quota
+	nilQuota.Refund("user12", 1)
+}
@@ -1,6 +1,7 @@
 package storage
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"math/rand"
@@ -31,7 +32,7 @@ func BenchmarkDBStorage(b *testing.B) {
 			url := fmt.Sprintf("https://random%v/random%v", rand.Intn(50000), rand.Intn(20000))
 			userID := fmt.Sprint(rand.Intn(200))
 			b.StartTimer()
-			s.CreateShort(userID, url)
+			s.CreateShort(context.Background(), userID, url)
 		}
 	})
 
@@ -42,7 +43,7 @@ func BenchmarkDBStorage(b *testing.B) {
 			id := fmt.Sprint(rand.Intn(s.LastID))
 			b.StartTimer()
 
-			s.GetLong(id)
+			s.GetLong(context.Background(), id)
 		}
 	})
 
@@ -54,7 +55,7 @@ func BenchmarkDBStorage(b *testing.B) {
 			userID := fmt.Sprint(rand.Intn(200))
 			b.StartTimer()
 
-			s.Delete(userID, id)
+			s.Delete(context.Background(), userID, id)
 		}
 	})
 
@@ -65,7 +66,7 @@ func BenchmarkDBStorage(b *testing.B) {
 			userID := fmt.Sprint(rand.Intn(200))
 			b.StartTimer()
 
-			s.GetHistory(userID)
+			s.GetHistory(context.Background(), userID)
 		}
 	})
 
@@ -87,7 +88,7 @@ func BenchmarkMapStorage(b *testing.B) {
 			url := fmt.Sprintf("https://random%v/random%v", rand.Intn(5000), rand.Intn(2000))
 			userID := fmt.Sprint(rand.Intn(200))
 			b.StartTimer()
-			s.CreateShort(userID, url)
+			s.CreateShort(context.Background(), userID, url)
 		}
 	})
 
@@ -98,7 +99,7 @@ func BenchmarkMapStorage(b *testing.B) {
 			id := fmt.Sprint(rand.Intn(len(s.Locations)))
 			b.StartTimer()
 
-			s.GetLong(id)
+			s.GetLong(context.Background(), id)
 		}
 	})
 
@@ -110,7 +111,7 @@ func BenchmarkMapStorage(b *testing.B) {
 			userID := fmt.Sprint(rand.Intn(200))
 			b.StartTimer()
 
-			s.Delete(userID, id)
+			s.Delete(context.Background(), userID, id)
 		}
 	})
 
@@ -121,7 +122,7 @@ func BenchmarkMapStorage(b *testing.B) {
 			userID := fmt.Sprint(rand.Intn(200))
 			b.StartTimer()
 
-			s.GetHistory(userID)
+			s.GetHistory(context.Background(), userID)
 		}
 	})
 
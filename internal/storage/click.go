@@ -0,0 +1,129 @@
+package storage
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+)
+
+// ClickSuffix is suffix of file, which stores visits of links of file storage.
+const ClickSuffix = ".clicks"
+
+// LinkStats are statistics of visits of short link.
+type LinkStats struct {
+	Clicks    int64      `json:"clicks"`
+	LastClick *time.Time `json:"last_click,omitempty"`
+}
+
+// ClickStorage counts visits of short links.
+type ClickStorage interface {
+	// AddClick counts visit of link at time.
+	AddClick(ctx context.Context, linkID string, at time.Time) error
+	// GetLinkStats gets statistics of link. Link without visits has zero statistics.
+	GetLinkStats(ctx context.Context, linkID string) (LinkStats, error)
+}
+
+// NewClickStorage gets clicks storage of links storage.
+// DB storage stores clicks in table, file storage in file next to links file, other storages in memory.
+func NewClickStorage(s Storage) (ClickStorage, error) {
+	if clicks, ok := s.(ClickStorage); ok {
+		return clicks, nil
+	}
+
+	if file, ok := s.(*FileStorage); ok {
+		return NewFileClicks(file.Cfg.StoragePath + ClickSuffix)
+	}
+
+	return NewMapClicks(), nil
+}
+
+// click is line of clicks file.
+type click struct {
+	LinkID string    `json:"link_id"`
+	At     time.Time `json:"at"`
+}
+
+// MapClicks stores statistics of links in map by link ID.
+// If File is set, every click is appended to it.
+type MapClicks struct {
+	Stats map[string]LinkStats
+	File  *os.File
+	*sync.Mutex
+}
+
+// NewMapClicks creates new in-memory clicks storage.
+func NewMapClicks() *MapClicks {
+	return &MapClicks{Stats: make(map[string]LinkStats), Mutex: &sync.Mutex{}}
+}
+
+// NewFileClicks creates clicks storage, which keeps clicks as JSON lines in file.
+func NewFileClicks(path string) (*MapClicks, error) {
+	s := NewMapClicks()
+
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_APPEND|os.O_CREATE|os.O_SYNC, 0777)
+	if err != nil {
+		return nil, err
+	}
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var c click
+		if err := json.Unmarshal(scanner.Bytes(), &c); err != nil {
+			file.Close()
+			return nil, err
+		}
+		s.count(c)
+	}
+
+	if err := scanner.Err(); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	s.File = file
+	return s, nil
+}
+
+// count adds click to statistics of its link.
+func (s *MapClicks) count(c click) {
+	stats := s.Stats[c.LinkID]
+	stats.Clicks++
+	if stats.LastClick == nil || c.At.After(*stats.LastClick) {
+		at := c.At
+		stats.LastClick = &at
+	}
+	s.Stats[c.LinkID] = stats
+}
+
+// AddClick counts visit of link.
+func (s *MapClicks) AddClick(ctx context.Context, linkID string, at time.Time) error {
+	s.Lock()
+	defer s.Unlock()
+
+	c := click{LinkID: linkID, At: at}
+
+	if s.File != nil {
+		data, err := json.Marshal(c)
+		if err != nil {
+			return err
+		}
+
+		if _, err := s.File.Write(append(data, '\n')); err != nil {
+			return err
+		}
+	}
+
+	s.count(c)
+	return nil
+}
+
+// GetLinkStats gets statistics of link.
+func (s *MapClicks) GetLinkStats(ctx context.Context, linkID string) (LinkStats, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	return s.Stats[linkID], nil
+}
@@ -0,0 +1,93 @@
+package storage
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/size12/url-shortener/internal/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileClicks(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "links.txt"+ClickSuffix)
+	ctx := context.Background()
+	first := time.Date(2023, 3, 12, 10, 0, 0, 0, time.UTC)
+	last := first.Add(time.Hour)
+
+	s, err := NewFileClicks(path)
+	assert.NoError(t, err)
+
+	stats, err := s.GetLinkStats(ctx, "1")
+	assert.NoError(t, err)
+	assert.Equal(t, LinkStats{}, stats)
+
+	assert.NoError(t, s.AddClick(ctx, "1", last))
+	assert.NoError(t, s.AddClick(ctx, "1", first))
+	assert.NoError(t, s.AddClick(ctx, "2", first))
+
+	// clicks are restored from file.
+	s, err = NewFileClicks(path)
+	assert.NoError(t, err)
+
+	stats, err = s.GetLinkStats(ctx, "1")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), stats.Clicks)
+	assert.True(t, last.Equal(*stats.LastClick))
+
+	stats, err = s.GetLinkStats(ctx, "2")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), stats.Clicks)
+}
+
+func TestNewClickStorage(t *testing.T) {
+	cfg := config.GetTestConfig()
+
+	s, err := NewMapStorage(cfg)
+	assert.NoError(t, err)
+	clicks, err := NewClickStorage(s)
+	assert.NoError(t, err)
+	assert.IsType(t, &MapClicks{}, clicks)
+	assert.Nil(t, clicks.(*MapClicks).File)
+
+	db, err := NewDBStorage(cfg)
+	assert.NoError(t, err)
+	clicks, err = NewClickStorage(db)
+	assert.NoError(t, err)
+	assert.Equal(t, db, clicks)
+}
+
+func TestDBStorage_Clicks(t *testing.T) {
+	cfg := config.GetTestConfig()
+	s, err := NewDBStorage(cfg)
+	assert.NoError(t, err)
+
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	assert.NoError(t, err)
+	defer db.Close()
+	s.DB = db
+
+	ctx := context.Background()
+	at := time.Date(2023, 3, 12, 10, 0, 0, 0, time.UTC)
+
+	mock.ExpectExec("INSERT INTO link_clicks (link_id, clicks, last_click) VALUES ($1, 1, $2) "+
+		"ON CONFLICT (link_id) DO UPDATE SET clicks = link_clicks.clicks + 1, last_click = GREATEST(link_clicks.last_click, EXCLUDED.last_click)").
+		WithArgs("1", at).WillReturnResult(sqlmock.NewResult(0, 1))
+	assert.NoError(t, s.AddClick(ctx, "1", at))
+
+	mock.ExpectQuery("SELECT clicks, last_click FROM link_clicks WHERE link_id = $1").
+		WithArgs("1").WillReturnRows(sqlmock.NewRows([]string{"clicks", "last_click"}).AddRow(3, at))
+	stats, err := s.GetLinkStats(ctx, "1")
+	assert.NoError(t, err)
+	assert.Equal(t, LinkStats{Clicks: 3, LastClick: &at}, stats)
+
+	mock.ExpectQuery("SELECT clicks, last_click FROM link_clicks WHERE link_id = $1").
+		WithArgs("2").WillReturnRows(sqlmock.NewRows([]string{"clicks", "last_click"}))
+	stats, err = s.GetLinkStats(ctx, "2")
+	assert.NoError(t, err)
+	assert.Equal(t, LinkStats{}, stats)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
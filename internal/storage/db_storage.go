@@ -3,16 +3,26 @@ package storage
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
-	"log"
+	"strings"
 	"time"
 
 	"github.com/golang-migrate/migrate/v4"
 	"github.com/golang-migrate/migrate/v4/database/postgres"
 	"github.com/size12/url-shortener/internal/config"
+	"github.com/size12/url-shortener/internal/logger"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
 )
 
+// tracer creates spans of DB queries.
+var tracer = otel.Tracer("github.com/size12/url-shortener/internal/storage")
+
 // DBStorage is storage that uses DB.
 // Implements storage.Storage interface.
 type DBStorage struct {
@@ -29,12 +39,36 @@ func (s *DBStorage) GetConfig() config.Config {
 }
 
 // Ping check connection to storage.
-func (s *DBStorage) Ping() error {
-	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+func (s *DBStorage) Ping(ctx context.Context) error {
+	ctx, span := startSpan(ctx, "Ping", "")
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
 	defer cancel()
 	return s.DB.PingContext(ctx)
 }
 
+// CheckMigrations checks that last migration of DB schema didn't fail.
+func (s *DBStorage) CheckMigrations(ctx context.Context) error {
+	ctx, span := startSpan(ctx, "CheckMigrations", "SELECT dirty FROM schema_migrations LIMIT 1")
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	var dirty bool
+	err := s.DB.QueryRowContext(ctx, "SELECT dirty FROM schema_migrations LIMIT 1").Scan(&dirty)
+	if err != nil {
+		return logError(ctx, "Failed check migrations", err)
+	}
+
+	if dirty {
+		return ErrDirtyMigration
+	}
+
+	return nil
+}
+
 // NewDBStorage creates new DB storage.
 func NewDBStorage(cfg config.Config) (*DBStorage, error) {
 	s := &DBStorage{Cfg: cfg, LastID: 0}
@@ -55,7 +89,6 @@ func NewDBStorage(cfg config.Config) (*DBStorage, error) {
 	err = migrateUP(db, cfg)
 
 	if err != nil {
-		log.Println("Failed migrate DB: ", err)
 		return s, err
 	}
 
@@ -81,7 +114,7 @@ func NewDBStorage(cfg config.Config) (*DBStorage, error) {
 func migrateUP(db *sql.DB, cfg config.Config) error {
 	driver, err := postgres.WithInstance(db, &postgres.Config{})
 	if err != nil {
-		log.Printf("Failed create postgres instance: %v\n", err)
+		logger.Log.Error("Failed create postgres instance", zap.Error(err))
 		return err
 	}
 
@@ -90,13 +123,13 @@ func migrateUP(db *sql.DB, cfg config.Config) error {
 		"pgx", driver)
 
 	if err != nil {
-		log.Printf("Failed create migration instance: %v\n", err)
+		logger.Log.Error("Failed create migration instance", zap.Error(err))
 		return err
 	}
 
 	err = m.Up()
 	if err != nil && err != migrate.ErrNoChange {
-		log.Println("Failed migrate: ", err)
+		logger.Log.Error("Failed migrate DB", zap.Error(err))
 		return err
 	}
 
@@ -104,23 +137,25 @@ func migrateUP(db *sql.DB, cfg config.Config) error {
 }
 
 // CreateShort creates short url from long.
-func (s *DBStorage) CreateShort(userID string, urls ...string) ([]string, error) {
+func (s *DBStorage) CreateShort(ctx context.Context, userID string, urls ...string) ([]string, error) {
 	var isErr409 error
 	result := make([]string, 0, len(urls))
 
-	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
-	defer cancel()
+	ctx, span := startSpan(ctx, "CreateShort", "INSERT INTO links (id, url, cookie, deleted) VALUES ($1, $2, $3, $4)")
+	defer span.End()
 
-	tx, err := s.DB.Begin()
-	defer tx.Rollback()
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
 
+	tx, err := s.DB.BeginTx(ctx, nil)
 	if err != nil {
-		return result, err
+		return result, logError(ctx, "Failed begin transaction", err)
 	}
+	defer tx.Rollback()
 
 	stmt, err := tx.PrepareContext(ctx, "INSERT INTO links (id, url, cookie, deleted) VALUES ($1, $2, $3, $4)")
 	if err != nil {
-		return result, err
+		return result, logError(ctx, "Failed prepare insert", err)
 	}
 	defer stmt.Close()
 
@@ -130,13 +165,13 @@ func (s *DBStorage) CreateShort(userID string, urls ...string) ([]string, error)
 		var alreadyAdded bool
 		rows, err = s.DB.QueryContext(ctx, "SELECT id FROM links WHERE url = $1 LIMIT 1", url)
 		if err != nil {
-			return result, err
+			return result, logError(ctx, "Failed find link", err)
 		}
 		for rows.Next() {
 			var id string
 			err = rows.Scan(&id)
 			if err != nil {
-				return result, err
+				return result, logError(ctx, "Failed find link", err)
 			}
 			isErr409 = Err409
 			alreadyAdded = true
@@ -144,13 +179,13 @@ func (s *DBStorage) CreateShort(userID string, urls ...string) ([]string, error)
 		}
 
 		if err = rows.Err(); err != nil {
-			return result, err
+			return result, logError(ctx, "Failed find link", err)
 		}
 		if !alreadyAdded {
 			s.LastID++
 			newID := fmt.Sprint(s.LastID)
 			if _, err = stmt.ExecContext(ctx, newID, url, userID, false); err != nil {
-				return result, err
+				return result, logError(ctx, "Failed insert link", err)
 			}
 			result = append(result, newID)
 		}
@@ -158,15 +193,18 @@ func (s *DBStorage) CreateShort(userID string, urls ...string) ([]string, error)
 
 	err = tx.Commit()
 	if err != nil {
-		return result, err
+		return result, logError(ctx, "Failed commit transaction", err)
 	}
 
 	return result, isErr409
 }
 
 // GetLong gets long url from short.
-func (s *DBStorage) GetLong(id string) (string, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+func (s *DBStorage) GetLong(ctx context.Context, id string) (string, error) {
+	ctx, span := startSpan(ctx, "GetLong", "SELECT url, deleted FROM links WHERE id=$1 LIMIT 1")
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
 	defer cancel()
 
 	row := s.DB.QueryRowContext(ctx, "SELECT url, deleted FROM links WHERE id=$1 LIMIT 1", id)
@@ -181,12 +219,11 @@ func (s *DBStorage) GetLong(id string) (string, error) {
 	}
 
 	if err != nil {
-		return "", err
+		return "", logError(ctx, "Failed get long url", err)
 	}
 
 	if err := row.Err(); err != nil {
-		fmt.Println("ROW ERROR")
-		return "", err
+		return "", logError(ctx, "Failed get long url", err)
 	}
 
 	if deleted {
@@ -196,48 +233,254 @@ func (s *DBStorage) GetLong(id string) (string, error) {
 	return long, nil
 }
 
-// Delete deletes url.
-func (s *DBStorage) Delete(userID string, ids ...string) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+// GetLink gets link with its metadata.
+func (s *DBStorage) GetLink(ctx context.Context, id string) (Link, error) {
+	query := "SELECT url, cookie, deleted, created_at, options, original_url FROM links WHERE id=$1 LIMIT 1"
+	ctx, span := startSpan(ctx, "GetLink", query)
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
 	defer cancel()
 
-	tx, err := s.DB.Begin()
-	defer tx.Rollback()
+	link := Link{ID: id}
+	var options []byte
+
+	err := s.DB.QueryRowContext(ctx, query, id).Scan(&link.URL, &link.UserID, &link.Deleted, &link.CreatedAt, &options, &link.OriginalURL)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return Link{}, Err404
+	}
+
+	if err != nil {
+		return Link{}, logError(ctx, "Failed get link", err)
+	}
 
+	if len(options) != 0 {
+		if err := json.Unmarshal(options, &link.Options); err != nil {
+			return Link{}, logError(ctx, "Failed unmarshal link options", err)
+		}
+	}
+
+	if link.Deleted {
+		return link, Err410
+	}
+
+	return link, nil
+}
+
+// SetLinkOptions sets options of link.
+func (s *DBStorage) SetLinkOptions(ctx context.Context, id string, opts LinkOptions) error {
+	query := "UPDATE links SET options = $1 WHERE id = $2"
+	ctx, span := startSpan(ctx, "SetLinkOptions", query)
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	options, err := json.Marshal(opts)
 	if err != nil {
 		return err
 	}
 
-	stmt, err := tx.PrepareContext(ctx, "UPDATE links SET deleted = TRUE WHERE id = $1 AND cookie = $2")
+	result, err := s.DB.ExecContext(ctx, query, options, id)
+	if err != nil {
+		return logError(ctx, "Failed set link options", err)
+	}
+
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return logError(ctx, "Failed set link options", err)
+	}
+
+	if updated == 0 {
+		return Err404
+	}
+
+	return nil
+}
+
+// SetOriginalURL sets url of link as it was sent by owner.
+func (s *DBStorage) SetOriginalURL(ctx context.Context, id, original string) error {
+	query := "UPDATE links SET original_url = $1 WHERE id = $2"
+	ctx, span := startSpan(ctx, "SetOriginalURL", query)
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	result, err := s.DB.ExecContext(ctx, query, original, id)
+	if err != nil {
+		return logError(ctx, "Failed set original url", err)
+	}
+
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return logError(ctx, "Failed set original url", err)
+	}
+
+	if updated == 0 {
+		return Err404
+	}
+
+	return nil
+}
+
+// SetUTMPreset creates or replaces UTM preset of user.
+func (s *DBStorage) SetUTMPreset(ctx context.Context, userID, name string, utm UTM) error {
+	query := "INSERT INTO utm_presets (cookie, name, utm) VALUES ($1, $2, $3) ON CONFLICT (cookie, name) DO UPDATE SET utm = EXCLUDED.utm"
+	ctx, span := startSpan(ctx, "SetUTMPreset", query)
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	data, err := json.Marshal(utm)
 	if err != nil {
 		return err
 	}
 
+	if _, err := s.DB.ExecContext(ctx, query, userID, name, data); err != nil {
+		return logError(ctx, "Failed set UTM preset", err)
+	}
+	return nil
+}
+
+// GetUTMPreset gets UTM preset of user.
+func (s *DBStorage) GetUTMPreset(ctx context.Context, userID, name string) (UTM, error) {
+	query := "SELECT utm FROM utm_presets WHERE cookie = $1 AND name = $2"
+	ctx, span := startSpan(ctx, "GetUTMPreset", query)
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	var data []byte
+	err := s.DB.QueryRowContext(ctx, query, userID, name).Scan(&data)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return UTM{}, Err404
+	}
+
+	if err != nil {
+		return UTM{}, logError(ctx, "Failed get UTM preset", err)
+	}
+
+	var utm UTM
+	if err := json.Unmarshal(data, &utm); err != nil {
+		return UTM{}, logError(ctx, "Failed unmarshal UTM preset", err)
+	}
+	return utm, nil
+}
+
+// GetUTMPresets gets all UTM presets of user.
+func (s *DBStorage) GetUTMPresets(ctx context.Context, userID string) (map[string]UTM, error) {
+	query := "SELECT name, utm FROM utm_presets WHERE cookie = $1"
+	ctx, span := startSpan(ctx, "GetUTMPresets", query)
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	rows, err := s.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, logError(ctx, "Failed get UTM presets", err)
+	}
+	defer rows.Close()
+
+	presets := make(map[string]UTM)
+	for rows.Next() {
+		var name string
+		var data []byte
+		if err := rows.Scan(&name, &data); err != nil {
+			return nil, logError(ctx, "Failed get UTM presets", err)
+		}
+
+		var utm UTM
+		if err := json.Unmarshal(data, &utm); err != nil {
+			return nil, logError(ctx, "Failed unmarshal UTM preset", err)
+		}
+		presets[name] = utm
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, logError(ctx, "Failed get UTM presets", err)
+	}
+
+	return presets, nil
+}
+
+// DeleteUTMPreset deletes UTM preset of user.
+func (s *DBStorage) DeleteUTMPreset(ctx context.Context, userID, name string) error {
+	query := "DELETE FROM utm_presets WHERE cookie = $1 AND name = $2"
+	ctx, span := startSpan(ctx, "DeleteUTMPreset", query)
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	result, err := s.DB.ExecContext(ctx, query, userID, name)
+	if err != nil {
+		return logError(ctx, "Failed delete UTM preset", err)
+	}
+
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return logError(ctx, "Failed delete UTM preset", err)
+	}
+
+	if deleted == 0 {
+		return Err404
+	}
+	return nil
+}
+
+// Delete deletes url.
+func (s *DBStorage) Delete(ctx context.Context, userID string, ids ...string) error {
+	ctx, span := startSpan(ctx, "Delete", "UPDATE links SET deleted = TRUE WHERE id = $1 AND cookie = $2")
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return logError(ctx, "Failed begin transaction", err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, "UPDATE links SET deleted = TRUE WHERE id = $1 AND cookie = $2")
+	if err != nil {
+		return logError(ctx, "Failed prepare delete", err)
+	}
+
 	for _, id := range ids {
 		if _, err = stmt.ExecContext(ctx, id, userID); err != nil {
-			return err
+			return logError(ctx, "Failed delete link", err)
 		}
 	}
 
 	err = tx.Commit()
 	if err != nil {
-		return err
+		return logError(ctx, "Failed commit transaction", err)
 	}
 
 	return nil
 }
 
 // GetHistory gets history of links.
-func (s *DBStorage) GetHistory(userID string) ([]LinkJSON, error) {
+func (s *DBStorage) GetHistory(ctx context.Context, userID string) ([]LinkJSON, error) {
 	var history []LinkJSON
 
-	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	ctx, span := startSpan(ctx, "GetHistory", "SELECT id, COALESCE(NULLIF(original_url, ''), url) FROM links WHERE cookie=$1")
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
 	defer cancel()
 
-	rows, err := s.DB.QueryContext(ctx, "SELECT id, url FROM links WHERE cookie=$1", userID)
+	rows, err := s.DB.QueryContext(ctx, "SELECT id, COALESCE(NULLIF(original_url, ''), url) FROM links WHERE cookie=$1", userID)
 
 	if err != nil {
-		return history, err
+		return history, logError(ctx, "Failed get history", err)
 	}
 
 	defer rows.Close()
@@ -248,7 +491,7 @@ func (s *DBStorage) GetHistory(userID string) ([]LinkJSON, error) {
 		err = rows.Scan(&id, &long)
 
 		if err != nil {
-			return history, err
+			return history, logError(ctx, "Failed get history", err)
 		}
 
 		history = append(history, LinkJSON{
@@ -259,29 +502,791 @@ func (s *DBStorage) GetHistory(userID string) ([]LinkJSON, error) {
 	}
 
 	if err := rows.Err(); err != nil {
-		return history, err
+		return history, logError(ctx, "Failed get history", err)
 	}
 
 	return history, nil
 }
 
 // GetStatistic gets total count of users and urls.
-func (s *DBStorage) GetStatistic() (Statistic, error) {
+func (s *DBStorage) GetStatistic(ctx context.Context) (Statistic, error) {
 	stat := Statistic{Urls: s.LastID}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	ctx, span := startSpan(ctx, "GetStatistic", "SELECT COUNT(DISTINCT cookie) FROM links;")
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
 	defer cancel()
 
 	row := s.DB.QueryRowContext(ctx, "SELECT COUNT(DISTINCT cookie) FROM links;")
 
 	err := row.Scan(&stat.Users)
 	if err != nil {
-		return stat, err
+		return stat, logError(ctx, "Failed get statistic", err)
 	}
 
 	if err := row.Err(); err != nil {
-		return stat, err
+		return stat, logError(ctx, "Failed get statistic", err)
 	}
 
 	return stat, nil
 }
+
+// startSpan starts span of DB operation.
+func startSpan(ctx context.Context, operation, statement string) (context.Context, trace.Span) {
+	return tracer.Start(ctx, "DBStorage."+operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.DBSystemPostgreSQL, semconv.DBStatementKey.String(statement)),
+	)
+}
+
+// logError logs failed DB operation with request-scoped logger, marks span as failed and returns error.
+func logError(ctx context.Context, msg string, err error) error {
+	logger.FromContext(ctx).Error(msg, zap.Error(err))
+
+	span := trace.SpanFromContext(ctx)
+	span.RecordError(err)
+	span.SetStatus(codes.Error, msg)
+
+	return err
+}
+
+// insertAudit is query, which adds entry to takedowns audit trail.
+const insertAudit = "INSERT INTO takedown_audit (action, kind, target, reason, code, actor, created_at) VALUES ($1, $2, $3, $4, $5, $6, $7)"
+
+// AddTakedown adds takedown or replaces takedown of the same target and records it in audit trail.
+func (s *DBStorage) AddTakedown(ctx context.Context, t Takedown) error {
+	query := "INSERT INTO takedowns (kind, target, reason, code, actor, created_at) VALUES ($1, $2, $3, $4, $5, $6) " +
+		"ON CONFLICT (kind, target) DO UPDATE SET reason = EXCLUDED.reason, code = EXCLUDED.code, actor = EXCLUDED.actor, created_at = EXCLUDED.created_at"
+	ctx, span := startSpan(ctx, "AddTakedown", query)
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return logError(ctx, "Failed begin transaction", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, query, t.Kind, t.Target, t.Reason, t.Code, t.Actor, t.CreatedAt); err != nil {
+		return logError(ctx, "Failed add takedown", err)
+	}
+
+	if _, err := tx.ExecContext(ctx, insertAudit, AuditTakedown, t.Kind, t.Target, t.Reason, t.Code, t.Actor, t.CreatedAt); err != nil {
+		return logError(ctx, "Failed add takedown audit", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return logError(ctx, "Failed commit transaction", err)
+	}
+
+	return nil
+}
+
+// RemoveTakedown removes takedown and records it in audit trail.
+func (s *DBStorage) RemoveTakedown(ctx context.Context, t Takedown) error {
+	query := "DELETE FROM takedowns WHERE kind = $1 AND target = $2"
+	ctx, span := startSpan(ctx, "RemoveTakedown", query)
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return logError(ctx, "Failed begin transaction", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, query, t.Kind, t.Target)
+	if err != nil {
+		return logError(ctx, "Failed remove takedown", err)
+	}
+
+	removed, err := result.RowsAffected()
+	if err != nil {
+		return logError(ctx, "Failed remove takedown", err)
+	}
+
+	if removed == 0 {
+		return Err404
+	}
+
+	if _, err := tx.ExecContext(ctx, insertAudit, AuditRestore, t.Kind, t.Target, t.Reason, t.Code, t.Actor, t.CreatedAt); err != nil {
+		return logError(ctx, "Failed add takedown audit", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return logError(ctx, "Failed commit transaction", err)
+	}
+
+	return nil
+}
+
+// GetTakedown gets active takedown.
+func (s *DBStorage) GetTakedown(ctx context.Context, kind, target string) (Takedown, error) {
+	query := "SELECT reason, code, actor, created_at FROM takedowns WHERE kind = $1 AND target = $2"
+	ctx, span := startSpan(ctx, "GetTakedown", query)
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	t := Takedown{Kind: kind, Target: target}
+	err := s.DB.QueryRowContext(ctx, query, kind, target).Scan(&t.Reason, &t.Code, &t.Actor, &t.CreatedAt)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return Takedown{}, Err404
+	}
+
+	if err != nil {
+		return Takedown{}, logError(ctx, "Failed get takedown", err)
+	}
+
+	return t, nil
+}
+
+// GetTakedowns gets active takedowns from the oldest.
+func (s *DBStorage) GetTakedowns(ctx context.Context) ([]Takedown, error) {
+	query := "SELECT kind, target, reason, code, actor, created_at FROM takedowns ORDER BY created_at"
+	ctx, span := startSpan(ctx, "GetTakedowns", query)
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	rows, err := s.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, logError(ctx, "Failed get takedowns", err)
+	}
+	defer rows.Close()
+
+	takedowns := make([]Takedown, 0)
+	for rows.Next() {
+		var t Takedown
+		if err := rows.Scan(&t.Kind, &t.Target, &t.Reason, &t.Code, &t.Actor, &t.CreatedAt); err != nil {
+			return nil, logError(ctx, "Failed get takedowns", err)
+		}
+		takedowns = append(takedowns, t)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, logError(ctx, "Failed get takedowns", err)
+	}
+
+	return takedowns, nil
+}
+
+// GetAudit gets takedowns audit trail from the oldest entry.
+func (s *DBStorage) GetAudit(ctx context.Context) ([]AuditEntry, error) {
+	query := "SELECT action, kind, target, reason, code, actor, created_at FROM takedown_audit ORDER BY id"
+	ctx, span := startSpan(ctx, "GetAudit", query)
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	rows, err := s.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, logError(ctx, "Failed get takedowns audit", err)
+	}
+	defer rows.Close()
+
+	audit := make([]AuditEntry, 0)
+	for rows.Next() {
+		var entry AuditEntry
+		err := rows.Scan(&entry.Action, &entry.Kind, &entry.Target, &entry.Reason, &entry.Code, &entry.Actor, &entry.CreatedAt)
+		if err != nil {
+			return nil, logError(ctx, "Failed get takedowns audit", err)
+		}
+		audit = append(audit, entry)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, logError(ctx, "Failed get takedowns audit", err)
+	}
+
+	return audit, nil
+}
+
+// AddReport adds open abuse report.
+func (s *DBStorage) AddReport(ctx context.Context, r Report) (Report, error) {
+	query := "INSERT INTO reports (link_id, reason, reporter_ip, status, created_at) VALUES ($1, $2, $3, $4, $5) RETURNING id"
+	ctx, span := startSpan(ctx, "AddReport", query)
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	r.Status = ReportOpen
+	err := s.DB.QueryRowContext(ctx, query, r.LinkID, r.Reason, r.ReporterIP, r.Status, r.CreatedAt).Scan(&r.ID)
+	if err != nil {
+		return Report{}, logError(ctx, "Failed add report", err)
+	}
+
+	return r, nil
+}
+
+// GetLinkReports gets open reports of link.
+func (s *DBStorage) GetLinkReports(ctx context.Context, linkID string) ([]Report, error) {
+	query := "SELECT id, link_id, reason, reporter_ip, status, created_at FROM reports WHERE link_id = $1 AND status = $2 ORDER BY id"
+	return s.getReports(ctx, "GetLinkReports", query, linkID, ReportOpen)
+}
+
+// GetOpenReports gets open reports from the oldest.
+func (s *DBStorage) GetOpenReports(ctx context.Context) ([]Report, error) {
+	query := "SELECT id, link_id, reason, reporter_ip, status, created_at FROM reports WHERE status = $1 ORDER BY id"
+	return s.getReports(ctx, "GetOpenReports", query, ReportOpen)
+}
+
+// getReports gets reports by query.
+func (s *DBStorage) getReports(ctx context.Context, operation, query string, args ...interface{}) ([]Report, error) {
+	ctx, span := startSpan(ctx, operation, query)
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	rows, err := s.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, logError(ctx, "Failed get reports", err)
+	}
+	defer rows.Close()
+
+	reports := make([]Report, 0)
+	for rows.Next() {
+		var r Report
+		if err := rows.Scan(&r.ID, &r.LinkID, &r.Reason, &r.ReporterIP, &r.Status, &r.CreatedAt); err != nil {
+			return nil, logError(ctx, "Failed get reports", err)
+		}
+		reports = append(reports, r)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, logError(ctx, "Failed get reports", err)
+	}
+
+	return reports, nil
+}
+
+// ResolveReports sets status of open reports of link.
+func (s *DBStorage) ResolveReports(ctx context.Context, linkID, status string) error {
+	query := "UPDATE reports SET status = $1 WHERE link_id = $2 AND status = $3"
+	ctx, span := startSpan(ctx, "ResolveReports", query)
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	result, err := s.DB.ExecContext(ctx, query, status, linkID, ReportOpen)
+	if err != nil {
+		return logError(ctx, "Failed resolve reports", err)
+	}
+
+	resolved, err := result.RowsAffected()
+	if err != nil {
+		return logError(ctx, "Failed resolve reports", err)
+	}
+
+	if resolved == 0 {
+		return Err404
+	}
+
+	return nil
+}
+
+// AddClick counts visit of link.
+func (s *DBStorage) AddClick(ctx context.Context, linkID string, at time.Time) error {
+	query := "INSERT INTO link_clicks (link_id, clicks, last_click) VALUES ($1, 1, $2) " +
+		"ON CONFLICT (link_id) DO UPDATE SET clicks = link_clicks.clicks + 1, last_click = GREATEST(link_clicks.last_click, EXCLUDED.last_click)"
+	ctx, span := startSpan(ctx, "AddClick", query)
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	if _, err := s.DB.ExecContext(ctx, query, linkID, at); err != nil {
+		return logError(ctx, "Failed add click", err)
+	}
+
+	return nil
+}
+
+// GetLinkStats gets statistics of link.
+func (s *DBStorage) GetLinkStats(ctx context.Context, linkID string) (LinkStats, error) {
+	query := "SELECT clicks, last_click FROM link_clicks WHERE link_id = $1"
+	ctx, span := startSpan(ctx, "GetLinkStats", query)
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	var stats LinkStats
+	var lastClick sql.NullTime
+	err := s.DB.QueryRowContext(ctx, query, linkID).Scan(&stats.Clicks, &lastClick)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return LinkStats{}, nil
+	}
+
+	if err != nil {
+		return LinkStats{}, logError(ctx, "Failed get link stats", err)
+	}
+
+	if lastClick.Valid {
+		stats.LastClick = &lastClick.Time
+	}
+
+	return stats, nil
+}
+
+// GetResponse gets response of user's idempotency key.
+func (s *DBStorage) GetResponse(ctx context.Context, userID, key string, now time.Time) (IdempotentResponse, error) {
+	query := "SELECT fingerprint, status, content_type, location, body, expires_at FROM idempotency_keys " +
+		"WHERE cookie = $1 AND idempotency_key = $2 AND expires_at > $3"
+	ctx, span := startSpan(ctx, "GetResponse", query)
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	resp := IdempotentResponse{UserID: userID, Key: key}
+	err := s.DB.QueryRowContext(ctx, query, userID, key, now).
+		Scan(&resp.Fingerprint, &resp.Status, &resp.ContentType, &resp.Location, &resp.Body, &resp.ExpiresAt)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return IdempotentResponse{}, Err404
+	}
+
+	if err != nil {
+		return IdempotentResponse{}, logError(ctx, "Failed get idempotent response", err)
+	}
+
+	return resp, nil
+}
+
+// SaveResponse saves response of user's idempotency key and removes expired responses.
+func (s *DBStorage) SaveResponse(ctx context.Context, resp IdempotentResponse, now time.Time) error {
+	query := "INSERT INTO idempotency_keys (cookie, idempotency_key, fingerprint, status, content_type, location, body, expires_at) " +
+		"VALUES ($1, $2, $3, $4, $5, $6, $7, $8) ON CONFLICT (cookie, idempotency_key) DO UPDATE SET " +
+		"fingerprint = EXCLUDED.fingerprint, status = EXCLUDED.status, content_type = EXCLUDED.content_type, " +
+		"location = EXCLUDED.location, body = EXCLUDED.body, expires_at = EXCLUDED.expires_at"
+	ctx, span := startSpan(ctx, "SaveResponse", query)
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	if _, err := s.DB.ExecContext(ctx, "DELETE FROM idempotency_keys WHERE expires_at <= $1", now); err != nil {
+		return logError(ctx, "Failed remove expired idempotent responses", err)
+	}
+
+	_, err := s.DB.ExecContext(ctx, query,
+		resp.UserID, resp.Key, resp.Fingerprint, resp.Status, resp.ContentType, resp.Location, resp.Body, resp.ExpiresAt)
+	if err != nil {
+		return logError(ctx, "Failed save idempotent response", err)
+	}
+
+	return nil
+}
+
+// jobTimeout is timeout of queries, which add job with all its items.
+const jobTimeout = 30 * time.Second
+
+// AddJob adds job with items.
+func (s *DBStorage) AddJob(ctx context.Context, job Job, items []BatchJSON) (Job, error) {
+	query := "INSERT INTO jobs (cookie, status, total, processed, failed, error, created_at, updated_at) " +
+		"VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id"
+	ctx, span := startSpan(ctx, "AddJob", query)
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, jobTimeout)
+	defer cancel()
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return Job{}, logError(ctx, "Failed begin transaction", err)
+	}
+	defer tx.Rollback()
+
+	job.Total = len(items)
+	err = tx.QueryRowContext(ctx, query, job.UserID, job.Status, job.Total, job.Processed, job.Failed, job.Error,
+		job.CreatedAt, job.UpdatedAt).Scan(&job.ID)
+	if err != nil {
+		return Job{}, logError(ctx, "Failed add job", err)
+	}
+
+	stmt, err := tx.PrepareContext(ctx, "INSERT INTO job_items (job_id, position, request) VALUES ($1, $2, $3)")
+	if err != nil {
+		return Job{}, logError(ctx, "Failed prepare insert", err)
+	}
+	defer stmt.Close()
+
+	for i, item := range items {
+		item.ShortURL = ""
+		request, err := json.Marshal(item)
+		if err != nil {
+			return Job{}, err
+		}
+
+		if _, err := stmt.ExecContext(ctx, job.ID, i, request); err != nil {
+			return Job{}, logError(ctx, "Failed add job item", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return Job{}, logError(ctx, "Failed commit transaction", err)
+	}
+
+	return job, nil
+}
+
+// GetJob gets job.
+func (s *DBStorage) GetJob(ctx context.Context, id int64) (Job, error) {
+	query := "SELECT id, cookie, status, total, processed, failed, error, created_at, updated_at FROM jobs WHERE id = $1"
+	jobs, err := s.getJobs(ctx, "GetJob", query, id)
+	if err != nil {
+		return Job{}, err
+	}
+
+	if len(jobs) == 0 {
+		return Job{}, Err404
+	}
+
+	return jobs[0], nil
+}
+
+// GetUnfinishedJobs gets queued and running jobs from the oldest.
+func (s *DBStorage) GetUnfinishedJobs(ctx context.Context) ([]Job, error) {
+	query := "SELECT id, cookie, status, total, processed, failed, error, created_at, updated_at FROM jobs " +
+		"WHERE status IN ($1, $2) ORDER BY id"
+	return s.getJobs(ctx, "GetUnfinishedJobs", query, JobQueued, JobRunning)
+}
+
+// getJobs gets jobs by query.
+func (s *DBStorage) getJobs(ctx context.Context, operation, query string, args ...interface{}) ([]Job, error) {
+	ctx, span := startSpan(ctx, operation, query)
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	rows, err := s.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, logError(ctx, "Failed get jobs", err)
+	}
+	defer rows.Close()
+
+	jobs := make([]Job, 0)
+	for rows.Next() {
+		var j Job
+		err := rows.Scan(&j.ID, &j.UserID, &j.Status, &j.Total, &j.Processed, &j.Failed, &j.Error, &j.CreatedAt, &j.UpdatedAt)
+		if err != nil {
+			return nil, logError(ctx, "Failed get jobs", err)
+		}
+		jobs = append(jobs, j)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, logError(ctx, "Failed get jobs", err)
+	}
+
+	return jobs, nil
+}
+
+// GetJobItems gets items of job from position offset.
+func (s *DBStorage) GetJobItems(ctx context.Context, id int64, offset, limit int) ([]JobItem, error) {
+	query := "SELECT position, request, short_url, error FROM job_items WHERE job_id = $1 AND position >= $2 ORDER BY position LIMIT $3"
+	ctx, span := startSpan(ctx, "GetJobItems", query)
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	rows, err := s.DB.QueryContext(ctx, query, id, offset, limit)
+	if err != nil {
+		return nil, logError(ctx, "Failed get job items", err)
+	}
+	defer rows.Close()
+
+	items := make([]JobItem, 0)
+	for rows.Next() {
+		var item JobItem
+		var request []byte
+		var shortURL string
+		if err := rows.Scan(&item.Position, &request, &shortURL, &item.Error); err != nil {
+			return nil, logError(ctx, "Failed get job items", err)
+		}
+
+		if err := json.Unmarshal(request, &item.BatchJSON); err != nil {
+			return nil, logError(ctx, "Failed get job items", err)
+		}
+		item.ShortURL = shortURL
+		items = append(items, item)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, logError(ctx, "Failed get job items", err)
+	}
+
+	return items, nil
+}
+
+// UpdateJob saves progress of job and results of its items.
+func (s *DBStorage) UpdateJob(ctx context.Context, job Job, items ...JobItem) error {
+	query := "UPDATE jobs SET status = $1, processed = $2, failed = $3, error = $4, updated_at = $5 WHERE id = $6"
+	ctx, span := startSpan(ctx, "UpdateJob", query)
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return logError(ctx, "Failed begin transaction", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, query, job.Status, job.Processed, job.Failed, job.Error, job.UpdatedAt, job.ID)
+	if err != nil {
+		return logError(ctx, "Failed update job", err)
+	}
+
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return logError(ctx, "Failed update job", err)
+	}
+
+	if updated == 0 {
+		return Err404
+	}
+
+	if len(items) > 0 {
+		stmt, err := tx.PrepareContext(ctx, "UPDATE job_items SET short_url = $1, error = $2 WHERE job_id = $3 AND position = $4")
+		if err != nil {
+			return logError(ctx, "Failed prepare update", err)
+		}
+		defer stmt.Close()
+
+		for _, item := range items {
+			if _, err := stmt.ExecContext(ctx, item.ShortURL, item.Error, job.ID, item.Position); err != nil {
+				return logError(ctx, "Failed update job item", err)
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return logError(ctx, "Failed commit transaction", err)
+	}
+
+	return nil
+}
+
+// AddWebhook adds webhook.
+func (s *DBStorage) AddWebhook(ctx context.Context, hook Webhook) (Webhook, error) {
+	query := "INSERT INTO webhooks (cookie, url, secret, events, created_at) VALUES ($1, $2, $3, $4, $5) RETURNING id"
+	ctx, span := startSpan(ctx, "AddWebhook", query)
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	err := s.DB.QueryRowContext(ctx, query, hook.UserID, hook.URL, hook.Secret, strings.Join(hook.Events, ","), hook.CreatedAt).
+		Scan(&hook.ID)
+	if err != nil {
+		return Webhook{}, logError(ctx, "Failed add webhook", err)
+	}
+
+	return hook, nil
+}
+
+// GetWebhook gets webhook.
+func (s *DBStorage) GetWebhook(ctx context.Context, id int64) (Webhook, error) {
+	query := "SELECT id, cookie, url, secret, events, created_at FROM webhooks WHERE id = $1"
+	hooks, err := s.getWebhooks(ctx, "GetWebhook", query, id)
+	if err != nil {
+		return Webhook{}, err
+	}
+
+	if len(hooks) == 0 {
+		return Webhook{}, Err404
+	}
+
+	return hooks[0], nil
+}
+
+// GetWebhooks gets webhooks of user from the oldest.
+func (s *DBStorage) GetWebhooks(ctx context.Context, userID string) ([]Webhook, error) {
+	query := "SELECT id, cookie, url, secret, events, created_at FROM webhooks WHERE cookie = $1 ORDER BY id"
+	return s.getWebhooks(ctx, "GetWebhooks", query, userID)
+}
+
+// getWebhooks gets webhooks by query.
+func (s *DBStorage) getWebhooks(ctx context.Context, operation, query string, args ...interface{}) ([]Webhook, error) {
+	ctx, span := startSpan(ctx, operation, query)
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	rows, err := s.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, logError(ctx, "Failed get webhooks", err)
+	}
+	defer rows.Close()
+
+	hooks := make([]Webhook, 0)
+	for rows.Next() {
+		var hook Webhook
+		var events string
+		if err := rows.Scan(&hook.ID, &hook.UserID, &hook.URL, &hook.Secret, &events, &hook.CreatedAt); err != nil {
+			return nil, logError(ctx, "Failed get webhooks", err)
+		}
+		hook.Events = strings.Split(events, ",")
+		hooks = append(hooks, hook)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, logError(ctx, "Failed get webhooks", err)
+	}
+
+	return hooks, nil
+}
+
+// DeleteWebhook deletes webhook of user. Its deliveries are kept.
+func (s *DBStorage) DeleteWebhook(ctx context.Context, userID string, id int64) error {
+	query := "DELETE FROM webhooks WHERE id = $1 AND cookie = $2"
+	ctx, span := startSpan(ctx, "DeleteWebhook", query)
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	result, err := s.DB.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return logError(ctx, "Failed delete webhook", err)
+	}
+
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return logError(ctx, "Failed delete webhook", err)
+	}
+
+	if deleted == 0 {
+		return Err404
+	}
+	return nil
+}
+
+// deliveryColumns are columns of delivery in order of scanDelivery.
+const deliveryColumns = "id, webhook_id, cookie, event, payload, status, attempts, response_code, last_error, next_attempt, created_at, updated_at"
+
+// AddDelivery adds delivery.
+func (s *DBStorage) AddDelivery(ctx context.Context, d Delivery) (Delivery, error) {
+	query := "INSERT INTO webhook_deliveries (webhook_id, cookie, event, payload, status, attempts, response_code, last_error, " +
+		"next_attempt, created_at, updated_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11) RETURNING id"
+	ctx, span := startSpan(ctx, "AddDelivery", query)
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	err := s.DB.QueryRowContext(ctx, query, d.WebhookID, d.UserID, d.Event, string(d.Payload), d.Status, d.Attempts,
+		d.ResponseCode, d.LastError, d.NextAttempt, d.CreatedAt, d.UpdatedAt).Scan(&d.ID)
+	if err != nil {
+		return Delivery{}, logError(ctx, "Failed add delivery", err)
+	}
+
+	return d, nil
+}
+
+// GetDelivery gets delivery.
+func (s *DBStorage) GetDelivery(ctx context.Context, id int64) (Delivery, error) {
+	query := "SELECT " + deliveryColumns + " FROM webhook_deliveries WHERE id = $1"
+	deliveries, err := s.getDeliveries(ctx, "GetDelivery", query, id)
+	if err != nil {
+		return Delivery{}, err
+	}
+
+	if len(deliveries) == 0 {
+		return Delivery{}, Err404
+	}
+
+	return deliveries[0], nil
+}
+
+// UpdateDelivery saves status and attempts of delivery.
+func (s *DBStorage) UpdateDelivery(ctx context.Context, d Delivery) error {
+	query := "UPDATE webhook_deliveries SET status = $1, attempts = $2, response_code = $3, last_error = $4, " +
+		"next_attempt = $5, updated_at = $6 WHERE id = $7"
+	ctx, span := startSpan(ctx, "UpdateDelivery", query)
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	result, err := s.DB.ExecContext(ctx, query, d.Status, d.Attempts, d.ResponseCode, d.LastError, d.NextAttempt, d.UpdatedAt, d.ID)
+	if err != nil {
+		return logError(ctx, "Failed update delivery", err)
+	}
+
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return logError(ctx, "Failed update delivery", err)
+	}
+
+	if updated == 0 {
+		return Err404
+	}
+	return nil
+}
+
+// GetDeliveries gets deliveries of user from the newest.
+func (s *DBStorage) GetDeliveries(ctx context.Context, userID, status string, limit int) ([]Delivery, error) {
+	query := "SELECT " + deliveryColumns + " FROM webhook_deliveries WHERE cookie = $1 AND ($2 = '' OR status = $2) " +
+		"ORDER BY id DESC LIMIT $3"
+	return s.getDeliveries(ctx, "GetDeliveries", query, userID, status, limit)
+}
+
+// GetDueDeliveries gets pending deliveries, which should be sent at now, from the oldest.
+func (s *DBStorage) GetDueDeliveries(ctx context.Context, now time.Time, limit int) ([]Delivery, error) {
+	query := "SELECT " + deliveryColumns + " FROM webhook_deliveries WHERE status = $1 AND next_attempt <= $2 " +
+		"ORDER BY next_attempt LIMIT $3"
+	return s.getDeliveries(ctx, "GetDueDeliveries", query, DeliveryPending, now, limit)
+}
+
+// getDeliveries gets deliveries by query.
+func (s *DBStorage) getDeliveries(ctx context.Context, operation, query string, args ...interface{}) ([]Delivery, error) {
+	ctx, span := startSpan(ctx, operation, query)
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	rows, err := s.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, logError(ctx, "Failed get deliveries", err)
+	}
+	defer rows.Close()
+
+	deliveries := make([]Delivery, 0)
+	for rows.Next() {
+		var d Delivery
+		var payload string
+		err := rows.Scan(&d.ID, &d.WebhookID, &d.UserID, &d.Event, &payload, &d.Status, &d.Attempts, &d.ResponseCode,
+			&d.LastError, &d.NextAttempt, &d.CreatedAt, &d.UpdatedAt)
+		if err != nil {
+			return nil, logError(ctx, "Failed get deliveries", err)
+		}
+		d.Payload = json.RawMessage(payload)
+		deliveries = append(deliveries, d)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, logError(ctx, "Failed get deliveries", err)
+	}
+
+	return deliveries, nil
+}
@@ -1,8 +1,13 @@
 package storage
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"os"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/size12/url-shortener/internal/config"
@@ -64,7 +69,7 @@ func TestDBStorage(t *testing.T) {
 
 	mock.ExpectCommit()
 
-	result, err := s.CreateShort("user12", "https://yandex.ru", "https://google.com")
+	result, err := s.CreateShort(context.Background(), "user12", "https://yandex.ru", "https://google.com")
 	assert.NoError(t, err)
 	assert.Equal(t, []string{"1", "2"}, result)
 
@@ -80,7 +85,7 @@ func TestDBStorage(t *testing.T) {
 
 	mock.ExpectCommit()
 
-	result, err = s.CreateShort("user12", "https://yandex.ru")
+	result, err = s.CreateShort(context.Background(), "user12", "https://yandex.ru")
 	assert.Equal(t, Err409, err)
 	assert.Equal(t, []string{"1"}, result)
 
@@ -97,7 +102,7 @@ func TestDBStorage(t *testing.T) {
 
 	mock.ExpectRollback()
 
-	_, err = s.CreateShort("user12", "https://yandex.ru")
+	_, err = s.CreateShort(context.Background(), "user12", "https://yandex.ru")
 	assert.Equal(t, ErrRow, err)
 
 	assert.NoError(t, mock.ExpectationsWereMet())
@@ -105,7 +110,7 @@ func TestDBStorage(t *testing.T) {
 	// ping DB (no error).
 
 	mock.ExpectPing()
-	err = s.Ping()
+	err = s.Ping(context.Background())
 	assert.NoError(t, err)
 	assert.NoError(t, mock.ExpectationsWereMet())
 
@@ -113,16 +118,29 @@ func TestDBStorage(t *testing.T) {
 
 	ErrPing := errors.New("failed ping DB")
 	mock.ExpectPing().WillReturnError(ErrPing)
-	err = s.Ping()
+	err = s.Ping(context.Background())
 	assert.Equal(t, ErrPing, err)
 	assert.NoError(t, mock.ExpectationsWereMet())
 
+	// check migrations.
+
+	mock.ExpectQuery("SELECT dirty FROM schema_migrations LIMIT 1").
+		WillReturnRows(sqlmock.NewRows([]string{"dirty"}).AddRow(false))
+	err = s.CheckMigrations(context.Background())
+	assert.NoError(t, err)
+
+	mock.ExpectQuery("SELECT dirty FROM schema_migrations LIMIT 1").
+		WillReturnRows(sqlmock.NewRows([]string{"dirty"}).AddRow(true))
+	err = s.CheckMigrations(context.Background())
+	assert.Equal(t, ErrDirtyMigration, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
 	// get long url.
 
 	mock.ExpectQuery("SELECT url, deleted FROM links WHERE id=$1 LIMIT 1").WithArgs("1").
 		WillReturnRows(sqlmock.NewRows([]string{"url", "deleted"}).AddRow("https://yandex.ru", false))
 
-	longURL, err := s.GetLong("1")
+	longURL, err := s.GetLong(context.Background(), "1")
 	assert.NoError(t, err)
 	assert.Equal(t, "https://yandex.ru", longURL)
 	assert.NoError(t, mock.ExpectationsWereMet())
@@ -132,7 +150,7 @@ func TestDBStorage(t *testing.T) {
 	mock.ExpectQuery("SELECT url, deleted FROM links WHERE id=$1 LIMIT 1").WithArgs("3").
 		WillReturnRows(sqlmock.NewRows([]string{"url", "deleted"}))
 
-	_, err = s.GetLong("3")
+	_, err = s.GetLong(context.Background(), "3")
 	assert.Equal(t, Err404, err)
 	assert.NoError(t, mock.ExpectationsWereMet())
 
@@ -141,7 +159,7 @@ func TestDBStorage(t *testing.T) {
 	mock.ExpectQuery("SELECT url, deleted FROM links WHERE id=$1 LIMIT 1").WithArgs("1").
 		WillReturnRows(sqlmock.NewRows([]string{"url", "deleted"}).AddRow("https://yandex.ru", false).RowError(0, ErrRow))
 
-	_, err = s.GetLong("1")
+	_, err = s.GetLong(context.Background(), "1")
 
 	assert.Equal(t, ErrRow, err)
 	assert.NoError(t, mock.ExpectationsWereMet())
@@ -151,16 +169,16 @@ func TestDBStorage(t *testing.T) {
 	mock.ExpectQuery("SELECT url, deleted FROM links WHERE id=$1 LIMIT 1").WithArgs("1").
 		WillReturnRows(sqlmock.NewRows([]string{"url", "deleted"}).AddRow("https://yandex.ru", true))
 
-	_, err = s.GetLong("1")
+	_, err = s.GetLong(context.Background(), "1")
 	assert.Equal(t, Err410, err)
 	assert.NoError(t, mock.ExpectationsWereMet())
 
 	// get urls history from exists user.
 
-	mock.ExpectQuery("SELECT id, url FROM links WHERE cookie=$1").WithArgs("user12").
+	mock.ExpectQuery("SELECT id, COALESCE(NULLIF(original_url, ''), url) FROM links WHERE cookie=$1").WithArgs("user12").
 		WillReturnRows(sqlmock.NewRows([]string{"id", "url"}).AddRow("1", "https://yandex.ru").AddRow("2", "https://google.com"))
 
-	history, err := s.GetHistory("user12")
+	history, err := s.GetHistory(context.Background(), "user12")
 
 	assert.NoError(t, err)
 
@@ -179,10 +197,10 @@ func TestDBStorage(t *testing.T) {
 
 	// get urls history from non-exists user.
 
-	mock.ExpectQuery("SELECT id, url FROM links WHERE cookie=$1").WithArgs("unknown").
+	mock.ExpectQuery("SELECT id, COALESCE(NULLIF(original_url, ''), url) FROM links WHERE cookie=$1").WithArgs("unknown").
 		WillReturnRows(sqlmock.NewRows([]string{"id", "url"}))
 
-	history, err = s.GetHistory("unknown")
+	history, err = s.GetHistory(context.Background(), "unknown")
 
 	assert.NoError(t, err)
 	assert.Equal(t, history, []LinkJSON(nil))
@@ -190,10 +208,10 @@ func TestDBStorage(t *testing.T) {
 
 	// get urls history with error.
 
-	mock.ExpectQuery("SELECT id, url FROM links WHERE cookie=$1").WithArgs("user12").
+	mock.ExpectQuery("SELECT id, COALESCE(NULLIF(original_url, ''), url) FROM links WHERE cookie=$1").WithArgs("user12").
 		WillReturnRows(sqlmock.NewRows([]string{"id", "url"}).AddRow("1", "https://yandex.ru").RowError(0, ErrRow))
 
-	history, err = s.GetHistory("user12")
+	history, err = s.GetHistory(context.Background(), "user12")
 
 	assert.Equal(t, ErrRow, err)
 	assert.Equal(t, history, []LinkJSON(nil))
@@ -207,7 +225,7 @@ func TestDBStorage(t *testing.T) {
 
 	mock.ExpectCommit()
 
-	err = s.Delete("user12", "1")
+	err = s.Delete(context.Background(), "user12", "1")
 	assert.NoError(t, err)
 	assert.NoError(t, mock.ExpectationsWereMet())
 
@@ -219,7 +237,7 @@ func TestDBStorage(t *testing.T) {
 
 	mock.ExpectCommit()
 
-	err = s.Delete("unknown", "1")
+	err = s.Delete(context.Background(), "unknown", "1")
 	assert.NoError(t, err)
 	assert.NoError(t, mock.ExpectationsWereMet())
 
@@ -231,14 +249,14 @@ func TestDBStorage(t *testing.T) {
 
 	mock.ExpectRollback()
 
-	err = s.Delete("unknown", "1")
+	err = s.Delete(context.Background(), "unknown", "1")
 	assert.Equal(t, ErrRow, err)
 	assert.NoError(t, mock.ExpectationsWereMet())
 
 	// get statistic.
 	mock.ExpectQuery("SELECT COUNT(DISTINCT cookie) FROM links;").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(20))
 
-	stat, err := s.GetStatistic()
+	stat, err := s.GetStatistic(context.Background())
 	assert.NoError(t, err)
 	assert.Equal(t, Statistic{
 		Urls:  s.LastID,
@@ -247,4 +265,173 @@ func TestDBStorage(t *testing.T) {
 
 	assert.NoError(t, mock.ExpectationsWereMet())
 
+	// get link.
+	created := time.Date(2023, 3, 12, 10, 0, 0, 0, time.UTC)
+	mock.ExpectQuery("SELECT url, cookie, deleted, created_at, options, original_url FROM links WHERE id=$1 LIMIT 1").WithArgs("1").
+		WillReturnRows(sqlmock.NewRows([]string{"url", "cookie", "deleted", "created_at", "options", "original_url"}).
+			AddRow("https://yandex.ru", "user12", false, created, []byte(`{"redirect_code":308}`), "HTTPS://Yandex.ru/"))
+
+	link, err := s.GetLink(context.Background(), "1")
+	assert.NoError(t, err)
+	assert.Equal(t, Link{
+		ID:          "1",
+		URL:         "https://yandex.ru",
+		UserID:      "user12",
+		CreatedAt:   created,
+		Options:     LinkOptions{RedirectCode: 308},
+		OriginalURL: "HTTPS://Yandex.ru/",
+	}, link)
+
+	mock.ExpectQuery("SELECT url, cookie, deleted, created_at, options, original_url FROM links WHERE id=$1 LIMIT 1").WithArgs("1").
+		WillReturnRows(sqlmock.NewRows([]string{"url", "cookie", "deleted", "created_at", "options", "original_url"}).
+			AddRow("https://yandex.ru", "user12", true, created, []byte(`{}`), ""))
+
+	link, err = s.GetLink(context.Background(), "1")
+	assert.Equal(t, Err410, err)
+	assert.True(t, link.Deleted)
+
+	mock.ExpectQuery("SELECT url, cookie, deleted, created_at, options, original_url FROM links WHERE id=$1 LIMIT 1").WithArgs("2").
+		WillReturnRows(sqlmock.NewRows([]string{"url", "cookie", "deleted", "created_at", "options", "original_url"}))
+
+	_, err = s.GetLink(context.Background(), "2")
+	assert.Equal(t, Err404, err)
+
+	// set link options.
+	mock.ExpectExec("UPDATE links SET options = $1 WHERE id = $2").
+		WithArgs([]byte(`{"redirect_code":301}`), "1").WillReturnResult(sqlmock.NewResult(0, 1))
+	err = s.SetLinkOptions(context.Background(), "1", LinkOptions{RedirectCode: 301})
+	assert.NoError(t, err)
+
+	mock.ExpectExec("UPDATE links SET options = $1 WHERE id = $2").
+		WithArgs([]byte(`{"redirect_code":301}`), "2").WillReturnResult(sqlmock.NewResult(0, 0))
+	err = s.SetLinkOptions(context.Background(), "2", LinkOptions{RedirectCode: 301})
+	assert.Equal(t, Err404, err)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	// set original url.
+	mock.ExpectExec("UPDATE links SET original_url = $1 WHERE id = $2").
+		WithArgs("HTTPS://Yandex.ru/", "1").WillReturnResult(sqlmock.NewResult(0, 1))
+	err = s.SetOriginalURL(context.Background(), "1", "HTTPS://Yandex.ru/")
+	assert.NoError(t, err)
+
+	mock.ExpectExec("UPDATE links SET original_url = $1 WHERE id = $2").
+		WithArgs("HTTPS://Yandex.ru/", "2").WillReturnResult(sqlmock.NewResult(0, 0))
+	err = s.SetOriginalURL(context.Background(), "2", "HTTPS://Yandex.ru/")
+	assert.Equal(t, Err404, err)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	// UTM presets.
+	mock.ExpectExec("INSERT INTO utm_presets (cookie, name, utm) VALUES ($1, $2, $3) ON CONFLICT (cookie, name) DO UPDATE SET utm = EXCLUDED.utm").
+		WithArgs("user12", "newsletter", []byte(`{"source":"newsletter"}`)).WillReturnResult(sqlmock.NewResult(0, 1))
+	err = s.SetUTMPreset(context.Background(), "user12", "newsletter", UTM{Source: "newsletter"})
+	assert.NoError(t, err)
+
+	mock.ExpectQuery("SELECT utm FROM utm_presets WHERE cookie = $1 AND name = $2").WithArgs("user12", "newsletter").
+		WillReturnRows(sqlmock.NewRows([]string{"utm"}).AddRow([]byte(`{"source":"newsletter"}`)))
+	utm, err := s.GetUTMPreset(context.Background(), "user12", "newsletter")
+	assert.NoError(t, err)
+	assert.Equal(t, UTM{Source: "newsletter"}, utm)
+
+	mock.ExpectQuery("SELECT utm FROM utm_presets WHERE cookie = $1 AND name = $2").WithArgs("user12", "unknown").
+		WillReturnRows(sqlmock.NewRows([]string{"utm"}))
+	_, err = s.GetUTMPreset(context.Background(), "user12", "unknown")
+	assert.Equal(t, Err404, err)
+
+	mock.ExpectQuery("SELECT name, utm FROM utm_presets WHERE cookie = $1").WithArgs("user12").
+		WillReturnRows(sqlmock.NewRows([]string{"name", "utm"}).AddRow("newsletter", []byte(`{"source":"newsletter"}`)))
+	presets, err := s.GetUTMPresets(context.Background(), "user12")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]UTM{"newsletter": {Source: "newsletter"}}, presets)
+
+	mock.ExpectExec("DELETE FROM utm_presets WHERE cookie = $1 AND name = $2").WithArgs("user12", "newsletter").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	assert.NoError(t, s.DeleteUTMPreset(context.Background(), "user12", "newsletter"))
+
+	mock.ExpectExec("DELETE FROM utm_presets WHERE cookie = $1 AND name = $2").WithArgs("user12", "newsletter").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	assert.Equal(t, Err404, s.DeleteUTMPreset(context.Background(), "user12", "newsletter"))
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	// takedowns.
+	takedown := Takedown{Kind: TakedownLink, Target: "1", Reason: "court order", Code: 451, Actor: "legal", CreatedAt: created}
+
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO takedowns (kind, target, reason, code, actor, created_at) VALUES ($1, $2, $3, $4, $5, $6) "+
+		"ON CONFLICT (kind, target) DO UPDATE SET reason = EXCLUDED.reason, code = EXCLUDED.code, actor = EXCLUDED.actor, created_at = EXCLUDED.created_at").
+		WithArgs("link", "1", "court order", 451, "legal", created).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(insertAudit).
+		WithArgs("takedown", "link", "1", "court order", 451, "legal", created).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+	assert.NoError(t, s.AddTakedown(context.Background(), takedown))
+
+	mock.ExpectQuery("SELECT reason, code, actor, created_at FROM takedowns WHERE kind = $1 AND target = $2").WithArgs("link", "1").
+		WillReturnRows(sqlmock.NewRows([]string{"reason", "code", "actor", "created_at"}).AddRow("court order", 451, "legal", created))
+	got, err := s.GetTakedown(context.Background(), TakedownLink, "1")
+	assert.NoError(t, err)
+	assert.Equal(t, takedown, got)
+
+	mock.ExpectQuery("SELECT reason, code, actor, created_at FROM takedowns WHERE kind = $1 AND target = $2").WithArgs("link", "2").
+		WillReturnRows(sqlmock.NewRows([]string{"reason", "code", "actor", "created_at"}))
+	_, err = s.GetTakedown(context.Background(), TakedownLink, "2")
+	assert.Equal(t, Err404, err)
+
+	mock.ExpectQuery("SELECT kind, target, reason, code, actor, created_at FROM takedowns ORDER BY created_at").
+		WillReturnRows(sqlmock.NewRows([]string{"kind", "target", "reason", "code", "actor", "created_at"}).
+			AddRow("link", "1", "court order", 451, "legal", created))
+	takedowns, err := s.GetTakedowns(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []Takedown{takedown}, takedowns)
+
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE FROM takedowns WHERE kind = $1 AND target = $2").WithArgs("link", "1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(insertAudit).
+		WithArgs("restore", "link", "1", "court order", 451, "legal", created).WillReturnResult(sqlmock.NewResult(2, 1))
+	mock.ExpectCommit()
+	assert.NoError(t, s.RemoveTakedown(context.Background(), takedown))
+
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE FROM takedowns WHERE kind = $1 AND target = $2").WithArgs("link", "1").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+	assert.Equal(t, Err404, s.RemoveTakedown(context.Background(), takedown))
+
+	mock.ExpectQuery("SELECT action, kind, target, reason, code, actor, created_at FROM takedown_audit ORDER BY id").
+		WillReturnRows(sqlmock.NewRows([]string{"action", "kind", "target", "reason", "code", "actor", "created_at"}).
+			AddRow("takedown", "link", "1", "court order", 451, "legal", created).
+			AddRow("restore", "link", "1", "court order", 451, "legal", created))
+	audit, err := s.GetAudit(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []AuditEntry{{Action: AuditTakedown, Takedown: takedown}, {Action: AuditRestore, Takedown: takedown}}, audit)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestDBStorage_LongURL needs real DB, it's skipped, if DATABASE_DSN isn't set.
+func TestDBStorage_LongURL(t *testing.T) {
+	cfg := config.GetTestConfig()
+	cfg.BasePath = os.Getenv("DATABASE_DSN")
+	cfg.DBMigrationPath = "file://../../migrations"
+	if cfg.BasePath == "" {
+		t.Skip("DATABASE_DSN is empty")
+	}
+
+	s, err := NewDBStorage(cfg)
+	assert.NoError(t, err)
+	defer s.DB.Close()
+
+	// urls longer than 255 characters fit into links table.
+	long := fmt.Sprintf("https://yandex.ru/%d/", time.Now().UnixNano())
+	long += strings.Repeat("a", 300-len(long))
+
+	result, err := s.CreateShort(context.Background(), "user12", long)
+	assert.NoError(t, err)
+	assert.Len(t, result, 1)
+
+	got, err := s.GetLong(context.Background(), result[0])
+	assert.NoError(t, err)
+	assert.Equal(t, long, got)
 }
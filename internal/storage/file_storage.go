@@ -2,37 +2,56 @@ package storage
 
 import (
 	"bufio"
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"os"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/size12/url-shortener/internal/config"
 )
 
+// MetaSuffix is suffix of file, which stores owners, creation time and options of links in file storage.
+const MetaSuffix = ".meta"
+
 // FileStorage struct of file storage, implements storage.Storage.
 type FileStorage struct {
 	Cfg    config.Config
 	File   *os.File
 	LastID int
+	// MetaFile stores metadata of links as JSON lines. The last line of link wins.
+	MetaFile *os.File
+	Meta     map[string]Link
 	*sync.Mutex
 }
 
+// linkMeta is line of meta file.
+type linkMeta struct {
+	ID        string      `json:"id"`
+	UserID    string      `json:"user_id,omitempty"`
+	CreatedAt time.Time   `json:"created_at"`
+	Options   LinkOptions `json:"options"`
+	// OriginalURL is url as it was sent by owner, if it differs from stored one.
+	OriginalURL string `json:"original_url,omitempty"`
+}
+
 // GetConfig gets config.
 func (s *FileStorage) GetConfig() config.Config {
 	return s.Cfg
 }
 
 // Ping does nothing.
-func (s *FileStorage) Ping() error {
+func (s *FileStorage) Ping(ctx context.Context) error {
 	return nil
 }
 
 // NewFileStorage creates new file storage.
 func NewFileStorage(cfg config.Config) (*FileStorage, error) {
-	s := &FileStorage{Cfg: cfg, Mutex: &sync.Mutex{}}
+	s := &FileStorage{Cfg: cfg, Meta: make(map[string]Link), Mutex: &sync.Mutex{}}
 
 	if cfg.StoragePath == "" {
 		return s, errors.New("empty file path")
@@ -57,11 +76,48 @@ func NewFileStorage(cfg config.Config) (*FileStorage, error) {
 
 	s.LastID = id
 
+	metaFile, err := os.OpenFile(cfg.StoragePath+MetaSuffix, os.O_RDWR|os.O_APPEND|os.O_CREATE|os.O_SYNC, 0777)
+	if err != nil {
+		return s, err
+	}
+
+	s.MetaFile = metaFile
+
+	metaScanner := bufio.NewScanner(metaFile)
+	for metaScanner.Scan() {
+		var meta linkMeta
+		if err := json.Unmarshal(metaScanner.Bytes(), &meta); err != nil {
+			return s, err
+		}
+		s.Meta[meta.ID] = Link{UserID: meta.UserID, CreatedAt: meta.CreatedAt, Options: meta.Options, OriginalURL: meta.OriginalURL}
+	}
+
+	if err := metaScanner.Err(); err != nil {
+		return s, err
+	}
+
 	return s, nil
 }
 
+// writeMeta saves metadata of links to meta file.
+func (s *FileStorage) writeMeta(ids ...string) error {
+	var builder strings.Builder
+	encoder := json.NewEncoder(&builder)
+
+	for _, id := range ids {
+		link := s.Meta[id]
+		err := encoder.Encode(linkMeta{ID: id, UserID: link.UserID, CreatedAt: link.CreatedAt, Options: link.Options, OriginalURL: link.OriginalURL})
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err := s.MetaFile.WriteString(builder.String())
+	return err
+}
+
 // CreateShort creates short url from long.
-func (s *FileStorage) CreateShort(userID string, urls ...string) ([]string, error) {
+func (s *FileStorage) CreateShort(ctx context.Context, userID string, urls ...string) ([]string, error) {
 	s.Lock()
 	defer s.Unlock()
 
@@ -71,27 +127,32 @@ func (s *FileStorage) CreateShort(userID string, urls ...string) ([]string, erro
 
 	var builder strings.Builder
 
+	now := time.Now()
+
 	for _, long := range urls {
 		builder.WriteString(long)
 		builder.WriteRune('\n')
 		s.LastID++
-		result = append(result, fmt.Sprint(s.LastID))
+		id := fmt.Sprint(s.LastID)
+		result = append(result, id)
+		s.Meta[id] = Link{UserID: userID, CreatedAt: now}
 	}
 
 	_, err := s.File.Write([]byte(builder.String()))
 	if err != nil {
 		return nil, err
 	}
-	//err = s.File.Sync()
-	//if err != nil {
-	//	return nil, err
-	//}
+
+	err = s.writeMeta(result...)
+	if err != nil {
+		return nil, err
+	}
 
 	return result, nil
 }
 
 // GetLong gets long url from short.
-func (s *FileStorage) GetLong(id string) (string, error) {
+func (s *FileStorage) GetLong(ctx context.Context, id string) (string, error) {
 	s.Lock()
 	defer s.Unlock()
 
@@ -111,16 +172,19 @@ func (s *FileStorage) GetLong(id string) (string, error) {
 }
 
 // Delete does nothing.
-func (s *FileStorage) Delete(userID string, ids ...string) error {
+func (s *FileStorage) Delete(ctx context.Context, userID string, ids ...string) error {
 	// do nothing for file storage.
 	return nil
 }
 
 // GetHistory gets history of urls.
-func (s *FileStorage) GetHistory(userID string) ([]LinkJSON, error) {
+func (s *FileStorage) GetHistory(ctx context.Context, userID string) ([]LinkJSON, error) {
 	// return all links.
 	var history []LinkJSON
 
+	s.Lock()
+	defer s.Unlock()
+
 	_, err := s.File.Seek(0, io.SeekStart)
 	if err != nil {
 		return history, err
@@ -131,6 +195,9 @@ func (s *FileStorage) GetHistory(userID string) ([]LinkJSON, error) {
 	for scanner.Scan() {
 		id++
 		long := scanner.Text()
+		if original := s.Meta[fmt.Sprint(id)].OriginalURL; original != "" {
+			long = original
+		}
 		history = append(history, LinkJSON{ShortURL: s.Cfg.BaseURL + "/" + fmt.Sprint(id), LongURL: long})
 	}
 
@@ -142,9 +209,55 @@ func (s *FileStorage) GetHistory(userID string) ([]LinkJSON, error) {
 }
 
 // GetStatistic gets total count of users and urls.
-func (s *FileStorage) GetStatistic() (Statistic, error) {
+func (s *FileStorage) GetStatistic(ctx context.Context) (Statistic, error) {
 	return Statistic{
 		Urls:  s.LastID,
 		Users: 0,
 	}, nil
 }
+
+// GetLink gets link with its metadata.
+func (s *FileStorage) GetLink(ctx context.Context, id string) (Link, error) {
+	long, err := s.GetLong(ctx, id)
+	if err != nil {
+		return Link{}, err
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	link := s.Meta[id]
+	link.ID = id
+	link.URL = long
+	return link, nil
+}
+
+// SetLinkOptions sets options of link.
+func (s *FileStorage) SetLinkOptions(ctx context.Context, id string, opts LinkOptions) error {
+	if _, err := s.GetLong(ctx, id); err != nil {
+		return err
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	link := s.Meta[id]
+	link.Options = opts
+	s.Meta[id] = link
+	return s.writeMeta(id)
+}
+
+// SetOriginalURL sets url of link as it was sent by owner.
+func (s *FileStorage) SetOriginalURL(ctx context.Context, id, original string) error {
+	if _, err := s.GetLong(ctx, id); err != nil {
+		return err
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	link := s.Meta[id]
+	link.OriginalURL = original
+	s.Meta[id] = link
+	return s.writeMeta(id)
+}
@@ -1,6 +1,7 @@
 package storage
 
 import (
+	"context"
 	"errors"
 	"io"
 	"os"
@@ -18,6 +19,8 @@ func TestNewFileStorage(t *testing.T) {
 
 	err = os.RemoveAll(cfg.StoragePath)
 	assert.NoError(t, err)
+	err = os.RemoveAll(cfg.StoragePath + MetaSuffix)
+	assert.NoError(t, err)
 
 	// new file storage with empty file name
 	cfg = config.GetTestConfig()
@@ -33,15 +36,19 @@ func TestFileStorage_GetConfig(t *testing.T) {
 	assert.Equal(t, cfg, s.GetConfig())
 	err = os.RemoveAll(cfg.StoragePath)
 	assert.NoError(t, err)
+	err = os.RemoveAll(cfg.StoragePath + MetaSuffix)
+	assert.NoError(t, err)
 }
 
 func TestFileStorage_Ping(t *testing.T) {
 	cfg := config.GetTestConfig()
 	s, err := NewFileStorage(cfg)
 	assert.NoError(t, err)
-	assert.NoError(t, s.Ping())
+	assert.NoError(t, s.Ping(context.Background()))
 	err = os.RemoveAll(cfg.StoragePath)
 	assert.NoError(t, err)
+	err = os.RemoveAll(cfg.StoragePath + MetaSuffix)
+	assert.NoError(t, err)
 }
 
 func TestFileStorage_CreateShort(t *testing.T) {
@@ -78,7 +85,7 @@ func TestFileStorage_CreateShort(t *testing.T) {
 		assert.NoError(t, err)
 
 		var res []string
-		res, err = s.CreateShort("user12", test.urls...)
+		res, err = s.CreateShort(context.Background(), "user12", test.urls...)
 		assert.Equal(t, test.err, err, test.name)
 		assert.Equal(t, test.want, res, test.name)
 		_, err = s.File.Seek(0, io.SeekStart)
@@ -92,9 +99,11 @@ func TestFileStorage_CreateShort(t *testing.T) {
 		}
 	}
 
-	assert.NoError(t, s.Ping())
+	assert.NoError(t, s.Ping(context.Background()))
 	err = os.RemoveAll(cfg.StoragePath)
 	assert.NoError(t, err)
+	err = os.RemoveAll(cfg.StoragePath + MetaSuffix)
+	assert.NoError(t, err)
 }
 
 func TestFileStorage_GetLong(t *testing.T) {
@@ -130,18 +139,20 @@ func TestFileStorage_GetLong(t *testing.T) {
 		s, err = NewFileStorage(cfg)
 		assert.NoError(t, err)
 
-		_, err = s.CreateShort("user12", test.urls...)
+		_, err = s.CreateShort(context.Background(), "user12", test.urls...)
 		assert.NoError(t, err)
 
 		var longURL string
-		longURL, err = s.GetLong(test.id)
+		longURL, err = s.GetLong(context.Background(), test.id)
 		assert.Equal(t, test.err, err)
 		assert.Equal(t, test.want, longURL)
 	}
 
-	assert.NoError(t, s.Ping())
+	assert.NoError(t, s.Ping(context.Background()))
 	err = os.RemoveAll(cfg.StoragePath)
 	assert.NoError(t, err)
+	err = os.RemoveAll(cfg.StoragePath + MetaSuffix)
+	assert.NoError(t, err)
 }
 
 func TestFileStorage_Delete(t *testing.T) {
@@ -151,11 +162,13 @@ func TestFileStorage_Delete(t *testing.T) {
 	s, err := NewFileStorage(cfg)
 	assert.NoError(t, err)
 
-	err = s.Delete("user12", "1234") // do nothing.
+	err = s.Delete(context.Background(), "user12", "1234") // do nothing.
 	assert.NoError(t, err)
 
 	err = os.RemoveAll(cfg.StoragePath)
 	assert.NoError(t, err)
+	err = os.RemoveAll(cfg.StoragePath + MetaSuffix)
+	assert.NoError(t, err)
 }
 
 func TestFileStorage_GetHistory(t *testing.T) {
@@ -166,16 +179,16 @@ func TestFileStorage_GetHistory(t *testing.T) {
 
 	// get history from empty file.
 
-	history, err := s.GetHistory("user12")
+	history, err := s.GetHistory(context.Background(), "user12")
 
 	assert.NoError(t, err)
 	assert.Empty(t, history)
 
 	// get history from non-empty file.
-	_, err = s.CreateShort("user12", "https://yandex.ru", "https://google.com", "https://youtube.com")
+	_, err = s.CreateShort(context.Background(), "user12", "https://yandex.ru", "https://google.com", "https://youtube.com")
 	assert.NoError(t, err)
 
-	history, err = s.GetHistory("user12")
+	history, err = s.GetHistory(context.Background(), "user12")
 	assert.NoError(t, err)
 
 	assert.Equal(t, []LinkJSON{
@@ -195,6 +208,8 @@ func TestFileStorage_GetHistory(t *testing.T) {
 
 	err = os.RemoveAll(cfg.StoragePath)
 	assert.NoError(t, err)
+	err = os.RemoveAll(cfg.StoragePath + MetaSuffix)
+	assert.NoError(t, err)
 }
 
 func TestFileStorage_GetStatistic(t *testing.T) {
@@ -203,7 +218,7 @@ func TestFileStorage_GetStatistic(t *testing.T) {
 	s, err := NewFileStorage(cfg)
 	assert.NoError(t, err)
 
-	stat, err := s.GetStatistic()
+	stat, err := s.GetStatistic(context.Background())
 	assert.NoError(t, err)
 	assert.Equal(t, Statistic{
 		Urls:  0,
@@ -211,9 +226,9 @@ func TestFileStorage_GetStatistic(t *testing.T) {
 	}, stat)
 
 	// add url and get statistic again.
-	_, err = s.CreateShort("user12", "https:/yandex.ru")
+	_, err = s.CreateShort(context.Background(), "user12", "https:/yandex.ru")
 	assert.NoError(t, err)
-	stat, err = s.GetStatistic()
+	stat, err = s.GetStatistic(context.Background())
 	assert.NoError(t, err)
 	assert.Equal(t, Statistic{
 		Urls:  1,
@@ -221,4 +236,46 @@ func TestFileStorage_GetStatistic(t *testing.T) {
 	}, stat)
 	err = os.RemoveAll(cfg.StoragePath)
 	assert.NoError(t, err)
+	err = os.RemoveAll(cfg.StoragePath + MetaSuffix)
+	assert.NoError(t, err)
+}
+
+func TestFileStorage_LinkOptions(t *testing.T) {
+	cfg := config.GetTestConfig()
+	cfg.StoragePath = t.TempDir() + "/links.txt"
+
+	s, err := NewFileStorage(cfg)
+	assert.NoError(t, err)
+
+	_, err = s.CreateShort(context.Background(), "user12", "https://yandex.ru", "https://google.com")
+	assert.NoError(t, err)
+
+	opts := LinkOptions{RedirectCode: 301}
+	assert.NoError(t, s.SetLinkOptions(context.Background(), "2", opts))
+	assert.Equal(t, Err404, s.SetLinkOptions(context.Background(), "3", opts))
+	assert.NoError(t, s.SetOriginalURL(context.Background(), "2", "https://Google.com:443/"))
+
+	// metadata is restored from meta file.
+	s, err = NewFileStorage(cfg)
+	assert.NoError(t, err)
+
+	link, err := s.GetLink(context.Background(), "2")
+	assert.NoError(t, err)
+	assert.Equal(t, "https://google.com", link.URL)
+	assert.Equal(t, "user12", link.UserID)
+	assert.Equal(t, opts, link.Options)
+	assert.Equal(t, "https://Google.com:443/", link.OriginalURL)
+	assert.False(t, link.CreatedAt.IsZero())
+
+	history, err := s.GetHistory(context.Background(), "user12")
+	assert.NoError(t, err)
+	assert.Equal(t, "https://yandex.ru", history[0].LongURL)
+	assert.Equal(t, "https://Google.com:443/", history[1].LongURL)
+
+	link, err = s.GetLink(context.Background(), "1")
+	assert.NoError(t, err)
+	assert.Equal(t, LinkOptions{}, link.Options)
+
+	_, err = s.GetLink(context.Background(), "3")
+	assert.Equal(t, Err404, err)
 }
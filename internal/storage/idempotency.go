@@ -0,0 +1,143 @@
+package storage
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+)
+
+// IdempotencySuffix is suffix of file, which stores responses of idempotent requests of file storage.
+const IdempotencySuffix = ".idempotency"
+
+// IdempotentResponse is response of request with idempotency key, which is replayed to retries of request.
+// Fingerprint identifies request, so the same key can't be used for other request.
+type IdempotentResponse struct {
+	UserID      string    `json:"user_id"`
+	Key         string    `json:"key"`
+	Fingerprint string    `json:"fingerprint"`
+	Status      int       `json:"status"`
+	ContentType string    `json:"content_type,omitempty"`
+	Location    string    `json:"location,omitempty"`
+	Body        []byte    `json:"body,omitempty"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
+// IsExpired checks if response is expired at time now.
+func (resp IdempotentResponse) IsExpired(now time.Time) bool {
+	return !now.Before(resp.ExpiresAt)
+}
+
+// IdempotencyStorage stores responses of requests with idempotency keys.
+type IdempotencyStorage interface {
+	// GetResponse gets response of user's key, which isn't expired at now. It returns Err404, if there is no such response.
+	GetResponse(ctx context.Context, userID, key string, now time.Time) (IdempotentResponse, error)
+	// SaveResponse saves response of user's key and removes responses, which are expired at now.
+	SaveResponse(ctx context.Context, resp IdempotentResponse, now time.Time) error
+}
+
+// NewIdempotencyStorage gets idempotency storage of links storage.
+// DB storage stores responses in table, file storage in file next to links file, other storages in memory.
+func NewIdempotencyStorage(s Storage) (IdempotencyStorage, error) {
+	if responses, ok := s.(IdempotencyStorage); ok {
+		return responses, nil
+	}
+
+	if file, ok := s.(*FileStorage); ok {
+		return NewFileIdempotency(file.Cfg.StoragePath+IdempotencySuffix, time.Now())
+	}
+
+	return NewMapIdempotency(), nil
+}
+
+// idempotencyKey is key of user's response in map.
+func idempotencyKey(userID, key string) string {
+	return userID + "\x00" + key
+}
+
+// MapIdempotency stores responses in map by user and key.
+// If File is set, every response is appended to it.
+type MapIdempotency struct {
+	Responses map[string]IdempotentResponse
+	File      *os.File
+	*sync.Mutex
+}
+
+// NewMapIdempotency creates new in-memory idempotency storage.
+func NewMapIdempotency() *MapIdempotency {
+	return &MapIdempotency{Responses: make(map[string]IdempotentResponse), Mutex: &sync.Mutex{}}
+}
+
+// NewFileIdempotency creates idempotency storage, which keeps responses as JSON lines in file.
+// Responses, which are expired at now, aren't loaded.
+func NewFileIdempotency(path string, now time.Time) (*MapIdempotency, error) {
+	s := NewMapIdempotency()
+
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_APPEND|os.O_CREATE|os.O_SYNC, 0777)
+	if err != nil {
+		return nil, err
+	}
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 64<<20)
+	for scanner.Scan() {
+		var resp IdempotentResponse
+		if err := json.Unmarshal(scanner.Bytes(), &resp); err != nil {
+			file.Close()
+			return nil, err
+		}
+
+		if !resp.IsExpired(now) {
+			s.Responses[idempotencyKey(resp.UserID, resp.Key)] = resp
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	s.File = file
+	return s, nil
+}
+
+// GetResponse gets response of user's key.
+func (s *MapIdempotency) GetResponse(ctx context.Context, userID, key string, now time.Time) (IdempotentResponse, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	resp, ok := s.Responses[idempotencyKey(userID, key)]
+	if !ok || resp.IsExpired(now) {
+		return IdempotentResponse{}, Err404
+	}
+
+	return resp, nil
+}
+
+// SaveResponse saves response of user's key.
+func (s *MapIdempotency) SaveResponse(ctx context.Context, resp IdempotentResponse, now time.Time) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.File != nil {
+		data, err := json.Marshal(resp)
+		if err != nil {
+			return err
+		}
+
+		if _, err := s.File.Write(append(data, '\n')); err != nil {
+			return err
+		}
+	}
+
+	for key, stored := range s.Responses {
+		if stored.IsExpired(now) {
+			delete(s.Responses, key)
+		}
+	}
+
+	s.Responses[idempotencyKey(resp.UserID, resp.Key)] = resp
+	return nil
+}
@@ -0,0 +1,113 @@
+package storage
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/size12/url-shortener/internal/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileIdempotency(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "links.txt"+IdempotencySuffix)
+	ctx := context.Background()
+	now := time.Date(2023, 3, 12, 10, 0, 0, 0, time.UTC)
+
+	s, err := NewFileIdempotency(path, now)
+	assert.NoError(t, err)
+
+	_, err = s.GetResponse(ctx, "user12", "key", now)
+	assert.ErrorIs(t, err, Err404)
+
+	resp := IdempotentResponse{
+		UserID: "user12", Key: "key", Fingerprint: "abc", Status: 201,
+		ContentType: "application/json", Body: []byte(`{"result":"1"}`), ExpiresAt: now.Add(time.Hour),
+	}
+	assert.NoError(t, s.SaveResponse(ctx, resp, now))
+	assert.NoError(t, s.SaveResponse(ctx, IdempotentResponse{UserID: "user12", Key: "old", ExpiresAt: now.Add(time.Minute)}, now))
+
+	got, err := s.GetResponse(ctx, "user12", "key", now)
+	assert.NoError(t, err)
+	assert.Equal(t, resp, got)
+
+	// keys are per user.
+	_, err = s.GetResponse(ctx, "user13", "key", now)
+	assert.ErrorIs(t, err, Err404)
+
+	// responses are restored from file, expired ones are skipped.
+	later := now.Add(30 * time.Minute)
+	s, err = NewFileIdempotency(path, later)
+	assert.NoError(t, err)
+	assert.Len(t, s.Responses, 1)
+
+	got, err = s.GetResponse(ctx, "user12", "key", later)
+	assert.NoError(t, err)
+	assert.Equal(t, resp.Body, got.Body)
+
+	_, err = s.GetResponse(ctx, "user12", "key", now.Add(time.Hour))
+	assert.ErrorIs(t, err, Err404)
+}
+
+func TestNewIdempotencyStorage(t *testing.T) {
+	cfg := config.GetTestConfig()
+
+	s, err := NewMapStorage(cfg)
+	assert.NoError(t, err)
+	responses, err := NewIdempotencyStorage(s)
+	assert.NoError(t, err)
+	assert.IsType(t, &MapIdempotency{}, responses)
+
+	db, err := NewDBStorage(cfg)
+	assert.NoError(t, err)
+	responses, err = NewIdempotencyStorage(db)
+	assert.NoError(t, err)
+	assert.Equal(t, db, responses)
+}
+
+func TestDBStorage_Idempotency(t *testing.T) {
+	cfg := config.GetTestConfig()
+	s, err := NewDBStorage(cfg)
+	assert.NoError(t, err)
+
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	assert.NoError(t, err)
+	defer db.Close()
+	s.DB = db
+
+	ctx := context.Background()
+	now := time.Date(2023, 3, 12, 10, 0, 0, 0, time.UTC)
+	resp := IdempotentResponse{
+		UserID: "user12", Key: "key", Fingerprint: "abc", Status: 201,
+		ContentType: "text/plain; charset=utf-8", Body: []byte("http://127.0.0.1:8081/1"), ExpiresAt: now.Add(time.Hour),
+	}
+
+	mock.ExpectExec("DELETE FROM idempotency_keys WHERE expires_at <= $1").
+		WithArgs(now).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO idempotency_keys (cookie, idempotency_key, fingerprint, status, content_type, location, body, expires_at) "+
+		"VALUES ($1, $2, $3, $4, $5, $6, $7, $8) ON CONFLICT (cookie, idempotency_key) DO UPDATE SET "+
+		"fingerprint = EXCLUDED.fingerprint, status = EXCLUDED.status, content_type = EXCLUDED.content_type, "+
+		"location = EXCLUDED.location, body = EXCLUDED.body, expires_at = EXCLUDED.expires_at").
+		WithArgs("user12", "key", "abc", 201, resp.ContentType, "", resp.Body, resp.ExpiresAt).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	assert.NoError(t, s.SaveResponse(ctx, resp, now))
+
+	query := "SELECT fingerprint, status, content_type, location, body, expires_at FROM idempotency_keys " +
+		"WHERE cookie = $1 AND idempotency_key = $2 AND expires_at > $3"
+
+	mock.ExpectQuery(query).WithArgs("user12", "key", now).WillReturnRows(
+		sqlmock.NewRows([]string{"fingerprint", "status", "content_type", "location", "body", "expires_at"}).
+			AddRow("abc", 201, resp.ContentType, "", resp.Body, resp.ExpiresAt))
+	got, err := s.GetResponse(ctx, "user12", "key", now)
+	assert.NoError(t, err)
+	assert.Equal(t, resp, got)
+
+	mock.ExpectQuery(query).WithArgs("user12", "other", now).
+		WillReturnRows(sqlmock.NewRows([]string{"fingerprint", "status", "content_type", "location", "body", "expires_at"}))
+	_, err = s.GetResponse(ctx, "user12", "other", now)
+	assert.ErrorIs(t, err, Err404)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,263 @@
+package storage
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+)
+
+// JobSuffix is suffix of file, which stores bulk shortening jobs of file storage.
+const JobSuffix = ".jobs"
+
+// Statuses of bulk shortening job.
+const (
+	JobQueued  = "queued"
+	JobRunning = "running"
+	JobDone    = "done"
+	JobFailed  = "failed"
+)
+
+// fileJobItems is how many items of new job are written in one line of file.
+const fileJobItems = 1000
+
+// Job is bulk shortening job. Its items are shortened by workers in chunks, Processed items are done.
+type Job struct {
+	ID        int64     `json:"id"`
+	UserID    string    `json:"user_id"`
+	Status    string    `json:"status"`
+	Total     int       `json:"total"`
+	Processed int       `json:"processed"`
+	Failed    int       `json:"failed"`
+	Error     string    `json:"error,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// IsFinished checks if job won't be processed anymore.
+func (j Job) IsFinished() bool {
+	return j.Status == JobDone || j.Status == JobFailed
+}
+
+// JobItem is url of job. ShortURL or Error are set, when item is processed.
+type JobItem struct {
+	Position int `json:"position"`
+	BatchJSON
+	Error string `json:"error,omitempty"`
+}
+
+// JobStorage stores bulk shortening jobs and their items.
+type JobStorage interface {
+	// AddJob adds job with items and returns it with ID.
+	AddJob(ctx context.Context, job Job, items []BatchJSON) (Job, error)
+	// GetJob gets job. It returns Err404, if there is no such job.
+	GetJob(ctx context.Context, id int64) (Job, error)
+	// GetJobItems gets at most limit items of job from position offset.
+	GetJobItems(ctx context.Context, id int64, offset, limit int) ([]JobItem, error)
+	// UpdateJob saves progress of job and results of its processed items.
+	UpdateJob(ctx context.Context, job Job, items ...JobItem) error
+	// GetUnfinishedJobs gets queued and running jobs from the oldest.
+	GetUnfinishedJobs(ctx context.Context) ([]Job, error)
+}
+
+// NewJobStorage gets jobs storage of links storage.
+// DB storage stores jobs in tables, file storage in file next to links file, other storages in memory.
+func NewJobStorage(s Storage) (JobStorage, error) {
+	if jobs, ok := s.(JobStorage); ok {
+		return jobs, nil
+	}
+
+	if file, ok := s.(*FileStorage); ok {
+		return NewFileJobs(file.Cfg.StoragePath + JobSuffix)
+	}
+
+	return NewMapJobs(), nil
+}
+
+// jobRecord is line of jobs file: job and its new or changed items.
+type jobRecord struct {
+	Job   Job       `json:"job"`
+	Items []JobItem `json:"items,omitempty"`
+}
+
+// MapJobs stores jobs in slice, job ID is its index plus one.
+// If File is set, every new or changed job is appended to it.
+type MapJobs struct {
+	Jobs  []Job
+	Items map[int64][]JobItem
+	File  *os.File
+	*sync.Mutex
+}
+
+// NewMapJobs creates new in-memory jobs storage.
+func NewMapJobs() *MapJobs {
+	return &MapJobs{Items: make(map[int64][]JobItem), Mutex: &sync.Mutex{}}
+}
+
+// NewFileJobs creates jobs storage, which keeps jobs as JSON lines in file.
+// Changed job is appended again with its changed items, so the last line of job and item wins.
+func NewFileJobs(path string) (*MapJobs, error) {
+	s := NewMapJobs()
+
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_APPEND|os.O_CREATE|os.O_SYNC, 0777)
+	if err != nil {
+		return nil, err
+	}
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 64<<20)
+	for scanner.Scan() {
+		var record jobRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			file.Close()
+			return nil, err
+		}
+
+		job := record.Job
+		if job.ID <= 0 {
+			continue
+		}
+		if job.ID > int64(len(s.Jobs)) {
+			s.Jobs = append(s.Jobs, make([]Job, int(job.ID)-len(s.Jobs))...)
+		}
+		s.Jobs[job.ID-1] = job
+
+		items := s.Items[job.ID]
+		if len(items) < job.Total {
+			items = append(items, make([]JobItem, job.Total-len(items))...)
+		}
+		for _, item := range record.Items {
+			if item.Position >= 0 && item.Position < len(items) {
+				items[item.Position] = item
+			}
+		}
+		s.Items[job.ID] = items
+	}
+
+	if err := scanner.Err(); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	s.File = file
+	return s, nil
+}
+
+// save appends job and its items to file, if it's set.
+func (s *MapJobs) save(job Job, items []JobItem) error {
+	if s.File == nil {
+		return nil
+	}
+
+	data, err := json.Marshal(jobRecord{Job: job, Items: items})
+	if err != nil {
+		return err
+	}
+
+	_, err = s.File.Write(append(data, '\n'))
+	return err
+}
+
+// AddJob adds job with items.
+func (s *MapJobs) AddJob(ctx context.Context, job Job, items []BatchJSON) (Job, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	job.ID = int64(len(s.Jobs)) + 1
+	job.Total = len(items)
+
+	jobItems := make([]JobItem, len(items))
+	for i, item := range items {
+		item.ShortURL = ""
+		jobItems[i] = JobItem{Position: i, BatchJSON: item}
+	}
+
+	if len(jobItems) == 0 {
+		if err := s.save(job, nil); err != nil {
+			return Job{}, err
+		}
+	}
+	for start := 0; start < len(jobItems); start += fileJobItems {
+		end := start + fileJobItems
+		if end > len(jobItems) {
+			end = len(jobItems)
+		}
+		if err := s.save(job, jobItems[start:end]); err != nil {
+			return Job{}, err
+		}
+	}
+
+	s.Jobs = append(s.Jobs, job)
+	s.Items[job.ID] = jobItems
+	return job, nil
+}
+
+// GetJob gets job.
+func (s *MapJobs) GetJob(ctx context.Context, id int64) (Job, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	if id <= 0 || id > int64(len(s.Jobs)) || s.Jobs[id-1].ID == 0 {
+		return Job{}, Err404
+	}
+	return s.Jobs[id-1], nil
+}
+
+// GetJobItems gets items of job from position offset.
+func (s *MapJobs) GetJobItems(ctx context.Context, id int64, offset, limit int) ([]JobItem, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	items := s.Items[id]
+	if offset < 0 || offset >= len(items) {
+		return make([]JobItem, 0), nil
+	}
+
+	end := len(items)
+	if limit > 0 && offset+limit < end {
+		end = offset + limit
+	}
+
+	result := make([]JobItem, end-offset)
+	copy(result, items[offset:end])
+	return result, nil
+}
+
+// UpdateJob saves job and its items.
+func (s *MapJobs) UpdateJob(ctx context.Context, job Job, items ...JobItem) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if job.ID <= 0 || job.ID > int64(len(s.Jobs)) || s.Jobs[job.ID-1].ID == 0 {
+		return Err404
+	}
+
+	if err := s.save(job, items); err != nil {
+		return err
+	}
+
+	s.Jobs[job.ID-1] = job
+	stored := s.Items[job.ID]
+	for _, item := range items {
+		if item.Position >= 0 && item.Position < len(stored) {
+			stored[item.Position] = item
+		}
+	}
+	return nil
+}
+
+// GetUnfinishedJobs gets queued and running jobs from the oldest.
+func (s *MapJobs) GetUnfinishedJobs(ctx context.Context) ([]Job, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	jobs := make([]Job, 0)
+	for _, job := range s.Jobs {
+		if job.ID != 0 && !job.IsFinished() {
+			jobs = append(jobs, job)
+		}
+	}
+	return jobs, nil
+}
@@ -0,0 +1,167 @@
+package storage
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/size12/url-shortener/internal/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileJobs(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "links.txt"+JobSuffix)
+	ctx := context.Background()
+	created := time.Date(2023, 3, 12, 10, 0, 0, 0, time.UTC)
+
+	s, err := NewFileJobs(path)
+	assert.NoError(t, err)
+
+	_, err = s.GetJob(ctx, 1)
+	assert.ErrorIs(t, err, Err404)
+
+	urls := make([]BatchJSON, fileJobItems+1)
+	for i := range urls {
+		urls[i] = BatchJSON{CorrelationID: "id", URL: "https://yandex.ru"}
+	}
+	urls[0].ShortURL = "http://127.0.0.1:8080/1"
+
+	job, err := s.AddJob(ctx, Job{UserID: "user12", Status: JobQueued, CreatedAt: created, UpdatedAt: created}, urls)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), job.ID)
+	assert.Equal(t, len(urls), job.Total)
+
+	items, err := s.GetJobItems(ctx, job.ID, 0, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, []JobItem{
+		{Position: 0, BatchJSON: BatchJSON{CorrelationID: "id", URL: "https://yandex.ru"}},
+		{Position: 1, BatchJSON: BatchJSON{CorrelationID: "id", URL: "https://yandex.ru"}},
+	}, items)
+
+	items[0].ShortURL = "http://127.0.0.1:8080/1"
+	items[1].Error = "url is too long"
+	job.Status, job.Processed, job.Failed = JobRunning, 2, 1
+	assert.NoError(t, s.UpdateJob(ctx, job, items...))
+	assert.ErrorIs(t, s.UpdateJob(ctx, Job{ID: 2}), Err404)
+
+	unfinished, err := s.GetUnfinishedJobs(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []Job{job}, unfinished)
+
+	// jobs and results are restored from file.
+	s, err = NewFileJobs(path)
+	assert.NoError(t, err)
+
+	restored, err := s.GetJob(ctx, job.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, job, restored)
+
+	restoredItems, err := s.GetJobItems(ctx, job.ID, 0, 3)
+	assert.NoError(t, err)
+	assert.Equal(t, items, restoredItems[:2])
+	assert.Equal(t, 2, restoredItems[2].Position)
+
+	last, err := s.GetJobItems(ctx, job.ID, fileJobItems, 10)
+	assert.NoError(t, err)
+	assert.Len(t, last, 1)
+
+	job.Status, job.Processed = JobDone, job.Total
+	assert.NoError(t, s.UpdateJob(ctx, job))
+	unfinished, err = s.GetUnfinishedJobs(ctx)
+	assert.NoError(t, err)
+	assert.Empty(t, unfinished)
+}
+
+func TestNewJobStorage(t *testing.T) {
+	cfg := config.GetTestConfig()
+
+	s, err := NewMapStorage(cfg)
+	assert.NoError(t, err)
+	jobs, err := NewJobStorage(s)
+	assert.NoError(t, err)
+	assert.IsType(t, &MapJobs{}, jobs)
+
+	db, err := NewDBStorage(cfg)
+	assert.NoError(t, err)
+	jobs, err = NewJobStorage(db)
+	assert.NoError(t, err)
+	assert.Equal(t, db, jobs)
+}
+
+func TestDBStorage_Jobs(t *testing.T) {
+	cfg := config.GetTestConfig()
+	s, err := NewDBStorage(cfg)
+	assert.NoError(t, err)
+
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	assert.NoError(t, err)
+	defer db.Close()
+	s.DB = db
+
+	ctx := context.Background()
+	created := time.Date(2023, 3, 12, 10, 0, 0, 0, time.UTC)
+	request := `{"correlation_id":"a","original_url":"https://yandex.ru"}`
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("INSERT INTO jobs (cookie, status, total, processed, failed, error, created_at, updated_at) "+
+		"VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id").
+		WithArgs("user12", JobQueued, 1, 0, 0, "", created, created).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(3))
+	mock.ExpectPrepare("INSERT INTO job_items (job_id, position, request) VALUES ($1, $2, $3)").
+		ExpectExec().WithArgs(int64(3), 0, []byte(request)).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	job, err := s.AddJob(ctx, Job{UserID: "user12", Status: JobQueued, CreatedAt: created, UpdatedAt: created},
+		[]BatchJSON{{CorrelationID: "a", URL: "https://yandex.ru"}})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), job.ID)
+	assert.Equal(t, 1, job.Total)
+
+	columns := []string{"id", "cookie", "status", "total", "processed", "failed", "error", "created_at", "updated_at"}
+	mock.ExpectQuery("SELECT id, cookie, status, total, processed, failed, error, created_at, updated_at FROM jobs WHERE id = $1").
+		WithArgs(int64(3)).WillReturnRows(sqlmock.NewRows(columns).AddRow(3, "user12", JobQueued, 1, 0, 0, "", created, created))
+	got, err := s.GetJob(ctx, 3)
+	assert.NoError(t, err)
+	assert.Equal(t, job, got)
+
+	mock.ExpectQuery("SELECT id, cookie, status, total, processed, failed, error, created_at, updated_at FROM jobs WHERE id = $1").
+		WithArgs(int64(4)).WillReturnRows(sqlmock.NewRows(columns))
+	_, err = s.GetJob(ctx, 4)
+	assert.ErrorIs(t, err, Err404)
+
+	mock.ExpectQuery("SELECT id, cookie, status, total, processed, failed, error, created_at, updated_at FROM jobs "+
+		"WHERE status IN ($1, $2) ORDER BY id").
+		WithArgs(JobQueued, JobRunning).WillReturnRows(sqlmock.NewRows(columns).AddRow(3, "user12", JobQueued, 1, 0, 0, "", created, created))
+	unfinished, err := s.GetUnfinishedJobs(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []Job{job}, unfinished)
+
+	mock.ExpectQuery("SELECT position, request, short_url, error FROM job_items WHERE job_id = $1 AND position >= $2 ORDER BY position LIMIT $3").
+		WithArgs(int64(3), 0, 100).
+		WillReturnRows(sqlmock.NewRows([]string{"position", "request", "short_url", "error"}).AddRow(0, []byte(request), "", ""))
+	items, err := s.GetJobItems(ctx, 3, 0, 100)
+	assert.NoError(t, err)
+	assert.Equal(t, []JobItem{{Position: 0, BatchJSON: BatchJSON{CorrelationID: "a", URL: "https://yandex.ru"}}}, items)
+
+	items[0].ShortURL = "http://127.0.0.1:8081/1"
+	job.Status, job.Processed = JobDone, 1
+
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE jobs SET status = $1, processed = $2, failed = $3, error = $4, updated_at = $5 WHERE id = $6").
+		WithArgs(JobDone, 1, 0, "", created, int64(3)).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectPrepare("UPDATE job_items SET short_url = $1, error = $2 WHERE job_id = $3 AND position = $4").
+		ExpectExec().WithArgs("http://127.0.0.1:8081/1", "", int64(3), 0).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	assert.NoError(t, s.UpdateJob(ctx, job, items...))
+
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE jobs SET status = $1, processed = $2, failed = $3, error = $4, updated_at = $5 WHERE id = $6").
+		WithArgs(JobDone, 1, 0, "", created, int64(4)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+	job.ID = 4
+	assert.ErrorIs(t, s.UpdateJob(ctx, job), Err404)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -1,10 +1,12 @@
 package storage
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"net/url"
 	"sync"
+	"time"
 
 	"github.com/size12/url-shortener/internal/config"
 )
@@ -15,6 +17,9 @@ type MapStorage struct {
 	Locations map[string]string
 	Users     map[string][]string
 	Deleted   map[string]bool
+	// Meta is owner, creation time and options of links.
+	// It's kept only for storages created by NewMapStorage.
+	Meta map[string]Link
 	*sync.Mutex
 }
 
@@ -23,8 +28,9 @@ func NewMapStorage(cfg config.Config) (*MapStorage, error) {
 	loc := make(map[string]string)
 	users := make(map[string][]string)
 	deleted := make(map[string]bool)
+	meta := make(map[string]Link)
 
-	return &MapStorage{Locations: loc, Users: users, Deleted: deleted, Cfg: cfg, Mutex: &sync.Mutex{}}, nil
+	return &MapStorage{Locations: loc, Users: users, Deleted: deleted, Meta: meta, Cfg: cfg, Mutex: &sync.Mutex{}}, nil
 }
 
 // Interface storage.Storage implementation.
@@ -35,12 +41,12 @@ func (s *MapStorage) GetConfig() config.Config {
 }
 
 // Ping do nothing.
-func (s *MapStorage) Ping() error {
+func (s *MapStorage) Ping(ctx context.Context) error {
 	return nil
 }
 
 // CreateShort creates short url from long.
-func (s *MapStorage) CreateShort(userID string, urls ...string) ([]string, error) {
+func (s *MapStorage) CreateShort(ctx context.Context, userID string, urls ...string) ([]string, error) {
 	result := make([]string, 0, len(urls))
 	s.Lock()
 	defer s.Unlock()
@@ -71,13 +77,16 @@ func (s *MapStorage) CreateShort(userID string, urls ...string) ([]string, error
 
 		s.Locations[newID] = longURL
 		s.Users[userID] = append(s.Users[userID], newID)
+		if s.Meta != nil {
+			s.Meta[newID] = Link{UserID: userID, CreatedAt: time.Now()}
+		}
 	}
 
 	return result, isErr409
 }
 
 // GetLong gets long url from short.
-func (s *MapStorage) GetLong(id string) (string, error) {
+func (s *MapStorage) GetLong(ctx context.Context, id string) (string, error) {
 	s.Lock()
 	defer s.Unlock()
 	if el, ok := s.Locations[id]; ok {
@@ -91,7 +100,7 @@ func (s *MapStorage) GetLong(id string) (string, error) {
 }
 
 // Delete deletes url.
-func (s *MapStorage) Delete(userID string, ids ...string) error {
+func (s *MapStorage) Delete(ctx context.Context, userID string, ids ...string) error {
 	s.Lock()
 	defer s.Unlock()
 	canDelete := s.Users[userID]
@@ -108,7 +117,7 @@ func (s *MapStorage) Delete(userID string, ids ...string) error {
 }
 
 // GetHistory gets history of links.
-func (s *MapStorage) GetHistory(userID string) ([]LinkJSON, error) {
+func (s *MapStorage) GetHistory(ctx context.Context, userID string) ([]LinkJSON, error) {
 	s.Lock()
 	defer s.Unlock()
 
@@ -117,15 +126,80 @@ func (s *MapStorage) GetHistory(userID string) ([]LinkJSON, error) {
 
 	for i, id := range historyShort {
 		long := s.Locations[id]
+		if original := s.Meta[id].OriginalURL; original != "" {
+			long = original
+		}
 		history[i] = LinkJSON{ShortURL: s.Cfg.BaseURL + "/" + id, LongURL: long}
 	}
 	return history, nil
 }
 
 // GetStatistic gets total count of users and urls.
-func (s *MapStorage) GetStatistic() (Statistic, error) {
+func (s *MapStorage) GetStatistic(ctx context.Context) (Statistic, error) {
+	s.Lock()
+	defer s.Unlock()
+
 	return Statistic{
 		Urls:  len(s.Locations),
 		Users: len(s.Users),
 	}, nil
 }
+
+// GetLink gets link with its metadata.
+func (s *MapStorage) GetLink(ctx context.Context, id string) (Link, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	long, ok := s.Locations[id]
+	if !ok {
+		return Link{}, Err404
+	}
+
+	link := s.Meta[id]
+	link.ID = id
+	link.URL = long
+	link.Deleted = s.Deleted[id]
+
+	if link.Deleted {
+		return link, Err410
+	}
+	return link, nil
+}
+
+// SetLinkOptions sets options of link.
+func (s *MapStorage) SetLinkOptions(ctx context.Context, id string, opts LinkOptions) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if _, ok := s.Locations[id]; !ok {
+		return Err404
+	}
+
+	if s.Meta == nil {
+		s.Meta = make(map[string]Link)
+	}
+
+	link := s.Meta[id]
+	link.Options = opts
+	s.Meta[id] = link
+	return nil
+}
+
+// SetOriginalURL sets url of link as it was sent by owner.
+func (s *MapStorage) SetOriginalURL(ctx context.Context, id, original string) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if _, ok := s.Locations[id]; !ok {
+		return Err404
+	}
+
+	if s.Meta == nil {
+		s.Meta = make(map[string]Link)
+	}
+
+	link := s.Meta[id]
+	link.OriginalURL = original
+	s.Meta[id] = link
+	return nil
+}
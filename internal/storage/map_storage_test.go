@@ -1,6 +1,7 @@
 package storage
 
 import (
+	"context"
 	"errors"
 	"testing"
 
@@ -65,7 +66,7 @@ func TestMapStorage_CreateShort(t *testing.T) {
 	for _, test := range tc {
 		s, err := NewMapStorage(cfg)
 		assert.NoError(t, err, test.name)
-		res, err := s.CreateShort("user12", test.urls...)
+		res, err := s.CreateShort(context.Background(), "user12", test.urls...)
 		assert.Equal(t, test.err, err, test.name)
 		assert.Equal(t, test.want, res, test.name)
 		assert.Equal(t, test.loc, s.Locations)
@@ -123,7 +124,7 @@ func TestMapStorage_GetLong(t *testing.T) {
 	for _, test := range tc {
 		s.Locations = test.loc
 		s.Deleted = test.deleted
-		res, err := s.GetLong(test.id)
+		res, err := s.GetLong(context.Background(), test.id)
 		assert.Equal(t, test.err, err, test.name)
 		assert.Equal(t, test.result, res, test.name)
 	}
@@ -172,7 +173,7 @@ func TestMapStorage_Delete(t *testing.T) {
 		s.Users = test.users
 		s.Deleted = test.deleted
 
-		err := s.Delete("user1", test.id)
+		err := s.Delete(context.Background(), "user1", test.id)
 		assert.Equal(t, test.err, err, test.name)
 		assert.Equal(t, test.wantDeleted, s.Deleted, test.name)
 	}
@@ -239,7 +240,7 @@ func TestMapStorage_GetHistory(t *testing.T) {
 		s.Locations = test.loc
 		s.Users = test.users
 
-		res, err := s.GetHistory(test.cookie)
+		res, err := s.GetHistory(context.Background(), test.cookie)
 		assert.Equal(t, test.err, err)
 		assert.Equal(t, test.want, res)
 	}
@@ -251,5 +252,44 @@ func TestMapStorage_Ping(t *testing.T) {
 	s, err := NewMapStorage(cfg)
 	assert.NoError(t, err)
 
-	assert.NoError(t, s.Ping(), "failed ping test")
+	assert.NoError(t, s.Ping(context.Background()), "failed ping test")
+}
+
+func TestMapStorage_LinkOptions(t *testing.T) {
+	cfg := config.GetTestConfig()
+	s, err := NewMapStorage(cfg)
+	assert.NoError(t, err)
+
+	_, err = s.CreateShort(context.Background(), "user12", "https://yandex.ru")
+	assert.NoError(t, err)
+
+	opts := LinkOptions{RedirectCode: 308}
+	assert.NoError(t, s.SetLinkOptions(context.Background(), "1", opts))
+	assert.Equal(t, Err404, s.SetLinkOptions(context.Background(), "2", opts))
+
+	link, err := s.GetLink(context.Background(), "1")
+	assert.NoError(t, err)
+	assert.Equal(t, "1", link.ID)
+	assert.Equal(t, "https://yandex.ru", link.URL)
+	assert.Equal(t, "user12", link.UserID)
+	assert.Equal(t, opts, link.Options)
+	assert.False(t, link.CreatedAt.IsZero())
+
+	_, err = s.GetLink(context.Background(), "2")
+	assert.Equal(t, Err404, err)
+
+	// original url is shown in history.
+	assert.NoError(t, s.SetOriginalURL(context.Background(), "1", "HTTPS://Yandex.ru/"))
+	assert.Equal(t, Err404, s.SetOriginalURL(context.Background(), "2", "HTTPS://Yandex.ru/"))
+
+	history, err := s.GetHistory(context.Background(), "user12")
+	assert.NoError(t, err)
+	assert.Equal(t, "HTTPS://Yandex.ru/", history[0].LongURL)
+
+	assert.NoError(t, s.Delete(context.Background(), "user12", "1"))
+	link, err = s.GetLink(context.Background(), "1")
+	assert.Equal(t, Err410, err)
+	assert.True(t, link.Deleted)
+	assert.Equal(t, "https://yandex.ru", link.URL)
+	assert.Equal(t, "HTTPS://Yandex.ru/", link.DisplayURL())
 }
@@ -0,0 +1,188 @@
+package storage
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+)
+
+// ReportSuffix is suffix of file, which stores abuse reports of file storage.
+const ReportSuffix = ".reports"
+
+// Statuses of abuse report.
+const (
+	ReportOpen      = "open"
+	ReportDismissed = "dismissed"
+	ReportTakenDown = "taken_down"
+)
+
+// Report is abuse report of short link.
+type Report struct {
+	ID         int64     `json:"id"`
+	LinkID     string    `json:"link_id"`
+	Reason     string    `json:"reason"`
+	ReporterIP string    `json:"reporter_ip"`
+	Status     string    `json:"status"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// ReportStorage stores abuse reports. Open reports are moderation queue.
+type ReportStorage interface {
+	// AddReport adds open report and returns it with ID.
+	AddReport(ctx context.Context, r Report) (Report, error)
+	// GetLinkReports gets open reports of link.
+	GetLinkReports(ctx context.Context, linkID string) ([]Report, error)
+	// GetOpenReports gets open reports of all links from the oldest.
+	GetOpenReports(ctx context.Context) ([]Report, error)
+	// ResolveReports sets status of open reports of link. It returns Err404, if link has no open reports.
+	ResolveReports(ctx context.Context, linkID, status string) error
+}
+
+// NewReportStorage gets reports storage of links storage.
+// DB storage stores reports in table, file storage in file next to links file, other storages in memory.
+func NewReportStorage(s Storage) (ReportStorage, error) {
+	if reports, ok := s.(ReportStorage); ok {
+		return reports, nil
+	}
+
+	if file, ok := s.(*FileStorage); ok {
+		return NewFileReports(file.Cfg.StoragePath + ReportSuffix)
+	}
+
+	return NewMapReports(), nil
+}
+
+// MapReports stores reports in slice, report ID is its index plus one.
+// If File is set, every new or changed report is appended to it.
+type MapReports struct {
+	Reports []Report
+	File    *os.File
+	*sync.Mutex
+}
+
+// NewMapReports creates new in-memory reports storage.
+func NewMapReports() *MapReports {
+	return &MapReports{Mutex: &sync.Mutex{}}
+}
+
+// NewFileReports creates reports storage, which keeps reports as JSON lines in file.
+// Changed report is appended again, so the last line of report wins.
+func NewFileReports(path string) (*MapReports, error) {
+	s := NewMapReports()
+
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_APPEND|os.O_CREATE|os.O_SYNC, 0777)
+	if err != nil {
+		return nil, err
+	}
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var r Report
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			file.Close()
+			return nil, err
+		}
+
+		if r.ID > int64(len(s.Reports)) {
+			s.Reports = append(s.Reports, make([]Report, int(r.ID)-len(s.Reports))...)
+		}
+		if r.ID > 0 {
+			s.Reports[r.ID-1] = r
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	s.File = file
+	return s, nil
+}
+
+// save appends report to file, if it's set.
+func (s *MapReports) save(r Report) error {
+	if s.File == nil {
+		return nil
+	}
+
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.File.Write(append(data, '\n'))
+	return err
+}
+
+// AddReport adds open report.
+func (s *MapReports) AddReport(ctx context.Context, r Report) (Report, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	r.ID = int64(len(s.Reports)) + 1
+	r.Status = ReportOpen
+
+	if err := s.save(r); err != nil {
+		return Report{}, err
+	}
+
+	s.Reports = append(s.Reports, r)
+	return r, nil
+}
+
+// GetLinkReports gets open reports of link.
+func (s *MapReports) GetLinkReports(ctx context.Context, linkID string) ([]Report, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	reports := make([]Report, 0)
+	for _, r := range s.Reports {
+		if r.LinkID == linkID && r.Status == ReportOpen {
+			reports = append(reports, r)
+		}
+	}
+	return reports, nil
+}
+
+// GetOpenReports gets open reports from the oldest.
+func (s *MapReports) GetOpenReports(ctx context.Context) ([]Report, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	reports := make([]Report, 0)
+	for _, r := range s.Reports {
+		if r.Status == ReportOpen {
+			reports = append(reports, r)
+		}
+	}
+	return reports, nil
+}
+
+// ResolveReports sets status of open reports of link.
+func (s *MapReports) ResolveReports(ctx context.Context, linkID, status string) error {
+	s.Lock()
+	defer s.Unlock()
+
+	resolved := false
+	for i, r := range s.Reports {
+		if r.LinkID != linkID || r.Status != ReportOpen {
+			continue
+		}
+
+		r.Status = status
+		if err := s.save(r); err != nil {
+			return err
+		}
+		s.Reports[i] = r
+		resolved = true
+	}
+
+	if !resolved {
+		return Err404
+	}
+	return nil
+}
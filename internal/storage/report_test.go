@@ -0,0 +1,97 @@
+package storage
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/size12/url-shortener/internal/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileReports(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "links.txt"+ReportSuffix)
+	ctx := context.Background()
+	created := time.Date(2023, 3, 12, 10, 0, 0, 0, time.UTC)
+
+	s, err := NewFileReports(path)
+	assert.NoError(t, err)
+
+	first, err := s.AddReport(ctx, Report{LinkID: "1", Reason: "phishing", ReporterIP: "1.1.1.1", CreatedAt: created})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), first.ID)
+	assert.Equal(t, ReportOpen, first.Status)
+
+	second, err := s.AddReport(ctx, Report{LinkID: "2", Reason: "spam", ReporterIP: "2.2.2.2", CreatedAt: created})
+	assert.NoError(t, err)
+	_, err = s.AddReport(ctx, Report{LinkID: "1", Reason: "malware", ReporterIP: "2.2.2.2", CreatedAt: created})
+	assert.NoError(t, err)
+
+	reports, err := s.GetLinkReports(ctx, "1")
+	assert.NoError(t, err)
+	assert.Len(t, reports, 2)
+
+	assert.NoError(t, s.ResolveReports(ctx, "1", ReportDismissed))
+	assert.Equal(t, Err404, s.ResolveReports(ctx, "1", ReportDismissed))
+
+	// reports are restored from file.
+	s, err = NewFileReports(path)
+	assert.NoError(t, err)
+
+	reports, err = s.GetOpenReports(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []Report{second}, reports)
+
+	reports, err = s.GetLinkReports(ctx, "1")
+	assert.NoError(t, err)
+	assert.Empty(t, reports)
+
+	next, err := s.AddReport(ctx, Report{LinkID: "3", Reason: "spam", CreatedAt: created})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(4), next.ID)
+}
+
+func TestDBStorage_Reports(t *testing.T) {
+	cfg := config.GetTestConfig()
+	s, err := NewDBStorage(cfg)
+	assert.NoError(t, err)
+
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	assert.NoError(t, err)
+	defer db.Close()
+	s.DB = db
+
+	ctx := context.Background()
+	created := time.Date(2023, 3, 12, 10, 0, 0, 0, time.UTC)
+	columns := []string{"id", "link_id", "reason", "reporter_ip", "status", "created_at"}
+
+	mock.ExpectQuery("INSERT INTO reports (link_id, reason, reporter_ip, status, created_at) VALUES ($1, $2, $3, $4, $5) RETURNING id").
+		WithArgs("1", "phishing", "1.1.1.1", "open", created).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(7))
+	report, err := s.AddReport(ctx, Report{LinkID: "1", Reason: "phishing", ReporterIP: "1.1.1.1", CreatedAt: created})
+	assert.NoError(t, err)
+	assert.Equal(t, Report{ID: 7, LinkID: "1", Reason: "phishing", ReporterIP: "1.1.1.1", Status: ReportOpen, CreatedAt: created}, report)
+
+	mock.ExpectQuery("SELECT id, link_id, reason, reporter_ip, status, created_at FROM reports WHERE link_id = $1 AND status = $2 ORDER BY id").
+		WithArgs("1", "open").WillReturnRows(sqlmock.NewRows(columns).AddRow(7, "1", "phishing", "1.1.1.1", "open", created))
+	reports, err := s.GetLinkReports(ctx, "1")
+	assert.NoError(t, err)
+	assert.Equal(t, []Report{report}, reports)
+
+	mock.ExpectQuery("SELECT id, link_id, reason, reporter_ip, status, created_at FROM reports WHERE status = $1 ORDER BY id").
+		WithArgs("open").WillReturnRows(sqlmock.NewRows(columns))
+	reports, err = s.GetOpenReports(ctx)
+	assert.NoError(t, err)
+	assert.Empty(t, reports)
+
+	mock.ExpectExec("UPDATE reports SET status = $1 WHERE link_id = $2 AND status = $3").
+		WithArgs("dismissed", "1", "open").WillReturnResult(sqlmock.NewResult(0, 1))
+	assert.NoError(t, s.ResolveReports(ctx, "1", ReportDismissed))
+
+	mock.ExpectExec("UPDATE reports SET status = $1 WHERE link_id = $2 AND status = $3").
+		WithArgs("dismissed", "1", "open").WillReturnResult(sqlmock.NewResult(0, 0))
+	assert.Equal(t, Err404, s.ResolveReports(ctx, "1", ReportDismissed))
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -2,7 +2,13 @@
 package storage
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"time"
+	"unicode/utf8"
 
 	"github.com/size12/url-shortener/internal/config"
 )
@@ -12,17 +18,43 @@ var (
 	Err409 = errors.New("link is already in storage")
 	Err410 = errors.New("link is deleted, sorry :(")
 	Err404 = errors.New("not found")
+
+	ErrDirtyMigration = errors.New("last DB migration failed, schema is dirty")
+
+	ErrInvalidOptions      = errors.New("invalid link options")
+	ErrInvalidRedirectCode = fmt.Errorf("%w: redirect code must be 301, 302, 307 or 308", ErrInvalidOptions)
+	ErrInvalidQueryMode    = fmt.Errorf("%w: query mode must be append or override", ErrInvalidOptions)
+	ErrTitleTooLong        = fmt.Errorf("%w: title must be at most %d characters", ErrInvalidOptions, MaxTitleLength)
+)
+
+// Query modes of link: how query of short link request is merged into long url.
+const (
+	// QueryModeAppend adds request parameters to parameters of long url.
+	QueryModeAppend = "append"
+	// QueryModeOverride replaces parameters of long url by request parameters with the same name.
+	QueryModeOverride = "override"
 )
 
+// MaxTitleLength is max length of link title.
+const MaxTitleLength = 200
+
 // Storage is an interface that describes storage.
 type Storage interface {
-	CreateShort(userID string, urls ...string) ([]string, error)
-	GetLong(id string) (string, error)
-	Delete(userID string, ids ...string) error
-	GetHistory(userID string) ([]LinkJSON, error)
-	Ping() error
+	CreateShort(ctx context.Context, userID string, urls ...string) ([]string, error)
+	GetLong(ctx context.Context, id string) (string, error)
+	Delete(ctx context.Context, userID string, ids ...string) error
+	GetHistory(ctx context.Context, userID string) ([]LinkJSON, error)
+	Ping(ctx context.Context) error
 	GetConfig() config.Config
-	GetStatistic() (Statistic, error)
+	GetStatistic(ctx context.Context) (Statistic, error)
+	GetLink(ctx context.Context, id string) (Link, error)
+	SetLinkOptions(ctx context.Context, id string, opts LinkOptions) error
+	SetOriginalURL(ctx context.Context, id, original string) error
+}
+
+// MigrationChecker is storage with schema migrations, which state can be checked.
+type MigrationChecker interface {
+	CheckMigrations(ctx context.Context) error
 }
 
 // NewStorage creates new storage based on config.
@@ -38,6 +70,81 @@ func NewStorage(cfg config.Config) (Storage, error) {
 	return NewMapStorage(cfg)
 }
 
+// LinkOptions are per-link settings, which are set by link owner.
+type LinkOptions struct {
+	// RedirectCode is status code of redirect. Zero means code from config.
+	RedirectCode int `json:"redirect_code,omitempty"`
+	// QueryMode is how request query is forwarded to long url. Empty mode means query isn't forwarded.
+	QueryMode string `json:"query_mode,omitempty"`
+	// ForwardPath appends path after short link ID to long url.
+	ForwardPath bool `json:"forward_path,omitempty"`
+	// Title is shown on preview page of link.
+	Title string `json:"title,omitempty"`
+	// AlwaysPreview shows preview page with destination instead of redirect.
+	AlwaysPreview bool `json:"always_preview,omitempty"`
+	// ExpiresAt is when link stops redirecting. Nil means link never expires.
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// IsExpired checks if link is expired at time now.
+func (opts LinkOptions) IsExpired(now time.Time) bool {
+	return opts.ExpiresAt != nil && !now.Before(*opts.ExpiresAt)
+}
+
+// IsZero checks if no option is set.
+func (opts LinkOptions) IsZero() bool {
+	return reflect.ValueOf(opts).IsZero()
+}
+
+// Validate checks options.
+func (opts LinkOptions) Validate() error {
+	if opts.RedirectCode != 0 && !IsRedirectCode(opts.RedirectCode) {
+		return ErrInvalidRedirectCode
+	}
+
+	switch opts.QueryMode {
+	case "", QueryModeAppend, QueryModeOverride:
+	default:
+		return ErrInvalidQueryMode
+	}
+
+	if utf8.RuneCountInString(opts.Title) > MaxTitleLength {
+		return ErrTitleTooLong
+	}
+
+	return nil
+}
+
+// IsRedirectCode checks if code is one of redirect codes, which can be used for short links.
+func IsRedirectCode(code int) bool {
+	switch code {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return true
+	default:
+		return false
+	}
+}
+
+// Link is short link with its metadata.
+type Link struct {
+	ID        string
+	URL       string
+	UserID    string
+	Deleted   bool
+	CreatedAt time.Time
+	Options   LinkOptions
+	// OriginalURL is url as it was sent by link owner, if it differs from normalized URL.
+	OriginalURL string
+}
+
+// DisplayURL gets url, which is shown to users: original one, if it's kept, or normalized one.
+func (link Link) DisplayURL() string {
+	if link.OriginalURL != "" {
+		return link.OriginalURL
+	}
+	return link.URL
+}
+
 // Structs for response.
 
 // Statistic struct for statistic which contains total shortened URLs number and users number.
@@ -57,11 +164,15 @@ type BatchJSON struct {
 	CorrelationID string `json:"correlation_id,omitempty"`
 	URL           string `json:"original_url,omitempty"`
 	ShortURL      string `json:"short_url,omitempty"`
+	LinkOptions
+	UTMRequest
 }
 
 // RequestJSON struct for single application/json request.
 type RequestJSON struct {
 	URL string `json:"url"`
+	LinkOptions
+	UTMRequest
 }
 
 // ResponseJSON struct for single application/json response.
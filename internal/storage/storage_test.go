@@ -3,7 +3,9 @@ package storage
 import (
 	"os"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/size12/url-shortener/internal/config"
 	"github.com/stretchr/testify/assert"
@@ -26,4 +28,39 @@ func TestNewStorage(t *testing.T) {
 	assert.Equal(t, reflect.TypeOf(&FileStorage{}), reflect.TypeOf(s))
 	err = os.RemoveAll("1.txt")
 	assert.NoError(t, err)
+	err = os.RemoveAll("1.txt" + MetaSuffix)
+	assert.NoError(t, err)
+}
+
+func TestLinkOptions_Validate(t *testing.T) {
+	assert.NoError(t, LinkOptions{}.Validate())
+	assert.True(t, LinkOptions{}.IsZero())
+
+	for _, code := range []int{301, 302, 307, 308} {
+		assert.NoError(t, LinkOptions{RedirectCode: code}.Validate())
+	}
+
+	assert.Equal(t, ErrInvalidRedirectCode, LinkOptions{RedirectCode: 200}.Validate())
+	assert.False(t, LinkOptions{RedirectCode: 200}.IsZero())
+
+	for _, mode := range []string{QueryModeAppend, QueryModeOverride} {
+		assert.NoError(t, LinkOptions{QueryMode: mode}.Validate())
+	}
+	assert.Equal(t, ErrInvalidQueryMode, LinkOptions{QueryMode: "merge"}.Validate())
+	assert.False(t, LinkOptions{ForwardPath: true}.IsZero())
+
+	assert.NoError(t, LinkOptions{Title: strings.Repeat("я", MaxTitleLength)}.Validate())
+	assert.ErrorIs(t, LinkOptions{Title: strings.Repeat("a", MaxTitleLength+1)}.Validate(), ErrInvalidOptions)
+}
+
+func TestLinkOptions_IsExpired(t *testing.T) {
+	now := time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)
+	expires := now.Add(time.Hour)
+	opts := LinkOptions{ExpiresAt: &expires}
+
+	assert.False(t, LinkOptions{}.IsExpired(now))
+	assert.False(t, opts.IsZero())
+	assert.False(t, opts.IsExpired(now))
+	assert.True(t, opts.IsExpired(expires))
+	assert.True(t, opts.IsExpired(now.Add(2*time.Hour)))
 }
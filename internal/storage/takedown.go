@@ -0,0 +1,206 @@
+package storage
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// TakedownSuffix is suffix of file, which stores takedowns audit of file storage.
+const TakedownSuffix = ".takedowns"
+
+// Kinds of takedown.
+const (
+	// TakedownLink blocks single short link by its ID.
+	TakedownLink = "link"
+	// TakedownDomain blocks all links to domain and its subdomains.
+	TakedownDomain = "domain"
+)
+
+// Actions of takedowns audit.
+const (
+	AuditTakedown = "takedown"
+	AuditRestore  = "restore"
+)
+
+// Takedown is administrative block of short link or destination domain.
+type Takedown struct {
+	Kind   string `json:"kind"`
+	Target string `json:"target"`
+	Reason string `json:"reason"`
+	// Code is status code of blocked links: 451 or 410.
+	Code      int       `json:"code"`
+	Actor     string    `json:"actor,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// AuditEntry is record of takedowns audit trail.
+// For restore, takedown fields are who restored links and why.
+type AuditEntry struct {
+	Action string `json:"action"`
+	Takedown
+}
+
+// TakedownStorage stores active takedowns and audit trail of all takedowns and restores.
+type TakedownStorage interface {
+	// AddTakedown adds takedown or replaces takedown of the same target.
+	AddTakedown(ctx context.Context, t Takedown) error
+	// RemoveTakedown removes takedown of kind and target of t. It returns Err404, if there is no such takedown.
+	RemoveTakedown(ctx context.Context, t Takedown) error
+	// GetTakedown gets active takedown. It returns Err404, if target isn't blocked.
+	GetTakedown(ctx context.Context, kind, target string) (Takedown, error)
+	GetTakedowns(ctx context.Context) ([]Takedown, error)
+	GetAudit(ctx context.Context) ([]AuditEntry, error)
+}
+
+// NewTakedownStorage gets takedowns storage of links storage.
+// DB storage stores takedowns in tables, file storage in file next to links file, other storages in memory.
+func NewTakedownStorage(s Storage) (TakedownStorage, error) {
+	if takedowns, ok := s.(TakedownStorage); ok {
+		return takedowns, nil
+	}
+
+	if file, ok := s.(*FileStorage); ok {
+		return NewFileTakedowns(file.Cfg.StoragePath + TakedownSuffix)
+	}
+
+	return NewMapTakedowns(), nil
+}
+
+// MapTakedowns stores takedowns in map. If File is set, audit trail is appended to it.
+type MapTakedowns struct {
+	Active map[string]Takedown
+	Audit  []AuditEntry
+	File   *os.File
+	*sync.Mutex
+}
+
+// NewMapTakedowns creates new in-memory takedowns storage.
+func NewMapTakedowns() *MapTakedowns {
+	return &MapTakedowns{Active: make(map[string]Takedown), Mutex: &sync.Mutex{}}
+}
+
+// NewFileTakedowns creates takedowns storage, which keeps audit trail as JSON lines in file.
+// Active takedowns are restored by replaying audit trail.
+func NewFileTakedowns(path string) (*MapTakedowns, error) {
+	s := NewMapTakedowns()
+
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_APPEND|os.O_CREATE|os.O_SYNC, 0777)
+	if err != nil {
+		return nil, err
+	}
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var entry AuditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			file.Close()
+			return nil, err
+		}
+		s.apply(entry)
+	}
+
+	if err := scanner.Err(); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	s.File = file
+	return s, nil
+}
+
+// takedownKey is key of takedown in map.
+func takedownKey(kind, target string) string {
+	return kind + " " + target
+}
+
+// apply applies audit entry to active takedowns.
+func (s *MapTakedowns) apply(entry AuditEntry) {
+	key := takedownKey(entry.Kind, entry.Target)
+	switch entry.Action {
+	case AuditTakedown:
+		s.Active[key] = entry.Takedown
+	case AuditRestore:
+		delete(s.Active, key)
+	}
+	s.Audit = append(s.Audit, entry)
+}
+
+// record saves audit entry to file, if it's set, and applies it.
+func (s *MapTakedowns) record(entry AuditEntry) error {
+	if s.File != nil {
+		data, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+
+		if _, err := s.File.Write(append(data, '\n')); err != nil {
+			return err
+		}
+	}
+
+	s.apply(entry)
+	return nil
+}
+
+// AddTakedown adds takedown.
+func (s *MapTakedowns) AddTakedown(ctx context.Context, t Takedown) error {
+	s.Lock()
+	defer s.Unlock()
+
+	return s.record(AuditEntry{Action: AuditTakedown, Takedown: t})
+}
+
+// RemoveTakedown removes takedown.
+func (s *MapTakedowns) RemoveTakedown(ctx context.Context, t Takedown) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if _, ok := s.Active[takedownKey(t.Kind, t.Target)]; !ok {
+		return Err404
+	}
+
+	return s.record(AuditEntry{Action: AuditRestore, Takedown: t})
+}
+
+// GetTakedown gets active takedown.
+func (s *MapTakedowns) GetTakedown(ctx context.Context, kind, target string) (Takedown, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	t, ok := s.Active[takedownKey(kind, target)]
+	if !ok {
+		return Takedown{}, Err404
+	}
+	return t, nil
+}
+
+// GetTakedowns gets active takedowns from the oldest.
+func (s *MapTakedowns) GetTakedowns(ctx context.Context) ([]Takedown, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	takedowns := make([]Takedown, 0, len(s.Active))
+	for _, t := range s.Active {
+		takedowns = append(takedowns, t)
+	}
+
+	sort.Slice(takedowns, func(i, j int) bool {
+		return takedowns[i].CreatedAt.Before(takedowns[j].CreatedAt)
+	})
+	return takedowns, nil
+}
+
+// GetAudit gets audit trail from the oldest entry.
+func (s *MapTakedowns) GetAudit(ctx context.Context) ([]AuditEntry, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	audit := make([]AuditEntry, len(s.Audit))
+	copy(audit, s.Audit)
+	return audit, nil
+}
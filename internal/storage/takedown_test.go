@@ -0,0 +1,70 @@
+package storage
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/size12/url-shortener/internal/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileTakedowns(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "links.txt"+TakedownSuffix)
+	ctx := context.Background()
+
+	s, err := NewFileTakedowns(path)
+	assert.NoError(t, err)
+
+	_, err = s.GetTakedown(ctx, TakedownLink, "1")
+	assert.Equal(t, Err404, err)
+
+	created := time.Date(2023, 3, 12, 10, 0, 0, 0, time.UTC)
+	link := Takedown{Kind: TakedownLink, Target: "1", Reason: "court order", Code: 451, Actor: "legal", CreatedAt: created}
+	domain := Takedown{Kind: TakedownDomain, Target: "evil.ru", Reason: "phishing", Code: 410, CreatedAt: created.Add(time.Hour)}
+
+	assert.NoError(t, s.AddTakedown(ctx, link))
+	assert.NoError(t, s.AddTakedown(ctx, domain))
+
+	got, err := s.GetTakedown(ctx, TakedownLink, "1")
+	assert.NoError(t, err)
+	assert.Equal(t, link, got)
+
+	restore := Takedown{Kind: TakedownLink, Target: "1", Reason: "order is cancelled", Actor: "legal", CreatedAt: created.Add(2 * time.Hour)}
+	assert.NoError(t, s.RemoveTakedown(ctx, restore))
+	assert.Equal(t, Err404, s.RemoveTakedown(ctx, restore))
+
+	// takedowns and audit are restored from file.
+	s, err = NewFileTakedowns(path)
+	assert.NoError(t, err)
+
+	takedowns, err := s.GetTakedowns(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []Takedown{domain}, takedowns)
+
+	audit, err := s.GetAudit(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []AuditEntry{
+		{Action: AuditTakedown, Takedown: link},
+		{Action: AuditTakedown, Takedown: domain},
+		{Action: AuditRestore, Takedown: restore},
+	}, audit)
+}
+
+func TestNewTakedownStorage(t *testing.T) {
+	cfg := config.GetTestConfig()
+
+	s, err := NewMapStorage(cfg)
+	assert.NoError(t, err)
+	takedowns, err := NewTakedownStorage(s)
+	assert.NoError(t, err)
+	assert.IsType(t, &MapTakedowns{}, takedowns)
+	assert.Nil(t, takedowns.(*MapTakedowns).File)
+
+	db, err := NewDBStorage(cfg)
+	assert.NoError(t, err)
+	takedowns, err = NewTakedownStorage(db)
+	assert.NoError(t, err)
+	assert.Equal(t, db, takedowns)
+}
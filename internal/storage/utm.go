@@ -0,0 +1,210 @@
+package storage
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/url"
+	"os"
+	"sync"
+)
+
+// UTMPresetSuffix is suffix of file, which stores UTM presets of file storage.
+const UTMPresetSuffix = ".utm"
+
+// UTM are UTM parameters of long url.
+type UTM struct {
+	Source   string `json:"source,omitempty"`
+	Medium   string `json:"medium,omitempty"`
+	Campaign string `json:"campaign,omitempty"`
+	Term     string `json:"term,omitempty"`
+	Content  string `json:"content,omitempty"`
+}
+
+// Merge returns UTM parameters, where parameters of other override these ones.
+func (utm UTM) Merge(other UTM) UTM {
+	if other.Source != "" {
+		utm.Source = other.Source
+	}
+	if other.Medium != "" {
+		utm.Medium = other.Medium
+	}
+	if other.Campaign != "" {
+		utm.Campaign = other.Campaign
+	}
+	if other.Term != "" {
+		utm.Term = other.Term
+	}
+	if other.Content != "" {
+		utm.Content = other.Content
+	}
+	return utm
+}
+
+// Values converts UTM parameters to query parameters. Empty parameters are skipped.
+func (utm UTM) Values() url.Values {
+	values := url.Values{}
+	for name, value := range map[string]string{
+		"utm_source":   utm.Source,
+		"utm_medium":   utm.Medium,
+		"utm_campaign": utm.Campaign,
+		"utm_term":     utm.Term,
+		"utm_content":  utm.Content,
+	} {
+		if value != "" {
+			values.Set(name, value)
+		}
+	}
+	return values
+}
+
+// UTMRequest are UTM parameters, which are added to long url, when link is created.
+// Parameters of preset are used first, then they are overridden by UTM.
+type UTMRequest struct {
+	UTM       *UTM   `json:"utm,omitempty"`
+	UTMPreset string `json:"utm_preset,omitempty"`
+}
+
+// UTMPresetStorage stores named UTM presets of users.
+type UTMPresetStorage interface {
+	SetUTMPreset(ctx context.Context, userID, name string, utm UTM) error
+	GetUTMPreset(ctx context.Context, userID, name string) (UTM, error)
+	GetUTMPresets(ctx context.Context, userID string) (map[string]UTM, error)
+	DeleteUTMPreset(ctx context.Context, userID, name string) error
+}
+
+// NewUTMPresetStorage gets UTM presets storage of links storage.
+// DB storage stores presets in table, file storage in file next to links file, other storages in memory.
+func NewUTMPresetStorage(s Storage) (UTMPresetStorage, error) {
+	if presets, ok := s.(UTMPresetStorage); ok {
+		return presets, nil
+	}
+
+	if file, ok := s.(*FileStorage); ok {
+		return NewFileUTMPresets(file.Cfg.StoragePath + UTMPresetSuffix)
+	}
+
+	return NewMapUTMPresets(), nil
+}
+
+// utmPresetRecord is line of UTM presets file. The last record of preset wins.
+type utmPresetRecord struct {
+	UserID  string `json:"user_id"`
+	Name    string `json:"name"`
+	UTM     UTM    `json:"utm"`
+	Deleted bool   `json:"deleted,omitempty"`
+}
+
+// MapUTMPresets stores UTM presets in map. If File is set, changes are appended to it.
+type MapUTMPresets struct {
+	Presets map[string]map[string]UTM
+	File    *os.File
+	*sync.Mutex
+}
+
+// NewMapUTMPresets creates new map UTM presets storage.
+func NewMapUTMPresets() *MapUTMPresets {
+	return &MapUTMPresets{Presets: make(map[string]map[string]UTM), Mutex: &sync.Mutex{}}
+}
+
+// NewFileUTMPresets creates UTM presets storage, which keeps changes of presets as JSON lines in file.
+// Presets are restored by replaying file.
+func NewFileUTMPresets(path string) (*MapUTMPresets, error) {
+	s := NewMapUTMPresets()
+
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_APPEND|os.O_CREATE|os.O_SYNC, 0777)
+	if err != nil {
+		return nil, err
+	}
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var record utmPresetRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			file.Close()
+			return nil, err
+		}
+		s.apply(record)
+	}
+
+	if err := scanner.Err(); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	s.File = file
+	return s, nil
+}
+
+// apply applies record to presets.
+func (s *MapUTMPresets) apply(record utmPresetRecord) {
+	if record.Deleted {
+		delete(s.Presets[record.UserID], record.Name)
+		return
+	}
+
+	if s.Presets[record.UserID] == nil {
+		s.Presets[record.UserID] = make(map[string]UTM)
+	}
+	s.Presets[record.UserID][record.Name] = record.UTM
+}
+
+// record saves record to file, if it's set, and applies it.
+func (s *MapUTMPresets) record(record utmPresetRecord) error {
+	if s.File != nil {
+		data, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+
+		if _, err := s.File.Write(append(data, '\n')); err != nil {
+			return err
+		}
+	}
+
+	s.apply(record)
+	return nil
+}
+
+// SetUTMPreset creates or replaces preset of user.
+func (s *MapUTMPresets) SetUTMPreset(ctx context.Context, userID, name string, utm UTM) error {
+	s.Lock()
+	defer s.Unlock()
+
+	return s.record(utmPresetRecord{UserID: userID, Name: name, UTM: utm})
+}
+
+// GetUTMPreset gets preset of user.
+func (s *MapUTMPresets) GetUTMPreset(ctx context.Context, userID, name string) (UTM, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	utm, ok := s.Presets[userID][name]
+	if !ok {
+		return UTM{}, Err404
+	}
+	return utm, nil
+}
+
+// GetUTMPresets gets all presets of user.
+func (s *MapUTMPresets) GetUTMPresets(ctx context.Context, userID string) (map[string]UTM, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	presets := make(map[string]UTM, len(s.Presets[userID]))
+	for name, utm := range s.Presets[userID] {
+		presets[name] = utm
+	}
+	return presets, nil
+}
+
+// DeleteUTMPreset deletes preset of user.
+func (s *MapUTMPresets) DeleteUTMPreset(ctx context.Context, userID, name string) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if _, ok := s.Presets[userID][name]; !ok {
+		return Err404
+	}
+	return s.record(utmPresetRecord{UserID: userID, Name: name, Deleted: true})
+}
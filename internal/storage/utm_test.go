@@ -0,0 +1,100 @@
+package storage
+
+import (
+	"context"
+	"net/url"
+	"path/filepath"
+	"testing"
+
+	"github.com/size12/url-shortener/internal/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUTM_Merge(t *testing.T) {
+	preset := UTM{Source: "newsletter", Medium: "email", Campaign: "spring"}
+	utm := preset.Merge(UTM{Campaign: "summer", Content: "button"})
+
+	assert.Equal(t, UTM{Source: "newsletter", Medium: "email", Campaign: "summer", Content: "button"}, utm)
+	assert.Equal(t, url.Values{
+		"utm_source":   {"newsletter"},
+		"utm_medium":   {"email"},
+		"utm_campaign": {"summer"},
+		"utm_content":  {"button"},
+	}, utm.Values())
+	assert.Empty(t, UTM{}.Values())
+}
+
+func TestMapUTMPresets(t *testing.T) {
+	s := NewMapUTMPresets()
+	ctx := context.Background()
+
+	_, err := s.GetUTMPreset(ctx, "user12", "newsletter")
+	assert.Equal(t, Err404, err)
+
+	utm := UTM{Source: "newsletter", Medium: "email"}
+	assert.NoError(t, s.SetUTMPreset(ctx, "user12", "newsletter", utm))
+
+	got, err := s.GetUTMPreset(ctx, "user12", "newsletter")
+	assert.NoError(t, err)
+	assert.Equal(t, utm, got)
+
+	// presets of other users aren't visible.
+	_, err = s.GetUTMPreset(ctx, "user13", "newsletter")
+	assert.Equal(t, Err404, err)
+
+	presets, err := s.GetUTMPresets(ctx, "user12")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]UTM{"newsletter": utm}, presets)
+
+	assert.NoError(t, s.DeleteUTMPreset(ctx, "user12", "newsletter"))
+	assert.Equal(t, Err404, s.DeleteUTMPreset(ctx, "user12", "newsletter"))
+}
+
+func TestFileUTMPresets(t *testing.T) {
+	cfg := config.GetTestConfig()
+	cfg.StoragePath = filepath.Join(t.TempDir(), "links.txt")
+	ctx := context.Background()
+
+	file, err := NewFileStorage(cfg)
+	assert.NoError(t, err)
+	presets, err := NewUTMPresetStorage(file)
+	assert.NoError(t, err)
+	s := presets.(*MapUTMPresets)
+	assert.NotNil(t, s.File)
+
+	newsletter := UTM{Source: "newsletter", Medium: "email"}
+	assert.NoError(t, s.SetUTMPreset(ctx, "user12", "newsletter", UTM{Source: "newsletter"}))
+	assert.NoError(t, s.SetUTMPreset(ctx, "user12", "newsletter", newsletter))
+	assert.NoError(t, s.SetUTMPreset(ctx, "user12", "ads", UTM{Source: "google", Medium: "cpc"}))
+	assert.NoError(t, s.SetUTMPreset(ctx, "user13", "newsletter", UTM{Source: "other"}))
+	assert.NoError(t, s.DeleteUTMPreset(ctx, "user12", "ads"))
+
+	// presets are restored from file, the last change wins.
+	s, err = NewFileUTMPresets(cfg.StoragePath + UTMPresetSuffix)
+	assert.NoError(t, err)
+
+	got, err := s.GetUTMPresets(ctx, "user12")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]UTM{"newsletter": newsletter}, got)
+
+	utm, err := s.GetUTMPreset(ctx, "user13", "newsletter")
+	assert.NoError(t, err)
+	assert.Equal(t, UTM{Source: "other"}, utm)
+}
+
+func TestNewUTMPresetStorage(t *testing.T) {
+	cfg := config.GetTestConfig()
+
+	db, err := NewDBStorage(cfg)
+	assert.NoError(t, err)
+	presets, err := NewUTMPresetStorage(db)
+	assert.NoError(t, err)
+	assert.Equal(t, db, presets)
+
+	m, err := NewMapStorage(cfg)
+	assert.NoError(t, err)
+	presets, err = NewUTMPresetStorage(m)
+	assert.NoError(t, err)
+	assert.IsType(t, &MapUTMPresets{}, presets)
+	assert.Nil(t, presets.(*MapUTMPresets).File)
+}
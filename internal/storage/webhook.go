@@ -0,0 +1,326 @@
+package storage
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// WebhookSuffix is suffix of file, which stores webhooks and their deliveries of file storage.
+const WebhookSuffix = ".webhooks"
+
+// Events of links, which webhooks can subscribe to.
+const (
+	EventLinkCreated = "link.created"
+	EventLinkClicked = "link.clicked"
+	EventLinkDeleted = "link.deleted"
+)
+
+// Statuses of webhook delivery. Dead delivery failed every attempt, it's in dead-letter list until it's replayed.
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryDead      = "dead"
+)
+
+// Webhook is user's subscription to events of links. Payloads are signed by Secret.
+type Webhook struct {
+	ID        int64     `json:"id"`
+	UserID    string    `json:"user_id"`
+	URL       string    `json:"url"`
+	Secret    string    `json:"secret"`
+	Events    []string  `json:"events"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// HasEvent checks if webhook is subscribed to event.
+func (hook Webhook) HasEvent(event string) bool {
+	for _, e := range hook.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// Delivery is payload of event, which is sent to webhook. Pending delivery is sent at NextAttempt.
+type Delivery struct {
+	ID           int64           `json:"id"`
+	WebhookID    int64           `json:"webhook_id"`
+	UserID       string          `json:"user_id"`
+	Event        string          `json:"event"`
+	Payload      json.RawMessage `json:"payload"`
+	Status       string          `json:"status"`
+	Attempts     int             `json:"attempts"`
+	ResponseCode int             `json:"response_code,omitempty"`
+	LastError    string          `json:"last_error,omitempty"`
+	NextAttempt  time.Time       `json:"next_attempt"`
+	CreatedAt    time.Time       `json:"created_at"`
+	UpdatedAt    time.Time       `json:"updated_at"`
+}
+
+// WebhookStorage stores webhooks and their deliveries.
+type WebhookStorage interface {
+	// AddWebhook adds webhook and returns it with ID.
+	AddWebhook(ctx context.Context, hook Webhook) (Webhook, error)
+	// GetWebhook gets webhook. It returns Err404, if there is no such webhook.
+	GetWebhook(ctx context.Context, id int64) (Webhook, error)
+	// GetWebhooks gets webhooks of user from the oldest.
+	GetWebhooks(ctx context.Context, userID string) ([]Webhook, error)
+	// DeleteWebhook deletes webhook of user. It returns Err404, if user has no such webhook.
+	DeleteWebhook(ctx context.Context, userID string, id int64) error
+	// AddDelivery adds delivery and returns it with ID.
+	AddDelivery(ctx context.Context, d Delivery) (Delivery, error)
+	// GetDelivery gets delivery. It returns Err404, if there is no such delivery.
+	GetDelivery(ctx context.Context, id int64) (Delivery, error)
+	// UpdateDelivery saves status and attempts of delivery.
+	UpdateDelivery(ctx context.Context, d Delivery) error
+	// GetDeliveries gets at most limit deliveries of user from the newest. Empty status gets deliveries of any status.
+	GetDeliveries(ctx context.Context, userID, status string, limit int) ([]Delivery, error)
+	// GetDueDeliveries gets at most limit pending deliveries, which should be sent at now, from the oldest.
+	GetDueDeliveries(ctx context.Context, now time.Time, limit int) ([]Delivery, error)
+}
+
+// NewWebhookStorage gets webhooks storage of links storage.
+// DB storage stores webhooks in tables, file storage in file next to links file, other storages in memory.
+func NewWebhookStorage(s Storage) (WebhookStorage, error) {
+	if webhooks, ok := s.(WebhookStorage); ok {
+		return webhooks, nil
+	}
+
+	if file, ok := s.(*FileStorage); ok {
+		return NewFileWebhooks(file.Cfg.StoragePath + WebhookSuffix)
+	}
+
+	return NewMapWebhooks(), nil
+}
+
+// webhookRecord is line of webhooks file: new or deleted webhook, or new or changed delivery.
+type webhookRecord struct {
+	Webhook  *Webhook  `json:"webhook,omitempty"`
+	Deleted  bool      `json:"deleted,omitempty"`
+	Delivery *Delivery `json:"delivery,omitempty"`
+}
+
+// MapWebhooks stores webhooks and deliveries in slices, ID is index plus one. Deleted webhook has zero ID.
+// If File is set, every change is appended to it.
+type MapWebhooks struct {
+	Webhooks   []Webhook
+	Deliveries []Delivery
+	File       *os.File
+	*sync.Mutex
+}
+
+// NewMapWebhooks creates new in-memory webhooks storage.
+func NewMapWebhooks() *MapWebhooks {
+	return &MapWebhooks{Mutex: &sync.Mutex{}}
+}
+
+// NewFileWebhooks creates webhooks storage, which keeps changes as JSON lines in file.
+// Changed delivery is appended again, so the last line of delivery wins.
+// File has secrets of webhooks, so only owner can read it.
+func NewFileWebhooks(path string) (*MapWebhooks, error) {
+	s := NewMapWebhooks()
+
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_APPEND|os.O_CREATE|os.O_SYNC, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	// file could be created with wider permissions before.
+	if err := file.Chmod(0600); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 16<<20)
+	for scanner.Scan() {
+		var record webhookRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			file.Close()
+			return nil, err
+		}
+
+		if hook := record.Webhook; hook != nil && hook.ID > 0 {
+			if hook.ID > int64(len(s.Webhooks)) {
+				s.Webhooks = append(s.Webhooks, make([]Webhook, int(hook.ID)-len(s.Webhooks))...)
+			}
+			if record.Deleted {
+				s.Webhooks[hook.ID-1] = Webhook{}
+			} else {
+				s.Webhooks[hook.ID-1] = *hook
+			}
+		}
+
+		if d := record.Delivery; d != nil && d.ID > 0 {
+			if d.ID > int64(len(s.Deliveries)) {
+				s.Deliveries = append(s.Deliveries, make([]Delivery, int(d.ID)-len(s.Deliveries))...)
+			}
+			s.Deliveries[d.ID-1] = *d
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	s.File = file
+	return s, nil
+}
+
+// save appends record to file, if it's set.
+func (s *MapWebhooks) save(record webhookRecord) error {
+	if s.File == nil {
+		return nil
+	}
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.File.Write(append(data, '\n'))
+	return err
+}
+
+// AddWebhook adds webhook.
+func (s *MapWebhooks) AddWebhook(ctx context.Context, hook Webhook) (Webhook, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	hook.ID = int64(len(s.Webhooks)) + 1
+	if err := s.save(webhookRecord{Webhook: &hook}); err != nil {
+		return Webhook{}, err
+	}
+
+	s.Webhooks = append(s.Webhooks, hook)
+	return hook, nil
+}
+
+// GetWebhook gets webhook.
+func (s *MapWebhooks) GetWebhook(ctx context.Context, id int64) (Webhook, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	if id <= 0 || id > int64(len(s.Webhooks)) || s.Webhooks[id-1].ID == 0 {
+		return Webhook{}, Err404
+	}
+	return s.Webhooks[id-1], nil
+}
+
+// GetWebhooks gets webhooks of user.
+func (s *MapWebhooks) GetWebhooks(ctx context.Context, userID string) ([]Webhook, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	hooks := make([]Webhook, 0)
+	for _, hook := range s.Webhooks {
+		if hook.ID != 0 && hook.UserID == userID {
+			hooks = append(hooks, hook)
+		}
+	}
+	return hooks, nil
+}
+
+// DeleteWebhook deletes webhook of user.
+func (s *MapWebhooks) DeleteWebhook(ctx context.Context, userID string, id int64) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if id <= 0 || id > int64(len(s.Webhooks)) || s.Webhooks[id-1].ID == 0 || s.Webhooks[id-1].UserID != userID {
+		return Err404
+	}
+
+	hook := s.Webhooks[id-1]
+	if err := s.save(webhookRecord{Webhook: &hook, Deleted: true}); err != nil {
+		return err
+	}
+
+	s.Webhooks[id-1] = Webhook{}
+	return nil
+}
+
+// AddDelivery adds delivery.
+func (s *MapWebhooks) AddDelivery(ctx context.Context, d Delivery) (Delivery, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	d.ID = int64(len(s.Deliveries)) + 1
+	if err := s.save(webhookRecord{Delivery: &d}); err != nil {
+		return Delivery{}, err
+	}
+
+	s.Deliveries = append(s.Deliveries, d)
+	return d, nil
+}
+
+// GetDelivery gets delivery.
+func (s *MapWebhooks) GetDelivery(ctx context.Context, id int64) (Delivery, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	if id <= 0 || id > int64(len(s.Deliveries)) || s.Deliveries[id-1].ID == 0 {
+		return Delivery{}, Err404
+	}
+	return s.Deliveries[id-1], nil
+}
+
+// UpdateDelivery saves delivery.
+func (s *MapWebhooks) UpdateDelivery(ctx context.Context, d Delivery) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if d.ID <= 0 || d.ID > int64(len(s.Deliveries)) || s.Deliveries[d.ID-1].ID == 0 {
+		return Err404
+	}
+
+	if err := s.save(webhookRecord{Delivery: &d}); err != nil {
+		return err
+	}
+
+	s.Deliveries[d.ID-1] = d
+	return nil
+}
+
+// GetDeliveries gets deliveries of user from the newest.
+func (s *MapWebhooks) GetDeliveries(ctx context.Context, userID, status string, limit int) ([]Delivery, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	deliveries := make([]Delivery, 0)
+	for i := len(s.Deliveries) - 1; i >= 0 && (limit <= 0 || len(deliveries) < limit); i-- {
+		d := s.Deliveries[i]
+		if d.ID != 0 && d.UserID == userID && (status == "" || d.Status == status) {
+			deliveries = append(deliveries, d)
+		}
+	}
+	return deliveries, nil
+}
+
+// GetDueDeliveries gets pending deliveries, which should be sent at now, from the oldest.
+func (s *MapWebhooks) GetDueDeliveries(ctx context.Context, now time.Time, limit int) ([]Delivery, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	deliveries := make([]Delivery, 0)
+	for _, d := range s.Deliveries {
+		if d.ID != 0 && d.Status == DeliveryPending && !d.NextAttempt.After(now) {
+			deliveries = append(deliveries, d)
+		}
+	}
+
+	sort.SliceStable(deliveries, func(i, j int) bool {
+		return deliveries[i].NextAttempt.Before(deliveries[j].NextAttempt)
+	})
+
+	if limit > 0 && len(deliveries) > limit {
+		deliveries = deliveries[:limit]
+	}
+	return deliveries, nil
+}
@@ -0,0 +1,205 @@
+package storage
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/size12/url-shortener/internal/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileWebhooks(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "links.txt"+WebhookSuffix)
+	ctx := context.Background()
+	created := time.Date(2023, 3, 12, 10, 0, 0, 0, time.UTC)
+
+	s, err := NewFileWebhooks(path)
+	assert.NoError(t, err)
+
+	// file has secrets.
+	info, err := os.Stat(path)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	_, err = s.GetWebhook(ctx, 1)
+	assert.ErrorIs(t, err, Err404)
+
+	hook, err := s.AddWebhook(ctx, Webhook{UserID: "user12", URL: "https://crm.example.com/hook", Secret: "secret",
+		Events: []string{EventLinkCreated, EventLinkDeleted}, CreatedAt: created})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), hook.ID)
+	assert.True(t, hook.HasEvent(EventLinkDeleted))
+	assert.False(t, hook.HasEvent(EventLinkClicked))
+
+	other, err := s.AddWebhook(ctx, Webhook{UserID: "user13", URL: "https://crm.example.com/other", CreatedAt: created})
+	assert.NoError(t, err)
+
+	first, err := s.AddDelivery(ctx, Delivery{WebhookID: hook.ID, UserID: "user12", Event: EventLinkCreated,
+		Payload: json.RawMessage(`{"id":"evt_1"}`), Status: DeliveryPending, NextAttempt: created, CreatedAt: created, UpdatedAt: created})
+	assert.NoError(t, err)
+	second, err := s.AddDelivery(ctx, Delivery{WebhookID: hook.ID, UserID: "user12", Event: EventLinkDeleted,
+		Payload: json.RawMessage(`{"id":"evt_2"}`), Status: DeliveryPending, NextAttempt: created.Add(-time.Minute),
+		CreatedAt: created, UpdatedAt: created})
+	assert.NoError(t, err)
+
+	// due deliveries are sent from the oldest attempt.
+	due, err := s.GetDueDeliveries(ctx, created, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, []Delivery{second, first}, due)
+	due, err = s.GetDueDeliveries(ctx, created.Add(-time.Hour), 10)
+	assert.NoError(t, err)
+	assert.Empty(t, due)
+
+	first.Status, first.Attempts, first.ResponseCode, first.LastError = DeliveryDead, 3, 500, "webhook responded with status 500"
+	assert.NoError(t, s.UpdateDelivery(ctx, first))
+	assert.ErrorIs(t, s.UpdateDelivery(ctx, Delivery{ID: 3}), Err404)
+
+	assert.ErrorIs(t, s.DeleteWebhook(ctx, "user12", other.ID), Err404)
+	assert.NoError(t, s.DeleteWebhook(ctx, "user13", other.ID))
+
+	// webhooks and deliveries are restored from file.
+	s, err = NewFileWebhooks(path)
+	assert.NoError(t, err)
+
+	hooks, err := s.GetWebhooks(ctx, "user12")
+	assert.NoError(t, err)
+	assert.Equal(t, []Webhook{hook}, hooks)
+
+	_, err = s.GetWebhook(ctx, other.ID)
+	assert.ErrorIs(t, err, Err404)
+
+	restored, err := s.GetDelivery(ctx, first.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, first, restored)
+
+	deliveries, err := s.GetDeliveries(ctx, "user12", "", 10)
+	assert.NoError(t, err)
+	assert.Equal(t, []Delivery{second, first}, deliveries)
+
+	deliveries, err = s.GetDeliveries(ctx, "user12", DeliveryDead, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, []Delivery{first}, deliveries)
+
+	deliveries, err = s.GetDeliveries(ctx, "user13", "", 10)
+	assert.NoError(t, err)
+	assert.Empty(t, deliveries)
+
+	// new webhook doesn't reuse ID of deleted one.
+	hook, err = s.AddWebhook(ctx, Webhook{UserID: "user13", URL: "https://crm.example.com/new", CreatedAt: created})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), hook.ID)
+}
+
+func TestNewWebhookStorage(t *testing.T) {
+	cfg := config.GetTestConfig()
+
+	s, err := NewMapStorage(cfg)
+	assert.NoError(t, err)
+	webhooks, err := NewWebhookStorage(s)
+	assert.NoError(t, err)
+	assert.IsType(t, &MapWebhooks{}, webhooks)
+
+	db, err := NewDBStorage(cfg)
+	assert.NoError(t, err)
+	webhooks, err = NewWebhookStorage(db)
+	assert.NoError(t, err)
+	assert.Equal(t, db, webhooks)
+}
+
+func TestDBStorage_Webhooks(t *testing.T) {
+	cfg := config.GetTestConfig()
+	s, err := NewDBStorage(cfg)
+	assert.NoError(t, err)
+
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	assert.NoError(t, err)
+	defer db.Close()
+	s.DB = db
+
+	ctx := context.Background()
+	created := time.Date(2023, 3, 12, 10, 0, 0, 0, time.UTC)
+	events := []string{EventLinkCreated, EventLinkClicked}
+
+	mock.ExpectQuery("INSERT INTO webhooks (cookie, url, secret, events, created_at) VALUES ($1, $2, $3, $4, $5) RETURNING id").
+		WithArgs("user12", "https://crm.example.com/hook", "secret", "link.created,link.clicked", created).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(2))
+	hook, err := s.AddWebhook(ctx, Webhook{UserID: "user12", URL: "https://crm.example.com/hook", Secret: "secret",
+		Events: events, CreatedAt: created})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), hook.ID)
+
+	hookColumns := []string{"id", "cookie", "url", "secret", "events", "created_at"}
+	mock.ExpectQuery("SELECT id, cookie, url, secret, events, created_at FROM webhooks WHERE id = $1").
+		WithArgs(int64(2)).WillReturnRows(sqlmock.NewRows(hookColumns).
+		AddRow(2, "user12", "https://crm.example.com/hook", "secret", "link.created,link.clicked", created))
+	got, err := s.GetWebhook(ctx, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, hook, got)
+
+	mock.ExpectQuery("SELECT id, cookie, url, secret, events, created_at FROM webhooks WHERE id = $1").
+		WithArgs(int64(3)).WillReturnRows(sqlmock.NewRows(hookColumns))
+	_, err = s.GetWebhook(ctx, 3)
+	assert.ErrorIs(t, err, Err404)
+
+	mock.ExpectQuery("SELECT id, cookie, url, secret, events, created_at FROM webhooks WHERE cookie = $1 ORDER BY id").
+		WithArgs("user12").WillReturnRows(sqlmock.NewRows(hookColumns).
+		AddRow(2, "user12", "https://crm.example.com/hook", "secret", "link.created,link.clicked", created))
+	hooks, err := s.GetWebhooks(ctx, "user12")
+	assert.NoError(t, err)
+	assert.Equal(t, []Webhook{hook}, hooks)
+
+	mock.ExpectExec("DELETE FROM webhooks WHERE id = $1 AND cookie = $2").
+		WithArgs(int64(2), "user13").WillReturnResult(sqlmock.NewResult(0, 0))
+	assert.ErrorIs(t, s.DeleteWebhook(ctx, "user13", 2), Err404)
+
+	payload := `{"id":"evt_1"}`
+	mock.ExpectQuery("INSERT INTO webhook_deliveries (webhook_id, cookie, event, payload, status, attempts, response_code, last_error, "+
+		"next_attempt, created_at, updated_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11) RETURNING id").
+		WithArgs(int64(2), "user12", EventLinkCreated, payload, DeliveryPending, 0, 0, "", created, created, created).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(5))
+	d, err := s.AddDelivery(ctx, Delivery{WebhookID: 2, UserID: "user12", Event: EventLinkCreated, Payload: json.RawMessage(payload),
+		Status: DeliveryPending, NextAttempt: created, CreatedAt: created, UpdatedAt: created})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(5), d.ID)
+
+	deliveryColumns := []string{"id", "webhook_id", "cookie", "event", "payload", "status", "attempts", "response_code",
+		"last_error", "next_attempt", "created_at", "updated_at"}
+	deliveryRow := []driver.Value{5, 2, "user12", EventLinkCreated, payload, DeliveryPending, 0, 0, "", created, created, created}
+
+	mock.ExpectQuery("SELECT id, webhook_id, cookie, event, payload, status, attempts, response_code, last_error, next_attempt, " +
+		"created_at, updated_at FROM webhook_deliveries WHERE id = $1").
+		WithArgs(int64(5)).WillReturnRows(sqlmock.NewRows(deliveryColumns).AddRow(deliveryRow...))
+	gotDelivery, err := s.GetDelivery(ctx, 5)
+	assert.NoError(t, err)
+	assert.Equal(t, d, gotDelivery)
+
+	mock.ExpectQuery("SELECT id, webhook_id, cookie, event, payload, status, attempts, response_code, last_error, next_attempt, "+
+		"created_at, updated_at FROM webhook_deliveries WHERE cookie = $1 AND ($2 = '' OR status = $2) ORDER BY id DESC LIMIT $3").
+		WithArgs("user12", DeliveryPending, 50).WillReturnRows(sqlmock.NewRows(deliveryColumns).AddRow(deliveryRow...))
+	deliveries, err := s.GetDeliveries(ctx, "user12", DeliveryPending, 50)
+	assert.NoError(t, err)
+	assert.Equal(t, []Delivery{d}, deliveries)
+
+	mock.ExpectQuery("SELECT id, webhook_id, cookie, event, payload, status, attempts, response_code, last_error, next_attempt, "+
+		"created_at, updated_at FROM webhook_deliveries WHERE status = $1 AND next_attempt <= $2 ORDER BY next_attempt LIMIT $3").
+		WithArgs(DeliveryPending, created, 100).WillReturnRows(sqlmock.NewRows(deliveryColumns).AddRow(deliveryRow...))
+	deliveries, err = s.GetDueDeliveries(ctx, created, 100)
+	assert.NoError(t, err)
+	assert.Equal(t, []Delivery{d}, deliveries)
+
+	d.Status, d.Attempts, d.ResponseCode, d.LastError = DeliveryPending, 1, 502, "webhook responded with status 502"
+	d.NextAttempt = created.Add(30 * time.Second)
+	mock.ExpectExec("UPDATE webhook_deliveries SET status = $1, attempts = $2, response_code = $3, last_error = $4, "+
+		"next_attempt = $5, updated_at = $6 WHERE id = $7").
+		WithArgs(DeliveryPending, 1, 502, "webhook responded with status 502", d.NextAttempt, created, int64(5)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	assert.NoError(t, s.UpdateDelivery(ctx, d))
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
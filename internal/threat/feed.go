@@ -0,0 +1,240 @@
+package threat
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/size12/url-shortener/internal/logger"
+	"github.com/size12/url-shortener/internal/urlnorm"
+	"go.uber.org/zap"
+)
+
+// Limits of url expressions, which are hashed for hash-prefix lookup, like in Safe Browsing.
+const (
+	maxHostComponents = 5
+	maxPathPrefixes   = 4
+)
+
+// Hash prefix length limits in bytes.
+const (
+	minPrefixLength = 4
+	maxPrefixLength = sha256.Size
+)
+
+// FeedChecker checks urls against local threat feed file. File is reloaded, when it's modified.
+//
+// Every line of file is domain or "hash <hex>", lines starting with "#" are comments.
+// Domain matches itself and its subdomains.
+// Hash is prefix (4-32 bytes) of SHA-256 of url expression "host/path" as in Safe Browsing:
+// host and its parent domains are combined with path, path without query and parent directories.
+type FeedChecker struct {
+	*sync.Mutex
+	file     string
+	domains  map[string]bool
+	prefixes map[int]map[string]bool
+	modTime  time.Time
+	checked  time.Time
+	interval time.Duration
+	now      func() time.Time
+}
+
+// NewFeedChecker loads threat feed from file. File is checked for changes every interval.
+func NewFeedChecker(file string, interval time.Duration) (*FeedChecker, error) {
+	c := &FeedChecker{
+		Mutex:    &sync.Mutex{},
+		file:     file,
+		interval: interval,
+		now:      time.Now,
+	}
+
+	info, err := os.Stat(file)
+	if err != nil {
+		return nil, err
+	}
+
+	err = c.load(info.ModTime())
+	if err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// load loads threat feed from file.
+func (c *FeedChecker) load(modTime time.Time) error {
+	file, err := os.Open(c.file)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	domains := make(map[string]bool)
+	prefixes := make(map[int]map[string]bool)
+
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		if strings.HasPrefix(text, "hash ") {
+			prefix, err := hex.DecodeString(strings.TrimSpace(strings.TrimPrefix(text, "hash ")))
+			if err != nil || len(prefix) < minPrefixLength || len(prefix) > maxPrefixLength {
+				return fmt.Errorf("line %d: hash must be hex prefix of %d-%d bytes", line, minPrefixLength, maxPrefixLength)
+			}
+
+			if prefixes[len(prefix)] == nil {
+				prefixes[len(prefix)] = make(map[string]bool)
+			}
+			prefixes[len(prefix)][string(prefix)] = true
+			continue
+		}
+
+		domain, err := urlnorm.NormalizeHost(strings.Trim(text, "."))
+		if err != nil || strings.ContainsAny(domain, " /") {
+			return fmt.Errorf("line %d: invalid domain %q", line, text)
+		}
+		domains[domain] = true
+	}
+
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	c.domains, c.prefixes = domains, prefixes
+	c.modTime = modTime
+	c.checked = c.now()
+	return nil
+}
+
+// reload reloads threat feed, if file was modified. If new file is invalid, old feed is used.
+func (c *FeedChecker) reload() {
+	if c.now().Sub(c.checked) < c.interval {
+		return
+	}
+	c.checked = c.now()
+
+	info, err := os.Stat(c.file)
+	if err != nil {
+		logger.Log.Error("Failed check threat feed", zap.Error(err))
+		return
+	}
+
+	if info.ModTime().Equal(c.modTime) {
+		return
+	}
+
+	if err := c.load(info.ModTime()); err != nil {
+		logger.Log.Error("Failed reload threat feed", zap.Error(err))
+		return
+	}
+
+	logger.Log.Info("Threat feed reloaded", zap.String("file", c.file))
+}
+
+// CheckURL checks if url or its domain is in threat feed.
+func (c *FeedChecker) CheckURL(ctx context.Context, rawURL string) (Verdict, error) {
+	canonical, err := urlnorm.Normalize(rawURL, urlnorm.Rules{DropFragment: true})
+	if err != nil {
+		return Verdict{}, err
+	}
+
+	u, err := url.Parse(canonical)
+	if err != nil || u.Host == "" {
+		return Verdict{}, nil
+	}
+
+	hosts := hostSuffixes(u.Hostname())
+	expressions := urlExpressions(hosts, u)
+
+	c.Lock()
+	defer c.Unlock()
+
+	c.reload()
+
+	for _, host := range hosts {
+		if c.domains[host] {
+			return Verdict{Malicious: true, Reason: "domain " + host + " is in threat feed"}, nil
+		}
+	}
+
+	for _, expression := range expressions {
+		hash := sha256.Sum256([]byte(expression))
+		for length, prefixes := range c.prefixes {
+			if prefixes[string(hash[:length])] {
+				return Verdict{Malicious: true, Reason: "url matches threat feed"}, nil
+			}
+		}
+	}
+
+	return Verdict{}, nil
+}
+
+// hostSuffixes gets host and its parent domains. Top level domain alone isn't included.
+func hostSuffixes(host string) []string {
+	host = strings.TrimSuffix(host, ".")
+	if net.ParseIP(host) != nil {
+		return []string{host}
+	}
+
+	hosts := []string{host}
+	components := strings.Split(host, ".")
+	if len(components) > maxHostComponents {
+		components = components[len(components)-maxHostComponents:]
+	}
+
+	for i := 1; i < len(components)-1; i++ {
+		if suffix := strings.Join(components[i:], "."); suffix != host {
+			hosts = append(hosts, suffix)
+		}
+	}
+
+	return hosts
+}
+
+// urlExpressions combines hosts with full path, path without query, root and first parent directories.
+func urlExpressions(hosts []string, u *url.URL) []string {
+	escaped := u.EscapedPath()
+	if escaped == "" {
+		escaped = "/"
+	}
+
+	paths := []string{escaped}
+	if u.RawQuery != "" {
+		paths = append([]string{escaped + "?" + u.RawQuery}, paths...)
+	}
+
+	dirs := strings.Split(strings.Trim(escaped, "/"), "/")
+	if !strings.HasSuffix(escaped, "/") {
+		dirs = dirs[:len(dirs)-1]
+	}
+
+	dir := "/"
+	for i := 0; i < maxPathPrefixes; i++ {
+		if dir != escaped {
+			paths = append(paths, dir)
+		}
+		if i >= len(dirs) || dirs[i] == "" {
+			break
+		}
+		dir += dirs[i] + "/"
+	}
+
+	expressions := make([]string, 0, len(hosts)*len(paths))
+	for _, host := range hosts {
+		for _, p := range paths {
+			expressions = append(expressions, host+p)
+		}
+	}
+	return expressions
+}
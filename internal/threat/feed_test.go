@@ -0,0 +1,88 @@
+package threat
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// hashPrefix gets hex prefix of SHA-256 of url expression.
+func hashPrefix(expression string, length int) string {
+	hash := sha256.Sum256([]byte(expression))
+	return hex.EncodeToString(hash[:length])
+}
+
+func TestFeedChecker_CheckURL(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "feed.txt")
+	feed := "# threat feed\nevil.ru\n" +
+		"hash " + hashPrefix("phish.com/login/", 4) + "\n" +
+		"hash " + hashPrefix("docs.example.com/files/virus.exe", 32) + "\n"
+	assert.NoError(t, os.WriteFile(file, []byte(feed), 0600))
+
+	c, err := NewFeedChecker(file, 0)
+	assert.NoError(t, err)
+
+	tests := []struct {
+		url       string
+		malicious bool
+	}{
+		{url: "https://yandex.ru", malicious: false},
+		{url: "https://evil.ru/page", malicious: true},
+		{url: "https://WWW.Evil.ru", malicious: true},
+		{url: "https://notevil.ru", malicious: false},
+		{url: "https://phish.com/login/", malicious: true},
+		{url: "https://phish.com/login/step/2?user=1#form", malicious: true},
+		{url: "https://secure.phish.com/login/index.html", malicious: true},
+		{url: "https://phish.com/", malicious: false},
+		{url: "https://docs.example.com/files/virus.exe?download=1", malicious: true},
+		{url: "https://docs.example.com/files/readme.txt", malicious: false},
+		{url: "not url", malicious: false},
+	}
+
+	for _, tc := range tests {
+		verdict, err := c.CheckURL(context.Background(), tc.url)
+		assert.NoError(t, err, tc.url)
+		assert.Equal(t, tc.malicious, verdict.Malicious, tc.url)
+		if tc.malicious {
+			assert.NotEmpty(t, verdict.Reason, tc.url)
+		}
+	}
+
+	// feed is reloaded, invalid feed is ignored.
+	modTime := time.Now().Add(time.Minute)
+	assert.NoError(t, os.WriteFile(file, []byte("yandex.ru\n"), 0600))
+	assert.NoError(t, os.Chtimes(file, modTime, modTime))
+
+	verdict, err := c.CheckURL(context.Background(), "https://mail.yandex.ru")
+	assert.NoError(t, err)
+	assert.True(t, verdict.Malicious)
+
+	modTime = modTime.Add(time.Minute)
+	assert.NoError(t, os.WriteFile(file, []byte("hash xyz\n"), 0600))
+	assert.NoError(t, os.Chtimes(file, modTime, modTime))
+
+	verdict, err = c.CheckURL(context.Background(), "https://yandex.ru")
+	assert.NoError(t, err)
+	assert.True(t, verdict.Malicious)
+
+	_, err = NewFeedChecker(file, 0)
+	assert.Error(t, err)
+}
+
+func TestURLExpressions(t *testing.T) {
+	u, err := url.Parse("http://a.b.c/1/2.html?param=1")
+	assert.NoError(t, err)
+
+	expressions := urlExpressions(hostSuffixes(u.Hostname()), u)
+	assert.Equal(t, []string{
+		"a.b.c/1/2.html?param=1", "a.b.c/1/2.html", "a.b.c/", "a.b.c/1/",
+		"b.c/1/2.html?param=1", "b.c/1/2.html", "b.c/", "b.c/1/",
+	}, expressions)
+}
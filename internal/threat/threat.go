@@ -0,0 +1,23 @@
+// Package threat checks long urls against threat lists, so short links can't lead to phishing and malware.
+package threat
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrMaliciousURL is returned, if long url is flagged by checker.
+var ErrMaliciousURL = errors.New("url is flagged as malicious")
+
+// Verdict is result of url check.
+type Verdict struct {
+	Malicious bool
+	// Reason is why url is flagged, it can be shown to users.
+	Reason string
+}
+
+// URLChecker checks if url is malicious.
+// It's called, when link is created, and can be called again on redirect, because threat lists change.
+type URLChecker interface {
+	CheckURL(ctx context.Context, rawURL string) (Verdict, error)
+}
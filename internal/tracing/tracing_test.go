@@ -0,0 +1,107 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/size12/url-shortener/internal/config"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"google.golang.org/grpc"
+	grpccodes "google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// traceParent is W3C trace context of incoming request.
+const traceParent = "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"
+
+// recordSpans sets global tracer provider, which records spans for test.
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		_ = provider.Shutdown(context.Background())
+	})
+
+	return recorder
+}
+
+func TestMiddleware(t *testing.T) {
+	recorder := recordSpans(t)
+
+	r := chi.NewRouter()
+	r.Use(Middleware)
+	r.Get("/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTemporaryRedirect)
+	})
+
+	request := httptest.NewRequest(http.MethodGet, "/1", nil)
+	request.Header.Set("traceparent", traceParent)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, request)
+
+	spans := recorder.Ended()
+	assert.Len(t, spans, 1)
+	assert.Equal(t, "GET /{id}", spans[0].Name())
+	assert.Equal(t, "0af7651916cd43dd8448eb211c80319c", spans[0].SpanContext().TraceID().String())
+	assert.Equal(t, "b7ad6b7169203331", spans[0].Parent().SpanID().String())
+	assert.Equal(t, codes.Unset, spans[0].Status().Code)
+}
+
+func TestUnaryInterceptor(t *testing.T) {
+	recorder := recordSpans(t)
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.New(map[string]string{"traceparent": traceParent}))
+	info := &grpc.UnaryServerInfo{FullMethod: "/url_shortener.Shortener/GetLong"}
+
+	_, err := UnaryInterceptor(ctx, nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, status.Error(grpccodes.NotFound, "Link not in storage")
+	})
+	assert.Error(t, err)
+
+	spans := recorder.Ended()
+	assert.Len(t, spans, 1)
+	assert.Equal(t, info.FullMethod, spans[0].Name())
+	assert.Equal(t, "0af7651916cd43dd8448eb211c80319c", spans[0].SpanContext().TraceID().String())
+	assert.Equal(t, codes.Error, spans[0].Status().Code)
+}
+
+func TestNewExporter(t *testing.T) {
+	cfg := config.GetTestConfig()
+
+	// tracing is disabled.
+	for _, name := range []string{"", ExporterNone} {
+		cfg.TracingExporter = name
+		exporter, err := newExporter(cfg, nil)
+		assert.NoError(t, err)
+		assert.Nil(t, exporter)
+	}
+
+	// stdout exporter writes spans.
+	var buf bytes.Buffer
+	cfg.TracingExporter = ExporterStdout
+	exporter, err := newExporter(cfg, &buf)
+	assert.NoError(t, err)
+
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	_, span := provider.Tracer("test").Start(context.Background(), "GET /{id}")
+	span.End()
+	assert.NoError(t, provider.Shutdown(context.Background()))
+	assert.Contains(t, buf.String(), "GET /{id}")
+
+	cfg.TracingExporter = "jaeger"
+	_, err = newExporter(cfg, nil)
+	assert.Error(t, err)
+}
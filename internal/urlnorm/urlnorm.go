@@ -0,0 +1,166 @@
+// Package urlnorm normalizes long urls, so different spellings of the same url are stored as one link.
+package urlnorm
+
+import (
+	"errors"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/idna"
+)
+
+// ErrInvalidHost is returned, if host of url can't be converted to punycode.
+var ErrInvalidHost = errors.New("invalid host of url")
+
+// defaultPorts are ports, which are stripped from urls with these schemes.
+var defaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+	"ws":    "80",
+	"wss":   "443",
+	"ftp":   "21",
+}
+
+// Rules are optional normalization rules.
+// Scheme, host, port and path are always normalized, because it doesn't change where url leads.
+type Rules struct {
+	// SortQuery sorts query parameters by name. Values of the same parameter keep their order.
+	SortQuery bool
+	// DropFragment removes fragment from url.
+	DropFragment bool
+}
+
+// Normalize gets canonical form of url:
+// scheme and host are lowercased, IDN host is converted to punycode, default port is stripped
+// and path is cleaned. Query is sorted and fragment is dropped, if rules say so.
+// Urls without scheme or host are returned as is, storage decides if they are valid.
+func Normalize(raw string, rules Rules) (string, error) {
+	u, err := url.Parse(raw)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return raw, nil
+	}
+
+	u.Scheme = strings.ToLower(u.Scheme)
+
+	host, err := NormalizeHost(u.Hostname())
+	if err != nil {
+		return "", err
+	}
+
+	port := u.Port()
+	if port == defaultPorts[u.Scheme] {
+		port = ""
+	}
+
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+	if port != "" {
+		host += ":" + port
+	}
+	u.Host = host
+
+	if err := cleanPath(u); err != nil {
+		return raw, nil
+	}
+
+	u.ForceQuery = false
+	if rules.SortQuery {
+		sortQuery(u)
+	}
+
+	if rules.DropFragment {
+		u.Fragment = ""
+		u.RawFragment = ""
+	}
+
+	return u.String(), nil
+}
+
+// NormalizeHost lowercases host and converts IDN host to punycode.
+// ASCII hosts are only lowercased, so IDNA rules don't reject host names, which work in DNS.
+func NormalizeHost(host string) (string, error) {
+	if isASCII(host) {
+		return strings.ToLower(host), nil
+	}
+
+	ascii, err := idna.Lookup.ToASCII(host)
+	if err != nil {
+		return "", ErrInvalidHost
+	}
+	return strings.ToLower(ascii), nil
+}
+
+// isASCII checks if string has only ASCII characters.
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+// cleanPath removes dot segments and duplicate slashes from path. Trailing slash is kept,
+// but root path is removed, because "http://site.ru/" and "http://site.ru" are the same url.
+// Escaped path is cleaned, so escaped slashes stay escaped.
+func cleanPath(u *url.URL) error {
+	escaped := u.EscapedPath()
+	if escaped == "" || escaped == "/" {
+		u.Path, u.RawPath = "", ""
+		return nil
+	}
+
+	cleaned := path.Clean("/" + escaped)
+	if strings.HasSuffix(escaped, "/") && cleaned != "/" {
+		cleaned += "/"
+	}
+	if cleaned == "/" {
+		cleaned = ""
+	}
+
+	decoded, err := url.PathUnescape(cleaned)
+	if err != nil {
+		return err
+	}
+
+	u.Path, u.RawPath = decoded, cleaned
+	return nil
+}
+
+// sortQuery sorts query parameters by name. Parameters keep their encoding.
+func sortQuery(u *url.URL) {
+	if u.RawQuery == "" {
+		return
+	}
+
+	pairs := strings.Split(u.RawQuery, "&")
+	names := make([]string, len(pairs))
+	for i, pair := range pairs {
+		key, _, _ := strings.Cut(pair, "=")
+		name, err := url.QueryUnescape(key)
+		if err != nil {
+			name = key
+		}
+		names[i] = name
+	}
+
+	sort.Stable(byName{pairs: pairs, names: names})
+	u.RawQuery = strings.Join(pairs, "&")
+}
+
+// byName sorts query pairs by unescaped names.
+type byName struct {
+	pairs []string
+	names []string
+}
+
+func (b byName) Len() int           { return len(b.pairs) }
+func (b byName) Less(i, j int) bool { return b.names[i] < b.names[j] }
+func (b byName) Swap(i, j int) {
+	b.pairs[i], b.pairs[j] = b.pairs[j], b.pairs[i]
+	b.names[i], b.names[j] = b.names[j], b.names[i]
+}
@@ -0,0 +1,46 @@
+package urlnorm
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		name  string
+		raw   string
+		rules Rules
+		want  string
+	}{
+		{name: "scheme and host are lowercased", raw: "HTTP://Example.COM/Path", want: "http://example.com/Path"},
+		{name: "root path is removed", raw: "http://example.com/", want: "http://example.com"},
+		{name: "default port is stripped", raw: "http://example.com:80", want: "http://example.com"},
+		{name: "https default port is stripped", raw: "https://example.com:443/a", want: "https://example.com/a"},
+		{name: "other port is kept", raw: "https://example.com:80/a", want: "https://example.com:80/a"},
+		{name: "IDN host is converted to punycode", raw: "https://Яндекс.РФ/путь", want: "https://xn--d1acpjx3f.xn--p1ai/%D0%BF%D1%83%D1%82%D1%8C"},
+		{name: "IPv6 host", raw: "http://[::1]:80/", want: "http://[::1]"},
+		{name: "path is cleaned", raw: "http://example.com/a//b/./c/../d", want: "http://example.com/a/b/d"},
+		{name: "trailing slash is kept", raw: "http://example.com/a/b/", want: "http://example.com/a/b/"},
+		{name: "escaped slash stays escaped", raw: "http://example.com/a%2Fb/../c", want: "http://example.com/c"},
+		{name: "escaped slash in segment", raw: "http://example.com/a%2Fb", want: "http://example.com/a%2Fb"},
+		{name: "empty query is removed", raw: "http://example.com/a?", want: "http://example.com/a"},
+		{name: "query isn't sorted by default", raw: "http://example.com/?b=2&a=1#top", want: "http://example.com?b=2&a=1#top"},
+		{name: "query is sorted", raw: "http://example.com/?b=2&a=1&b=1&%61=3", rules: Rules{SortQuery: true}, want: "http://example.com?a=1&%61=3&b=2&b=1"},
+		{name: "fragment is dropped", raw: "http://example.com/a#top", rules: Rules{DropFragment: true}, want: "http://example.com/a"},
+		{name: "user info is kept", raw: "ftp://User@Example.com:21/file", want: "ftp://User@example.com/file"},
+		{name: "underscore in host", raw: "http://my_host.example.com", want: "http://my_host.example.com"},
+		{name: "url without scheme is kept", raw: "rkgrekgeg", want: "rkgrekgeg"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := Normalize(tc.raw, tc.rules)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+
+	_, err := Normalize("http://a\u200d.com/", Rules{})
+	assert.ErrorIs(t, err, ErrInvalidHost)
+}
@@ -0,0 +1,208 @@
+"use strict";
+
+// Web interface uses the same HTTP API as other clients. User is identified by userID cookie,
+// which is set by the service on the first request.
+
+const state = {
+  links: [],
+  selected: new Set(),
+};
+
+const $ = (id) => document.getElementById(id);
+
+// linkID gets ID of link from its short url.
+function linkID(shortURL) {
+  const path = new URL(shortURL, location.origin).pathname;
+  return path.slice(path.lastIndexOf("/") + 1);
+}
+
+function showMessage(element, text, isError) {
+  element.textContent = text;
+  element.classList.toggle("error", Boolean(isError));
+  element.hidden = !text;
+}
+
+// errorText gets message of error response. API errors are problem JSON with detail of error.
+async function errorText(response) {
+  const text = (await response.text()).trim();
+  if (response.headers.get("Content-Type") === "application/problem+json") {
+    try {
+      return JSON.parse(text).detail || response.statusText;
+    } catch {
+      // not JSON, so text is shown as is.
+    }
+  }
+  return text || response.statusText;
+}
+
+async function shorten(event) {
+  event.preventDefault();
+  const result = $("shorten-result");
+
+  const response = await fetch("/api/shorten", {
+    method: "POST",
+    headers: { "Content-Type": "application/json" },
+    body: JSON.stringify({ url: $("shorten-url").value }),
+  });
+
+  if (response.status !== 201 && response.status !== 409) {
+    showMessage(result, "Failed to shorten: " + (await errorText(response)), true);
+    return;
+  }
+
+  const { result: shortURL } = await response.json();
+  result.textContent = response.status === 409 ? "Link was already shortened: " : "Short link: ";
+  const anchor = document.createElement("a");
+  anchor.href = shortURL;
+  anchor.textContent = shortURL;
+  result.append(anchor);
+  result.classList.remove("error");
+  result.hidden = false;
+
+  $("shorten-url").value = "";
+  await loadHistory();
+}
+
+async function loadHistory() {
+  const message = $("history-message");
+  const response = await fetch("/api/user/urls");
+
+  if (response.status === 204) {
+    state.links = [];
+  } else if (response.ok) {
+    state.links = (await response.json()).map((link) => ({ ...link, id: linkID(link.short_url) }));
+  } else {
+    showMessage(message, "Failed to load links: " + (await errorText(response)), true);
+    return;
+  }
+
+  showMessage(message, state.links.length === 0 ? "You have no links yet." : "");
+  state.selected.clear();
+  render();
+}
+
+function render() {
+  const query = $("search").value.trim().toLowerCase();
+  const body = $("history").tBodies[0];
+  body.replaceChildren();
+
+  const visible = state.links.filter((link) =>
+    !query || link.short_url.toLowerCase().includes(query) || link.original_url.toLowerCase().includes(query));
+
+  for (const link of visible) {
+    const row = body.insertRow();
+
+    const checkbox = document.createElement("input");
+    checkbox.type = "checkbox";
+    checkbox.checked = state.selected.has(link.id);
+    checkbox.setAttribute("aria-label", "Select " + link.short_url);
+    checkbox.addEventListener("change", () => {
+      if (checkbox.checked) {
+        state.selected.add(link.id);
+      } else {
+        state.selected.delete(link.id);
+      }
+      updateSelection();
+    });
+    row.insertCell().append(checkbox);
+
+    const short = document.createElement("a");
+    short.href = link.short_url;
+    short.textContent = link.short_url;
+    row.insertCell().append(short);
+
+    const long = row.insertCell();
+    long.className = "long";
+    long.textContent = link.original_url;
+
+    const details = document.createElement("button");
+    details.type = "button";
+    details.textContent = "Stats & QR";
+    details.addEventListener("click", () => showDetails(link.id));
+    row.insertCell().append(details);
+  }
+
+  $("select-all").checked = visible.length > 0 && visible.every((link) => state.selected.has(link.id));
+  updateSelection();
+}
+
+function updateSelection() {
+  const button = $("delete-selected");
+  button.disabled = state.selected.size === 0;
+  button.textContent = state.selected.size === 0 ? "Delete selected" : `Delete selected (${state.selected.size})`;
+}
+
+function selectAll() {
+  const query = $("search").value.trim().toLowerCase();
+  for (const link of state.links) {
+    if (query && !link.short_url.toLowerCase().includes(query) && !link.original_url.toLowerCase().includes(query)) {
+      continue;
+    }
+    if ($("select-all").checked) {
+      state.selected.add(link.id);
+    } else {
+      state.selected.delete(link.id);
+    }
+  }
+  render();
+}
+
+async function deleteSelected() {
+  const ids = [...state.selected];
+  if (!confirm(`Delete ${ids.length} link(s)? Deleted links stop redirecting.`)) {
+    return;
+  }
+
+  const response = await fetch("/api/user/urls", {
+    method: "DELETE",
+    headers: { "Content-Type": "application/json" },
+    body: JSON.stringify(ids),
+  });
+
+  if (response.status !== 202) {
+    showMessage($("history-message"), "Failed to delete: " + (await errorText(response)), true);
+    return;
+  }
+
+  // links are deleted in background, so they are hidden at once.
+  state.links = state.links.filter((link) => !state.selected.has(link.id));
+  state.selected.clear();
+  showMessage($("history-message"), `Deleted ${ids.length} link(s).`);
+  $("details").hidden = true;
+  render();
+}
+
+function formatTime(value) {
+  return value ? new Date(value).toLocaleString() : "—";
+}
+
+async function showDetails(id) {
+  const response = await fetch(`/api/user/urls/${encodeURIComponent(id)}/stats`);
+  if (!response.ok) {
+    showMessage($("history-message"), "Failed to load stats: " + (await errorText(response)), true);
+    return;
+  }
+
+  const stats = await response.json();
+  $("details-id").textContent = stats.short_url;
+  $("details-url").textContent = stats.original_url;
+  $("details-created").textContent = formatTime(stats.created_at);
+  $("details-clicks").textContent = String(stats.clicks);
+  $("details-last-click").textContent = formatTime(stats.last_click);
+
+  const qr = `/${encodeURIComponent(id)}/qr`;
+  $("details-qr").src = `${qr}?format=svg&size=192`;
+  $("details-qr-svg").href = `${qr}?format=svg&size=512`;
+  $("details-qr-png").href = `${qr}?format=png&size=512`;
+
+  $("details").hidden = false;
+  $("details").scrollIntoView({ behavior: "smooth" });
+}
+
+$("shorten-form").addEventListener("submit", shorten);
+$("search").addEventListener("input", render);
+$("refresh").addEventListener("click", loadHistory);
+$("select-all").addEventListener("change", selectAll);
+$("delete-selected").addEventListener("click", deleteSelected);
+
+loadHistory();
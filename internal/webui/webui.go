@@ -0,0 +1,30 @@
+// Package webui serves embedded web interface for managing links.
+package webui
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+// static are files of web interface.
+//
+//go:embed static
+var static embed.FS
+
+// Handler serves web interface, which is mounted at prefix.
+// Interface uses HTTP API with cookie of user, so it shows links of the same user as API.
+func Handler(prefix string) http.Handler {
+	files, err := fs.Sub(static, "static")
+	if err != nil {
+		// static directory is embedded, so it always exists.
+		panic(err)
+	}
+
+	fileServer := http.StripPrefix(prefix, http.FileServer(http.FS(files)))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// interface is changed with service, so it's revalidated on every load.
+		w.Header().Set("Cache-Control", "no-cache")
+		fileServer.ServeHTTP(w, r)
+	})
+}
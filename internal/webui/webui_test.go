@@ -0,0 +1,40 @@
+package webui
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandler(t *testing.T) {
+	r := chi.NewRouter()
+	r.Method(http.MethodGet, "/ui/*", Handler("/ui"))
+
+	tests := []struct {
+		target      string
+		code        int
+		contentType string
+		contains    string
+	}{
+		{target: "/ui/", code: http.StatusOK, contentType: "text/html; charset=utf-8", contains: `<script src="app.js">`},
+		{target: "/ui/app.js", code: http.StatusOK, contentType: "javascript", contains: "/api/user/urls"},
+		{target: "/ui/style.css", code: http.StatusOK, contentType: "text/css; charset=utf-8", contains: "table"},
+		{target: "/ui/missing.js", code: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		request := httptest.NewRequest(http.MethodGet, tt.target, nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, request)
+
+		assert.Equal(t, tt.code, w.Code, tt.target)
+		assert.Contains(t, w.Header().Get("Content-Type"), tt.contentType, tt.target)
+		assert.Contains(t, w.Body.String(), tt.contains, tt.target)
+		if tt.code == http.StatusOK {
+			assert.Equal(t, "no-cache", w.Header().Get("Cache-Control"), tt.target)
+		}
+	}
+}
@@ -0,0 +1,3 @@
+ALTER TABLE links
+    DROP COLUMN IF EXISTS created_at,
+    DROP COLUMN IF EXISTS options;
@@ -0,0 +1,3 @@
+ALTER TABLE links
+    ADD COLUMN created_at timestamptz NOT NULL DEFAULT now(),
+    ADD COLUMN options jsonb NOT NULL DEFAULT '{}';
@@ -0,0 +1,6 @@
+CREATE TABLE utm_presets (
+    cookie varchar(255),
+    name varchar(255),
+    utm jsonb NOT NULL,
+    PRIMARY KEY (cookie, name)
+);
@@ -0,0 +1,2 @@
+ALTER TABLE links
+    ADD COLUMN original_url TEXT NOT NULL DEFAULT '';
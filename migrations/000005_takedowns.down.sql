@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS takedown_audit;
+DROP TABLE IF EXISTS takedowns;
@@ -0,0 +1,20 @@
+CREATE TABLE takedowns (
+    kind varchar(16),
+    target varchar(255),
+    reason text NOT NULL,
+    code integer NOT NULL,
+    actor varchar(255) NOT NULL DEFAULT '',
+    created_at timestamptz NOT NULL DEFAULT now(),
+    PRIMARY KEY (kind, target)
+);
+
+CREATE TABLE takedown_audit (
+    id bigserial PRIMARY KEY,
+    action varchar(16) NOT NULL,
+    kind varchar(16) NOT NULL,
+    target varchar(255) NOT NULL,
+    reason text NOT NULL,
+    code integer NOT NULL,
+    actor varchar(255) NOT NULL DEFAULT '',
+    created_at timestamptz NOT NULL DEFAULT now()
+);
@@ -0,0 +1,10 @@
+CREATE TABLE reports (
+    id bigserial PRIMARY KEY,
+    link_id varchar(255) NOT NULL,
+    reason text NOT NULL,
+    reporter_ip varchar(64) NOT NULL DEFAULT '',
+    status varchar(16) NOT NULL DEFAULT 'open',
+    created_at timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX reports_open_idx ON reports (link_id) WHERE status = 'open';
@@ -0,0 +1,5 @@
+CREATE TABLE link_clicks (
+    link_id varchar(255) PRIMARY KEY,
+    clicks bigint NOT NULL DEFAULT 0,
+    last_click timestamptz
+);
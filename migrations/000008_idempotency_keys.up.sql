@@ -0,0 +1,13 @@
+CREATE TABLE idempotency_keys (
+    cookie varchar(255),
+    idempotency_key varchar(255),
+    fingerprint varchar(64) NOT NULL,
+    status integer NOT NULL,
+    content_type text NOT NULL DEFAULT '',
+    location text NOT NULL DEFAULT '',
+    body bytea,
+    expires_at timestamptz NOT NULL,
+    PRIMARY KEY (cookie, idempotency_key)
+);
+
+CREATE INDEX idempotency_keys_expires_at_idx ON idempotency_keys (expires_at);
@@ -0,0 +1,22 @@
+CREATE TABLE jobs (
+    id bigserial PRIMARY KEY,
+    cookie varchar(255) NOT NULL,
+    status varchar(16) NOT NULL DEFAULT 'queued',
+    total integer NOT NULL,
+    processed integer NOT NULL DEFAULT 0,
+    failed integer NOT NULL DEFAULT 0,
+    error text NOT NULL DEFAULT '',
+    created_at timestamptz NOT NULL DEFAULT now(),
+    updated_at timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX jobs_unfinished_idx ON jobs (id) WHERE status IN ('queued', 'running');
+
+CREATE TABLE job_items (
+    job_id bigint NOT NULL REFERENCES jobs (id) ON DELETE CASCADE,
+    position integer NOT NULL,
+    request jsonb NOT NULL,
+    short_url text NOT NULL DEFAULT '',
+    error text NOT NULL DEFAULT '',
+    PRIMARY KEY (job_id, position)
+);
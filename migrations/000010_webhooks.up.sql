@@ -0,0 +1,28 @@
+CREATE TABLE webhooks (
+    id bigserial PRIMARY KEY,
+    cookie varchar(255) NOT NULL,
+    url text NOT NULL,
+    secret text NOT NULL,
+    events text NOT NULL,
+    created_at timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX webhooks_cookie_idx ON webhooks (cookie);
+
+CREATE TABLE webhook_deliveries (
+    id bigserial PRIMARY KEY,
+    webhook_id bigint NOT NULL,
+    cookie varchar(255) NOT NULL,
+    event varchar(32) NOT NULL,
+    payload text NOT NULL,
+    status varchar(16) NOT NULL DEFAULT 'pending',
+    attempts integer NOT NULL DEFAULT 0,
+    response_code integer NOT NULL DEFAULT 0,
+    last_error text NOT NULL DEFAULT '',
+    next_attempt timestamptz NOT NULL,
+    created_at timestamptz NOT NULL DEFAULT now(),
+    updated_at timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX webhook_deliveries_due_idx ON webhook_deliveries (next_attempt) WHERE status = 'pending';
+CREATE INDEX webhook_deliveries_cookie_idx ON webhook_deliveries (cookie, id);
@@ -0,0 +1,2 @@
+ALTER TABLE links
+    ALTER COLUMN url TYPE varchar(255);
@@ -27,6 +27,7 @@ const (
 	Shortener_BatchShort_FullMethodName    = "/url_shortener.Shortener/BatchShort"
 	Shortener_Delete_FullMethodName        = "/url_shortener.Shortener/Delete"
 	Shortener_GetHistory_FullMethodName    = "/url_shortener.Shortener/GetHistory"
+	Shortener_GetQRCode_FullMethodName     = "/url_shortener.Shortener/GetQRCode"
 )
 
 // ShortenerClient is the client API for Shortener service.
@@ -40,6 +41,7 @@ type ShortenerClient interface {
 	BatchShort(ctx context.Context, in *Batch, opts ...grpc.CallOption) (*Batch, error)
 	Delete(ctx context.Context, in *Link, opts ...grpc.CallOption) (*emptypb.Empty, error)
 	GetHistory(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*Batch, error)
+	GetQRCode(ctx context.Context, in *QRRequest, opts ...grpc.CallOption) (*QRCode, error)
 }
 
 type shortenerClient struct {
@@ -113,6 +115,15 @@ func (c *shortenerClient) GetHistory(ctx context.Context, in *emptypb.Empty, opt
 	return out, nil
 }
 
+func (c *shortenerClient) GetQRCode(ctx context.Context, in *QRRequest, opts ...grpc.CallOption) (*QRCode, error) {
+	out := new(QRCode)
+	err := c.cc.Invoke(ctx, Shortener_GetQRCode_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // ShortenerServer is the server API for Shortener service.
 // All implementations must embed UnimplementedShortenerServer
 // for forward compatibility
@@ -124,6 +135,7 @@ type ShortenerServer interface {
 	BatchShort(context.Context, *Batch) (*Batch, error)
 	Delete(context.Context, *Link) (*emptypb.Empty, error)
 	GetHistory(context.Context, *emptypb.Empty) (*Batch, error)
+	GetQRCode(context.Context, *QRRequest) (*QRCode, error)
 	mustEmbedUnimplementedShortenerServer()
 }
 
@@ -152,6 +164,9 @@ func (UnimplementedShortenerServer) Delete(context.Context, *Link) (*emptypb.Emp
 func (UnimplementedShortenerServer) GetHistory(context.Context, *emptypb.Empty) (*Batch, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method GetHistory not implemented")
 }
+func (UnimplementedShortenerServer) GetQRCode(context.Context, *QRRequest) (*QRCode, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetQRCode not implemented")
+}
 func (UnimplementedShortenerServer) mustEmbedUnimplementedShortenerServer() {}
 
 // UnsafeShortenerServer may be embedded to opt out of forward compatibility for this service.
@@ -291,6 +306,24 @@ func _Shortener_GetHistory_Handler(srv interface{}, ctx context.Context, dec fun
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Shortener_GetQRCode_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(QRRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ShortenerServer).GetQRCode(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Shortener_GetQRCode_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ShortenerServer).GetQRCode(ctx, req.(*QRRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // Shortener_ServiceDesc is the grpc.ServiceDesc for Shortener service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -326,6 +359,10 @@ var Shortener_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "GetHistory",
 			Handler:    _Shortener_GetHistory_Handler,
 		},
+		{
+			MethodName: "GetQRCode",
+			Handler:    _Shortener_GetQRCode_Handler,
+		},
 	},
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "proto/service.proto",